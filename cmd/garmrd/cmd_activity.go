@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"garmr/internal/fitx"
+	"garmr/internal/store"
+	"garmr/internal/webhook"
+)
+
+// garmrd activity list|show|delete|backfill
+func runActivity(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: garmrd activity list|show|delete|backfill [flags] [id...]")
+		return 2
+	}
+	sub := args[0]
+	fs := flag.NewFlagSet("garmrd activity "+sub, flag.ExitOnError)
+	sport := fs.String("sport", "", "list: only this sport")
+	limit := fs.Int("limit", 20, "list: number of activities")
+	offset := fs.Int("offset", 0, "list: skip this many activities")
+	username := fs.String("user", "", "owner of the activities (default: first admin; backfill: all users)")
+	c, fs, err := loadConfigFlags(fs, args[1:])
+	if err != nil {
+		return fail(err)
+	}
+	db, err := openStore(c)
+	if err != nil {
+		return fail(err)
+	}
+	defer db.Close()
+	var uid int64
+	if sub != "backfill" || *username != "" {
+		if uid, err = ownerID(db, *username); err != nil {
+			return fail(err)
+		}
+	}
+
+	var ids []int64
+	for _, a := range fs.Args() {
+		id, err := strconv.ParseInt(a, 10, 64)
+		if err != nil || id <= 0 {
+			return fail(fmt.Errorf("invalid activity id %q", a))
+		}
+		ids = append(ids, id)
+	}
+	if sub != "list" && sub != "backfill" && len(ids) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: garmrd activity %s [flags] <id>...\n", sub)
+		return 2
+	}
+
+	switch sub {
+	case "list":
+		acts, total, err := db.ListActivities(uid, *sport, *limit, *offset)
+		if err != nil {
+			return fail(err)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSTART (UTC)\tSPORT\tDISTANCE\tDURATION")
+		for _, a := range acts {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%.2f km\t%s\n", a.ID, a.StartTimeUTC.Format("2006-01-02 15:04"),
+				a.Sport, float64(a.DistanceM)/1000, clock(a.DurationS))
+		}
+		tw.Flush()
+		fmt.Printf("%d of %d activities\n", len(acts), total)
+	case "show":
+		for i, id := range ids {
+			a, err := db.GetActivity(uid, id)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fail(fmt.Errorf("activity %d not found", id))
+			}
+			if err != nil {
+				return fail(err)
+			}
+			if i > 0 {
+				fmt.Println()
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintf(tw, "ID\t%d\n", a.ID)
+			fmt.Fprintf(tw, "Start (UTC)\t%s\n", a.StartTimeUTC.Format("2006-01-02 15:04:05"))
+			fmt.Fprintf(tw, "Sport\t%s / %s\n", a.Sport, a.SubSport)
+			fmt.Fprintf(tw, "Distance\t%.2f km\n", float64(a.DistanceM)/1000)
+			fmt.Fprintf(tw, "Duration\t%s\n", clock(a.DurationS))
+			if a.ElapsedS.Valid {
+				fmt.Fprintf(tw, "Elapsed / moving\t%s / %s\n", clock(int(a.ElapsedS.Int64)), clock(int(a.MovingS.Int64)))
+			}
+			fmt.Fprintf(tw, "Heart rate\tavg %d / max %d bpm\n", a.AvgHR, a.MaxHR)
+			fmt.Fprintf(tw, "Elevation\t+%.0f / -%.0f m\n", a.AscentM, a.DescentM)
+			fmt.Fprintf(tw, "Calories\t%d kcal\n", a.Calories)
+			if a.AerobicTE.Valid {
+				fmt.Fprintf(tw, "Aerobic TE\t%.1f\n", a.AerobicTE.Float64)
+			}
+			if a.AnaerobicTE.Valid {
+				fmt.Fprintf(tw, "Anaerobic TE\t%.1f\n", a.AnaerobicTE.Float64)
+			}
+			fmt.Fprintf(tw, "Device\t%s %s\n", a.DeviceVendor, a.DeviceModel)
+			fmt.Fprintf(tw, "File\t%s\n", a.RawPath)
+			tw.Flush()
+			laps, err := db.ListLaps(id)
+			if err != nil {
+				return fail(err)
+			}
+			if len(laps) > 0 {
+				fmt.Println()
+				tw = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(tw, "LAP\tDISTANCE\tDURATION\tAVG HR")
+				for _, l := range laps {
+					fmt.Fprintf(tw, "%d\t%.2f km\t%s\t%d\n", l.Index+1, float64(l.DistM)/1000, clock(l.DurS), l.AvgHR)
+				}
+				tw.Flush()
+			}
+		}
+	case "delete":
+		hooks := webhook.New(db)
+		for _, id := range ids {
+			a, err := db.GetActivity(uid, id)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fail(fmt.Errorf("activity %d not found", id))
+			}
+			if err != nil {
+				return fail(err)
+			}
+			if err := db.DeleteActivity(uid, id); err != nil {
+				return fail(err)
+			}
+			hooks.Emit(webhook.EventActivityDeleted, webhook.NewActivityData(a, "cli", ""))
+			fmt.Printf("deleted activity %d\n", id)
+		}
+	case "backfill":
+		return backfillTimer(db, uid)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown activity command %q\n", sub)
+		return 2
+	}
+	return 0
+}
+
+// backfillTimer reads the elapsed and moving time and the timer events of
+// activities imported before they were stored from their FIT files, for
+// userID or, if it is 0, everyone.
+func backfillTimer(db *store.DB, userID int64) int {
+	files, err := db.ActivitiesWithoutTimer(userID)
+	if err != nil {
+		return fail(err)
+	}
+	failed := 0
+	for _, f := range files {
+		act, _, _, _, err := fitx.ParseFIT(f.RawPath)
+		if err == nil {
+			err = db.WithTx(func(tx *sql.Tx) error {
+				return db.InsertTimer(tx, f.ID, act)
+			})
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "activity %d: %v\n", f.ID, err)
+			failed++
+		}
+	}
+	fmt.Printf("%d activities: %d updated, %d failed\n", len(files), len(files)-failed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// clock renders seconds as h:mm:ss.
+func clock(sec int) string {
+	return fmt.Sprintf("%d:%02d:%02d", sec/3600, (sec%3600)/60, sec%60)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"garmr/internal/store"
+)
+
+// garmrd migrate up|down|status
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: garmrd migrate up|down|status [flags]")
+		return 2
+	}
+	sub := args[0]
+	c, _, err := loadConfig("garmrd migrate "+sub, args[1:])
+	if err != nil {
+		return fail(err)
+	}
+	db, err := store.Open(c.DBPath)
+	if err != nil {
+		return fail(err)
+	}
+	defer db.Close()
+
+	switch sub {
+	case "up":
+		err = store.Migrate(db)
+	case "down":
+		err = store.MigrateDown(db)
+	case "status":
+		err = store.MigrationStatus(db)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n", sub)
+		return 2
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+// garmrd vacuum
+func runVacuum(args []string) int {
+	c, _, err := loadConfig("garmrd vacuum", args)
+	if err != nil {
+		return fail(err)
+	}
+	db, err := openStore(c)
+	if err != nil {
+		return fail(err)
+	}
+	defer db.Close()
+
+	before, err := db.SizeBytes()
+	if err != nil {
+		return fail(err)
+	}
+	if err := db.Vacuum(); err != nil {
+		return fail(err)
+	}
+	after, err := db.SizeBytes()
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Printf("vacuumed %s: %.1f MB -> %.1f MB\n", c.DBPath, float64(before)/(1<<20), float64(after)/(1<<20))
+	return 0
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"garmr/internal/importer"
+	"garmr/internal/webhook"
+)
+
+// garmrd import <file|dir>...  (directories are searched recursively)
+func runImport(args []string) int {
+	flags := flag.NewFlagSet("garmrd import", flag.ExitOnError)
+	username := flags.String("user", "", "owner of the imported activities (default: first admin)")
+	c, flags, err := loadConfigFlags(flags, args)
+	if err != nil {
+		return fail(err)
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: garmrd import [flags] <file|dir>...")
+		return 2
+	}
+	var files []string
+	for _, p := range flags.Args() {
+		st, err := os.Stat(p)
+		if err != nil {
+			return fail(err)
+		}
+		if !st.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".fit") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	db, err := openStore(c)
+	if err != nil {
+		return fail(err)
+	}
+	defer db.Close()
+	// on a fresh install the admin from the config is created here as the
+	// server would, so importing can come before the first start
+	hasUsers, err := db.HasUsers()
+	if err != nil {
+		return fail(err)
+	}
+	if !hasUsers {
+		if err := db.EnsureInitialUser(c.AuthUser, c.AuthPass); err != nil {
+			return fail(err)
+		}
+	}
+	uid, err := ownerID(db, *username)
+	if err != nil {
+		return fail(err)
+	}
+
+	// webhook deliveries are queued here and sent by the running server
+	im := importer.New(c, db, webhook.New(db))
+	sum := im.ImportFiles(uid, files, "cli")
+	fmt.Printf("%d file(s): %d imported, %d wellness, %d duplicates, %d failed\n",
+		sum.FoundFiles, sum.Imported, sum.Wellness, sum.Duplicates, len(sum.Errors))
+	if len(sum.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"garmr/internal/store"
+)
+
+// garmrd user add|passwd|role|disable|enable|reset-2fa|list|delete
+func runUser(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: garmrd user add|passwd|role|disable|enable|reset-2fa|list|delete [flags] [username] [role]")
+		return 2
+	}
+	sub := args[0]
+	fs := flag.NewFlagSet("garmrd user "+sub, flag.ExitOnError)
+	passFile := fs.String("password-file", "", "read the password from this file instead of stdin")
+	role := fs.String("role", store.RoleAthlete, "add: role of the new user ("+strings.Join(store.Roles, ", ")+")")
+	c, fs, err := loadConfigFlags(fs, args[1:])
+	if err != nil {
+		return fail(err)
+	}
+	db, err := openStore(c)
+	if err != nil {
+		return fail(err)
+	}
+	defer db.Close()
+
+	username := strings.TrimSpace(fs.Arg(0))
+	if sub != "list" && username == "" {
+		fmt.Fprintf(os.Stderr, "usage: garmrd user %s [flags] <username>\n", sub)
+		return 2
+	}
+
+	switch sub {
+	case "list":
+		users, err := db.ListUsers()
+		if err != nil {
+			return fail(err)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tUSERNAME\tROLE\tSTATUS\tCREATED\tLAST LOGIN")
+		for _, u := range users {
+			last := "never"
+			if u.LastLoginAt.Valid {
+				last = u.LastLoginAt.String
+			}
+			status := "active"
+			if u.Disabled {
+				status = "disabled"
+			}
+			if u.TwoFactor {
+				status += ", 2fa"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", u.ID, u.Username, u.Role, status, u.CreatedAt, last)
+		}
+		tw.Flush()
+	case "add":
+		pass, err := readPassword(*passFile)
+		if err != nil {
+			return fail(err)
+		}
+		id, err := db.CreateUser(username, pass, *role)
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Printf("created %s %s (id %d)\n", *role, username, id)
+	case "passwd":
+		u, err := db.GetUserByUsername(username)
+		if err != nil {
+			return fail(fmt.Errorf("user %q not found", username))
+		}
+		pass, err := readPassword(*passFile)
+		if err != nil {
+			return fail(err)
+		}
+		if err := db.UpdatePassword(u.ID, pass); err != nil {
+			return fail(err)
+		}
+		// sign out everywhere so a recovered account starts clean
+		if err := db.DeleteSessionsForUserExcept(u.ID, ""); err != nil {
+			return fail(err)
+		}
+		fmt.Printf("password updated for %s; existing sessions signed out\n", username)
+	case "role":
+		u, err := db.GetUserByUsername(username)
+		if err != nil {
+			return fail(fmt.Errorf("user %q not found", username))
+		}
+		if err := db.SetUserRole(u.ID, fs.Arg(1)); err != nil {
+			return fail(err)
+		}
+		fmt.Printf("%s is now %s\n", username, fs.Arg(1))
+	case "disable", "enable":
+		u, err := db.GetUserByUsername(username)
+		if err != nil {
+			return fail(fmt.Errorf("user %q not found", username))
+		}
+		if err := db.SetUserDisabled(u.ID, sub == "disable"); err != nil {
+			return fail(err)
+		}
+		fmt.Printf("%sd user %s\n", sub, username)
+	case "reset-2fa":
+		u, err := db.GetUserByUsername(username)
+		if err != nil {
+			return fail(fmt.Errorf("user %q not found", username))
+		}
+		if err := db.DisableTOTP(u.ID); err != nil {
+			return fail(err)
+		}
+		fmt.Printf("two-factor sign-in turned off for %s\n", username)
+	case "delete":
+		u, err := db.GetUserByUsername(username)
+		if err != nil {
+			return fail(fmt.Errorf("user %q not found", username))
+		}
+		if err := db.DeleteUser(u.ID); err != nil {
+			return fail(err)
+		}
+		fmt.Printf("deleted user %s\n", username)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown user command %q\n", sub)
+		return 2
+	}
+	return 0
+}
+
+// readPassword reads a password from path, or the first line of stdin.
+// Typed input is echoed; pipe it in (or use -password-file) on shared terminals.
+func readPassword(path string) (string, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if st, err := os.Stdin.Stat(); err == nil && st.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "Password: ")
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		if err != nil {
+			return "", errors.New("no password given on stdin")
+		}
+		return "", errors.New("empty password")
+	}
+	return line, nil
+}
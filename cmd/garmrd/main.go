@@ -2,29 +2,169 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"net/http"
+	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"garmr/internal/cfg"
 	"garmr/internal/importer"
 	"garmr/internal/store"
+	"garmr/internal/tlscert"
 	"garmr/internal/web"
+	"garmr/internal/webhook"
 )
 
+const usage = `usage: garmrd [flags]                      start the server
+       garmrd config check [flags]
+       garmrd user add|passwd|role|disable|enable|list|delete [flags] [username] [role]
+       garmrd import [flags] <file|dir>...
+       garmrd activity list|show|delete|backfill [flags] [id...]
+       garmrd migrate up|down|status [flags]
+       garmrd vacuum [flags]
+
+Every command accepts -config and the per-setting flags (see -h).`
+
 func main() {
-	configPath := flag.String("config", "", "path to config")
-	flag.Parse()
+	args := os.Args[1:]
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		serve(args)
+		return
+	}
+	var code int
+	switch args[0] {
+	case "serve":
+		serve(args[1:])
+	case "config":
+		code = runConfig(args[1:])
+	case "user":
+		code = runUser(args[1:])
+	case "import":
+		code = runImport(args[1:])
+	case "activity":
+		code = runActivity(args[1:])
+	case "migrate":
+		code = runMigrate(args[1:])
+	case "vacuum":
+		code = runVacuum(args[1:])
+	case "help":
+		fmt.Println(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", args[0], usage)
+		code = 2
+	}
+	os.Exit(code)
+}
+
+// loadConfig parses the shared flags (-config plus one flag per setting)
+// and layers defaults, config file, GARMR_* env vars and flags.
+func loadConfig(name string, args []string) (cfg.Config, *flag.FlagSet, error) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	return loadConfigFlags(fs, args)
+}
+
+// loadConfigFlags is loadConfig for commands that register extra flags on
+// fs before parsing.
+func loadConfigFlags(fs *flag.FlagSet, args []string) (cfg.Config, *flag.FlagSet, error) {
+	configPath := fs.String("config", "", "path to config (default ./garmr.json or $"+cfg.EnvConfig+")")
+	applyFlags := cfg.BindFlags(fs)
+	_ = parseInterspersed(fs, args)
 
 	// Auto-detect config file if not specified
-	actualConfigPath := *configPath
-	if actualConfigPath == "" {
-		actualConfigPath = "./garmr.json"
+	path, required := *configPath, true
+	if path == "" {
+		path = os.Getenv(cfg.EnvConfig)
+	}
+	if path == "" {
+		path, required = "./garmr.json", false
+	}
+
+	c, err := cfg.Load(path, required)
+	if err != nil {
+		return c, fs, err
+	}
+	if err := applyFlags(&c); err != nil {
+		return c, fs, err
+	}
+	return c, fs, c.Validate()
+}
+
+// parseInterspersed is fs.Parse, but it also takes flags after positional
+// arguments, which the flag package would leave in fs.Args(): `garmrd user
+// add alice -role admin` must not create an athlete. "--" still ends the
+// flags. Afterwards fs.Args() holds the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) error {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			pos = append(pos, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		pos, args = append(pos, rest[0]), rest[1:]
+	}
+	return fs.Parse(append([]string{"--"}, pos...))
+}
+
+// openStore opens and migrates the database for an admin command.
+func openStore(c cfg.Config) (*store.DB, error) {
+	db, err := store.Open(c.DBPath)
+	if err != nil {
+		return nil, fmt.Errorf("db open: %w", err)
+	}
+	if err := store.Migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
 	}
+	return db, nil
+}
 
-	c := cfg.Load(actualConfigPath)
+// ownerID resolves the -user flag of data commands; empty means the
+// primary admin, who also owns USB imports.
+func ownerID(db *store.DB, username string) (int64, error) {
+	if username == "" {
+		id, err := db.PrimaryUserID()
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errors.New("no active admin; pass -user")
+		}
+		return id, err
+	}
+	u, err := db.GetUserByUsername(username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("user %q not found", username)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return u.ID, nil
+}
+
+// fail prints err and returns the exit code for it.
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	return 1
+}
+
+func serve(args []string) {
+	c, _, err := loadConfig("garmrd", args)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
 
 	db, err := store.Open(c.DBPath)
 	if err != nil {
@@ -39,22 +179,56 @@ func main() {
 		log.Fatalf("auth bootstrap: %v", err)
 	}
 
-	im := importer.New(c, db)
+	hooks := webhook.New(db)
+	im := importer.New(c, db, hooks)
 
 	// Context that cancels on SIGINT/SIGTERM
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	go hooks.Run(ctx)
+
 	// Start background polling only if enabled
 	if c.PollMs > 0 {
 		go im.Run(ctx)
 	}
 
 	// Start HTTP server
-	srv := web.New(c, db, im)
+	srv := web.New(c, db, im, hooks)
+	var redirect *http.Server
+	if c.TLS() {
+		certFile, keyFile := c.TLSCert, c.TLSKey
+		if c.TLSSelfSigned {
+			certFile, keyFile, err = tlscert.SelfSigned(filepath.Join(filepath.Dir(c.DBPath), "tls"), c.TLSHosts)
+			if err != nil {
+				log.Fatalf("tls: self-signed certificate: %v", err)
+			}
+		}
+		certs, err := tlscert.NewReloader(certFile, keyFile)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate}
+		if c.HTTPRedirectAddr != "" {
+			redirect = &http.Server{Addr: c.HTTPRedirectAddr, Handler: web.RedirectToHTTPS(c.HTTPAddr), ReadHeaderTimeout: 10 * time.Second}
+			go func() {
+				log.Printf("http: redirecting %s to https", c.HTTPRedirectAddr)
+				if err := redirect.ListenAndServe(); err != nil && err.Error() != "http: Server closed" {
+					log.Printf("http redirect: %v", err)
+				}
+			}()
+		}
+	}
 	go func() {
-		log.Printf("http: listening on %s", c.HTTPAddr)
-		if err := srv.ListenAndServe(); err != nil && err.Error() != "http: Server closed" {
+		var err error
+		if srv.TLSConfig != nil {
+			log.Printf("https: listening on %s", c.HTTPAddr)
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("http: listening on %s", c.HTTPAddr)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err.Error() != "http: Server closed" {
 			log.Printf("http: %v", err)
 		}
 	}()
@@ -69,5 +243,26 @@ func main() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Printf("http shutdown: %v", err)
 	}
+	if redirect != nil {
+		_ = redirect.Shutdown(shutdownCtx)
+	}
 	log.Printf("bye")
 }
+
+// garmrd config check [flags]
+func runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "usage: garmrd config check [-config path] [flags]")
+		return 2
+	}
+	c, _, err := loadConfig("garmrd config check", args[1:])
+	if err != nil {
+		return fail(err)
+	}
+	out, err := c.Redacted()
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Println(string(out))
+	return 0
+}
@@ -0,0 +1,141 @@
+package analysis
+
+import (
+	"math"
+
+	"garmr/internal/fitx"
+)
+
+const (
+	// climbDropM is how far the smoothed elevation has to fall below the
+	// top reached so far for a climb to end there.
+	climbDropM = 10.0
+	// climbTrimM trims flat stretches at either end of a climb: it starts
+	// where it last was this close to its foot and ends where it first came
+	// this close to its top.
+	climbTrimM = 2.0
+	// A climb has to gain climbMinGainM at an average of climbMinGrade.
+	climbMinGainM = 15.0
+	climbMinGrade = 0.03
+)
+
+// Climb is a stretch of an activity that goes uphill.
+type Climb struct {
+	Index      int
+	StartT     int // seconds from the activity's start
+	EndT       int
+	StartDistM float64
+	LengthM    float64
+	GainM      float64
+	Grade      float64 // average, e.g. 0.06 for 6%
+	MaxGrade   float64
+	TimeS      float64 // timer time, pauses left out
+	Category   string  // "4" to "1" or "HC"; empty if too small for one
+}
+
+// VAM is the climb's rate of ascent in metres per hour.
+func (c Climb) VAM() float64 {
+	if c.TimeS <= 0 {
+		return 0
+	}
+	return c.GainM / c.TimeS * 3600
+}
+
+// Score is the climb's length in metres times its grade in percent, which
+// its category is based on.
+func (c Climb) Score() float64 {
+	return c.LengthM * c.Grade * 100
+}
+
+// climbCategories are the least scores of the categories, hardest first.
+var climbCategories = []struct {
+	name  string
+	score float64
+}{
+	{"HC", 80000},
+	{"1", 64000},
+	{"2", 32000},
+	{"3", 16000},
+	{"4", 8000},
+}
+
+// ClimbCategory returns the category of a climb score, or "" below
+// category 4.
+func ClimbCategory(score float64) string {
+	for _, c := range climbCategories {
+		if score >= c.score {
+			return c.name
+		}
+	}
+	return ""
+}
+
+// Climbs finds the climbs of an activity on its smoothed elevation. It
+// returns nil if the points have no distance or elevation.
+func Climbs(pts []Point, pauses []fitx.Pause) []Climb {
+	prof := NewProfile(pts)
+	if prof.Grade == nil {
+		return nil
+	}
+	elev := prof.Elev
+	var res []Climb
+	foot, top := 0, 0
+	for i := 1; i < len(elev); i++ {
+		switch {
+		case elev[i] < elev[foot]:
+			foot, top = i, i
+		case elev[i] > elev[top]:
+			top = i
+		case elev[top]-elev[i] >= climbDropM:
+			if c, ok := climb(pts, pauses, prof, foot, top); ok {
+				c.Index = len(res)
+				res = append(res, c)
+			}
+			foot, top = i, i
+		}
+	}
+	if c, ok := climb(pts, pauses, prof, foot, top); ok {
+		c.Index = len(res)
+		res = append(res, c)
+	}
+	return res
+}
+
+// climb measures the climb from the points foot to top, trimmed of flat
+// ends, and reports whether it is one.
+func climb(pts []Point, pauses []fitx.Pause, prof Profile, foot, top int) (Climb, bool) {
+	elev, dist := prof.Elev, prof.Dist
+	low, high := elev[foot], elev[top]
+	for i := foot; i < top; i++ {
+		if elev[i] <= low+climbTrimM {
+			foot = i
+		}
+	}
+	for i := top; i > foot; i-- {
+		if elev[i] >= high-climbTrimM {
+			top = i
+		}
+	}
+	c := Climb{
+		StartT:     pts[foot].T,
+		EndT:       pts[top].T,
+		StartDistM: dist[foot],
+		LengthM:    dist[top] - dist[foot],
+		GainM:      elev[top] - elev[foot],
+	}
+	if c.LengthM <= 0 || c.GainM < climbMinGainM {
+		return c, false
+	}
+	c.Grade = c.GainM / c.LengthM
+	if c.Grade < climbMinGrade {
+		return c, false
+	}
+	for i := foot + 1; i <= top; i++ {
+		c.MaxGrade = math.Max(c.MaxGrade, prof.Grade[i])
+		if dt := pts[i].T - pts[i-1].T; dt > 0 && !fitx.PausedBetween(pauses, pts[i-1].T, pts[i].T) {
+			c.TimeS += float64(dt)
+		}
+	}
+	c.Category = ClimbCategory(c.Score())
+	return c, true
+}
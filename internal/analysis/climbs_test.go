@@ -0,0 +1,176 @@
+package analysis
+
+import (
+	"testing"
+
+	"garmr/internal/fitx"
+)
+
+// hilly returns points 10 m and 5 s apart over lengthM metres, at the
+// elevation elev gives for each distance.
+func hilly(lengthM float64, elev func(d float64) float64) []Point {
+	var pts []Point
+	for i := 0; float64(i)*10 <= lengthM; i++ {
+		d := float64(i) * 10
+		e := elev(d)
+		pts = append(pts, Point{T: 5 * i, DistM: &d, ElevM: &e})
+	}
+	return pts
+}
+
+// ramps returns an elevation that is flat but for straight stretches
+// between the given (distance, elevation) corners.
+func ramps(corners ...[2]float64) func(float64) float64 {
+	return func(d float64) float64 {
+		if d <= corners[0][0] {
+			return corners[0][1]
+		}
+		for i := 1; i < len(corners); i++ {
+			a, b := corners[i-1], corners[i]
+			if d <= b[0] {
+				return a[1] + (d-a[0])/(b[0]-a[0])*(b[1]-a[1])
+			}
+		}
+		return corners[len(corners)-1][1]
+	}
+}
+
+func TestClimbs(t *testing.T) {
+	tests := []struct {
+		name  string
+		elev  func(float64) float64
+		gains []float64 // of the climbs found, roughly
+	}{
+		{name: "flat", elev: ramps([2]float64{0, 100})},
+		{
+			name:  "one climb",
+			elev:  ramps([2]float64{500, 100}, [2]float64{1500, 150}),
+			gains: []float64{50},
+		},
+		{
+			name: "too little gain",
+			elev: ramps([2]float64{500, 100}, [2]float64{700, 110}),
+		},
+		{
+			name: "too shallow",
+			elev: ramps([2]float64{500, 100}, [2]float64{1500, 120}), // 2%
+		},
+		{
+			name:  "just steep enough",
+			elev:  ramps([2]float64{500, 100}, [2]float64{1000, 120}), // 4%
+			gains: []float64{20},
+		},
+		{
+			name: "a small dip doesn't end a climb",
+			elev: ramps([2]float64{500, 100}, [2]float64{1000, 130}, [2]float64{1200, 125},
+				[2]float64{1700, 155}),
+			gains: []float64{55},
+		},
+		{
+			name: "a descent of more than 10 m does",
+			elev: ramps([2]float64{300, 100}, [2]float64{800, 130}, [2]float64{1000, 130},
+				[2]float64{1400, 110}, [2]float64{1600, 110}, [2]float64{2100, 140}),
+			gains: []float64{30, 30},
+		},
+		{
+			name: "descents aren't climbs",
+			elev: ramps([2]float64{500, 150}, [2]float64{1500, 100}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Climbs(hilly(2500, tt.elev), nil)
+			if len(got) != len(tt.gains) {
+				t.Fatalf("got %d climbs %+v, want %d", len(got), got, len(tt.gains))
+			}
+			for i, c := range got {
+				// the smoothed ends are trimmed by up to climbTrimM each
+				if c.Index != i || c.GainM > tt.gains[i] || c.GainM < tt.gains[i]-2*climbTrimM {
+					t.Errorf("climb %d = %+v, want gain about %v", i, c, tt.gains[i])
+				}
+				if c.Grade < climbMinGrade || c.StartT >= c.EndT || c.TimeS != float64(c.EndT-c.StartT) {
+					t.Errorf("climb %d = %+v", i, c)
+				}
+			}
+		})
+	}
+}
+
+func TestClimbTrimsFlatEnds(t *testing.T) {
+	got := Climbs(hilly(2500, ramps([2]float64{500, 100}, [2]float64{1500, 150})), nil)
+	if len(got) != 1 {
+		t.Fatalf("got %d climbs", len(got))
+	}
+	c := got[0]
+	// the ramp is 500 to 1500 m; smoothing rounds its corners over 50 m
+	if c.StartDistM < 450 || c.StartDistM > 550 || c.LengthM < 900 || c.LengthM > 1000 {
+		t.Fatalf("climb from %v m, %v m long; want the ramp from 500 m, about 1000 m", c.StartDistM, c.LengthM)
+	}
+	if c.MaxGrade < 0.049 || c.MaxGrade > 0.051 {
+		t.Fatalf("MaxGrade = %v, want 0.05", c.MaxGrade)
+	}
+}
+
+func TestClimbPausesLeftOut(t *testing.T) {
+	pts := hilly(2500, ramps([2]float64{500, 100}, [2]float64{1500, 150}))
+	// a 10 minute stop halfway up
+	for i := range pts {
+		if *pts[i].DistM > 1000 {
+			pts[i].T += 600
+		}
+	}
+	pauses := []fitx.Pause{{Stop: 500, Start: 1100}}
+	got := Climbs(pts, pauses)
+	if len(got) != 1 {
+		t.Fatalf("got %d climbs", len(got))
+	}
+	if c := got[0]; c.TimeS != float64(c.EndT-c.StartT-605) {
+		t.Fatalf("TimeS = %v over %d..%d, want the pause and the stretch it ends left out", c.TimeS, c.StartT, c.EndT)
+	}
+}
+
+func TestClimbsNoElevation(t *testing.T) {
+	if got := Climbs(steady(100, 10), nil); got != nil {
+		t.Fatalf("Climbs = %+v, want nil", got)
+	}
+}
+
+func TestClimbCategory(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  string
+	}{
+		{0, ""},
+		{7999, ""},
+		{8000, "4"},
+		{16000, "3"},
+		{31999, "3"},
+		{32000, "2"},
+		{64000, "1"},
+		{79999, "1"},
+		{80000, "HC"},
+	}
+	for _, tt := range tests {
+		if got := ClimbCategory(tt.score); got != tt.want {
+			t.Errorf("ClimbCategory(%v) = %q, want %q", tt.score, got, tt.want)
+		}
+	}
+	// 5 km at 4% scores 20000
+	c := Climb{LengthM: 5000, Grade: 0.04, GainM: 200, TimeS: 1200}
+	if c.Score() != 20000 || c.VAM() != 600 {
+		t.Fatalf("Score %v VAM %v", c.Score(), c.VAM())
+	}
+}
+
+func TestFlatFactor(t *testing.T) {
+	if f := FlatFactor(0); !near(f, 1) {
+		t.Errorf("FlatFactor(0) = %v", f)
+	}
+	if FlatFactor(0.1) <= 1 || FlatFactor(-0.05) >= 1 {
+		t.Errorf("FlatFactor(0.1) = %v, FlatFactor(-0.05) = %v", FlatFactor(0.1), FlatFactor(-0.05))
+	}
+	// clamped beyond the measured ±45%
+	if !near(FlatFactor(0.9), FlatFactor(0.45)) || !near(FlatFactor(-0.9), FlatFactor(-0.45)) {
+		t.Error("FlatFactor isn't clamped to ±45%")
+	}
+}
@@ -0,0 +1,115 @@
+package analysis
+
+import "math"
+
+const (
+	// smoothHalfM is half the width of the distance window elevation is
+	// averaged over; smoothHalfS is used instead without distance.
+	smoothHalfM = 50.0
+	smoothHalfS = 15.0
+	// gradeHalfM is half the distance grades are measured over.
+	gradeHalfM = 25.0
+	// maxGrade caps grades, mostly against barometer jumps at a standstill.
+	maxGrade = 0.5
+)
+
+// Profile is an activity's distance and smoothed elevation at each point,
+// and the grade there.
+type Profile struct {
+	Dist  []float64 // nil without distance
+	Elev  []float64 // smoothed; nil without elevation
+	Grade []float64 // nil without distance or elevation
+}
+
+// NewProfile builds the profile of pts.
+func NewProfile(pts []Point) Profile {
+	p := Profile{Dist: Distances(pts)}
+	p.Elev = smoothElevation(pts, p.Dist)
+	if p.Dist != nil && p.Elev != nil {
+		p.Grade = grades(p.Dist, p.Elev)
+	}
+	return p
+}
+
+// smoothElevation returns the recorded elevation with gaps filled in and
+// averaged over a window of distance, or of time if there is none. It is
+// nil if no point has an elevation.
+func smoothElevation(pts []Point, dist []float64) []float64 {
+	raw := fillElevation(pts)
+	if raw == nil {
+		return nil
+	}
+	axis, half := dist, smoothHalfM
+	if axis == nil {
+		axis, half = make([]float64, len(pts)), smoothHalfS
+		for i, p := range pts {
+			axis[i] = float64(p.T)
+		}
+	}
+	res := make([]float64, len(raw))
+	lo, hi, sum := 0, 0, 0.0 // the window is raw[lo:hi]
+	for i := range raw {
+		for hi < len(raw) && axis[hi] <= axis[i]+half {
+			sum += raw[hi]
+			hi++
+		}
+		for axis[lo] < axis[i]-half {
+			sum -= raw[lo]
+			lo++
+		}
+		res[i] = sum / float64(hi-lo)
+	}
+	return res
+}
+
+// fillElevation returns the elevation at each point, interpolating
+// between the points that have one and holding it before the first and
+// after the last.
+func fillElevation(pts []Point) []float64 {
+	res := make([]float64, len(pts))
+	last := -1
+	for i, p := range pts {
+		if p.ElevM == nil {
+			continue
+		}
+		res[i] = *p.ElevM
+		switch {
+		case last < 0:
+			for j := 0; j < i; j++ {
+				res[j] = res[i]
+			}
+		case i-last > 1:
+			for j := last + 1; j < i; j++ {
+				f := float64(j-last) / float64(i-last)
+				res[j] = res[last] + f*(res[i]-res[last])
+			}
+		}
+		last = i
+	}
+	if last < 0 {
+		return nil
+	}
+	for j := last + 1; j < len(res); j++ {
+		res[j] = res[last]
+	}
+	return res
+}
+
+// grades returns the grade at each point, over gradeHalfM either side of
+// it; 0 where less than half that distance was covered.
+func grades(dist, elev []float64) []float64 {
+	res := make([]float64, len(dist))
+	lo, hi := 0, 0
+	for i := range dist {
+		for hi+1 < len(dist) && dist[hi+1] <= dist[i]+gradeHalfM {
+			hi++
+		}
+		for dist[lo] < dist[i]-gradeHalfM {
+			lo++
+		}
+		if d := dist[hi] - dist[lo]; d >= gradeHalfM {
+			res[i] = math.Max(-maxGrade, math.Min(maxGrade, (elev[hi]-elev[lo])/d))
+		}
+	}
+	return res
+}
@@ -0,0 +1,233 @@
+// Package analysis derives views of an activity from its records, such as
+// distance splits and climbs, that aren't stored.
+package analysis
+
+import (
+	"math"
+
+	"garmr/internal/fitx"
+)
+
+// Split lengths in metres.
+const (
+	Kilometre = 1000.0
+	Mile      = 1609.344
+)
+
+// Point is one record of an activity, as far as the analysis needs it.
+type Point struct {
+	T        int      // seconds from the start
+	DistM    *float64 // distance recorded by the device
+	Lat, Lon *float64
+	ElevM    *float64
+	HR       *float64
+	Cad      *float64 // as recorded: rpm, or steps per minute per foot
+}
+
+// Split is one stretch of an activity of the split length; the last one
+// may be shorter.
+type Split struct {
+	Index  int
+	DistM  float64
+	TimeS  float64 // timer time, pauses left out
+	GainM  float64
+	LossM  float64
+	Grade  float64 // net elevation change over distance, e.g. 0.03 for 3%
+	FlatM  float64 // distance on the flat that takes the same effort
+	AvgHR  float64 // 0 without heart rate
+	AvgCad float64 // 0 without cadence
+	Best   bool    // fastest of the full splits
+	Worst  bool    // slowest of the full splits
+	Full   bool    // as long as the split length
+}
+
+// SpeedMPS is the split's average speed while the timer ran.
+func (s Split) SpeedMPS() float64 {
+	if s.TimeS <= 0 {
+		return 0
+	}
+	return s.DistM / s.TimeS
+}
+
+// GAPSpeedMPS is the grade-adjusted speed: the speed on the flat that takes
+// the same effort as the split's speed over its ups and downs.
+func (s Split) GAPSpeedMPS() float64 {
+	if s.TimeS <= 0 {
+		return 0
+	}
+	return s.FlatM / s.TimeS
+}
+
+// CostOfRunning is the energy cost of running in J/(kg·m) on a grade, after
+// Minetti et al. (2002). Grades are clamped to the ±45% it was measured on.
+func CostOfRunning(grade float64) float64 {
+	g := math.Max(-0.45, math.Min(0.45, grade))
+	return ((((155.4*g-30.4)*g-43.3)*g+46.3)*g+19.5)*g + 3.6
+}
+
+// FlatFactor is how much farther on the flat the effort of a metre on a
+// grade takes a runner.
+func FlatFactor(grade float64) float64 {
+	return CostOfRunning(grade) / CostOfRunning(0)
+}
+
+// Distances returns the distance covered at each point: the recorded
+// distance where the device wrote one, and otherwise the GPS track. It is
+// nil when the points have neither.
+func Distances(pts []Point) []float64 {
+	recorded := false
+	for _, p := range pts {
+		if p.DistM != nil {
+			recorded = true
+			break
+		}
+	}
+	res := make([]float64, len(pts))
+	var d float64
+	var lastLat, lastLon float64
+	hasLast := false
+	for i, p := range pts {
+		switch {
+		case recorded:
+			if p.DistM != nil && *p.DistM > d {
+				d = *p.DistM
+			}
+		case p.Lat != nil && p.Lon != nil && *p.Lat != 0 && *p.Lon != 0:
+			if hasLast {
+				d += haversineM(lastLat, lastLon, *p.Lat, *p.Lon)
+			}
+			lastLat, lastLon, hasLast = *p.Lat, *p.Lon, true
+		}
+		res[i] = d
+	}
+	if !recorded && !hasLast {
+		return nil
+	}
+	return res
+}
+
+// splitAcc adds up the records of the split being built.
+type splitAcc struct {
+	time, gain, loss, net float64
+	flat                  float64
+	hrSum, hrT            float64
+	cadSum, cadT          float64
+}
+
+// add adds the part frac of the stretch ending at b, which took dt seconds,
+// covered dd metres on grade and climbed de metres.
+func (s *splitAcc) add(frac, dt, dd, grade, de float64, b Point) {
+	t := frac * dt
+	s.time += t
+	s.flat += frac * dd * FlatFactor(grade)
+	switch e := frac * de; {
+	case e > 0:
+		s.gain += e
+	case e < 0:
+		s.loss -= e
+	}
+	s.net += frac * de
+	if b.HR != nil {
+		s.hrSum += *b.HR * t
+		s.hrT += t
+	}
+	if b.Cad != nil {
+		s.cadSum += *b.Cad * t
+		s.cadT += t
+	}
+}
+
+func (s *splitAcc) split(index int, dist float64) Split {
+	sp := Split{Index: index, DistM: dist, TimeS: s.time, GainM: s.gain, LossM: s.loss, FlatM: s.flat}
+	if dist > 0 {
+		sp.Grade = s.net / dist
+	}
+	if s.hrT > 0 {
+		sp.AvgHR = s.hrSum / s.hrT
+	}
+	if s.cadT > 0 {
+		sp.AvgCad = s.cadSum / s.cadT
+	}
+	return sp
+}
+
+// minSplitM is how long the last, shorter split has to be to be kept.
+const minSplitM = 10
+
+// Splits cuts an activity into splits of lengthM metres, leaving the time
+// of pauses out. Elevation and grades come from the smoothed profile. It
+// returns nil if the points have no distance.
+func Splits(pts []Point, pauses []fitx.Pause, lengthM float64) []Split {
+	prof := NewProfile(pts)
+	dist := prof.Dist
+	if dist == nil || lengthM <= 0 {
+		return nil
+	}
+	var res []Split
+	var cur splitAcc
+	start := 0.0 // distance where the current split began
+	for i := 1; i < len(pts); i++ {
+		a, b := pts[i-1], pts[i]
+		d0, d1 := dist[i-1], dist[i]
+		dt := float64(b.T - a.T)
+		if dt < 0 || fitx.PausedBetween(pauses, a.T, b.T) {
+			dt = 0
+		}
+		var de, grade float64
+		if prof.Grade != nil {
+			de, grade = prof.Elev[i]-prof.Elev[i-1], prof.Grade[i]
+		}
+		// cut the stretch where it crosses split boundaries
+		from := 0.0
+		for d1 > d0 && d1 >= start+lengthM {
+			f := (start + lengthM - d0) / (d1 - d0)
+			cur.add(f-from, dt, d1-d0, grade, de, b)
+			sp := cur.split(len(res), lengthM)
+			sp.Full = true
+			res = append(res, sp)
+			cur = splitAcc{}
+			start += lengthM
+			from = f
+		}
+		cur.add(1-from, dt, d1-d0, grade, de, b)
+	}
+	if rest := dist[len(dist)-1] - start; rest >= minSplitM {
+		res = append(res, cur.split(len(res), rest))
+	}
+	markBestWorst(res)
+	return res
+}
+
+// markBestWorst flags the fastest and slowest full split, if there are at
+// least two.
+func markBestWorst(splits []Split) {
+	best, worst := -1, -1
+	n := 0
+	for i, s := range splits {
+		if !s.Full || s.TimeS <= 0 {
+			continue
+		}
+		n++
+		if best < 0 || s.TimeS < splits[best].TimeS {
+			best = i
+		}
+		if worst < 0 || s.TimeS > splits[worst].TimeS {
+			worst = i
+		}
+	}
+	if n >= 2 {
+		splits[best].Best = true
+		splits[worst].Worst = true
+	}
+}
+
+// haversineM is the great-circle distance between two points in metres.
+func haversineM(lat1, lon1, lat2, lon2 float64) float64 {
+	const r = 6371000.0
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * r * math.Asin(math.Sqrt(h))
+}
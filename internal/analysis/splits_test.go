@@ -0,0 +1,144 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+
+	"garmr/internal/fitx"
+)
+
+// run returns points with recorded distances dist at times ts.
+func run(ts []int, dist []float64) []Point {
+	pts := make([]Point, len(ts))
+	for i := range ts {
+		d := dist[i]
+		pts[i] = Point{T: ts[i], DistM: &d}
+	}
+	return pts
+}
+
+// steady returns a run of n+1 points, 10 s and stepM metres apart.
+func steady(n int, stepM float64) []Point {
+	ts, dist := make([]int, n+1), make([]float64, n+1)
+	for i := range ts {
+		ts[i], dist[i] = 10*i, float64(i)*stepM
+	}
+	return run(ts, dist)
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-6 }
+
+func TestSplits(t *testing.T) {
+	type want struct {
+		dist, time float64
+		full       bool
+	}
+	tests := []struct {
+		name   string
+		pts    []Point
+		pauses []fitx.Pause
+		length float64
+		want   []want
+	}{
+		{
+			name:   "steady 2.5 km",
+			pts:    steady(62, 40.32258064516129), // 2500 m
+			length: Kilometre,
+			want:   []want{{1000, 248, true}, {1000, 248, true}, {500, 124, false}},
+		},
+		{
+			name:   "boundary inside a stretch",
+			pts:    run([]int{0, 90, 110}, []float64{0, 900, 1100}),
+			length: Kilometre,
+			want:   []want{{1000, 100, true}, {100, 10, false}},
+		},
+		{
+			name:   "ends exactly on a boundary",
+			pts:    run([]int{0, 100, 200}, []float64{0, 500, 1000}),
+			length: Kilometre,
+			want:   []want{{1000, 200, true}},
+		},
+		{
+			name:   "a rest under 10 m is dropped",
+			pts:    run([]int{0, 200, 202}, []float64{0, 1000, 1009}),
+			length: Kilometre,
+			want:   []want{{1000, 200, true}},
+		},
+		{
+			name:   "a rest of 10 m is kept",
+			pts:    run([]int{0, 200, 202}, []float64{0, 1000, 1010}),
+			length: Kilometre,
+			want:   []want{{1000, 200, true}, {10, 2, false}},
+		},
+		{
+			name:   "one stretch across several boundaries",
+			pts:    run([]int{0, 250}, []float64{0, 2500}),
+			length: Kilometre,
+			want:   []want{{1000, 100, true}, {1000, 100, true}, {500, 50, false}},
+		},
+		{
+			name:   "pauses are left out",
+			pts:    run([]int{0, 100, 400, 500}, []float64{0, 500, 500, 1000}),
+			pauses: []fitx.Pause{{Stop: 100, Start: 400}},
+			length: Kilometre,
+			want:   []want{{1000, 200, true}},
+		},
+		{
+			name:   "miles",
+			pts:    run([]int{0, 1000}, []float64{0, 2 * Mile}),
+			length: Mile,
+			want:   []want{{Mile, 500, true}, {Mile, 500, true}},
+		},
+		{
+			name:   "recorded distance going backwards is held",
+			pts:    run([]int{0, 100, 110, 200}, []float64{0, 600, 590, 1000}),
+			length: Kilometre,
+			want:   []want{{1000, 200, true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Splits(tt.pts, tt.pauses, tt.length)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d splits %+v, want %d", len(got), got, len(tt.want))
+			}
+			for i, w := range tt.want {
+				s := got[i]
+				if s.Index != i || !near(s.DistM, w.dist) || !near(s.TimeS, w.time) || s.Full != w.full {
+					t.Errorf("split %d = %+v, want dist %v time %v full %v", i, s, w.dist, w.time, w.full)
+				}
+				if !near(s.FlatM, s.DistM) {
+					t.Errorf("split %d: FlatM %v on the flat, want %v", i, s.FlatM, s.DistM)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitsNoDistance(t *testing.T) {
+	if got := Splits([]Point{{T: 0}, {T: 10}}, nil, Kilometre); got != nil {
+		t.Fatalf("Splits = %+v, want nil", got)
+	}
+	if got := Splits(steady(10, 100), nil, 0); got != nil {
+		t.Fatalf("Splits with length 0 = %+v, want nil", got)
+	}
+}
+
+func TestSplitsBestWorst(t *testing.T) {
+	// 1 km in 300 s, 250 s and 280 s, then a short one in 10 s
+	pts := run([]int{0, 300, 550, 830, 840}, []float64{0, 1000, 2000, 3000, 3050})
+	got := Splits(pts, nil, Kilometre)
+	if len(got) != 4 {
+		t.Fatalf("got %d splits", len(got))
+	}
+	for i, s := range got {
+		if s.Best != (i == 1) || s.Worst != (i == 0) {
+			t.Errorf("split %d: best %v worst %v", i, s.Best, s.Worst)
+		}
+	}
+	// a single full split is neither
+	got = Splits(run([]int{0, 300, 310}, []float64{0, 1000, 1050}), nil, Kilometre)
+	if got[0].Best || got[0].Worst {
+		t.Fatalf("single full split marked: %+v", got[0])
+	}
+}
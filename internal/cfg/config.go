@@ -1,11 +1,28 @@
 package cfg
 
 import (
+	"bytes"
 	"encoding/json"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
 	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 )
 
+// EnvPrefix is prepended to the upper-cased JSON key to form the
+// environment variable for a setting, e.g. GARMR_HTTP_ADDR.
+const EnvPrefix = "GARMR_"
+
+// EnvConfig names the config file when -config is not given.
+const EnvConfig = EnvPrefix + "CONFIG"
+
+// Fields tagged secret:"true" are redacted by Redacted and can also be
+// read from a file via "<key>_file" (config file) or GARMR_<KEY>_FILE.
 type Config struct {
 	DBPath      string   `json:"db_path"`
 	RawStore    string   `json:"raw_store"`
@@ -15,9 +32,36 @@ type Config struct {
 	GarminDirs  []string `json:"garmin_dirs"`
 	UseCDNTiles bool     `json:"use_cdn_tiles"`
 	AuthUser    string   `json:"auth_user"`
-	AuthPass    string   `json:"auth_pass"`
+	AuthPass    string   `json:"auth_pass" secret:"true"`
+
+	// Single sign-on. TrustedProxies (IPs or CIDRs) may set
+	// ProxyAuthHeader and X-Forwarded-For; the OIDC settings enable
+	// "Sign in with ..." on the login page.
+	TrustedProxies    []string `json:"trusted_proxies"`
+	ProxyAuthHeader   string   `json:"proxy_auth_header"`
+	OIDCIssuer        string   `json:"oidc_issuer"`
+	OIDCClientID      string   `json:"oidc_client_id"`
+	OIDCClientSecret  string   `json:"oidc_client_secret" secret:"true"`
+	OIDCRedirectURL   string   `json:"oidc_redirect_url"`
+	OIDCScopes        []string `json:"oidc_scopes"`
+	OIDCUsernameClaim string   `json:"oidc_username_claim"`
+	OIDCButton        string   `json:"oidc_button"`
+	SSOAutoCreate     bool     `json:"sso_auto_create"`
+	SSODefaultRole    string   `json:"sso_default_role"`
+
+	// TLS. Either certificate files (reloaded when they change) or a
+	// generated self-signed certificate; HTTPRedirectAddr additionally
+	// serves plain HTTP that redirects to HTTPS.
+	TLSCert          string   `json:"tls_cert"`
+	TLSKey           string   `json:"tls_key"`
+	TLSSelfSigned    bool     `json:"tls_self_signed"`
+	TLSHosts         []string `json:"tls_hosts"`
+	HTTPRedirectAddr string   `json:"http_redirect_addr"`
 }
 
+// TLS reports whether garmrd serves HTTPS itself.
+func (c Config) TLS() bool { return c.TLSCert != "" || c.TLSSelfSigned }
+
 func Default() Config {
 	return Config{
 		DBPath:      "./data/garmr.db",
@@ -35,20 +79,353 @@ func Default() Config {
 		UseCDNTiles: true,
 		AuthUser:    "",
 		AuthPass:    "",
+
+		OIDCScopes:        []string{"openid", "profile", "email"},
+		OIDCUsernameClaim: "preferred_username",
+		OIDCButton:        "Sign in with single sign-on",
+		SSODefaultRole:    "athlete",
 	}
 }
 
-func Load(path string) Config {
+// Load builds the configuration from defaults, the JSON file at path and
+// GARMR_* environment variables, in that order. A missing file is only an
+// error when required is set; anything else wrong with the file (bad JSON,
+// unknown keys, wrong types) is reported rather than ignored.
+func Load(path string, required bool) (Config, error) {
 	c := Default()
-	f, err := os.Open(path)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := c.applyFile(data); err != nil {
+				return c, fmt.Errorf("config %s: %w", path, err)
+			}
+		case errors.Is(err, os.ErrNotExist) && !required:
+		default:
+			return c, fmt.Errorf("config: %w", err)
+		}
+	}
+	if err := c.applyEnv(os.Environ()); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// Set assigns a setting by its JSON key, parsing value for the field type.
+// Lists are comma-separated.
+func (c *Config) Set(key, value string) error {
+	f, ok := c.field(key)
+	if !ok {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s: %q is not an integer", key, value)
+		}
+		f.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", key, value)
+		}
+		f.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, p := range strings.Split(value, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				items = append(items, p)
+			}
+		}
+		f.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s: unsupported type %s", key, f.Kind())
+	}
+	return nil
+}
+
+// SetFromFile assigns a secret setting from the contents of a file, with
+// surrounding whitespace trimmed.
+func (c *Config) SetFromFile(key, path string) error {
+	if !IsSecret(key) {
+		return fmt.Errorf("%s_file: only secrets can be read from files", key)
+	}
+	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Printf("config: using defaults (%v)", err)
-		return c
+		return fmt.Errorf("%s_file: %w", key, err)
+	}
+	return c.Set(key, strings.TrimSpace(string(data)))
+}
+
+// Validate reports settings that would make the server fail later on.
+func (c Config) Validate() error {
+	var errs []string
+	if strings.TrimSpace(c.DBPath) == "" {
+		errs = append(errs, "db_path must not be empty")
+	}
+	if strings.TrimSpace(c.RawStore) == "" {
+		errs = append(errs, "raw_store must not be empty")
+	}
+	if strings.TrimSpace(c.HTTPAddr) == "" {
+		errs = append(errs, "http_addr must not be empty")
+	}
+	if c.PollMs < 0 {
+		errs = append(errs, "poll_ms must not be negative")
+	}
+	if (c.AuthUser == "") != (c.AuthPass == "") {
+		errs = append(errs, "auth_user and auth_pass must be set together")
+	}
+	for _, p := range c.TrustedProxies {
+		if _, err := ParseProxy(p); err != nil {
+			errs = append(errs, "trusted_proxies: "+err.Error())
+		}
+	}
+	if c.ProxyAuthHeader != "" && len(c.TrustedProxies) == 0 {
+		errs = append(errs, "proxy_auth_header needs trusted_proxies")
+	}
+	if c.OIDCIssuer != "" {
+		if !strings.HasPrefix(c.OIDCIssuer, "https://") && !strings.HasPrefix(c.OIDCIssuer, "http://") {
+			errs = append(errs, "oidc_issuer must be an http(s) URL")
+		}
+		if c.OIDCClientID == "" {
+			errs = append(errs, "oidc_issuer needs oidc_client_id")
+		}
+		if strings.TrimSpace(c.OIDCUsernameClaim) == "" {
+			errs = append(errs, "oidc_username_claim must not be empty")
+		}
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		errs = append(errs, "tls_cert and tls_key must be set together")
+	}
+	if c.TLSCert != "" && c.TLSSelfSigned {
+		errs = append(errs, "tls_self_signed cannot be combined with tls_cert")
+	}
+	if c.HTTPRedirectAddr != "" && !c.TLS() {
+		errs = append(errs, "http_redirect_addr needs tls_cert or tls_self_signed")
+	}
+	switch c.SSODefaultRole { // see store.Roles
+	case "admin", "athlete", "viewer":
+	default:
+		errs = append(errs, fmt.Sprintf("sso_default_role: invalid role %q", c.SSODefaultRole))
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid config: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ParseProxy parses a trusted_proxies entry: an IP address or a CIDR range.
+func ParseProxy(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("%q is not an IP or CIDR", s)
+		}
+		return p.Masked(), nil
+	}
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%q is not an IP or CIDR", s)
+	}
+	a = a.Unmap()
+	return netip.PrefixFrom(a, a.BitLen()), nil
+}
+
+// Redacted returns the configuration as indented JSON with secrets masked.
+func (c Config) Redacted() ([]byte, error) {
+	v := reflect.ValueOf(&c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("secret") == "true" && v.Field(i).String() != "" {
+			v.Field(i).SetString("<redacted>")
+		}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// Keys lists every setting's JSON key in declaration order.
+func Keys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		keys = append(keys, jsonKey(t.Field(i)))
+	}
+	return keys
+}
+
+// IsSecret reports whether key names a secret setting.
+func IsSecret(key string) bool {
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if jsonKey(t.Field(i)) == key {
+			return t.Field(i).Tag.Get("secret") == "true"
+		}
+	}
+	return false
+}
+
+// EnvName returns the environment variable for a setting.
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(key)
+}
+
+func (c *Config) applyFile(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return describeJSONError(data, err)
+	}
+	var unknown []string
+	plain := map[string]json.RawMessage{}
+	files := map[string]string{}
+	for k, v := range raw {
+		if base, ok := strings.CutSuffix(k, "_file"); ok && IsSecret(base) {
+			var p string
+			if err := json.Unmarshal(v, &p); err != nil {
+				return fmt.Errorf("%s: must be a string path", k)
+			}
+			files[base] = p
+			continue
+		}
+		if _, ok := c.field(k); !ok {
+			unknown = append(unknown, k)
+			continue
+		}
+		plain[k] = v
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown setting(s) %s (valid: %s)", strings.Join(unknown, ", "), strings.Join(Keys(), ", "))
+	}
+	for base := range files {
+		if _, ok := plain[base]; ok {
+			return fmt.Errorf("set either %s or %s_file, not both", base, base)
+		}
+	}
+
+	known, _ := json.Marshal(plain)
+	dec := json.NewDecoder(bytes.NewReader(known))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		var te *json.UnmarshalTypeError
+		if errors.As(err, &te) {
+			return fmt.Errorf("%s: expected %s, got JSON %s", te.Field, te.Type, te.Value)
+		}
+		return err
+	}
+	for base, p := range files {
+		if err := c.SetFromFile(base, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Config) applyEnv(environ []string) error {
+	env := map[string]string{}
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, EnvPrefix) && k != EnvConfig {
+			env[k] = v
+		}
+	}
+	known := map[string]bool{}
+	for _, key := range Keys() {
+		known[EnvName(key)] = true
+		if IsSecret(key) {
+			known[EnvName(key)+"_FILE"] = true
+		}
+	}
+	var unknown []string
+	for k := range env {
+		if !known[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("env: unknown variable(s) %s", strings.Join(unknown, ", "))
+	}
+	for _, key := range Keys() {
+		name := EnvName(key)
+		v, direct := env[name]
+		p, fromFile := env[name+"_FILE"]
+		if direct && fromFile {
+			return fmt.Errorf("env: set either %s or %s_FILE, not both", name, name)
+		}
+		if direct {
+			if err := c.Set(key, v); err != nil {
+				return fmt.Errorf("env %s: %w", name, err)
+			}
+		}
+		if fromFile {
+			if err := c.SetFromFile(key, p); err != nil {
+				return fmt.Errorf("env %s_FILE: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) field(key string) (reflect.Value, bool) {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if jsonKey(t.Field(i)) == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func jsonKey(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	return name
+}
+
+// describeJSONError adds line/column information to syntax errors.
+func describeJSONError(data []byte, err error) error {
+	var se *json.SyntaxError
+	if errors.As(err, &se) {
+		line := 1 + bytes.Count(data[:se.Offset], []byte("\n"))
+		col := int(se.Offset) - bytes.LastIndexByte(data[:se.Offset], '\n')
+		return fmt.Errorf("line %d, column %d: %w", line, col, err)
+	}
+	return err
+}
+
+// BindFlags registers one flag per setting (db_path -> -db-path) on fs.
+// The returned function applies the flags that were given on the command
+// line, the last layer on top of Load.
+func BindFlags(fs *flag.FlagSet) func(*Config) error {
+	type setting struct{ key, value string }
+	var given []setting
+	for _, key := range Keys() {
+		if IsSecret(key) {
+			// keep secrets out of the process list; use *_file or env
+			continue
+		}
+		key := key
+		fs.Func(strings.ReplaceAll(key, "_", "-"), "override "+key+" ("+EnvName(key)+")", func(v string) error {
+			given = append(given, setting{key, v})
+			return nil
+		})
 	}
-	defer f.Close()
-	if err := json.NewDecoder(f).Decode(&c); err != nil {
-		log.Printf("config decode: %v (using defaults)", err)
-		return Default()
+	return func(c *Config) error {
+		for _, s := range given {
+			if err := c.Set(s.key, s.value); err != nil {
+				return fmt.Errorf("flag -%s: %w", strings.ReplaceAll(s.key, "_", "-"), err)
+			}
+		}
+		return nil
 	}
-	return c
 }
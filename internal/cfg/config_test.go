@@ -0,0 +1,216 @@
+package cfg
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeFile writes content to name in a temporary directory.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLayers(t *testing.T) {
+	type layered struct {
+		HTTPAddr, DBPath, RawStore string
+		PollMs                     int
+	}
+	file := writeFile(t, "garmr.json", `{"http_addr": "file:1", "poll_ms": 100, "db_path": "file.db"}`)
+	tests := []struct {
+		name  string
+		env   map[string]string
+		flags []string
+		want  layered
+	}{
+		{
+			name: "file over defaults",
+			want: layered{HTTPAddr: "file:1", PollMs: 100, DBPath: "file.db", RawStore: Default().RawStore},
+		},
+		{
+			name: "env over file",
+			env:  map[string]string{"GARMR_HTTP_ADDR": "env:2", "GARMR_RAW_STORE": "env-raw"},
+			want: layered{HTTPAddr: "env:2", PollMs: 100, DBPath: "file.db", RawStore: "env-raw"},
+		},
+		{
+			name:  "flags over env",
+			env:   map[string]string{"GARMR_HTTP_ADDR": "env:2", "GARMR_POLL_MS": "200"},
+			flags: []string{"-http-addr", "flag:3", "-db-path", "flag.db"},
+			want:  layered{HTTPAddr: "flag:3", PollMs: 200, DBPath: "flag.db", RawStore: Default().RawStore},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			apply := BindFlags(fs)
+			if err := fs.Parse(tt.flags); err != nil {
+				t.Fatal(err)
+			}
+			c, err := Load(file, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := apply(&c); err != nil {
+				t.Fatal(err)
+			}
+			got := layered{HTTPAddr: c.HTTPAddr, PollMs: c.PollMs, DBPath: c.DBPath, RawStore: c.RawStore}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "nope.json")
+	c, err := Load(missing, false)
+	if err != nil || c.HTTPAddr != Default().HTTPAddr {
+		t.Fatalf("optional missing file: %+v, %v", c, err)
+	}
+	if _, err := Load(missing, true); err == nil {
+		t.Fatal("required missing file: no error")
+	}
+}
+
+func TestFileErrors(t *testing.T) {
+	secret := writeFile(t, "pw", "s3cret\n")
+	tests := []struct {
+		name, json, wantErr string
+	}{
+		{"unknown key", `{"http_adr": "x"}`, `unknown setting(s) http_adr`},
+		{"unknown keys sorted", `{"zz": 1, "aa": 2}`, `unknown setting(s) aa, zz`},
+		{"wrong type", `{"poll_ms": "fast"}`, `poll_ms: expected int`},
+		{"syntax error with position", "{\n  \"poll_ms\": 1,\n}", `line 3, column 2`},
+		{"file for a non-secret", `{"db_path_file": "/x"}`, `unknown setting(s) db_path_file`},
+		{"secret and its file", `{"auth_pass": "a", "auth_pass_file": "` + secret + `"}`, `set either auth_pass or auth_pass_file`},
+		{"missing secret file", `{"auth_pass_file": "/does/not/exist"}`, `auth_pass_file:`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			err := c.applyFile([]byte(tt.json))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnv(t *testing.T) {
+	secret := writeFile(t, "pw", "  s3cret\n\n")
+	tests := []struct {
+		name    string
+		env     []string
+		check   func(Config) bool
+		wantErr string
+	}{
+		{
+			name:  "lists are comma separated",
+			env:   []string{"GARMR_SEARCH_ROOTS=/a, /b,,", "PATH=/bin"},
+			check: func(c Config) bool { return slices.Equal(c.SearchRoots, []string{"/a", "/b"}) },
+		},
+		{
+			name:  "bool",
+			env:   []string{"GARMR_USE_CDN_TILES=false"},
+			check: func(c Config) bool { return !c.UseCDNTiles },
+		},
+		{
+			name:  "secret from a file, whitespace and newline trimmed",
+			env:   []string{"GARMR_AUTH_PASS_FILE=" + secret},
+			check: func(c Config) bool { return c.AuthPass == "s3cret" },
+		},
+		{
+			name:  "config path isn't a setting",
+			env:   []string{"GARMR_CONFIG=/etc/garmr.json"},
+			check: func(c Config) bool { return true },
+		},
+		{name: "unknown variable", env: []string{"GARMR_HTTP_ADR=x", "GARMR_DB_PATH=x"}, wantErr: "unknown variable(s) GARMR_HTTP_ADR"},
+		{name: "file for a non-secret", env: []string{"GARMR_DB_PATH_FILE=/x"}, wantErr: "GARMR_DB_PATH_FILE"},
+		{name: "secret and its file", env: []string{"GARMR_AUTH_PASS=a", "GARMR_AUTH_PASS_FILE=" + secret}, wantErr: "not both"},
+		{name: "bad integer", env: []string{"GARMR_POLL_MS=soon"}, wantErr: `env GARMR_POLL_MS: poll_ms: "soon" is not an integer`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			err := c.applyEnv(tt.env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(c) {
+				t.Fatalf("config %+v", c)
+			}
+		})
+	}
+}
+
+func TestSecretFileInConfigFile(t *testing.T) {
+	secret := writeFile(t, "pw", "s3cret\r\n")
+	c := Default()
+	if err := c.applyFile([]byte(`{"auth_user": "admin", "auth_pass_file": "` + secret + `"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if c.AuthPass != "s3cret" {
+		t.Fatalf("AuthPass = %q", c.AuthPass)
+	}
+}
+
+func TestBindFlagsSkipsSecrets(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	BindFlags(fs)
+	if fs.Lookup("auth-pass") != nil {
+		t.Fatal("secrets must not be settable on the command line")
+	}
+	if fs.Lookup("auth-user") == nil || fs.Lookup("db-path") == nil {
+		t.Fatal("missing flags for settings")
+	}
+	apply := BindFlags(flag.NewFlagSet("test", flag.ContinueOnError))
+	c := Default()
+	if err := apply(&c); err != nil || c.HTTPAddr != Default().HTTPAddr {
+		t.Fatalf("no flags changed the config: %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := Default()
+	c.AuthUser, c.AuthPass = "admin", "hunter2"
+	out, err := c.Redacted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "hunter2") {
+		t.Fatalf("secret in output:\n%s", out)
+	}
+	var back map[string]any
+	if err := json.Unmarshal(out, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back["auth_pass"] != "<redacted>" || back["auth_user"] != "admin" {
+		t.Fatalf("auth_user %v, auth_pass %v", back["auth_user"], back["auth_pass"])
+	}
+	if c.AuthPass != "hunter2" {
+		t.Fatal("Redacted changed the config")
+	}
+	// an empty secret stays empty, so it's clear it isn't set
+	out, err = Default().Redacted()
+	if err != nil || !strings.Contains(string(out), `"auth_pass": ""`) {
+		t.Fatalf("empty secret:\n%s", out)
+	}
+}
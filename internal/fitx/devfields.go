@@ -0,0 +1,120 @@
+package fitx
+
+import (
+	"encoding/hex"
+	"os"
+	"time"
+)
+
+// DevField is a developer data field: a value written by a Connect IQ app or
+// a sensor such as Stryd, described by the file itself.
+type DevField struct {
+	Index  int    // developer data index
+	Num    int    // field definition number
+	AppID  string // application id in hex, "" if the file has none
+	Name   string
+	Units  string
+	Values []DevValue
+}
+
+// DevValue is one value of a developer field.
+type DevValue struct {
+	Msg   string // "record", "lap" or "session"
+	Pos   int    // record: seconds from the start; lap: lap index; session: 0
+	Value float64
+}
+
+// parseDevFields reads the developer fields of the file at path, in the
+// order they are described. Only fields with values are returned, and only
+// those of the first session, like the rest of the activity. Errors leave
+// them out.
+func parseDevFields(path string, start time.Time) []DevField {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	type desc struct {
+		DevField
+		scale, offset float64
+	}
+	apps := map[byte]string{}
+	byKey := map[devKey]*desc{}
+	var order []devKey
+	laps, sessions := 0, 0
+	add := func(m rawMsg, msg string, pos int) {
+		for k, v := range m.dev {
+			if df := byKey[k]; df != nil {
+				v = v/df.scale - df.offset
+				df.Values = append(df.Values, DevValue{Msg: msg, Pos: pos, Value: v})
+			}
+		}
+	}
+	_ = readRawMessages(f, func(m rawMsg) bool {
+		switch m.Num {
+		case 207: // developer_data_id
+			if i, ok := m.Uint(3); ok {
+				if id := m.Bytes(1); len(id) > 0 && !allFF(id) {
+					apps[byte(i)] = hex.EncodeToString(id)
+				}
+			}
+		case 206: // field_description
+			i, ok1 := m.Uint(0)
+			n, ok2 := m.Uint(1)
+			if !ok1 || !ok2 {
+				return true
+			}
+			k := devKey{index: byte(i), num: byte(n)}
+			d := &desc{DevField: DevField{
+				Index: int(i),
+				Num:   int(n),
+				AppID: apps[byte(i)],
+				Name:  m.String(3),
+				Units: m.String(8),
+			}, scale: 1}
+			if v, ok := m.Uint(6); ok && v > 0 {
+				d.scale = float64(v)
+			}
+			if v, ok := m.Int(7); ok {
+				d.offset = float64(v)
+			}
+			if old := byKey[k]; old != nil {
+				d.Values = old.Values // redescribed
+			} else {
+				order = append(order, k)
+			}
+			byKey[k] = d
+		case 20: // record
+			if !m.Time.IsZero() {
+				add(m, "record", int(m.Time.Sub(start).Seconds()))
+			}
+		case 19: // lap
+			add(m, "lap", laps)
+			laps++
+		case 18: // session
+			if sessions == 0 {
+				add(m, "session", 0)
+			}
+			sessions++
+		}
+		return true
+	})
+
+	var res []DevField
+	for _, k := range order {
+		if df := byKey[k]; len(df.Values) > 0 {
+			res = append(res, df.DevField)
+		}
+	}
+	return res
+}
+
+func allFF(b []byte) bool {
+	for _, c := range b {
+		if c != 0xFF {
+			return false
+		}
+	}
+	return true
+}
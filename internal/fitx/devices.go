@@ -0,0 +1,181 @@
+package fitx
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/tormoder/fit"
+)
+
+// Device is the recording device or a paired sensor, from the file_id and
+// device_info messages.
+type Device struct {
+	Key          string // stable identity: serial, ANT+ number or model
+	Index        int    // device_index; 0 is the device that made the file
+	Source       string // "local", "antplus", "bluetooth_low_energy", ...
+	Type         string // e.g. "heart_rate", "bike_power"; "" for the recorder
+	Manufacturer string
+	Product      string
+	Serial       uint32
+	Firmware     string
+	Battery      string   // "new", "good", "ok", "low", "critical" or ""
+	BatteryV     *float64 // volts
+}
+
+// Creator reports whether d is the device that recorded the activity.
+func (d Device) Creator() bool { return d.Index == 0 }
+
+// parseDevices collects one Device per device_index. A sensor usually has
+// a device_info at the start and the end of the activity; later messages
+// win, but empty fields don't overwrite known ones.
+func parseDevices(fileID fit.FileIdMsg, infos []*fit.DeviceInfoMsg) []Device {
+	var devs []Device
+	byIndex := map[int]int{}
+	for _, di := range infos {
+		if di.DeviceIndex == fit.DeviceIndexInvalid {
+			continue
+		}
+		idx := int(di.DeviceIndex)
+		pos, ok := byIndex[idx]
+		if !ok {
+			pos = len(devs)
+			byIndex[idx] = pos
+			devs = append(devs, Device{Index: idx})
+		}
+		d := &devs[pos]
+		if di.SourceType != fit.SourceTypeInvalid {
+			d.Source = snake(di.SourceType.String())
+		}
+		if t := deviceType(di); t != "" {
+			d.Type = t
+		}
+		if di.Manufacturer != fit.ManufacturerInvalid && di.Manufacturer != 0 {
+			d.Manufacturer = words(di.Manufacturer.String())
+		}
+		if name := strings.TrimSpace(di.ProductName); name != "" {
+			d.Product = name
+		} else if di.Product != 0xFFFF && d.Product == "" {
+			d.Product = productName(di.Manufacturer, di.Product)
+		}
+		if di.SerialNumber != 0 && di.SerialNumber != 0xFFFFFFFF {
+			d.Serial = di.SerialNumber
+		}
+		if di.SoftwareVersion != 0xFFFF && di.SoftwareVersion != 0 {
+			d.Firmware = fmt.Sprintf("%d.%02d", di.SoftwareVersion/100, di.SoftwareVersion%100)
+		}
+		if di.BatteryStatus >= fit.BatteryStatusNew && di.BatteryStatus <= fit.BatteryStatusCritical {
+			d.Battery = snake(di.BatteryStatus.String())
+		}
+		if di.BatteryVoltage != 0xFFFF && di.BatteryVoltage != 0 {
+			v := float64(di.BatteryVoltage) / 256 // scale 256
+			d.BatteryV = &v
+		}
+		if d.Key == "" && di.AntDeviceNumber != 0 {
+			d.Key = fmt.Sprintf("ant:%d:%d", di.DeviceType, di.AntDeviceNumber)
+		}
+	}
+
+	// The recorder is described by file_id even when device_info 0 is
+	// missing or sparse.
+	pos, ok := byIndex[0]
+	if !ok {
+		pos = len(devs)
+		devs = append(devs, Device{Index: 0})
+	}
+	rec := &devs[pos]
+	rec.Source, rec.Type = "local", ""
+	if fileID.Manufacturer != fit.ManufacturerInvalid && fileID.Manufacturer != 0 {
+		rec.Manufacturer = words(fileID.Manufacturer.String())
+		if name := strings.TrimSpace(fileID.ProductName); name != "" {
+			rec.Product = name
+		} else if fileID.Product != 0xFFFF {
+			rec.Product = productName(fileID.Manufacturer, fileID.Product)
+		}
+	}
+	if fileID.SerialNumber != 0 && fileID.SerialNumber != 0xFFFFFFFF {
+		rec.Serial = fileID.SerialNumber
+	}
+
+	out := devs[:0]
+	for _, d := range devs {
+		// internal sensors of the recorder (barometer, GPS chip, ...)
+		// show up as devices without an identity of their own
+		if !d.Creator() && d.Serial == 0 && d.Key == "" && (d.Source == "" || d.Source == "local") {
+			continue
+		}
+		if d.Manufacturer == "" && d.Product == "" && d.Serial == 0 && d.Key == "" {
+			continue
+		}
+		switch {
+		case d.Serial != 0:
+			d.Key = fmt.Sprintf("serial:%d", d.Serial)
+		case d.Key == "":
+			d.Key = "model:" + strings.ToLower(d.Manufacturer+":"+d.Product+":"+d.Type)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+func deviceType(di *fit.DeviceInfoMsg) string {
+	if di.DeviceType == 0xFF {
+		return ""
+	}
+	// BLE sensors report ANT+ device profile numbers too
+	if di.SourceType == fit.SourceTypeLocal {
+		return ""
+	}
+	if t := fit.AntplusDeviceType(di.DeviceType); !strings.Contains(t.String(), "(") {
+		return snake(t.String())
+	}
+	return ""
+}
+
+// productName names a product: Garmin's product IDs are in the FIT profile,
+// other vendors' are not.
+func productName(m fit.Manufacturer, product uint16) string {
+	if m == fit.ManufacturerGarmin || m == fit.ManufacturerDynastream || m == fit.ManufacturerDynastreamOem {
+		if s := fit.GarminProduct(product).String(); !strings.Contains(s, "(") {
+			return garminModel(s)
+		}
+	}
+	return fmt.Sprintf("#%d", product)
+}
+
+// garminModel turns profile names like "Fr945" or "Fenix6SSolar" into the
+// names on the box.
+func garminModel(s string) string {
+	s = words(s)
+	switch {
+	case strings.HasPrefix(s, "Fr "):
+		return "Forerunner " + s[3:]
+	case strings.HasPrefix(s, "Hrm"):
+		return "HRM" + s[3:]
+	}
+	return s
+}
+
+// words splits CamelCase and letter/digit boundaries: "WahooFitness" ->
+// "Wahoo Fitness", "Fr945" -> "Fr 945".
+func words(s string) string {
+	var b strings.Builder
+	rs := []rune(s)
+	for i, r := range rs {
+		if i > 0 {
+			prev := rs[i-1]
+			if (unicode.IsUpper(r) && unicode.IsLower(prev)) ||
+				(unicode.IsDigit(r) && unicode.IsLetter(prev)) ||
+				(unicode.IsUpper(r) && unicode.IsDigit(prev)) {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// snake turns enum names like "BikePower" into "bike_power".
+func snake(s string) string {
+	return strings.ReplaceAll(strings.ToLower(words(s)), " ", "_")
+}
@@ -0,0 +1,78 @@
+package fitx
+
+import (
+	"os"
+
+	"github.com/tormoder/fit"
+)
+
+// Record fields newer than the fit package's profile, read with the raw
+// decoder and matched to records by timestamp.
+const (
+	fieldVerticalRatio       = 83  // %, scale 100
+	fieldStanceTimeBalance   = 84  // % left, scale 100
+	fieldStepLength          = 85  // mm, scale 10
+	fieldRespirationRate     = 99  // breaths/min
+	fieldEnhancedRespiration = 108 // breaths/min, scale 100
+)
+
+// recordExtras returns the record messages of the file at path keyed by
+// their timestamp (s since the FIT epoch). Errors leave the extras out.
+func recordExtras(path string) map[int64]rawMsg {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	extras := map[int64]rawMsg{}
+	_ = readRawMessages(f, func(m rawMsg) bool {
+		if m.Num == 20 && !m.Time.IsZero() { // record
+			extras[m.Time.Unix()] = m
+		}
+		return true
+	})
+	return extras
+}
+
+// addDynamics copies running dynamics and the other optional record fields
+// into r.
+func addDynamics(r *Record, rr *fit.RecordMsg, raw rawMsg) {
+	scaled := func(v, invalid uint64, scale float64) *float64 {
+		if v == invalid || v == 0 {
+			return nil
+		}
+		f := float64(v) / scale
+		return &f
+	}
+	if rr.Distance != 0xFFFFFFFF {
+		d := float64(rr.Distance) / 100
+		r.DistanceM = &d
+	}
+	r.VertOscMM = scaled(uint64(rr.VerticalOscillation), 0xFFFF, 10)
+	r.GCTMS = scaled(uint64(rr.StanceTime), 0xFFFF, 10)
+	r.CadFraction = scaled(uint64(rr.FractionalCadence), 0xFF, 128)
+	// left_right_balance: the percentage of the right side if bit 7 is set,
+	// of an unknown side otherwise, which isn't worth showing
+	if b := uint8(rr.LeftRightBalance); b != 0xFF && b&0x80 != 0 && b&0x7F <= 100 {
+		left := float64(100 - int(b&0x7F))
+		r.PowerBalance = &left
+	}
+
+	get := func(field byte, scale float64) *float64 {
+		v, ok := raw.Uint(field) // invalid values are already left out
+		if !ok {
+			return nil
+		}
+		return scaled(v, 0, scale)
+	}
+	r.VertRatio = get(fieldVerticalRatio, 100)
+	r.GCTBalance = get(fieldStanceTimeBalance, 100)
+	if mm := get(fieldStepLength, 10); mm != nil {
+		m := *mm / 1000
+		r.StrideM = &m
+	}
+	r.RespRate = get(fieldEnhancedRespiration, 100)
+	if r.RespRate == nil {
+		r.RespRate = get(fieldRespirationRate, 1)
+	}
+}
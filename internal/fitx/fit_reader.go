@@ -24,9 +24,20 @@ type Activity struct {
 	DescentM     float64
 	DeviceVendor string
 	DeviceModel  string
+	Devices      []Device // recorder first, then paired sensors
 	// Training effects (Garmin specific)
 	AerobicTE   *float64 // Aerobic Training Effect (0.0-5.0)
 	AnaerobicTE *float64 // Anaerobic Training Effect (0.0-5.0)
+	// Pool swims
+	PoolLengthM float64 // 0 unless a pool swim
+	Lengths     []Length
+	// Connect IQ and other developer fields
+	DevFields []DevField
+	// DurationS is the timer time; these add the pauses back, or leave
+	// stops out
+	ElapsedS int
+	MovingS  int
+	Timer    []TimerEvent
 }
 
 type Record struct {
@@ -39,6 +50,16 @@ type Record struct {
 	TempC    *float64
 	PowerW   *int
 	SpeedMPS *float64
+	// Optional fields, mostly running dynamics
+	DistanceM    *float64
+	CadFraction  *float64 // added to Cad
+	VertOscMM    *float64 // vertical oscillation
+	GCTMS        *float64 // ground contact time
+	GCTBalance   *float64 // ground contact time balance, % left
+	StrideM      *float64 // step length
+	VertRatio    *float64 // vertical oscillation / step length, %
+	RespRate     *float64 // breaths per minute
+	PowerBalance *float64 // left/right power balance, % left
 }
 
 type Lap struct {
@@ -92,6 +113,12 @@ func ParseFIT(path string) (Activity, []Record, []Lap, []HRZone, error) {
 		Calories:     int(s.TotalCalories),
 		AscentM:      float64(s.TotalAscent),
 		DescentM:     float64(s.TotalDescent),
+		Devices:      parseDevices(fd.FileId, af.DeviceInfos),
+	}
+	for _, d := range meta.Devices {
+		if d.Creator() {
+			meta.DeviceVendor, meta.DeviceModel = d.Manufacturer, d.Product
+		}
 	}
 
 	// Extract Garmin-specific training metrics if available
@@ -107,6 +134,7 @@ func ParseFIT(path string) (Activity, []Record, []Lap, []HRZone, error) {
 	// Records (exported field!)
 	var recs []Record
 	start := s.StartTime
+	extras := recordExtras(path)
 	for _, rr := range af.Records {
 		r := Record{ TOffsetS: int(rr.Timestamp.Sub(start).Seconds()) }
 
@@ -120,7 +148,7 @@ func ParseFIT(path string) (Activity, []Record, []Lap, []HRZone, error) {
 	    }
 
 		// Speed (m/s) scale 1000
-		if rr.Speed != 0 {
+		if rr.Speed != 0 && rr.Speed != 0xFFFF {
 			v := float64(rr.Speed) / 1000.0
 			r.SpeedMPS = &v
 		}
@@ -139,6 +167,7 @@ func ParseFIT(path string) (Activity, []Record, []Lap, []HRZone, error) {
 			r.TempC = &v
 		}
 		if rr.Power != 0 { v := int(rr.Power); r.PowerW = &v }
+		addDynamics(&r, rr, extras[rr.Timestamp.Unix()])
 
 		recs = append(recs, r)
 	}
@@ -161,6 +190,10 @@ func ParseFIT(path string) (Activity, []Record, []Lap, []HRZone, error) {
 		laps = append(laps, l)
 	}
 
+	parseSwim(&meta, s, af.Lengths)
+	meta.DevFields = parseDevFields(path, start)
+	parseTimer(&meta, s, af.Events, recs)
+
 	// Calculate heart rate zones based on records
 	zones := calculateHRZones(recs, meta.MaxHR)
 
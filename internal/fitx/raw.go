@@ -0,0 +1,390 @@
+package fitx
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The fit package only knows the messages and fields of the FIT profile it
+// was generated from, and drops the rest. Wellness files are mostly made of
+// messages it doesn't know (stress, sleep, HRV), so they are read with this
+// small decoder of the record layer instead.
+
+// fitEpoch is FIT's time zero, 1989-12-31 00:00:00 UTC.
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// rawMsg is a decoded data message: the first value of each field, keyed
+// by field number, with invalid values left out.
+type rawMsg struct {
+	Num    uint16
+	Time   time.Time // from field 253 or a compressed timestamp header
+	fields map[byte]rawValue
+	bytes  map[byte][]byte    // string and byte array fields
+	dev    map[devKey]float64 // developer fields, first value
+}
+
+// devKey identifies a developer field: its developer data index and field
+// number.
+type devKey struct {
+	index, num byte
+}
+
+type rawValue struct {
+	u      uint64
+	signed bool
+}
+
+// Uint returns field n as an unsigned number.
+func (m rawMsg) Uint(n byte) (uint64, bool) {
+	v, ok := m.fields[n]
+	if !ok || (v.signed && int64(v.u) < 0) {
+		return 0, false
+	}
+	return v.u, true
+}
+
+// Int returns field n as a signed number.
+func (m rawMsg) Int(n byte) (int64, bool) {
+	v, ok := m.fields[n]
+	return int64(v.u), ok
+}
+
+// String returns string field n, "" if it is missing or empty.
+func (m rawMsg) String(n byte) string {
+	b := m.bytes[n]
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// Bytes returns byte array field n.
+func (m rawMsg) Bytes(n byte) []byte {
+	return m.bytes[n]
+}
+
+// Time32 returns field n as a FIT date_time.
+func (m rawMsg) Time32(n byte) (time.Time, bool) {
+	v, ok := m.Uint(n)
+	if !ok {
+		return time.Time{}, false
+	}
+	return fitEpoch.Add(time.Duration(v) * time.Second), true
+}
+
+type rawFieldDef struct {
+	num, size, baseType byte
+}
+
+type rawDef struct {
+	num       uint16
+	order     binary.ByteOrder
+	fields    []rawFieldDef
+	devFields []rawDevFieldDef
+}
+
+type rawDevFieldDef struct {
+	key  devKey
+	size byte
+}
+
+// readRawMessages decodes the data messages of a FIT file (including chained
+// files), calling fn for each until it returns false.
+func readRawMessages(r io.Reader, fn func(rawMsg) bool) error {
+	br := bufio.NewReader(r)
+	for first := true; ; first = false {
+		hdr := make([]byte, 12)
+		if _, err := io.ReadFull(br, hdr[:1]); err != nil {
+			if err == io.EOF && !first {
+				return nil
+			}
+			return err
+		}
+		size := int(hdr[0])
+		if size < 12 && !first {
+			return nil // padding after the last file
+		}
+		if size < 12 {
+			return fmt.Errorf("fit: bad header size %d", size)
+		}
+		rest := make([]byte, size-1)
+		if _, err := io.ReadFull(br, rest); err != nil {
+			return err
+		}
+		copy(hdr[1:], rest)
+		if string(hdr[8:12]) != ".FIT" {
+			if !first {
+				return nil
+			}
+			return errors.New("fit: not a FIT file")
+		}
+		dataSize := int64(binary.LittleEndian.Uint32(hdr[4:8]))
+		lr := &io.LimitedReader{R: br, N: dataSize}
+		stop, err := readRawRecords(bufio.NewReader(lr), fn)
+		if err != nil || stop {
+			return err
+		}
+		if _, err := io.CopyN(io.Discard, lr, lr.N); err != nil {
+			return err
+		}
+		// file CRC
+		if _, err := io.ReadFull(br, make([]byte, 2)); err != nil {
+			return err
+		}
+	}
+}
+
+func readRawRecords(r *bufio.Reader, fn func(rawMsg) bool) (stop bool, err error) {
+	defs := map[byte]*rawDef{}
+	devTypes := map[devKey]byte{} // base types from field_description messages
+	var lastTS uint32
+	for {
+		h, err := r.ReadByte()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		var local byte
+		var compressedTS bool
+		switch {
+		case h&0x80 != 0: // compressed timestamp header
+			local = (h >> 5) & 0x03
+			offset := uint32(h & 0x1F)
+			ts := lastTS&^0x1F | offset
+			if offset < lastTS&0x1F {
+				ts += 0x20
+			}
+			lastTS = ts
+			compressedTS = true
+		case h&0x40 != 0: // definition message
+			def, err := readRawDef(r, h&0x20 != 0)
+			if err != nil {
+				return false, err
+			}
+			defs[h&0x0F] = def
+			continue
+		default:
+			local = h & 0x0F
+		}
+
+		def := defs[local]
+		if def == nil {
+			return false, fmt.Errorf("fit: data message for undefined local type %d", local)
+		}
+		m := rawMsg{Num: def.num, fields: make(map[byte]rawValue, len(def.fields))}
+		for _, f := range def.fields {
+			buf := make([]byte, f.size)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return false, err
+			}
+			if v, ok := rawDecode(buf, f.baseType, def.order); ok {
+				m.fields[f.num] = v
+			}
+			if t := f.baseType & 0x1F; t == 0x07 || t == 0x0D {
+				if m.bytes == nil {
+					m.bytes = map[byte][]byte{}
+				}
+				m.bytes[f.num] = buf
+			}
+		}
+		for _, f := range def.devFields {
+			buf := make([]byte, f.size)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return false, err
+			}
+			t, ok := devTypes[f.key]
+			if !ok {
+				continue // no description, so no way to read it
+			}
+			if v, ok := rawNumber(buf, t, def.order); ok {
+				if m.dev == nil {
+					m.dev = map[devKey]float64{}
+				}
+				m.dev[f.key] = v
+			}
+		}
+		if m.Num == 206 { // field_description
+			i, ok1 := m.Uint(0)
+			n, ok2 := m.Uint(1)
+			t, ok3 := m.Uint(2)
+			if ok1 && ok2 && ok3 {
+				devTypes[devKey{index: byte(i), num: byte(n)}] = byte(t)
+			}
+		}
+		if ts, ok := m.Uint(253); ok {
+			lastTS = uint32(ts)
+			m.Time = fitEpoch.Add(time.Duration(ts) * time.Second)
+		} else if compressedTS {
+			m.Time = fitEpoch.Add(time.Duration(lastTS) * time.Second)
+		}
+		if !fn(m) {
+			return true, nil
+		}
+	}
+}
+
+func readRawDef(r *bufio.Reader, dev bool) (*rawDef, error) {
+	head := make([]byte, 5)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	def := &rawDef{order: binary.LittleEndian}
+	if head[1] == 1 {
+		def.order = binary.BigEndian
+	}
+	def.num = def.order.Uint16(head[2:4])
+	buf := make([]byte, 3*int(head[4]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(buf); i += 3 {
+		def.fields = append(def.fields, rawFieldDef{num: buf[i], size: buf[i+1], baseType: buf[i+2]})
+	}
+	if dev {
+		n, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 3*int(n))
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(buf); i += 3 {
+			def.devFields = append(def.devFields, rawDevFieldDef{key: devKey{index: buf[i+2], num: buf[i]}, size: buf[i+1]})
+		}
+	}
+	return def, nil
+}
+
+// rawDecode reads the first value of a field, reporting false for the base
+// type's invalid value, strings and floats.
+func rawDecode(b []byte, baseType byte, order binary.ByteOrder) (rawValue, bool) {
+	var u uint64
+	var size int
+	var signed, zeroInvalid bool
+	switch baseType & 0x1F {
+	case 0x00, 0x02, 0x0D: // enum, uint8, byte
+		size = 1
+	case 0x0A: // uint8z
+		size, zeroInvalid = 1, true
+	case 0x01:
+		size, signed = 1, true
+	case 0x03:
+		size, signed = 2, true
+	case 0x04:
+		size = 2
+	case 0x0B:
+		size, zeroInvalid = 2, true
+	case 0x05:
+		size, signed = 4, true
+	case 0x06:
+		size = 4
+	case 0x0C:
+		size, zeroInvalid = 4, true
+	case 0x0E:
+		size, signed = 8, true
+	case 0x0F:
+		size = 8
+	case 0x10:
+		size, zeroInvalid = 8, true
+	default: // string, float32, float64
+		return rawValue{}, false
+	}
+	if len(b) < size {
+		return rawValue{}, false
+	}
+	switch size {
+	case 1:
+		u = uint64(b[0])
+	case 2:
+		u = uint64(order.Uint16(b))
+	case 4:
+		u = uint64(order.Uint32(b))
+	case 8:
+		u = order.Uint64(b)
+	}
+	bits := uint(size * 8)
+	switch {
+	case zeroInvalid:
+		if u == 0 {
+			return rawValue{}, false
+		}
+	case signed:
+		if u == 1<<(bits-1)-1 {
+			return rawValue{}, false
+		}
+		// sign-extend
+		u = uint64(int64(u<<(64-bits)) >> (64 - bits))
+	default:
+		if bits == 64 && u == ^uint64(0) || bits < 64 && u == 1<<bits-1 {
+			return rawValue{}, false
+		}
+	}
+	return rawValue{u: u, signed: signed}, true
+}
+
+// rawNumber reads the first value of a numeric field of any base type,
+// including floats, reporting false for invalid values and strings.
+func rawNumber(b []byte, baseType byte, order binary.ByteOrder) (float64, bool) {
+	switch baseType & 0x1F {
+	case 0x08: // float32
+		if len(b) < 4 {
+			return 0, false
+		}
+		u := order.Uint32(b)
+		if u == 0xFFFFFFFF {
+			return 0, false
+		}
+		// shortest decimal that reads back as the float32, so 9.6 stays 9.6
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(math.Float32frombits(u)), 'g', -1, 32), 64)
+		return f, true
+	case 0x09: // float64
+		if len(b) < 8 {
+			return 0, false
+		}
+		u := order.Uint64(b)
+		if u == ^uint64(0) {
+			return 0, false
+		}
+		return math.Float64frombits(u), true
+	}
+	v, ok := rawDecode(b, baseType, order)
+	if !ok {
+		return 0, false
+	}
+	if v.signed {
+		return float64(int64(v.u)), true
+	}
+	return float64(v.u), true
+}
+
+// FileType returns the type in a FIT file's file_id message, e.g. 4 for an
+// activity or 32 for monitoring.
+func FileType(r io.Reader) (int, error) {
+	typ := -1
+	err := readRawMessages(r, func(m rawMsg) bool {
+		if m.Num != 0 { // file_id
+			return true
+		}
+		if t, ok := m.Uint(0); ok {
+			typ = int(t)
+		}
+		return false
+	})
+	if err != nil {
+		return 0, err
+	}
+	if typ < 0 {
+		return 0, errors.New("fit: no file_id")
+	}
+	return typ, nil
+}
@@ -0,0 +1,167 @@
+package fitx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRawDecode(t *testing.T) {
+	le, be := binary.LittleEndian, binary.BigEndian
+	tests := []struct {
+		name     string
+		b        []byte
+		baseType byte
+		order    binary.ByteOrder
+		want     int64
+		ok       bool
+	}{
+		{"uint8", []byte{42}, 0x02, le, 42, true},
+		{"uint8 invalid", []byte{0xFF}, 0x02, le, 0, false},
+		{"enum invalid", []byte{0xFF}, 0x00, le, 0, false},
+		{"uint8z zero invalid", []byte{0}, 0x0A, le, 0, false},
+		{"uint8z 0xFF valid", []byte{0xFF}, 0x0A, le, 255, true},
+		{"sint8 negative", []byte{0xFE}, 0x01, le, -2, true},
+		{"sint8 minimum", []byte{0x80}, 0x01, le, -128, true},
+		{"sint8 invalid", []byte{0x7F}, 0x01, le, 0, false},
+		{"uint16 little endian", []byte{0x34, 0x12}, 0x84, le, 0x1234, true},
+		{"uint16 big endian", []byte{0x12, 0x34}, 0x84, be, 0x1234, true},
+		{"uint16 invalid", []byte{0xFF, 0xFF}, 0x84, le, 0, false},
+		{"uint16z zero invalid", []byte{0, 0}, 0x8B, le, 0, false},
+		{"sint16 negative big endian", []byte{0xFF, 0x9C}, 0x83, be, -100, true},
+		{"sint16 invalid", []byte{0xFF, 0x7F}, 0x83, le, 0, false},
+		{"sint32 negative", []byte{0xFF, 0xFF, 0xFF, 0xFF}, 0x85, le, -1, true},
+		{"sint32 invalid", []byte{0xFF, 0xFF, 0xFF, 0x7F}, 0x85, le, 0, false},
+		{"uint32 invalid", []byte{0xFF, 0xFF, 0xFF, 0xFF}, 0x86, le, 0, false},
+		{"uint32z zero invalid", []byte{0, 0, 0, 0}, 0x8C, le, 0, false},
+		{"sint64 negative", []byte{0xF6, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, 0x8E, le, -10, true},
+		{"uint64 invalid", bytes.Repeat([]byte{0xFF}, 8), 0x8F, le, 0, false},
+		{"first of an array", []byte{7, 8, 9}, 0x02, le, 7, true},
+		{"short buffer", []byte{1}, 0x84, le, 0, false},
+		{"string", []byte("abc\x00"), 0x07, le, 0, false},
+		{"float32", []byte{0, 0, 0x80, 0x3F}, 0x88, le, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, ok := rawDecode(tt.b, tt.baseType, tt.order)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && int64(v.u) != tt.want {
+				t.Fatalf("value = %d, want %d", int64(v.u), tt.want)
+			}
+		})
+	}
+}
+
+func TestRawNumber(t *testing.T) {
+	tests := []struct {
+		name     string
+		b        []byte
+		baseType byte
+		want     float64
+		ok       bool
+	}{
+		{"float32 keeps its decimal", binary.LittleEndian.AppendUint32(nil, 0x4119999A), 0x88, 9.6, true},
+		{"float32 invalid", []byte{0xFF, 0xFF, 0xFF, 0xFF}, 0x88, 0, false},
+		{"float64 invalid", bytes.Repeat([]byte{0xFF}, 8), 0x89, 0, false},
+		{"sint16", []byte{0x9C, 0xFF}, 0x83, -100, true},
+		{"uint16", []byte{0x10, 0x27}, 0x84, 10000, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, ok := rawNumber(tt.b, tt.baseType, binary.LittleEndian)
+			if ok != tt.ok || v != tt.want {
+				t.Fatalf("rawNumber = %v %v, want %v %v", v, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+// fitFile wraps record bytes in a 12-byte header and a (unchecked) CRC.
+func fitFile(records ...[]byte) []byte {
+	data := bytes.Join(records, nil)
+	hdr := []byte{12, 0x10, 0, 0}
+	hdr = binary.LittleEndian.AppendUint32(hdr, uint32(len(data)))
+	hdr = append(hdr, ".FIT"...)
+	return append(append(hdr, data...), 0, 0)
+}
+
+// defMsg is a little endian definition message; fields are (num, size,
+// base type) triples.
+func defMsg(local byte, global uint16, fields ...byte) []byte {
+	b := []byte{0x40 | local, 0, 0}
+	b = binary.LittleEndian.AppendUint16(b, global)
+	return append(append(b, byte(len(fields)/3)), fields...)
+}
+
+func collect(t *testing.T, file []byte) []rawMsg {
+	t.Helper()
+	var msgs []rawMsg
+	if err := readRawMessages(bytes.NewReader(file), func(m rawMsg) bool {
+		msgs = append(msgs, m)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return msgs
+}
+
+func TestReadRawCompressedTimestamps(t *testing.T) {
+	ts := func(m rawMsg) uint32 { return uint32(m.Time.Sub(fitEpoch) / time.Second) }
+	file := fitFile(
+		defMsg(0, 55, 253, 4, 0x86, 1, 1, 0x02), // monitoring with a timestamp
+		defMsg(1, 55, 1, 1, 0x02),               // and without
+		append([]byte{0x00}, 0xE8, 0x03, 0, 0, 5),
+		[]byte{0x80 | 1<<5 | 10, 6}, // offset 10 after 1000 (offset 8)
+		[]byte{0x80 | 1<<5 | 3, 7},  // offset 3 < 10: the 5 bits rolled over
+		[]byte{0x80 | 1<<5 | 3, 8},  // same offset again: no rollover
+	)
+	msgs := collect(t, file)
+	want := []uint32{1000, 1002, 1027, 1027}
+	if len(msgs) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(msgs), len(want))
+	}
+	for i, m := range msgs {
+		if got := ts(m); got != want[i] {
+			t.Errorf("message %d: timestamp %d, want %d", i, got, want[i])
+		}
+		if v, ok := m.Uint(1); !ok || v != uint64(5+i) {
+			t.Errorf("message %d: field 1 = %d %v", i, v, ok)
+		}
+	}
+}
+
+func TestReadRawChainedFiles(t *testing.T) {
+	fileID := func(typ byte) []byte {
+		return append(defMsg(0, 0, 0, 1, 0x00), 0x00, typ)
+	}
+	record := append(defMsg(1, 20, 3, 1, 0x02), 0x01, 150)
+	chained := append(fitFile(fileID(4), record), fitFile(fileID(32))...)
+
+	var nums []uint16
+	for _, m := range collect(t, chained) {
+		nums = append(nums, m.Num)
+	}
+	if want := []uint16{0, 20, 0}; !slices.Equal(nums, want) {
+		t.Fatalf("messages = %v, want %v", nums, want)
+	}
+	// local types are per file: the second file doesn't see the first's
+	// definitions
+	bad := append(fitFile(fileID(4), record), fitFile([]byte{0x01, 150})...)
+	if err := readRawMessages(bytes.NewReader(bad), func(rawMsg) bool { return true }); err == nil {
+		t.Fatal("expected an error for an undefined local type in the second file")
+	}
+	// zero padding after the last file is ignored
+	if n := len(collect(t, append(chained, 0, 0, 0, 0))); n != 3 {
+		t.Fatalf("padded: got %d messages, want 3", n)
+	}
+	if typ, err := FileType(bytes.NewReader(chained)); err != nil || typ != 4 {
+		t.Fatalf("FileType = %d, %v; want 4", typ, err)
+	}
+	if _, err := FileType(bytes.NewReader([]byte("not a fit file at all"))); err == nil {
+		t.Fatal("expected an error for a file that isn't FIT")
+	}
+}
@@ -0,0 +1,62 @@
+package fitx
+
+import (
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+// Length is one pool length of a swim. Idle lengths are the rests a watch
+// records between intervals.
+type Length struct {
+	Index    int
+	StartOff float64 // s since the start of the activity
+	DurS     float64 // timer time
+	Strokes  int
+	Stroke   string // "freestyle", "backstroke", ...; "" for idle lengths
+	Active   bool
+}
+
+var swimStrokes = map[fit.SwimStroke]string{
+	fit.SwimStrokeFreestyle:    "freestyle",
+	fit.SwimStrokeBackstroke:   "backstroke",
+	fit.SwimStrokeBreaststroke: "breaststroke",
+	fit.SwimStrokeButterfly:    "butterfly",
+	fit.SwimStrokeDrill:        "drill",
+	fit.SwimStrokeMixed:        "mixed",
+	fit.SwimStrokeIm:           "IM",
+}
+
+// parseSwim reads the pool length (0 for open water and everything else)
+// and the lengths of a pool swim. For pool swims the distance is the
+// number of active lengths times the pool length, which is what the watch
+// counted; the session's distance can be off when lengths were edited.
+func parseSwim(meta *Activity, s *fit.SessionMsg, lengths []*fit.LengthMsg) {
+	if s.PoolLength == 0xFFFF || s.PoolLength == 0 {
+		return
+	}
+	meta.PoolLengthM = float64(s.PoolLength) / 100
+	active := 0
+	for i, l := range lengths {
+		if l.StartTime.Equal(time.Time{}) || l.TotalTimerTime == 0xFFFFFFFF {
+			continue
+		}
+		ln := Length{
+			Index:    i,
+			StartOff: l.StartTime.Sub(s.StartTime).Seconds(),
+			DurS:     float64(l.TotalTimerTime) / 1000,
+			Active:   l.LengthType == fit.LengthTypeActive,
+		}
+		if ln.Active {
+			active++
+			if l.TotalStrokes != 0xFFFF {
+				ln.Strokes = int(l.TotalStrokes)
+			}
+			ln.Stroke = swimStrokes[l.SwimStroke]
+		}
+		meta.Lengths = append(meta.Lengths, ln)
+	}
+	if active > 0 {
+		meta.DistanceM = int(float64(active)*meta.PoolLengthM + 0.5)
+	}
+}
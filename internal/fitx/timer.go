@@ -0,0 +1,105 @@
+package fitx
+
+import "github.com/tormoder/fit"
+
+// MovingSpeedMPS is the speed below which an athlete counts as standing
+// still for moving time.
+const MovingSpeedMPS = 0.5
+
+// TimerEvent is the activity timer starting or stopping, by hand or by auto
+// pause.
+type TimerEvent struct {
+	TOffsetS int
+	Start    bool
+}
+
+// Pause is a stretch with the timer stopped, from Stop up to Start.
+type Pause struct {
+	Stop, Start int // seconds from the activity's start
+}
+
+// Pauses returns the stretches between a timer stop and the next start.
+// A stop with no start after it ends the activity and isn't a pause.
+func Pauses(events []TimerEvent) []Pause {
+	var res []Pause
+	stopped, stop := false, 0
+	for _, e := range events {
+		switch {
+		case !e.Start && !stopped:
+			stopped, stop = true, e.TOffsetS
+		case e.Start && stopped:
+			stopped = false
+			if e.TOffsetS > stop {
+				res = append(res, Pause{Stop: stop, Start: e.TOffsetS})
+			}
+		}
+	}
+	return res
+}
+
+// PausedBetween reports whether a pause began at or after t0 and before t1,
+// i.e. whether the timer was stopped between two records at those offsets.
+func PausedBetween(pauses []Pause, t0, t1 int) bool {
+	for _, p := range pauses {
+		if p.Stop >= t0 && p.Stop < t1 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimer sets the elapsed time, timer events and moving time of a.
+func parseTimer(a *Activity, s *fit.SessionMsg, events []*fit.EventMsg, recs []Record) {
+	if s.TotalElapsedTime != 0xFFFFFFFF {
+		a.ElapsedS = int(float64(s.TotalElapsedTime) / 1000.0)
+	}
+	if a.ElapsedS == 0 && len(recs) > 0 {
+		a.ElapsedS = recs[len(recs)-1].TOffsetS
+	}
+	for _, e := range events {
+		if e.Event != fit.EventTimer {
+			continue
+		}
+		ev := TimerEvent{TOffsetS: int(e.Timestamp.Sub(s.StartTime).Seconds())}
+		switch e.EventType {
+		case fit.EventTypeStart:
+			ev.Start = true
+		case fit.EventTypeStop, fit.EventTypeStopAll, fit.EventTypeStopDisable, fit.EventTypeStopDisableAll:
+		default:
+			continue
+		}
+		a.Timer = append(a.Timer, ev)
+	}
+	a.MovingS = movingTime(recs, Pauses(a.Timer), a.DurationS)
+}
+
+// movingTime adds up the time between records while the timer ran and the
+// athlete moved at MovingSpeedMPS or faster. Without any speed or distance
+// in the records it is the timer time.
+func movingTime(recs []Record, pauses []Pause, timerS int) int {
+	moving, known := 0, false
+	for i := 1; i < len(recs); i++ {
+		a, b := recs[i-1], recs[i]
+		dt := b.TOffsetS - a.TOffsetS
+		if dt <= 0 || PausedBetween(pauses, a.TOffsetS, b.TOffsetS) {
+			continue
+		}
+		var spd float64
+		switch {
+		case b.SpeedMPS != nil:
+			spd = *b.SpeedMPS
+		case a.DistanceM != nil && b.DistanceM != nil:
+			spd = (*b.DistanceM - *a.DistanceM) / float64(dt)
+		default:
+			continue
+		}
+		known = true
+		if spd >= MovingSpeedMPS {
+			moving += dt
+		}
+	}
+	if !known || timerS > 0 && moving > timerS {
+		return timerS
+	}
+	return moving
+}
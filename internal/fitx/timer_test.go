@@ -0,0 +1,179 @@
+package fitx
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+func TestPauses(t *testing.T) {
+	stop := func(s int) TimerEvent { return TimerEvent{TOffsetS: s} }
+	start := func(s int) TimerEvent { return TimerEvent{TOffsetS: s, Start: true} }
+	tests := []struct {
+		name   string
+		events []TimerEvent
+		want   []Pause
+	}{
+		{name: "no events"},
+		{name: "start and final stop", events: []TimerEvent{start(0), stop(600)}},
+		{
+			name:   "stop and resume",
+			events: []TimerEvent{start(0), stop(100), start(160), stop(400), start(430), stop(900)},
+			want:   []Pause{{Stop: 100, Start: 160}, {Stop: 400, Start: 430}},
+		},
+		{
+			// auto pause stopping again while stopped by hand
+			name:   "second stop while stopped",
+			events: []TimerEvent{start(0), stop(100), stop(120), start(200)},
+			want:   []Pause{{Stop: 100, Start: 200}},
+		},
+		{
+			name:   "start while running",
+			events: []TimerEvent{start(0), start(50), stop(100), start(150)},
+			want:   []Pause{{Stop: 100, Start: 150}},
+		},
+		{
+			name:   "resumed in the same second",
+			events: []TimerEvent{start(0), stop(100), start(100), stop(200), start(210)},
+			want:   []Pause{{Stop: 200, Start: 210}},
+		},
+		{
+			name:   "no start event first",
+			events: []TimerEvent{stop(30), start(90)},
+			want:   []Pause{{Stop: 30, Start: 90}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Pauses(tt.events); !slices.Equal(got, tt.want) {
+				t.Fatalf("Pauses = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPausedBetween(t *testing.T) {
+	pauses := []Pause{{Stop: 100, Start: 160}}
+	tests := []struct {
+		t0, t1 int
+		want   bool
+	}{
+		{90, 100, false}, // the record at the stop is before the pause
+		{100, 165, true},
+		{95, 165, true},
+		{160, 170, false}, // after the start
+		{101, 110, false}, // inside, but the pause began earlier
+	}
+	for _, tt := range tests {
+		if got := PausedBetween(pauses, tt.t0, tt.t1); got != tt.want {
+			t.Errorf("PausedBetween(%d, %d) = %v, want %v", tt.t0, tt.t1, got, tt.want)
+		}
+	}
+}
+
+// recs returns records 10 s apart moving at the given speeds; a negative
+// speed leaves it out.
+func recs(speeds ...float64) []Record {
+	out := make([]Record, len(speeds))
+	for i, s := range speeds {
+		out[i].TOffsetS = 10 * i
+		if s >= 0 {
+			out[i].SpeedMPS = &s
+		}
+	}
+	return out
+}
+
+func TestMovingTime(t *testing.T) {
+	dist := func(ds ...float64) []Record {
+		out := make([]Record, len(ds))
+		for i, d := range ds {
+			out[i].TOffsetS = 10 * i
+			out[i].DistanceM = &d
+		}
+		return out
+	}
+	tests := []struct {
+		name   string
+		recs   []Record
+		pauses []Pause
+		timerS int
+		want   int
+	}{
+		{name: "all moving", recs: recs(3, 3, 3, 3), timerS: 30, want: 30},
+		{name: "standing still", recs: recs(3, 0, 0, 3), timerS: 30, want: 10},
+		// a stretch counts by the speed at its end
+		{name: "at the threshold", recs: recs(0, MovingSpeedMPS, 0), timerS: 20, want: 10},
+		{name: "just under the threshold", recs: recs(1, MovingSpeedMPS-0.01, 1), timerS: 20, want: 10},
+		{name: "speed from distance", recs: dist(0, 30, 34, 34, 39), timerS: 40, want: 20},
+		{name: "distance at the threshold", recs: dist(0, 5, 9.99), timerS: 20, want: 10},
+		{
+			name:   "pauses left out",
+			recs:   recs(3, 3, 3, 3, 3),
+			pauses: []Pause{{Stop: 10, Start: 15}},
+			timerS: 35,
+			want:   30,
+		},
+		{name: "no speed or distance", recs: recs(-1, -1, -1), timerS: 25, want: 25},
+		{name: "gaps in the speed", recs: recs(3, -1, 3), timerS: 20, want: 10},
+		{name: "never more than the timer", recs: recs(3, 3, 3), timerS: 15, want: 15},
+		{name: "no timer time", recs: recs(3, 3, 3), want: 20},
+		{name: "one record", recs: recs(3), timerS: 5, want: 5},
+		{
+			name:   "repeated offsets",
+			recs:   []Record{{TOffsetS: 0}, {TOffsetS: 10, SpeedMPS: ptr(2.0)}, {TOffsetS: 10, SpeedMPS: ptr(2.0)}},
+			timerS: 10,
+			want:   10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := movingTime(tt.recs, tt.pauses, tt.timerS); got != tt.want {
+				t.Fatalf("movingTime = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestParseTimer(t *testing.T) {
+	start := time.Date(2025, 5, 4, 8, 0, 0, 0, time.UTC)
+	ev := func(s int, e fit.Event, typ fit.EventType) *fit.EventMsg {
+		return &fit.EventMsg{Timestamp: start.Add(time.Duration(s) * time.Second), Event: e, EventType: typ}
+	}
+	events := []*fit.EventMsg{
+		ev(0, fit.EventTimer, fit.EventTypeStart),
+		ev(20, fit.EventLap, fit.EventTypeStop), // not the timer
+		ev(30, fit.EventTimer, fit.EventTypeStopAll),
+		ev(90, fit.EventTimer, fit.EventTypeStart),
+		ev(95, fit.EventTimer, fit.EventTypeMarker), // neither start nor stop
+		ev(130, fit.EventTimer, fit.EventTypeStopDisableAll),
+	}
+	// moving but for the pause and 20 s standing at the end
+	records := recs(3, 3, 3, 3, 3, 3, 3, 0, 0)
+	for i := range records {
+		if i >= 4 {
+			records[i].TOffsetS += 50
+		}
+	}
+
+	a := Activity{DurationS: 70}
+	parseTimer(&a, &fit.SessionMsg{StartTime: start, TotalElapsedTime: 135_000}, events, records)
+	want := []TimerEvent{{0, true}, {30, false}, {90, true}, {130, false}}
+	if !slices.Equal(a.Timer, want) {
+		t.Fatalf("Timer = %v, want %v", a.Timer, want)
+	}
+	if a.ElapsedS != 135 || a.MovingS != 50 {
+		t.Fatalf("ElapsedS %d, MovingS %d; want 135 and 50", a.ElapsedS, a.MovingS)
+	}
+
+	// without a session elapsed time it runs to the last record
+	a = Activity{DurationS: 70}
+	parseTimer(&a, &fit.SessionMsg{StartTime: start, TotalElapsedTime: 0xFFFFFFFF}, events, records)
+	if a.ElapsedS != 130 {
+		t.Fatalf("ElapsedS = %d, want the last record's 130", a.ElapsedS)
+	}
+}
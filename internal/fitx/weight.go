@@ -0,0 +1,38 @@
+package fitx
+
+import "time"
+
+// Weight is one weight_scale measurement, from a smart scale or the watch.
+type Weight struct {
+	Time     time.Time
+	WeightKg float64
+	FatPct   *float64
+	WaterPct *float64
+	MuscleKg *float64
+	BoneKg   *float64
+	BMI      *float64
+}
+
+// weightFromMsg reads a weight_scale message. Scales write 0xFFFE as the
+// weight while they are still measuring; those are skipped.
+func weightFromMsg(m rawMsg) (Weight, bool) {
+	kg, ok := m.Uint(0)
+	if !ok || kg == 0 || kg >= 0xFFFE || m.Time.IsZero() {
+		return Weight{}, false
+	}
+	w := Weight{Time: m.Time, WeightKg: float64(kg) / 100}
+	scaled := func(field byte, scale float64) *float64 {
+		v, ok := m.Uint(field)
+		if !ok || v == 0 {
+			return nil
+		}
+		f := float64(v) / scale
+		return &f
+	}
+	w.FatPct = scaled(1, 100)
+	w.WaterPct = scaled(2, 100)
+	w.BoneKg = scaled(4, 100)
+	w.MuscleKg = scaled(5, 100)
+	w.BMI = scaled(14, 10)
+	return w, true
+}
@@ -0,0 +1,355 @@
+package fitx
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// FIT file types of the wellness files Garmin watches write next to their
+// activities, and of scale files. 44, 49 and 68 are Garmin's own and not in
+// the FIT profile.
+const (
+	FileTypeWeight          = 9 // scales (Index), GARMIN/Weight
+	FileTypeMonitoringA     = 15
+	FileTypeMonitoringDaily = 28
+	FileTypeMonitoringB     = 32 // GARMIN/Monitor
+	FileTypeMetrics         = 44 // GARMIN/Metrics: VO2max
+	FileTypeSleep           = 49 // GARMIN/Sleep
+	FileTypeHRVStatus       = 68 // GARMIN/HRVStatus
+)
+
+// IsWellness reports whether files of type t are read by ParseWellness.
+func IsWellness(t int) bool {
+	switch t {
+	case FileTypeMonitoringA, FileTypeMonitoringDaily, FileTypeMonitoringB,
+		FileTypeMetrics, FileTypeSleep, FileTypeHRVStatus, FileTypeWeight:
+		return true
+	}
+	return false
+}
+
+// Message numbers read from wellness files.
+const (
+	mesgFileID         = 0
+	mesgWeightScale    = 30
+	mesgActivity       = 34
+	mesgMonitoring     = 55
+	mesgMonitoringInfo = 103
+	mesgMonitoringHR   = 211 // monitoring_hr_data
+	mesgStressLevel    = 227
+	mesgMaxMetData     = 229
+	mesgSleepLevel     = 275
+	mesgSleepScore     = 346 // sleep_assessment
+	mesgHRVSummary     = 370 // hrv_status_summary
+)
+
+// WellnessDay is what one wellness file says about one day. Fields the file
+// has nothing about are nil.
+type WellnessDay struct {
+	Day string // local date, 2006-01-02
+
+	Steps       *int
+	DistanceM   *float64
+	ModerateMin *int // intensity minutes
+	VigorousMin *int
+
+	RestingHR    *int
+	MinHR, MaxHR *int
+
+	StressAvg     *float64 // 0-100
+	StressMax     *int
+	StressSamples int
+
+	Sleep *Sleep // the night that ended on Day
+
+	HRVLastNight *float64 // ms
+	HRVWeekly    *float64 // ms
+	HRVStatus    string   // "balanced", "unbalanced", "low", "poor"
+
+	VO2Max        *float64 // running / generic
+	VO2MaxCycling *float64
+}
+
+// Sleep is one night from a sleep file.
+type Sleep struct {
+	Start, End                  time.Time
+	DeepS, LightS, RemS, AwakeS int
+	Score                       *int
+}
+
+// Wellness is a parsed wellness file.
+type Wellness struct {
+	FileType int
+	Serial   uint32
+	Days     []WellnessDay // by date
+	Weights  []Weight      // weight files only
+}
+
+var sleepLevels = map[uint64]string{1: "awake", 2: "light", 3: "deep", 4: "rem"}
+
+var hrvStatuses = map[uint64]string{1: "poor", 2: "low", 3: "unbalanced", 4: "balanced"}
+
+// ParseWellness reads a monitoring, sleep, HRV status or metrics file into
+// per-day values, or a weight file into its measurements.
+func ParseWellness(path string) (Wellness, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Wellness{}, err
+	}
+	defer f.Close()
+	return parseWellness(f)
+}
+
+func parseWellness(r io.Reader) (Wellness, error) {
+	var msgs []rawMsg
+	if err := readRawMessages(r, func(m rawMsg) bool {
+		msgs = append(msgs, m)
+		return true
+	}); err != nil {
+		return Wellness{}, err
+	}
+
+	w := Wellness{FileType: -1}
+	// The offset of local time, from messages that carry both; days are
+	// local dates.
+	var offset *time.Duration
+	var lastTime time.Time
+	for _, m := range msgs {
+		switch m.Num {
+		case mesgFileID:
+			if t, ok := m.Uint(0); ok && w.FileType < 0 {
+				w.FileType = int(t)
+			}
+			if s, ok := m.Uint(3); ok {
+				w.Serial = uint32(s)
+			}
+		case mesgMonitoringInfo, mesgActivity:
+			field := byte(0) // monitoring_info.local_timestamp
+			if m.Num == mesgActivity {
+				field = 5
+			}
+			if local, ok := m.Uint(field); ok && !m.Time.IsZero() && offset == nil {
+				d := fitEpoch.Add(time.Duration(local) * time.Second).Sub(m.Time).Round(15 * time.Minute)
+				offset = &d
+			}
+		}
+		if m.Time.After(lastTime) {
+			lastTime = m.Time
+		}
+	}
+	if w.FileType < 0 {
+		return w, fmt.Errorf("fit: no file_id")
+	}
+	if !IsWellness(w.FileType) {
+		return w, fmt.Errorf("fit: file type %d is not a wellness file", w.FileType)
+	}
+	dayOf := func(t time.Time) string {
+		if offset != nil {
+			return t.UTC().Add(*offset).Format("2006-01-02")
+		}
+		return t.Local().Format("2006-01-02")
+	}
+
+	days := map[string]*WellnessDay{}
+	day := func(t time.Time) *WellnessDay {
+		k := dayOf(t)
+		d := days[k]
+		if d == nil {
+			d = &WellnessDay{Day: k}
+			days[k] = d
+		}
+		return d
+	}
+
+	// Steps and distance are counted up per activity type since midnight,
+	// so a day's total is the sum of each type's highest count.
+	type dayType struct {
+		day string
+		typ uint64
+	}
+	cycles := map[dayType]uint64{}
+	distance := map[dayType]uint64{}
+
+	var lastFull uint32 // for monitoring's 16-bit timestamps
+	var sleepLevelsSeen []rawMsg
+	var sleepScore *int
+	for _, m := range msgs {
+		if !m.Time.IsZero() {
+			lastFull = uint32(m.Time.Sub(fitEpoch) / time.Second)
+		}
+		switch m.Num {
+		case mesgMonitoring:
+			t := m.Time
+			if ts16, ok := m.Uint(26); ok && t.IsZero() && lastFull != 0 {
+				ts := lastFull + (uint32(ts16)-lastFull&0xFFFF)&0xFFFF
+				t = fitEpoch.Add(time.Duration(ts) * time.Second)
+			}
+			if t.IsZero() {
+				continue
+			}
+			if mins, ok := m.Uint(29); ok && mins >= 1440 {
+				// a daily summary, stamped at the midnight ending the day
+				t = t.Add(-time.Second)
+			}
+			d := day(t)
+			typ, ok := m.Uint(5)
+			if !ok {
+				if ti, ok2 := m.Uint(24); ok2 {
+					typ, ok = ti&0x1F, true
+				}
+			}
+			if ok && (typ == 1 || typ == 6) { // running, walking: cycles are steps
+				if c, ok := m.Uint(3); ok && c > cycles[dayType{d.Day, typ}] {
+					cycles[dayType{d.Day, typ}] = c
+				}
+			}
+			if ok {
+				if dist, ok := m.Uint(2); ok && dist > distance[dayType{d.Day, typ}] {
+					distance[dayType{d.Day, typ}] = dist
+				}
+			}
+			if hr, ok := m.Uint(27); ok && hr > 0 {
+				v := int(hr)
+				if d.MinHR == nil || v < *d.MinHR {
+					d.MinHR = &v
+				}
+				if d.MaxHR == nil || v > *d.MaxHR {
+					d.MaxHR = &v
+				}
+			}
+			if mod, ok := m.Uint(33); ok {
+				d.ModerateMin = addInt(d.ModerateMin, int(mod))
+			}
+			if vig, ok := m.Uint(34); ok {
+				d.VigorousMin = addInt(d.VigorousMin, int(vig))
+			}
+		case mesgMonitoringHR:
+			if m.Time.IsZero() {
+				continue
+			}
+			if rhr, ok := m.Uint(1); ok && rhr > 0 { // current_day_resting_heart_rate
+				v := int(rhr)
+				day(m.Time).RestingHR = &v
+			}
+		case mesgStressLevel:
+			v, ok := m.Int(0)
+			t, okT := m.Time32(1)
+			if !ok || !okT || v < 0 || v > 100 {
+				continue // negative values mean no reading (moving, off wrist)
+			}
+			d := day(t)
+			avg := float64(v)
+			if d.StressAvg != nil {
+				avg = (*d.StressAvg*float64(d.StressSamples) + avg) / float64(d.StressSamples+1)
+			}
+			d.StressAvg = &avg
+			d.StressSamples++
+			if d.StressMax == nil || int(v) > *d.StressMax {
+				sv := int(v)
+				d.StressMax = &sv
+			}
+		case mesgSleepLevel:
+			if !m.Time.IsZero() {
+				sleepLevelsSeen = append(sleepLevelsSeen, m)
+			}
+		case mesgSleepScore:
+			if s, ok := m.Uint(6); ok && s <= 100 { // overall_sleep_score
+				v := int(s)
+				sleepScore = &v
+			}
+		case mesgHRVSummary:
+			if m.Time.IsZero() {
+				continue
+			}
+			d := day(m.Time)
+			if v, ok := m.Uint(1); ok {
+				ms := math.Round(float64(v)/128*10) / 10
+				d.HRVLastNight = &ms
+			}
+			if v, ok := m.Uint(0); ok {
+				ms := math.Round(float64(v)/128*10) / 10
+				d.HRVWeekly = &ms
+			}
+			if s, ok := m.Uint(6); ok {
+				d.HRVStatus = hrvStatuses[s]
+			}
+		case mesgWeightScale:
+			if wt, ok := weightFromMsg(m); ok {
+				w.Weights = append(w.Weights, wt)
+			}
+		case mesgMaxMetData:
+			t, ok := m.Time32(0) // update_time
+			v, okV := m.Uint(2)
+			if !ok || !okV || v == 0 {
+				continue
+			}
+			vo2 := float64(v) / 10
+			d := day(t)
+			sport, _ := m.Uint(5)
+			category, _ := m.Uint(8)
+			if sport == 2 || category == 1 { // cycling
+				d.VO2MaxCycling = &vo2
+			} else {
+				d.VO2Max = &vo2
+			}
+		}
+	}
+
+	for k, c := range cycles {
+		d := days[k.day]
+		d.Steps = addInt(d.Steps, int(c))
+	}
+	for k, dist := range distance {
+		d := days[k.day]
+		m := float64(dist) / 100
+		if d.DistanceM != nil {
+			m += *d.DistanceM
+		}
+		d.DistanceM = &m
+	}
+
+	if len(sleepLevelsSeen) > 0 {
+		sl := &Sleep{Start: sleepLevelsSeen[0].Time, End: lastTime, Score: sleepScore}
+		for i, m := range sleepLevelsSeen {
+			end := lastTime
+			if i+1 < len(sleepLevelsSeen) {
+				end = sleepLevelsSeen[i+1].Time
+			}
+			secs := int(end.Sub(m.Time) / time.Second)
+			if secs <= 0 {
+				continue
+			}
+			level, _ := m.Uint(0)
+			switch sleepLevels[level] {
+			case "awake":
+				sl.AwakeS += secs
+			case "light":
+				sl.LightS += secs
+			case "deep":
+				sl.DeepS += secs
+			case "rem":
+				sl.RemS += secs
+			}
+		}
+		day(sl.End).Sleep = sl
+	}
+
+	for _, d := range days {
+		if *d != (WellnessDay{Day: d.Day}) {
+			w.Days = append(w.Days, *d)
+		}
+	}
+	sort.Slice(w.Days, func(i, j int) bool { return w.Days[i].Day < w.Days[j].Day })
+	return w, nil
+}
+
+func addInt(p *int, v int) *int {
+	if p != nil {
+		v += *p
+	}
+	return &v
+}
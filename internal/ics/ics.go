@@ -0,0 +1,298 @@
+// Package ics reads and writes the small subset of iCalendar (RFC 5545)
+// garmr needs: VEVENTs with all-day or timed start/end, summary and
+// description.
+package ics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time // exclusive; zero when unknown
+	AllDay      bool
+	Summary     string
+	Description string
+}
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405"
+	maxLineOctets  = 75
+)
+
+// Write renders events as a VCALENDAR document.
+func Write(w io.Writer, calName string, events []Event) error {
+	bw := bufio.NewWriter(w)
+	stamp := time.Now().UTC().Format(dateTimeLayout) + "Z"
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//garmr//garmr//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + escapeText(calName),
+	}
+	for _, e := range events {
+		lines = append(lines, "BEGIN:VEVENT", "UID:"+escapeText(e.UID), "DTSTAMP:"+stamp)
+		if e.AllDay {
+			end := e.End
+			if end.IsZero() || !end.After(e.Start) {
+				end = e.Start.AddDate(0, 0, 1)
+			}
+			lines = append(lines,
+				"DTSTART;VALUE=DATE:"+e.Start.Format(dateLayout),
+				"DTEND;VALUE=DATE:"+end.Format(dateLayout))
+		} else {
+			lines = append(lines, "DTSTART:"+e.Start.UTC().Format(dateTimeLayout)+"Z")
+			if !e.End.IsZero() {
+				lines = append(lines, "DTEND:"+e.End.UTC().Format(dateTimeLayout)+"Z")
+			}
+		}
+		lines = append(lines, "SUMMARY:"+escapeText(e.Summary))
+		if e.Description != "" {
+			lines = append(lines, "DESCRIPTION:"+escapeText(e.Description))
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, l := range lines {
+		if _, err := bw.WriteString(fold(l)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// fold splits a content line into CRLF-terminated chunks of at most 75
+// octets, continuation lines starting with a single space.
+func fold(line string) string {
+	var b strings.Builder
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		// don't split inside a UTF-8 sequence
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+func escapeText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+func unescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// Parse extracts VEVENTs from an iCalendar stream. Events without a usable
+// DTSTART are skipped.
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var cur *Event
+	var duration string
+	depth := 0 // nesting inside the current VEVENT (e.g. VALARM)
+	for _, line := range lines {
+		name, params, value, ok := splitProperty(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			cur = &Event{}
+			duration = ""
+			depth = 0
+			continue
+		case name == "BEGIN" && cur != nil:
+			depth++
+			continue
+		case name == "END" && cur != nil && depth > 0:
+			depth--
+			continue
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if cur != nil && !cur.Start.IsZero() {
+				if cur.End.IsZero() && duration != "" {
+					if d, err := parseDuration(duration); err == nil {
+						cur.End = cur.Start.Add(d)
+					}
+				}
+				events = append(events, *cur)
+			}
+			cur = nil
+			continue
+		}
+		if cur == nil || depth > 0 {
+			continue
+		}
+		switch name {
+		case "UID":
+			cur.UID = value
+		case "SUMMARY":
+			cur.Summary = unescapeText(value)
+		case "DESCRIPTION":
+			cur.Description = unescapeText(value)
+		case "DTSTART":
+			if t, allDay, err := parseTime(value, params); err == nil {
+				cur.Start, cur.AllDay = t, allDay
+			}
+		case "DTEND":
+			if t, _, err := parseTime(value, params); err == nil {
+				cur.End = t
+			}
+		case "DURATION":
+			duration = value
+		}
+	}
+	return events, nil
+}
+
+func unfold(r io.Reader) ([]string, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	var lines []string
+	for sc.Scan() {
+		l := strings.TrimRight(sc.Text(), "\r")
+		if (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		lines = append(lines, l)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(strings.TrimSpace(lines[0]), "BEGIN:VCALENDAR") {
+		return nil, errors.New("not an iCalendar file")
+	}
+	return lines, nil
+}
+
+// splitProperty splits "NAME;PARAM=V;P2=V2:value" into its parts.
+func splitProperty(line string) (name string, params map[string]string, value string, ok bool) {
+	colon := -1
+	inQuote := false
+	for i, c := range line {
+		if c == '"' {
+			inQuote = !inQuote
+		}
+		if c == ':' && !inQuote {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, "", false
+	}
+	head := strings.Split(line[:colon], ";")
+	params = map[string]string{}
+	for _, p := range head[1:] {
+		if k, v, found := strings.Cut(p, "="); found {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(head[0]), params, line[colon+1:], true
+}
+
+func parseTime(value string, params map[string]string) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == len(dateLayout) {
+		t, err := time.Parse(dateLayout, value)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(dateTimeLayout, strings.TrimSuffix(value, "Z"))
+		return t, false, err
+	}
+	loc := time.Local
+	if tz := params["TZID"]; tz != "" {
+		if l, err := time.LoadLocation(tz); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation(dateTimeLayout, value, loc)
+	return t, false, err
+}
+
+// parseDuration handles the RFC 5545 subset used by calendar apps,
+// e.g. "PT1H30M", "P1D", "P1W".
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	s = s[1:]
+	var d time.Duration
+	inTime := false
+	num := 0
+	seen := false
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			num = num*10 + int(c-'0')
+			seen = true
+			continue
+		case c == 'T':
+			inTime = true
+			continue
+		}
+		if !seen {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		n := time.Duration(num)
+		switch {
+		case c == 'W':
+			d += n * 7 * 24 * time.Hour
+		case c == 'D':
+			d += n * 24 * time.Hour
+		case c == 'H' && inTime:
+			d += n * time.Hour
+		case c == 'M' && inTime:
+			d += n * time.Minute
+		case c == 'S' && inTime:
+			d += n * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		num, seen = 0, false
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
@@ -0,0 +1,175 @@
+package ics
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func utc(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseFixtures(t *testing.T) {
+	tests := []struct {
+		file string
+		want []Event
+	}{
+		{
+			// CRLF, UTC times, a folded and escaped description
+			file: "google.ics",
+			want: []Event{{
+				UID:     "abc123@google.com",
+				Start:   utc("2025-03-10T06:30:00Z"),
+				End:     utc("2025-03-10T07:30:00Z"),
+				Summary: "Intervals, track",
+				Description: "Warm up 15 min\nthen 6x800m at 5k pace; 90 s jog recoveries. " +
+					"Cool down with strides if the legs feel good, otherwise walk. Path: C:\\training",
+			}},
+		},
+		{
+			// TZID times on both DST changes, DURATION, a tab-folded line and
+			// an alarm whose description isn't the event's
+			file: "outlook.ics",
+			want: []Event{
+				{
+					UID:         "040000008200E00074C5B7101A82E008",
+					Start:       utc("2025-03-30T07:00:00Z"),
+					End:         utc("2025-03-30T08:30:00Z"),
+					Summary:     "Langer Lauf",
+					Description: "Ruhig laufen bis zum See",
+				},
+				{
+					UID:     "after-dst-end",
+					Start:   utc("2025-10-26T08:00:00Z"),
+					End:     utc("2025-10-26T09:00:00Z"),
+					Summary: "Recovery ride",
+				},
+			},
+		},
+		{
+			// VALUE=DATE, a bare date, and an event without DTSTART
+			file: "allday.ics",
+			want: []Event{
+				{UID: "race@example.com", Start: utc("2025-04-05T00:00:00Z"), End: utc("2025-04-07T00:00:00Z"), AllDay: true, Summary: "Race weekend"},
+				{UID: "rest@example.com", Start: utc("2025-04-08T00:00:00Z"), AllDay: true, Summary: "Rest day"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			got, err := Parse(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d events %+v, want %d", len(got), got, len(tt.want))
+			}
+			for i, w := range tt.want {
+				g := got[i]
+				if g.UID != w.UID || g.AllDay != w.AllDay || g.Summary != w.Summary || g.Description != w.Description {
+					t.Errorf("event %d = %+v\nwant %+v", i, g, w)
+				}
+				if !g.Start.Equal(w.Start) || !g.End.Equal(w.End) {
+					t.Errorf("event %d from %v to %v, want %v to %v", i, g.Start, g.End, w.Start, w.End)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFloatingTime(t *testing.T) {
+	// without a known TZID a time is in the server's zone
+	doc := "BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:20250101T100000\nEND:VEVENT\n" +
+		"BEGIN:VEVENT\nDTSTART;TZID=Mars/Olympus:20250101T100000\nEND:VEVENT\nEND:VCALENDAR\n"
+	got, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2025, 1, 1, 10, 0, 0, 0, time.Local)
+	if len(got) != 2 || !got[0].Start.Equal(want) || !got[1].Start.Equal(want) {
+		t.Fatalf("events %+v, want both at %v", got, want)
+	}
+}
+
+func TestParseNotCalendar(t *testing.T) {
+	for _, doc := range []string{"", "hello\n", "BEGIN:VCARD\nEND:VCARD\n"} {
+		if _, err := Parse(strings.NewReader(doc)); err == nil {
+			t.Errorf("Parse(%q): no error", doc)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"PT1H30M", 90 * time.Minute},
+		{"P1D", 24 * time.Hour},
+		{"P1W", 7 * 24 * time.Hour},
+		{"P1DT2H", 26 * time.Hour},
+		{"PT45S", 45 * time.Second},
+		{"-PT15M", -15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got, err := parseDuration(tt.in); err != nil || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"1H", "PH", "P1H", "P1X"} {
+		if _, err := parseDuration(bad); err == nil {
+			t.Errorf("parseDuration(%q): no error", bad)
+		}
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	events := []Event{
+		{
+			UID:         "w1@garmr",
+			Start:       utc("2025-06-01T05:00:00Z"),
+			End:         utc("2025-06-01T06:15:00Z"),
+			Summary:     "Tempo; 3×2 km, rest 2′ — " + strings.Repeat("ü", 40),
+			Description: "line one\nline two, with a back\\slash",
+		},
+		{UID: "w2@garmr", Start: utc("2025-06-02T00:00:00Z"), AllDay: true, Summary: "Rest"},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, "Plan, 2025", events); err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(l) > maxLineOctets {
+			t.Errorf("line of %d octets: %q", len(l), l)
+		}
+	}
+	got, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d events", len(got))
+	}
+	if g := got[0]; g.Summary != events[0].Summary || g.Description != events[0].Description ||
+		!g.Start.Equal(events[0].Start) || !g.End.Equal(events[0].End) {
+		t.Errorf("timed event %+v", g)
+	}
+	// an all-day event without an end lasts the day
+	if g := got[1]; !g.AllDay || !g.Start.Equal(events[1].Start) || !g.End.Equal(events[1].Start.AddDate(0, 0, 1)) {
+		t.Errorf("all-day event %+v", g)
+	}
+}
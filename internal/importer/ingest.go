@@ -17,63 +17,105 @@ import (
 
 var ErrDuplicate = errors.New("duplicate activity")
 
-func IngestFile(db *store.DB, rawStore, src string) error {
-	if _, err := os.Stat(src); err != nil { return err }
+// copyToRawStore copies src into today's directory of the raw store and
+// returns the copy's path. The Add functions hash the copy.
+func copyToRawStore(rawStore, src string) (string, error) {
+	if _, err := os.Stat(src); err != nil { return "", err }
 
-	if err := os.MkdirAll(rawStore, 0o755); err != nil { return err }
 	day := time.Now().Format("2006/01/02")
 	dstDir := filepath.Join(rawStore, day)
-	if err := os.MkdirAll(dstDir, 0o755); err != nil { return err }
+	if err := os.MkdirAll(dstDir, 0o755); err != nil { return "", err }
 
 	srcF, err := os.Open(src)
-	if err != nil { return err }
+	if err != nil { return "", err }
 	defer srcF.Close()
 
-	h := sha1.New()
-	tee := io.TeeReader(srcF, h)
-
 	dstPath := filepath.Join(dstDir, filepath.Base(src))
 	dstF, err := os.Create(dstPath)
-	if err != nil { return err }
-	if _, err := io.Copy(dstF, tee); err != nil { dstF.Close(); return err }
+	if err != nil { return "", err }
+	if _, err := io.Copy(dstF, srcF); err != nil { dstF.Close(); return "", err }
 	dstF.Close()
-	hash := hex.EncodeToString(h.Sum(nil))
+	return dstPath, nil
+}
+
+// IngestFile copies src into the raw store and imports it as an activity of
+// userID, returning the new activity ID.
+func IngestFile(db *store.DB, rawStore, src string, userID int64) (int64, error) {
+	dstPath, err := copyToRawStore(rawStore, src)
+	if err != nil {
+		return 0, err
+	}
+	return AddActivity(db, dstPath, userID)
+}
 
-	act, recs, laps, zones, err := fitx.ParseFIT(dstPath)
-	if err != nil { return err }
+// AddActivity parses an activity file that is already in the raw store and
+// stores it with its records, laps, devices and the rest for userID,
+// returning the new activity ID. A file userID imported before returns
+// ErrDuplicate.
+func AddActivity(db *store.DB, rawPath string, userID int64) (int64, error) {
+	data, err := os.ReadFile(rawPath)
+	if err != nil {
+		return 0, err
+	}
+	// hashed here rather than by the caller, so that uploads and scans of
+	// the same file match
+	sum := sha1.Sum(data)
+	hash := hex.EncodeToString(sum[:])
+	act, recs, laps, zones, err := fitx.ParseFIT(rawPath)
+	if err != nil {
+		return 0, err
+	}
 
-	return db.WithTx(func(tx *sql.Tx) error {
+	var id int64
+	err = db.WithTx(func(tx *sql.Tx) error {
 		if act.FitUID != "" {
-			if _, err := db.LookupActivityByUID(tx, act.FitUID); err == nil {
-				importlog.Printf("importer: skip duplicate (uid) %s", src)
+			if _, err := db.LookupActivityByUID(tx, userID, act.FitUID); err == nil {
+				importlog.Printf("importer: skip duplicate (uid) %s", rawPath)
 				return ErrDuplicate
 			}
 		}
-		if _, err := db.LookupActivityByHash(tx, hash); err == nil {
-			importlog.Printf("importer: skip duplicate (hash) %s", src)
+		if _, err := db.LookupActivityByHash(tx, userID, hash); err == nil {
+			importlog.Printf("importer: skip duplicate (hash) %s", rawPath)
 			return ErrDuplicate
 		}
 
-		id, err := db.InsertActivity(tx, act, dstPath, hash)
-		if err != nil { return err }
-		if err := db.InsertRecords(tx, id, recs); err != nil { return err }
-		if err := db.InsertLaps(tx, id, laps); err != nil { return err }
-
-		// Insert HR zones if available
+		id, err = db.InsertActivity(tx, userID, act, rawPath, hash)
+		if err != nil {
+			return err
+		}
+		if err := db.InsertRecords(tx, id, recs); err != nil {
+			return err
+		}
+		if err := db.InsertLaps(tx, id, laps); err != nil {
+			return err
+		}
+		if err := db.InsertActivityDevices(tx, userID, id, act.StartTimeUTC, act.Devices); err != nil {
+			return err
+		}
+		if err := db.InsertSwim(tx, id, act); err != nil {
+			return err
+		}
+		if err := db.InsertDevFields(tx, id, act); err != nil {
+			return err
+		}
+		if err := db.InsertTimer(tx, id, act); err != nil {
+			return err
+		}
 		if len(zones) > 0 {
-			var storeZones []store.HRZone
+			storeZones := make([]store.HRZone, 0, len(zones))
 			for _, z := range zones {
-				storeZones = append(storeZones, store.HRZone{
-					Zone:        z.Zone,
-					TimeSeconds: z.TimeSeconds,
-				})
+				storeZones = append(storeZones, store.HRZone{Zone: z.Zone, TimeSeconds: z.TimeSeconds})
+			}
+			if err := db.InsertHRZones(tx, id, storeZones); err != nil {
+				return err
 			}
-			if err := db.InsertHRZones(tx, id, storeZones); err != nil { return err }
+		}
+		if err := db.UpsertDailyAgg(tx, act.StartTimeUTC, act); err != nil {
+			return err
 		}
 
-		if err := db.UpsertDailyAgg(tx, act.StartTimeUTC, act); err != nil { return err }
-
-		importlog.Printf("importer: imported id=%d from %s (%s %dm %ds)", id, src, act.Sport, act.DistanceM, act.DurationS)
+		importlog.Printf("importer: imported id=%d from %s (%s %dm %ds)", id, rawPath, act.Sport, act.DistanceM, act.DurationS)
 		return nil
 	})
+	return id, err
 }
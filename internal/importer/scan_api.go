@@ -6,29 +6,59 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"garmr/internal/importlog"
+	"garmr/internal/metrics"
+	"garmr/internal/mount"
+	"garmr/internal/webhook"
 )
 
 // ScanSummary is returned to the web UI after a manual import.
 type ScanSummary struct {
 	Roots      []string `json:"roots"`
+	Devices    []string `json:"devices"` // watches recognised by their GarminDevice.xml
 	Dirs       []string `json:"dirs"`
 	FoundFiles int      `json:"found_files"`
 	Imported   int      `json:"imported"`
+	Wellness   int      `json:"wellness"` // monitoring, sleep, HRV and metrics files
 	Duplicates int      `json:"duplicates"`
 	Errors     []string `json:"errors"`
 }
 
-// ScanOnce scans the configured Garmin activity directories once and ingests any .fit files.
-// It’s designed to be called by the /api/import handler.
-func (im *Importer) ScanOnce() (ScanSummary, error) {
+// ScanOnce scans the configured Garmin activity directories once and ingests any .fit files
+// as activities of userID. It’s designed to be called by the /api/import handler.
+func (im *Importer) ScanOnce(userID int64) (ScanSummary, error) {
 	sum := ScanSummary{
 		Roots: im.c.SearchRoots,
 	}
 
 	// 1) Resolve candidate directories
 	var dirs []string
+	remove := map[string]bool{} // dirs whose imported files are deleted
+
+	// Watches say what they are and where their files are in GarminDevice.xml;
+	// each has its own choice of folders
+	for _, w := range mount.FindWatches(im.c.SearchRoots) {
+		dev, err := im.db.RegisterWatch(userID, w)
+		if err != nil {
+			importlog.Printf("import: %v", err)
+			continue
+		}
+		sum.Devices = append(sum.Devices, w.Model)
+		importlog.Printf("import: %s connected at %s (software %s)", w.Name(), w.Root, w.Software)
+		for _, f := range w.Folders {
+			if !dev.Pulls(f.Path, f.Default()) {
+				continue
+			}
+			d := w.Dir(f)
+			if st, err := os.Stat(d); err == nil && st.IsDir() {
+				dirs = append(dirs, d)
+				remove[d] = dev.ImportRemove
+			}
+		}
+	}
+
 	// Use explicit GarminDirs if provided
 	for _, d := range im.c.GarminDirs {
 		if d == "" {
@@ -40,7 +70,7 @@ func (im *Importer) ScanOnce() (ScanSummary, error) {
 	}
 
 	// If none configured/found, try some common defaults under the search roots
-	if len(dirs) == 0 {
+	if len(dirs) == 0 && len(sum.Devices) == 0 {
 		for _, root := range im.c.SearchRoots {
 			if root == "" {
 				continue
@@ -71,12 +101,16 @@ func (im *Importer) ScanOnce() (ScanSummary, error) {
 
 	// 2) Find .fit files (case-insensitive)
 	var files []string
+	removeFiles := map[string]bool{}
 	pats := []string{"*.fit", "*.FIT", "*.Fit"}
 	for _, d := range dirs {
 		for _, p := range pats {
 			glob := filepath.Join(d, p)
 			if matches, _ := filepath.Glob(glob); len(matches) > 0 {
 				files = append(files, matches...)
+				for _, m := range matches {
+					removeFiles[m] = remove[d]
+				}
 			}
 		}
 	}
@@ -87,21 +121,81 @@ func (im *Importer) ScanOnce() (ScanSummary, error) {
 	}
 
 	// 3) Ingest files
+	im.ingestFiles(userID, files, "scan", &sum, removeFiles)
+	return sum, nil
+}
+
+// ImportFiles ingests the given FIT files (e.g. from the command line) and
+// reports the outcome like ScanOnce.
+func (im *Importer) ImportFiles(userID int64, files []string, source string) ScanSummary {
+	sum := ScanSummary{FoundFiles: len(files)}
+	im.ingestFiles(userID, files, source, &sum, nil)
+	return sum
+}
+
+// ingestFiles imports files, deleting those marked in remove once they are
+// in the database.
+func (im *Importer) ingestFiles(userID int64, files []string, source string, sum *ScanSummary, remove map[string]bool) {
 	for _, f := range files {
-		if err := IngestFile(im.db, im.c.RawStore, f); err != nil {
+		started := time.Now()
+		if IsWellnessFile(f) {
+			im.ingestWellness(userID, f, source, sum, remove)
+			continue
+		}
+		id, err := IngestFile(im.db, im.c.RawStore, f, userID)
+		if err != nil {
 			// Check for duplicate error
 			if errors.Is(err, ErrDuplicate) {
+				metrics.ObserveImport(source, metrics.OutcomeDuplicate, time.Since(started))
 				sum.Duplicates++
 				importlog.Printf("ingest: %s -> duplicate (skipped)", f)
+				removeImported(f, remove)
 				continue
 			}
+			metrics.ObserveImport(source, metrics.OutcomeFailed, time.Since(started))
 			sum.Errors = append(sum.Errors, fmt.Sprintf("%s: %v", f, err))
 			importlog.Printf("ingest: %s -> ERROR: %v", f, err)
+			im.hooks.Emit(webhook.EventImportFailed, webhook.ImportFailedData{File: filepath.Base(f), Source: source, Error: err.Error()})
 			continue
 		}
+		metrics.ObserveImport(source, metrics.OutcomeImported, time.Since(started))
 		sum.Imported++
 		importlog.Printf("ingest: %s -> imported", f)
+		removeImported(f, remove)
+		if a, err := im.db.GetActivity(userID, id); err == nil {
+			im.hooks.Emit(webhook.EventActivityCreated, webhook.NewActivityData(a, source, filepath.Base(f)))
+		}
 	}
+}
 
-	return sum, nil
+func (im *Importer) ingestWellness(userID int64, f, source string, sum *ScanSummary, remove map[string]bool) {
+	started := time.Now()
+	err := IngestWellness(im.db, im.c.RawStore, f, userID)
+	switch {
+	case errors.Is(err, ErrDuplicate):
+		metrics.ObserveImport(source, metrics.OutcomeDuplicate, time.Since(started))
+		sum.Duplicates++
+		importlog.Printf("ingest: %s -> duplicate (skipped)", f)
+	case err != nil:
+		metrics.ObserveImport(source, metrics.OutcomeFailed, time.Since(started))
+		sum.Errors = append(sum.Errors, fmt.Sprintf("%s: %v", f, err))
+		importlog.Printf("ingest: %s -> ERROR: %v", f, err)
+		return
+	default:
+		metrics.ObserveImport(source, metrics.OutcomeImported, time.Since(started))
+		sum.Wellness++
+		importlog.Printf("ingest: %s -> wellness", f)
+	}
+	removeImported(f, remove)
+}
+
+func removeImported(f string, remove map[string]bool) {
+	if !remove[f] {
+		return
+	}
+	if err := os.Remove(f); err != nil {
+		importlog.Printf("ingest: remove %s: %v", f, err)
+		return
+	}
+	importlog.Printf("ingest: removed %s from the device", f)
 }
@@ -7,15 +7,18 @@ import (
 	"garmr/internal/cfg"
 	"garmr/internal/importlog"
 	"garmr/internal/store"
+	"garmr/internal/webhook"
 )
 
 type Importer struct {
-	c  cfg.Config
-	db *store.DB
+	c     cfg.Config
+	db    *store.DB
+	hooks *webhook.Dispatcher
 }
 
-func New(c cfg.Config, db *store.DB) *Importer {
-	return &Importer{c: c, db: db}
+// New returns an importer; hooks may be nil to disable webhook events.
+func New(c cfg.Config, db *store.DB, hooks *webhook.Dispatcher) *Importer {
+	return &Importer{c: c, db: db, hooks: hooks}
 }
 
 func (im *Importer) Run(ctx context.Context) {
@@ -33,7 +36,13 @@ func (im *Importer) Run(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-t.C:
-			_, _ = im.ScanOnce()
+			// nobody is signed in at the device; files go to the primary account
+			userID, err := im.db.PrimaryUserID()
+			if err != nil {
+				importlog.Printf("importer: no account to import into: %v", err)
+				continue
+			}
+			_, _ = im.ScanOnce(userID)
 		}
 	}
 }
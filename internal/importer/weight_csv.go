@@ -0,0 +1,190 @@
+package importer
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"garmr/internal/store"
+)
+
+const kgPerLb = 0.45359237
+
+// ParseWeightCSV reads weight measurements from a CSV file with a header
+// row, as exported by Garmin Connect, scales' apps or a spreadsheet. It
+// recognises columns by name: date and time (one column or two), weight,
+// body fat, water, muscle and bone mass (kg, or lb if the header or the
+// value says so) and BMI. Times without a zone are in loc.
+func ParseWeightCSV(r io.Reader, loc *time.Location) ([]store.Weight, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("csv: %w", err)
+	}
+	col := map[string]int{}
+	lbs := map[string]bool{}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		var name string
+		switch {
+		case strings.Contains(h, "date") || h == "timestamp":
+			name = "date"
+		case h == "time":
+			name = "time"
+		case strings.Contains(h, "change") || strings.Contains(h, "visceral"):
+			continue
+		case strings.Contains(h, "weight"):
+			name = "weight"
+		case strings.Contains(h, "fat"):
+			name = "fat"
+		case strings.Contains(h, "water") || strings.Contains(h, "hydration"):
+			name = "water"
+		case strings.Contains(h, "muscle"):
+			name = "muscle"
+		case strings.Contains(h, "bone"):
+			name = "bone"
+		case strings.Contains(h, "bmi"):
+			name = "bmi"
+		default:
+			continue
+		}
+		if _, dup := col[name]; !dup {
+			col[name] = i
+			lbs[name] = strings.Contains(h, "lb")
+		}
+	}
+	if _, ok := col["date"]; !ok {
+		return nil, errors.New("csv: no date column")
+	}
+	if _, ok := col["weight"]; !ok {
+		return nil, errors.New("csv: no weight column")
+	}
+
+	var res []store.Weight
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv: %w", err)
+		}
+		field := func(name string) string {
+			if i, ok := col[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		if field("weight") == "" {
+			continue // e.g. a day without a weigh-in
+		}
+		when := field("date")
+		if t := field("time"); t != "" {
+			when += " " + t
+		}
+		at, err := parseCSVTime(when, loc)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		w := store.Weight{MeasuredAt: at, Source: "csv"}
+		mass := func(name string) (float64, bool, error) {
+			s := field(name)
+			if s == "" || s == "--" {
+				return 0, false, nil
+			}
+			lb := lbs[name]
+			if v, ok := strings.CutSuffix(s, "lbs"); ok {
+				s, lb = v, true
+			} else if v, ok := strings.CutSuffix(s, "lb"); ok {
+				s, lb = v, true
+			}
+			f, err := parseCSVNumber(strings.TrimSuffix(s, "kg"))
+			if err != nil {
+				return 0, false, fmt.Errorf("line %d: %s: %w", line, name, err)
+			}
+			if lb {
+				f = math.Round(f*kgPerLb*100) / 100
+			}
+			return f, true, nil
+		}
+		number := func(name string) (float64, bool, error) {
+			s := strings.TrimSuffix(field(name), "%")
+			if s == "" || s == "--" {
+				return 0, false, nil
+			}
+			f, err := parseCSVNumber(s)
+			if err != nil {
+				return 0, false, fmt.Errorf("line %d: %s: %w", line, name, err)
+			}
+			return f, true, nil
+		}
+		kg, _, err := mass("weight")
+		if err != nil {
+			return nil, err
+		}
+		if kg <= 0 || kg > 500 {
+			return nil, fmt.Errorf("line %d: weight %.1f kg is out of range", line, kg)
+		}
+		w.WeightKg = kg
+		for _, f := range []struct {
+			name  string
+			dst   *sql.NullFloat64
+			parse func(string) (float64, bool, error)
+		}{
+			{"fat", &w.FatPct, number}, {"water", &w.WaterPct, number},
+			{"muscle", &w.MuscleKg, mass}, {"bone", &w.BoneKg, mass}, {"bmi", &w.BMI, number},
+		} {
+			v, ok, err := f.parse(f.name)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				f.dst.Float64, f.dst.Valid = v, true
+			}
+		}
+		res = append(res, w)
+	}
+}
+
+func parseCSVNumber(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, ".") {
+		s = strings.Replace(s, ",", ".", 1) // decimal comma
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+var csvTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 3:04 PM",
+	"2006-01-02",
+	"Jan 2, 2006 15:04",
+	"Jan 2, 2006 3:04 PM",
+	"Jan 2, 2006",
+	"2 Jan 2006 15:04",
+	"2 Jan 2006",
+	"02.01.2006 15:04",
+	"02.01.2006",
+}
+
+func parseCSVTime(s string, loc *time.Location) (time.Time, error) {
+	s = strings.Join(strings.Fields(s), " ")
+	for _, layout := range csvTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse date %q", s)
+}
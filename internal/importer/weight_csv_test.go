@@ -0,0 +1,161 @@
+package importer
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"garmr/internal/store"
+)
+
+func TestParseWeightCSV(t *testing.T) {
+	valid := func(v float64) sql.NullFloat64 { return sql.NullFloat64{Float64: v, Valid: true} }
+	tests := []struct {
+		name string
+		csv  string
+		want []store.Weight
+	}{
+		{
+			// units in the values, "--" for missing ones, and the change and
+			// visceral fat columns left out
+			name: "Garmin Connect export",
+			csv: "Date,Weight,Change,BMI,Visceral Fat,Body Fat,Skeletal Muscle Mass,Bone Mass,Body Water\n" +
+				"2025-03-02 07:30,158.7 lbs,-0.4 lbs,22.1,8,18.5 %,65.0 lbs,7.1 lbs,55.2 %\n" +
+				"2025-03-01 07:10,72.5 kg,--,--,--,--,--,--,--\n",
+			want: []store.Weight{
+				{MeasuredAt: time.Date(2025, 3, 2, 7, 30, 0, 0, time.UTC), WeightKg: 71.99, BMI: valid(22.1),
+					FatPct: valid(18.5), MuscleKg: valid(29.48), BoneKg: valid(3.22), WaterPct: valid(55.2)},
+				{MeasuredAt: time.Date(2025, 3, 1, 7, 10, 0, 0, time.UTC), WeightKg: 72.5},
+			},
+		},
+		{
+			name: "pounds in the header",
+			csv:  "date,Weight (lb),Muscle Mass (lb),Fat %\n2025-03-01,160,100,20\n",
+			want: []store.Weight{
+				{MeasuredAt: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), WeightKg: 72.57, MuscleKg: valid(45.36), FatPct: valid(20)},
+			},
+		},
+		{
+			// a spreadsheet: byte order mark, date and time apart, decimal
+			// commas, and a day without a weigh-in
+			name: "spreadsheet",
+			csv:  "\ufeffDatum / Date,Time,Weight kg,Hydration\n02.03.2025,6:05,\"71,8\",\"56,1\"\n03.03.2025,,,\n",
+			want: []store.Weight{
+				{MeasuredAt: time.Date(2025, 3, 2, 6, 5, 0, 0, time.UTC), WeightKg: 71.8, WaterPct: valid(56.1)},
+			},
+		},
+		{
+			name: "first of two weight columns",
+			csv:  "Timestamp,Weight,Weight (lb)\n2025-03-01T08:00:00Z,70,154.3\n",
+			want: []store.Weight{{MeasuredAt: time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC), WeightKg: 70}},
+		},
+		{
+			// both rows are kept; the store keeps the last one per time
+			name: "duplicate dates",
+			csv:  "Date,Weight\n\"Mar 1, 2025\",70\n2025-03-01,70.4\n",
+			want: []store.Weight{
+				{MeasuredAt: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), WeightKg: 70},
+				{MeasuredAt: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), WeightKg: 70.4},
+			},
+		},
+		{name: "header only", csv: "Date,Weight\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWeightCSV(strings.NewReader(tt.csv), time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d weights %+v, want %d", len(got), got, len(tt.want))
+			}
+			for i, w := range tt.want {
+				w.Source = "csv"
+				if g := got[i]; !g.MeasuredAt.Equal(w.MeasuredAt) || g.WeightKg != w.WeightKg || g.FatPct != w.FatPct ||
+					g.WaterPct != w.WaterPct || g.MuscleKg != w.MuscleKg || g.BoneKg != w.BoneKg || g.BMI != w.BMI || g.Source != w.Source {
+					t.Errorf("weight %d = %+v\nwant %+v", i, g, w)
+				}
+			}
+		})
+	}
+}
+
+func TestParseWeightCSVLocation(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseWeightCSV(strings.NewReader("Date,Weight\n2025-07-01 07:30,70\n2025-07-01T07:30:00Z,70\n"), loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// times without a zone are local, the others keep theirs
+	if !got[0].MeasuredAt.Equal(time.Date(2025, 7, 1, 5, 30, 0, 0, time.UTC)) ||
+		!got[1].MeasuredAt.Equal(time.Date(2025, 7, 1, 7, 30, 0, 0, time.UTC)) {
+		t.Fatalf("times %v, %v", got[0].MeasuredAt, got[1].MeasuredAt)
+	}
+}
+
+func TestParseWeightCSVErrors(t *testing.T) {
+	tests := []struct {
+		name, csv, wantErr string
+	}{
+		{"empty", "", "csv: EOF"},
+		{"no date column", "Weight,Fat\n70,20\n", "no date column"},
+		{"no weight column", "Date,Body Fat\n2025-03-01,20\n", "no weight column"},
+		{"bad date", "Date,Weight\n2025-03-01,70\nyesterday,70\n", `line 3: cannot parse date "yesterday"`},
+		{"bad weight", "Date,Weight\n2025-03-01,seventy\n", "line 2: weight:"},
+		{"weight out of range", "Date,Weight (lb)\n2025-03-01,1200\n", "line 2: weight 544.3 kg is out of range"},
+		{"zero weight", "Date,Weight\n2025-03-01,0\n", "out of range"},
+		{"bad body fat", "Date,Weight,Body Fat\n2025-03-01,70,high\n", "line 2: fat:"},
+		{"bad bone mass", "Date,Weight,Bone Mass\n2025-03-01,70,3.1 stone\n", "line 2: bone:"},
+		{"broken quoting", "Date,Weight\n2025-03-01,\"70\n", "csv:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseWeightCSV(strings.NewReader(tt.csv), time.UTC)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWeightCSVReimport(t *testing.T) {
+	db, err := store.Open(filepath.Join(t.TempDir(), "garmr.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := store.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	uid, err := db.CreateUser("alice", "password123", store.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csv := "Date,Weight\n2025-03-01 07:00,70\n2025-03-02 07:00,70.2\n2025-03-01 07:00,70.4\n"
+	for range 2 {
+		ws, err := ParseWeightCSV(strings.NewReader(csv), time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AddWeights(uid, ws); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := db.ListWeights(uid, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kg := map[string]float64{}
+	for _, w := range got {
+		kg[w.MeasuredAt.UTC().Format(time.DateOnly)] = w.WeightKg
+	}
+	if len(got) != 2 || kg["2025-03-01"] != 70.4 || kg["2025-03-02"] != 70.2 {
+		t.Fatalf("weights %+v, want one per time with the last value", got)
+	}
+}
@@ -0,0 +1,75 @@
+package importer
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"os"
+
+	"garmr/internal/fitx"
+	"garmr/internal/importlog"
+	"garmr/internal/store"
+)
+
+// IsWellnessFile reports whether path is a monitoring, sleep, HRV status or
+// metrics file rather than an activity.
+func IsWellnessFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	t, err := fitx.FileType(f)
+	return err == nil && fitx.IsWellness(t)
+}
+
+// IngestWellness copies a wellness file into the raw store and adds it to
+// userID's wellness days.
+func IngestWellness(db *store.DB, rawStore, src string, userID int64) error {
+	dstPath, err := copyToRawStore(rawStore, src)
+	if err != nil {
+		return err
+	}
+	return AddWellness(db, dstPath, userID)
+}
+
+// AddWellness parses a wellness file that is already in the raw store and
+// merges its days into userID's wellness data. A file imported before
+// returns ErrDuplicate.
+func AddWellness(db *store.DB, rawPath string, userID int64) error {
+	data, err := os.ReadFile(rawPath)
+	if err != nil {
+		return err
+	}
+	// hashed here rather than by the caller, so that uploads and scans of
+	// the same file match
+	sum := sha1.Sum(data)
+	hash := hex.EncodeToString(sum[:])
+	w, err := fitx.ParseWellness(rawPath)
+	if err != nil {
+		return err
+	}
+	err = db.WithTx(func(tx *sql.Tx) error {
+		dup, err := db.HasWellnessFile(tx, userID, hash)
+		if err != nil {
+			return err
+		}
+		if dup {
+			return ErrDuplicate
+		}
+		return db.InsertWellness(tx, userID, w, rawPath, hash)
+	})
+	if err != nil {
+		return err
+	}
+	if w.FileType == fitx.FileTypeWeight {
+		importlog.Printf("importer: weight file from %s (%d measurements)", rawPath, len(w.Weights))
+		return nil
+	}
+	var first, last string
+	if len(w.Days) > 0 {
+		first, last = w.Days[0].Day, w.Days[len(w.Days)-1].Day
+	}
+	importlog.Printf("importer: wellness file type %d from %s (%d days %s..%s)", w.FileType, rawPath, len(w.Days), first, last)
+	return nil
+}
@@ -57,6 +57,13 @@ func Subscribe() chan string {
 	return ch
 }
 
+// Subscribers returns the number of live subscribers (open SSE streams).
+func Subscribers() int {
+	mu.Lock()
+	defer mu.Unlock()
+	return len(subs)
+}
+
 func Unsubscribe(ch chan string) {
 	mu.Lock()
 	delete(subs, ch)
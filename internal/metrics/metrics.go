@@ -0,0 +1,198 @@
+// Package metrics keeps process-wide counters and histograms and renders
+// them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Import outcomes used as the "outcome" label.
+const (
+	OutcomeImported  = "imported"
+	OutcomeDuplicate = "duplicate"
+	OutcomeFailed    = "failed"
+)
+
+var (
+	importBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	httpBuckets   = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	imports = newCounter("garmr_imports_total",
+		"FIT files processed by the importer.", "source", "outcome")
+	importDuration = newHistogram("garmr_import_duration_seconds",
+		"Time spent importing one FIT file.", importBuckets, "source", "outcome")
+	httpDuration = newHistogram("garmr_http_request_duration_seconds",
+		"HTTP request latency by route pattern.", httpBuckets, "route", "method", "code")
+	webhookDeliveries = newCounter("garmr_webhook_deliveries_total",
+		"Webhook delivery attempts.", "outcome")
+)
+
+// ObserveImport records one imported, duplicate or failed file.
+func ObserveImport(source, outcome string, d time.Duration) {
+	imports.inc(source, outcome)
+	importDuration.observe(d.Seconds(), source, outcome)
+}
+
+// ObserveHTTP records a served request.
+func ObserveHTTP(route, method string, code int, d time.Duration) {
+	httpDuration.observe(d.Seconds(), route, method, strconv.Itoa(code))
+}
+
+// ObserveWebhook records a webhook delivery attempt.
+func ObserveWebhook(delivered bool) {
+	if delivered {
+		webhookDeliveries.inc("delivered")
+	} else {
+		webhookDeliveries.inc("failed")
+	}
+}
+
+// Gauge is a value sampled at scrape time.
+type Gauge struct {
+	Name  string
+	Help  string
+	Value float64
+}
+
+// Write renders all metrics plus the given gauges.
+func Write(w io.Writer, gauges []Gauge) error {
+	var b strings.Builder
+	for _, g := range gauges {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.Name, g.Help, g.Name, g.Name, formatFloat(g.Value))
+	}
+	imports.write(&b)
+	webhookDeliveries.write(&b)
+	importDuration.write(&b)
+	httpDuration.write(&b)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type counter struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	vals       map[string]float64
+}
+
+func newCounter(name, help string, labels ...string) *counter {
+	return &counter{name: name, help: help, labels: labels, vals: map[string]float64{}}
+}
+
+func (c *counter) inc(values ...string) {
+	k := strings.Join(values, "\xff")
+	c.mu.Lock()
+	c.vals[k]++
+	c.mu.Unlock()
+}
+
+func (c *counter) write(b *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, k := range sortedKeys(c.vals) {
+		fmt.Fprintf(b, "%s{%s} %s\n", c.name, labelPairs(c.labels, k, ""), formatFloat(c.vals[k]))
+	}
+}
+
+type series struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+type histogram struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+	mu         sync.Mutex
+	series     map[string]*series
+}
+
+func newHistogram(name, help string, buckets []float64, labels ...string) *histogram {
+	return &histogram{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*series{}}
+}
+
+func (h *histogram) observe(v float64, values ...string) {
+	k := strings.Join(values, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[k]
+	if s == nil {
+		s = &series{counts: make([]uint64, len(h.buckets))}
+		h.series[k] = s
+	}
+	for i, ub := range h.buckets {
+		if v <= ub {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *histogram) write(b *strings.Builder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.series[k]
+		var cum uint64
+		for i, ub := range h.buckets {
+			cum += s.counts[i]
+			fmt.Fprintf(b, "%s_bucket{%s} %d\n", h.name, labelPairs(h.labels, k, formatFloat(ub)), cum)
+		}
+		fmt.Fprintf(b, "%s_bucket{%s} %d\n", h.name, labelPairs(h.labels, k, "+Inf"), s.count)
+		fmt.Fprintf(b, "%s_sum{%s} %s\n", h.name, labelPairs(h.labels, k, ""), formatFloat(s.sum))
+		fmt.Fprintf(b, "%s_count{%s} %d\n", h.name, labelPairs(h.labels, k, ""), s.count)
+	}
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelPairs renders name="value" pairs for a series key, appending
+// le="..." when le is set.
+func labelPairs(names []string, key, le string) string {
+	values := strings.Split(key, "\xff")
+	parts := make([]string, 0, len(names)+1)
+	for i, n := range names {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		parts = append(parts, n+`="`+labelEscaper.Replace(v)+`"`)
+	}
+	if le != "" {
+		parts = append(parts, `le="`+le+`"`)
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCounterText(t *testing.T) {
+	c := newCounter("test_total", "Things counted.", "route", "outcome")
+	c.inc("/b", "ok")
+	c.inc(`/a "quoted" \ path`+"\nnext", "ok")
+	c.inc("/b", "ok")
+	c.inc("/a", "failed")
+	var b strings.Builder
+	c.write(&b)
+	// series are sorted by their unescaped label values
+	want := `# HELP test_total Things counted.
+# TYPE test_total counter
+test_total{route="/a \"quoted\" \\ path\nnext",outcome="ok"} 1
+test_total{route="/a",outcome="failed"} 1
+test_total{route="/b",outcome="ok"} 2
+`
+	if b.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestHistogramText(t *testing.T) {
+	h := newHistogram("test_seconds", "Time taken.", []float64{0.1, 1, 2.5}, "code")
+	for _, v := range []float64{0.05, 0.1, 0.7, 30} {
+		h.observe(v, "500")
+	}
+	h.observe(2, "200")
+	var b strings.Builder
+	h.write(&b)
+	want := `# HELP test_seconds Time taken.
+# TYPE test_seconds histogram
+test_seconds_bucket{code="200",le="0.1"} 0
+test_seconds_bucket{code="200",le="1"} 0
+test_seconds_bucket{code="200",le="2.5"} 1
+test_seconds_bucket{code="200",le="+Inf"} 1
+test_seconds_sum{code="200"} 2
+test_seconds_count{code="200"} 1
+test_seconds_bucket{code="500",le="0.1"} 2
+test_seconds_bucket{code="500",le="1"} 3
+test_seconds_bucket{code="500",le="2.5"} 3
+test_seconds_bucket{code="500",le="+Inf"} 4
+test_seconds_sum{code="500"} 30.85
+test_seconds_count{code="500"} 4
+`
+	if b.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	ObserveImport("scan", OutcomeImported, 300*time.Millisecond)
+	ObserveHTTP("GET /activity/{id}", "GET", 200, 20*time.Millisecond)
+	ObserveWebhook(false)
+
+	var b strings.Builder
+	err := Write(&b, []Gauge{
+		{Name: "garmr_activities", Help: "Stored activities.", Value: 12},
+		{Name: "garmr_db_bytes", Help: "Size of the database file.", Value: 1.5e9},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	// the counts are process-wide, so only the series are checked
+	for _, line := range []string{
+		"\ngarmr_activities 12\n",
+		"\ngarmr_db_bytes 1.5e+09\n",
+		"\n" + `garmr_imports_total{source="scan",outcome="imported"} `,
+		"\n" + `garmr_webhook_deliveries_total{outcome="failed"} `,
+		"\n" + `garmr_import_duration_seconds_bucket{source="scan",outcome="imported",le="0.5"} `,
+		"\n" + `garmr_http_request_duration_seconds_count{route="GET /activity/{id}",method="GET",code="200"} `,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("missing %q in\n%s", line, out)
+		}
+	}
+
+	// gauges first, then the families in a fixed order, each with its
+	// HELP and TYPE once
+	var families []string
+	for _, l := range strings.Split(out, "\n") {
+		if name, ok := strings.CutPrefix(l, "# TYPE "); ok {
+			families = append(families, name)
+		}
+	}
+	want := []string{
+		"garmr_activities gauge",
+		"garmr_db_bytes gauge",
+		"garmr_imports_total counter",
+		"garmr_webhook_deliveries_total counter",
+		"garmr_import_duration_seconds histogram",
+		"garmr_http_request_duration_seconds histogram",
+	}
+	if strings.Join(families, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("families\n%s\nwant\n%s", strings.Join(families, "\n"), strings.Join(want, "\n"))
+	}
+}
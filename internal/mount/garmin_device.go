@@ -0,0 +1,208 @@
+package mount
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Watch is a Garmin device mounted as USB mass storage, identified by its
+// GARMIN/GarminDevice.xml.
+type Watch struct {
+	Root       string // mount point of the volume
+	Model      string // e.g. "Forerunner 965"
+	PartNumber string // e.g. "006-B4315-00"
+	UnitID     uint32 // the serial number in the device's FIT files
+	Software   string // e.g. "15.11"
+	Folders    []Folder
+}
+
+// Folder is a directory the device writes FIT files of one type to.
+type Folder struct {
+	Type int    // FIT file type, e.g. 4 for activities
+	Path string // relative to the volume, e.g. "GARMIN/Activity"
+	Ext  string // usually "FIT"
+}
+
+// Default reports whether the folder is imported unless the device's
+// settings say otherwise: activities, the wellness files (monitoring,
+// sleep, HRV status, metrics) and weight.
+func (f Folder) Default() bool {
+	switch f.Type {
+	case 4, 9, 15, 28, 32, 44, 49, 68:
+		return true
+	}
+	return false
+}
+
+// Label names the folder's file type.
+func (f Folder) Label() string {
+	if l, ok := fitTypeLabels[f.Type]; ok {
+		return l
+	}
+	return fmt.Sprintf("FIT type %d", f.Type)
+}
+
+var fitTypeLabels = map[int]string{
+	2:  "Settings",
+	3:  "Sports",
+	4:  "Activities",
+	5:  "Workouts",
+	6:  "Courses",
+	7:  "Schedules",
+	9:  "Weight",
+	10: "Totals",
+	11: "Goals",
+	14: "Blood pressure",
+	15: "Monitoring",
+	20: "Activity summaries",
+	28: "Daily monitoring",
+	32: "Monitoring",
+	34: "Segments",
+	35: "Segment lists",
+	40: "Data field settings",
+	44: "Metrics",
+	49: "Sleep",
+	68: "HRV status",
+}
+
+// Dir returns the folder's absolute path on the watch.
+func (w Watch) Dir(f Folder) string {
+	return filepath.Join(w.Root, filepath.FromSlash(f.Path))
+}
+
+// Name is how the watch is shown, e.g. "Forerunner 965 (3400000000)".
+func (w Watch) Name() string {
+	if w.UnitID == 0 {
+		return w.Model
+	}
+	return fmt.Sprintf("%s (%d)", w.Model, w.UnitID)
+}
+
+// garminDeviceXML mirrors the parts of GarminDevice.xml garmr uses.
+type garminDeviceXML struct {
+	Model struct {
+		PartNumber      string `xml:"PartNumber"`
+		SoftwareVersion string `xml:"SoftwareVersion"`
+		Description     string `xml:"Description"`
+	} `xml:"Model"`
+	ID              string `xml:"Id"`
+	DisplayName     string `xml:"DisplayName"`
+	MassStorageMode struct {
+		DataTypes []struct {
+			Name  string `xml:"Name"`
+			Files []struct {
+				Location struct {
+					Path          string `xml:"Path"`
+					FileExtension string `xml:"FileExtension"`
+				} `xml:"Location"`
+				TransferDirection string `xml:"TransferDirection"`
+			} `xml:"File"`
+		} `xml:"DataType"`
+	} `xml:"MassStorageMode"`
+}
+
+// ReadGarminDevice identifies the device mounted at root from its
+// GARMIN/GarminDevice.xml.
+func ReadGarminDevice(root string) (Watch, error) {
+	var data []byte
+	var err error
+	for _, dir := range []string{"GARMIN", "Garmin", "garmin"} {
+		data, err = os.ReadFile(filepath.Join(root, dir, "GarminDevice.xml"))
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return Watch{}, err
+	}
+	var doc garminDeviceXML
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return Watch{}, fmt.Errorf("%s: %w", root, err)
+	}
+
+	w := Watch{Root: root, PartNumber: strings.TrimSpace(doc.Model.PartNumber)}
+	w.Model = strings.TrimSpace(doc.Model.Description)
+	if w.Model == "" {
+		w.Model = strings.TrimSpace(doc.DisplayName)
+	}
+	if w.Model == "" {
+		w.Model = "Garmin device"
+	}
+	if id, err := strconv.ParseUint(strings.TrimSpace(doc.ID), 10, 32); err == nil {
+		w.UnitID = uint32(id)
+	}
+	if v, err := strconv.Atoi(strings.TrimSpace(doc.Model.SoftwareVersion)); err == nil && v > 0 {
+		w.Software = fmt.Sprintf("%d.%02d", v/100, v%100)
+	}
+
+	seen := map[string]bool{}
+	for _, dt := range doc.MassStorageMode.DataTypes {
+		typ, ok := strings.CutPrefix(strings.TrimSpace(dt.Name), "FIT_TYPE_")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(typ)
+		if err != nil {
+			continue
+		}
+		for _, f := range dt.Files {
+			dir := strings.TrimSpace(f.TransferDirection)
+			if dir != "OutputFromUnit" && dir != "InputOutput" {
+				continue
+			}
+			p := strings.Trim(strings.ReplaceAll(strings.TrimSpace(f.Location.Path), "\\", "/"), "/")
+			if p == "" || seen[p] {
+				continue
+			}
+			seen[p] = true
+			w.Folders = append(w.Folders, Folder{Type: n, Path: p, Ext: strings.TrimSpace(f.Location.FileExtension)})
+		}
+	}
+	return w, nil
+}
+
+// FindWatches looks for Garmin devices in roots: a root can be a volume
+// itself, a directory of volumes (/Volumes, /run/media) or a directory of
+// per-user volume directories (/media/USER).
+func FindWatches(roots []string) []Watch {
+	var watches []Watch
+	seen := map[string]bool{}
+	try := func(dir string) bool {
+		if seen[dir] {
+			return true
+		}
+		w, err := ReadGarminDevice(dir)
+		if err != nil {
+			return false
+		}
+		seen[dir] = true
+		watches = append(watches, w)
+		return true
+	}
+	for _, r := range roots {
+		if r == "" || try(r) {
+			continue
+		}
+		entries, _ := os.ReadDir(r)
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+			p := filepath.Join(r, e.Name())
+			if try(p) {
+				continue
+			}
+			sub, _ := os.ReadDir(p)
+			for _, s := range sub {
+				if s.IsDir() {
+					try(filepath.Join(p, s.Name()))
+				}
+			}
+		}
+	}
+	return watches
+}
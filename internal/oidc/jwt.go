@@ -0,0 +1,220 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// verify checks the ID token's signature and standard claims.
+func (c *Client) verify(ctx context.Context, raw, nonce string) (*Claims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("id_token: malformed")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("id_token header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("id_token: bad signature encoding")
+	}
+	key, err := c.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" {
+			return nil, fmt.Errorf("id_token: alg %q does not match RSA key", header.Alg)
+		}
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) != nil {
+			return nil, errors.New("id_token: bad signature")
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(sig) != 64 {
+			return nil, fmt.Errorf("id_token: alg %q does not match EC key", header.Alg)
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, digest[:], r, s) {
+			return nil, errors.New("id_token: bad signature")
+		}
+	default:
+		return nil, errors.New("oidc: unsupported key type")
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("id_token claims: %w", err)
+	}
+	cl := &Claims{Raw: claims}
+	cl.Issuer, cl.Subject = cl.String("iss"), cl.String("sub")
+	if strings.TrimRight(cl.Issuer, "/") != c.cfg.Issuer {
+		return nil, fmt.Errorf("id_token: issuer %q not trusted", cl.Issuer)
+	}
+	if cl.Subject == "" {
+		return nil, errors.New("id_token: no subject")
+	}
+	if !audienceHas(claims["aud"], c.cfg.ClientID) {
+		return nil, errors.New("id_token: not issued for this client")
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(c.clockSkew)) {
+		return nil, errors.New("id_token: expired")
+	}
+	if iat, ok := claims["iat"].(float64); ok && time.Unix(int64(iat), 0).After(now.Add(c.clockSkew)) {
+		return nil, errors.New("id_token: issued in the future")
+	}
+	if subtle.ConstantTimeCompare([]byte(cl.String("nonce")), []byte(nonce)) != 1 {
+		return nil, errors.New("id_token: nonce mismatch")
+	}
+	return cl, nil
+}
+
+func audienceHas(aud any, clientID string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == clientID
+	case []any:
+		for _, v := range a {
+			if s, _ := v.(string); s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// key returns the signing key for kid, refetching the JWKS if it is unknown
+// (the provider may have rotated keys). An empty kid matches a lone key.
+func (c *Client) key(ctx context.Context, kid string) (any, error) {
+	meta, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if k := lookupKey(c.keys, kid); k != nil {
+		return k, nil
+	}
+	if c.keys != nil && time.Since(c.keysAt) < keysMinAge {
+		return nil, fmt.Errorf("id_token: unknown key %q", kid)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	status, err := c.doJSON(req, &set)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("status %d", status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	keys := map[string]any{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := k.publicKey(); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+	c.keys, c.keysAt = keys, time.Now()
+	if k := lookupKey(keys, kid); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("id_token: unknown key %q", kid)
+}
+
+func lookupKey(keys map[string]any, kid string) any {
+	if k, ok := keys[kid]; ok {
+		return k
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, k := range keys {
+			return k
+		}
+	}
+	return nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	b := func(s string) (*big.Int, error) {
+		raw, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(raw), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := b(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("bad exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !pub.Curve.IsOnCurve(x, y) {
+			return nil, errors.New("point not on curve")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
@@ -0,0 +1,215 @@
+// Package oidc is a small OpenID Connect relying party: discovery, the
+// authorization code flow with PKCE, and ID token verification (RS256 and
+// ES256) against the provider's JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config describes the client registration at the provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+type discovery struct {
+	Issuer        string `json:"issuer"`
+	AuthEndpoint  string `json:"authorization_endpoint"`
+	TokenEndpoint string `json:"token_endpoint"`
+	JWKSURI       string `json:"jwks_uri"`
+}
+
+// Client talks to one provider. Discovery and keys are fetched on first use
+// and refreshed when they get stale or a token names an unknown key.
+type Client struct {
+	cfg  Config
+	http *http.Client
+
+	mu        sync.Mutex
+	meta      *discovery
+	metaAt    time.Time
+	keys      map[string]any // kid -> *rsa.PublicKey or *ecdsa.PublicKey
+	keysAt    time.Time
+	clockSkew time.Duration
+}
+
+const (
+	metaTTL = time.Hour
+	// keysMinAge keeps an unknown kid from refetching the JWKS every request.
+	keysMinAge = time.Minute
+)
+
+func New(cfg Config) *Client {
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	return &Client{
+		cfg:       cfg,
+		http:      &http.Client{Timeout: 10 * time.Second},
+		clockSkew: 2 * time.Minute,
+	}
+}
+
+// AuthRequest is what the caller keeps (in a cookie) between redirecting to
+// the provider and handling the callback.
+type AuthRequest struct {
+	State       string
+	Nonce       string
+	Verifier    string // PKCE code verifier
+	RedirectURL string
+}
+
+// NewAuthRequest generates fresh state, nonce and PKCE verifier for a
+// sign-in that returns to redirectURL.
+func NewAuthRequest(redirectURL string) (AuthRequest, error) {
+	ar := AuthRequest{RedirectURL: redirectURL}
+	for _, p := range []*string{&ar.State, &ar.Nonce, &ar.Verifier} {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return AuthRequest{}, err
+		}
+		*p = base64.RawURLEncoding.EncodeToString(buf)
+	}
+	return ar, nil
+}
+
+// AuthCodeURL returns the provider URL to send the browser to.
+func (c *Client) AuthCodeURL(ctx context.Context, ar AuthRequest) (string, error) {
+	meta, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(ar.Verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.cfg.ClientID},
+		"redirect_uri":          {ar.RedirectURL},
+		"scope":                 {strings.Join(c.cfg.Scopes, " ")},
+		"state":                 {ar.State},
+		"nonce":                 {ar.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthEndpoint + sep + q.Encode(), nil
+}
+
+// Claims are the verified ID token claims. Raw holds all of them so callers
+// can pick a configurable username claim.
+type Claims struct {
+	Issuer  string
+	Subject string
+	Raw     map[string]any
+}
+
+// String returns claim name as a string, or "" if it is missing or not one.
+func (c *Claims) String(name string) string {
+	s, _ := c.Raw[name].(string)
+	return s
+}
+
+// Exchange trades the authorization code for tokens and returns the verified
+// claims of the ID token.
+func (c *Client) Exchange(ctx context.Context, code string, ar AuthRequest) (*Claims, error) {
+	meta, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {ar.RedirectURL},
+		"code_verifier": {ar.Verifier},
+	}
+	if c.cfg.ClientSecret == "" {
+		form.Set("client_id", c.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	}
+	var tok struct {
+		IDToken   string `json:"id_token"`
+		Error     string `json:"error"`
+		ErrorDesc string `json:"error_description"`
+	}
+	status, err := c.doJSON(req, &tok)
+	if err != nil {
+		return nil, fmt.Errorf("token request: %w", err)
+	}
+	if status != http.StatusOK || tok.Error != "" {
+		return nil, fmt.Errorf("token request: %d %s %s", status, tok.Error, tok.ErrorDesc)
+	}
+	if tok.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	return c.verify(ctx, tok.IDToken, ar.Nonce)
+}
+
+func (c *Client) discover(ctx context.Context) (*discovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.meta != nil && time.Since(c.metaAt) < metaTTL {
+		return c.meta, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta discovery
+	status, err := c.doJSON(req, &meta)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("status %d", status)
+	}
+	if err != nil {
+		if c.meta != nil {
+			return c.meta, nil // keep using what we had
+		}
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if strings.TrimRight(meta.Issuer, "/") != c.cfg.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", meta.Issuer, c.cfg.Issuer)
+	}
+	if meta.AuthEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("discovery: missing endpoints")
+	}
+	c.meta, c.metaAt = &meta, time.Now()
+	return c.meta, nil
+}
+
+func (c *Client) doJSON(req *http.Request, v any) (int, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return resp.StatusCode, fmt.Errorf("decode response (status %d): %w", resp.StatusCode, err)
+	}
+	return resp.StatusCode, nil
+}
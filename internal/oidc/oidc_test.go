@@ -0,0 +1,228 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testIdP is a minimal provider: discovery, JWKS with one RSA key, and a
+// token endpoint that checks the client secret and the PKCE verifier.
+type testIdP struct {
+	srv  *httptest.Server
+	key  *rsa.PrivateKey
+	auth url.Values // query of the last authorization request
+
+	// issuer, if set, is advertised by discovery instead of the server URL.
+	issuer string
+
+	// claims and signer shape the next ID token; tests override them.
+	claims func(iss, nonce string) map[string]any
+	signer *rsa.PrivateKey
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdP{key: key, signer: key}
+	idp.claims = func(iss, nonce string) map[string]any {
+		now := time.Now()
+		return map[string]any{
+			"iss":   iss,
+			"sub":   "sub-alice",
+			"aud":   "garmr",
+			"exp":   now.Add(time.Hour).Unix(),
+			"iat":   now.Unix(),
+			"nonce": nonce,
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		iss := idp.issuer
+		if iss == "" {
+			iss = idp.srv.URL
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 iss,
+			"authorization_endpoint": idp.srv.URL + "/authorize",
+			"token_endpoint":         idp.srv.URL + "/token",
+			"jwks_uri":               idp.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		pub := idp.key.PublicKey
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   b64(pub.N.Bytes()),
+			"e":   b64(big.NewInt(int64(pub.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "garmr" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("code") != "code-1" || b64(sum[:]) != idp.auth.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		tok := idp.sign(t, idp.claims(idp.srv.URL, idp.auth.Get("nonce")))
+		json.NewEncoder(w).Encode(map[string]string{"id_token": tok})
+	})
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+func (idp *testIdP) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	seg := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b64(b)
+	}
+	signed := seg(map[string]string{"alg": "RS256", "kid": "k1"}) + "." + seg(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.signer, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + b64(sig)
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// login runs the authorization request against idp and exchanges the code.
+// tamper, if set, changes the auth request before the exchange.
+func (idp *testIdP) login(t *testing.T, c *Client, tamper func(*AuthRequest)) (*Claims, error) {
+	t.Helper()
+	ctx := context.Background()
+	ar, err := NewAuthRequest("https://garmr.example/login/oidc/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := c.AuthCodeURL(ctx, ar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Query().Get("code_challenge_method"); got != "S256" {
+		t.Fatalf("code_challenge_method = %q", got)
+	}
+	if got := u.Query().Get("state"); got != ar.State {
+		t.Fatalf("state = %q, want %q", got, ar.State)
+	}
+	idp.auth = u.Query()
+	if tamper != nil {
+		tamper(&ar)
+	}
+	return c.Exchange(ctx, "code-1", ar)
+}
+
+func TestExchange(t *testing.T) {
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		claims  func(c map[string]any)
+		signer  *rsa.PrivateKey
+		tamper  func(*AuthRequest)
+		wantErr string
+	}{
+		{name: "valid"},
+		{name: "audience list", claims: func(c map[string]any) { c["aud"] = []string{"other", "garmr"} }},
+		{name: "bad signature", signer: other, wantErr: "bad signature"},
+		{name: "wrong issuer", claims: func(c map[string]any) { c["iss"] = "https://evil.example" }, wantErr: "not trusted"},
+		{name: "wrong audience", claims: func(c map[string]any) { c["aud"] = "other" }, wantErr: "not issued for this client"},
+		{name: "expired", claims: func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, wantErr: "expired"},
+		{name: "missing exp", claims: func(c map[string]any) { delete(c, "exp") }, wantErr: "expired"},
+		{name: "issued in the future", claims: func(c map[string]any) { c["iat"] = time.Now().Add(time.Hour).Unix() }, wantErr: "in the future"},
+		{name: "wrong nonce", claims: func(c map[string]any) { c["nonce"] = "replayed" }, wantErr: "nonce mismatch"},
+		{name: "no subject", claims: func(c map[string]any) { delete(c, "sub") }, wantErr: "no subject"},
+		{name: "wrong PKCE verifier", tamper: func(ar *AuthRequest) { ar.Verifier = "guessed" }, wantErr: "invalid_grant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newTestIdP(t)
+			base := idp.claims
+			idp.claims = func(iss, nonce string) map[string]any {
+				c := base(iss, nonce)
+				if tt.claims != nil {
+					tt.claims(c)
+				}
+				return c
+			}
+			if tt.signer != nil {
+				idp.signer = tt.signer
+			}
+			c := New(Config{Issuer: idp.srv.URL + "/", ClientID: "garmr", ClientSecret: "s3cret", Scopes: []string{"openid"}})
+			cl, err := idp.login(t, c, tt.tamper)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cl.Issuer != idp.srv.URL || cl.Subject != "sub-alice" {
+				t.Fatalf("claims = %q %q", cl.Issuer, cl.Subject)
+			}
+		})
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := newTestIdP(t)
+	idp.issuer = "https://evil.example"
+	c := New(Config{Issuer: idp.srv.URL, ClientID: "garmr"})
+	if _, err := c.AuthCodeURL(context.Background(), AuthRequest{}); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestVerifyUnsupportedKeyType(t *testing.T) {
+	idp := newTestIdP(t)
+	c := New(Config{Issuer: idp.srv.URL, ClientID: "garmr"})
+	if _, err := c.discover(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.keys, c.keysAt = map[string]any{"k1": pub}, time.Now()
+	tok := idp.sign(t, idp.claims(idp.srv.URL, "n"))
+	if _, err := c.verify(context.Background(), tok, "n"); err == nil || !strings.Contains(err.Error(), "unsupported key type") {
+		t.Fatalf("err = %v", err)
+	}
+}
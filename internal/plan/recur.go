@@ -0,0 +1,96 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxRecurrenceWeeks caps how far a single recurrence rule may expand.
+const maxRecurrenceWeeks = 52
+
+// Recurrence describes a weekly rule such as "every Tue/Thu for 8 weeks".
+type Recurrence struct {
+	Weekdays []time.Weekday
+	Start    time.Time // first day considered (inclusive)
+	Weeks    int       // number of weeks to expand, counted from Start
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+	"sun": time.Sunday, "sunday": time.Sunday,
+}
+
+// ParseWeekday accepts short or long English weekday names (case-insensitive).
+func ParseWeekday(s string) (time.Weekday, error) {
+	d, ok := weekdayNames[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return 0, fmt.Errorf("unknown weekday %q", s)
+	}
+	return d, nil
+}
+
+// ParseWeekdays parses a list of weekday names, dropping duplicates.
+func ParseWeekdays(names []string) ([]time.Weekday, error) {
+	seen := map[time.Weekday]struct{}{}
+	var out []time.Weekday
+	for _, n := range names {
+		if strings.TrimSpace(n) == "" {
+			continue
+		}
+		d, err := ParseWeekday(n)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[d]; ok {
+			continue
+		}
+		seen[d] = struct{}{}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// Dates expands the rule into concrete days (UTC midnight), in ascending order.
+func (r Recurrence) Dates() ([]time.Time, error) {
+	if len(r.Weekdays) == 0 {
+		return nil, errors.New("recurrence needs at least one weekday")
+	}
+	if r.Weeks <= 0 {
+		return nil, errors.New("recurrence needs a positive number of weeks")
+	}
+	if r.Weeks > maxRecurrenceWeeks {
+		return nil, fmt.Errorf("recurrence is limited to %d weeks", maxRecurrenceWeeks)
+	}
+	want := map[time.Weekday]bool{}
+	for _, d := range r.Weekdays {
+		want[d] = true
+	}
+	start := time.Date(r.Start.Year(), r.Start.Month(), r.Start.Day(), 0, 0, 0, 0, time.UTC)
+	var out []time.Time
+	for i := 0; i < r.Weeks*7; i++ {
+		d := start.AddDate(0, 0, i)
+		if want[d.Weekday()] {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+// Label renders the weekdays as "Tue/Thu", Monday first.
+func (r Recurrence) Label() string {
+	days := append([]time.Weekday(nil), r.Weekdays...)
+	sort.Slice(days, func(i, j int) bool { return (days[i]+6)%7 < (days[j]+6)%7 })
+	parts := make([]string, 0, len(days))
+	for _, d := range days {
+		parts = append(parts, d.String()[:3])
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,134 @@
+package plan
+
+import (
+	"slices"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// days parses YYYY-MM-DD dates as UTC midnights.
+func days(t *testing.T, ss ...string) []time.Time {
+	t.Helper()
+	out := make([]time.Time, len(ss))
+	for i, s := range ss {
+		d, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[i] = d
+	}
+	return out
+}
+
+func berlin(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestRecurrenceDates(t *testing.T) {
+	loc := berlin(t)
+	tests := []struct {
+		name string
+		rec  Recurrence
+		want []time.Time
+	}{
+		{
+			name: "two weekdays for two weeks",
+			rec:  Recurrence{Weekdays: []time.Weekday{time.Thursday, time.Tuesday}, Start: days(t, "2024-01-01")[0], Weeks: 2},
+			want: days(t, "2024-01-02", "2024-01-04", "2024-01-09", "2024-01-11"),
+		},
+		{
+			name: "weeks are counted from a mid-week start",
+			rec:  Recurrence{Weekdays: []time.Weekday{time.Monday, time.Wednesday}, Start: days(t, "2024-01-03")[0], Weeks: 1},
+			want: days(t, "2024-01-03", "2024-01-08"),
+		},
+		{
+			name: "duplicate weekdays give one date",
+			rec:  Recurrence{Weekdays: []time.Weekday{time.Friday, time.Friday}, Start: days(t, "2024-01-01")[0], Weeks: 1},
+			want: days(t, "2024-01-05"),
+		},
+		{
+			name: "leap day and month end",
+			rec:  Recurrence{Weekdays: []time.Weekday{time.Thursday, time.Friday}, Start: days(t, "2024-02-29")[0], Weeks: 2},
+			want: days(t, "2024-02-29", "2024-03-01", "2024-03-07", "2024-03-08"),
+		},
+		{
+			name: "year end",
+			rec:  Recurrence{Weekdays: []time.Weekday{time.Sunday, time.Thursday}, Start: days(t, "2025-12-27")[0], Weeks: 1},
+			want: days(t, "2025-12-28", "2026-01-01"),
+		},
+		{
+			// 00:30 CEST is still the day before in UTC; the local date counts
+			name: "start of summer time",
+			rec:  Recurrence{Weekdays: []time.Weekday{time.Monday}, Start: time.Date(2025, 3, 31, 0, 30, 0, 0, loc), Weeks: 2},
+			want: days(t, "2025-03-31", "2025-04-07"),
+		},
+		{
+			name: "end of summer time",
+			rec:  Recurrence{Weekdays: []time.Weekday{time.Sunday}, Start: time.Date(2025, 10, 20, 0, 15, 0, 0, loc), Weeks: 2},
+			want: days(t, "2025-10-26", "2025-11-02"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rec.Dates()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("Dates = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecurrenceWeeks(t *testing.T) {
+	start := days(t, "2024-01-01")[0]
+	rec := Recurrence{Weekdays: []time.Weekday{time.Monday, time.Wednesday, time.Saturday}, Start: start, Weeks: maxRecurrenceWeeks}
+	got, err := rec.Dates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3*maxRecurrenceWeeks {
+		t.Fatalf("got %d dates, want %d", len(got), 3*maxRecurrenceWeeks)
+	}
+	// the last date is inside the last week
+	if last, end := got[len(got)-1], start.AddDate(0, 0, 7*maxRecurrenceWeeks); !last.Before(end) || end.Sub(last) > 7*24*time.Hour {
+		t.Fatalf("last date %v, range ends %v", last, end)
+	}
+
+	for _, bad := range []Recurrence{
+		{Start: start, Weeks: 1},
+		{Weekdays: []time.Weekday{time.Monday}, Start: start},
+		{Weekdays: []time.Weekday{time.Monday}, Start: start, Weeks: -1},
+		{Weekdays: []time.Weekday{time.Monday}, Start: start, Weeks: maxRecurrenceWeeks + 1},
+	} {
+		if _, err := bad.Dates(); err == nil {
+			t.Errorf("Dates(%+v): no error", bad)
+		}
+	}
+}
+
+func TestParseWeekdays(t *testing.T) {
+	got, err := ParseWeekdays([]string{"Tue", " thursday ", "", "tues"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, []time.Weekday{time.Tuesday, time.Thursday}) {
+		t.Fatalf("ParseWeekdays = %v", got)
+	}
+	if _, err := ParseWeekdays([]string{"mon", "funday"}); err == nil {
+		t.Fatal("unknown weekday: no error")
+	}
+	if l := (Recurrence{Weekdays: got}).Label(); l != "Tue/Thu" {
+		t.Fatalf("Label = %q", l)
+	}
+	if l := (Recurrence{Weekdays: []time.Weekday{time.Sunday, time.Monday}}).Label(); l != "Mon/Sun" {
+		t.Fatalf("Label = %q, want Monday first", l)
+	}
+}
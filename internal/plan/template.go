@@ -0,0 +1,190 @@
+package plan
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"garmr/internal/store"
+)
+
+// Template is a multi-week training plan whose last week contains the race.
+//
+// JSON form:
+//
+//	{"name": "10k in 8 weeks", "workouts": [
+//	  {"week": 1, "day": "tue", "sport": "running", "title": "Intervals",
+//	   "distance_km": 8, "duration_min": 45, "notes": "6x800m"}
+//	]}
+//
+// CSV form uses a header row with the same keys:
+//
+//	week,day,sport,title,distance_km,duration_min,notes
+type Template struct {
+	Name     string            `json:"name"`
+	Workouts []TemplateWorkout `json:"workouts"`
+}
+
+type TemplateWorkout struct {
+	Week        int     `json:"week"` // 1-based; the highest week is race week
+	Day         string  `json:"day"`  // weekday name, e.g. "tue"
+	Sport       string  `json:"sport"`
+	Title       string  `json:"title"`
+	DistanceKm  float64 `json:"distance_km"`
+	DurationMin int     `json:"duration_min"`
+	Notes       string  `json:"notes"`
+}
+
+// ParseTemplate decodes a JSON or CSV template, picking the format from the
+// file extension and falling back to sniffing the first byte.
+func ParseTemplate(filename string, data []byte) (Template, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case ext == ".json", ext == "" && len(trimmed) > 0 && trimmed[0] == '{':
+		return parseTemplateJSON(trimmed)
+	case ext == ".csv", ext == "":
+		return parseTemplateCSV(bytes.NewReader(trimmed))
+	default:
+		return Template{}, fmt.Errorf("unsupported template type %q (use .json or .csv)", ext)
+	}
+}
+
+func parseTemplateJSON(data []byte) (Template, error) {
+	var t Template
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&t); err != nil {
+		return Template{}, fmt.Errorf("template json: %w", err)
+	}
+	return t, t.validate()
+}
+
+func parseTemplateCSV(r io.Reader) (Template, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return Template{}, fmt.Errorf("template csv: %w", err)
+	}
+	if len(rows) < 2 {
+		return Template{}, errors.New("template csv: need a header row and at least one workout")
+	}
+	col := map[string]int{}
+	for i, h := range rows[0] {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, req := range []string{"week", "day", "sport"} {
+		if _, ok := col[req]; !ok {
+			return Template{}, fmt.Errorf("template csv: missing %q column", req)
+		}
+	}
+	get := func(row []string, key string) string {
+		i, ok := col[key]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	var t Template
+	for n, row := range rows[1:] {
+		line := n + 2
+		if len(row) == 1 && strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+		week, err := strconv.Atoi(get(row, "week"))
+		if err != nil {
+			return Template{}, fmt.Errorf("template csv line %d: invalid week", line)
+		}
+		w := TemplateWorkout{
+			Week:  week,
+			Day:   get(row, "day"),
+			Sport: get(row, "sport"),
+			Title: get(row, "title"),
+			Notes: get(row, "notes"),
+		}
+		if v := get(row, "distance_km"); v != "" {
+			if w.DistanceKm, err = strconv.ParseFloat(v, 64); err != nil {
+				return Template{}, fmt.Errorf("template csv line %d: invalid distance_km", line)
+			}
+		}
+		if v := get(row, "duration_min"); v != "" {
+			if w.DurationMin, err = strconv.Atoi(v); err != nil {
+				return Template{}, fmt.Errorf("template csv line %d: invalid duration_min", line)
+			}
+		}
+		t.Workouts = append(t.Workouts, w)
+	}
+	return t, t.validate()
+}
+
+func (t Template) validate() error {
+	if len(t.Workouts) == 0 {
+		return errors.New("template has no workouts")
+	}
+	for i, w := range t.Workouts {
+		if w.Week < 1 {
+			return fmt.Errorf("workout %d: week must be >= 1", i+1)
+		}
+		if _, err := ParseWeekday(w.Day); err != nil {
+			return fmt.Errorf("workout %d: %v", i+1, err)
+		}
+		if strings.TrimSpace(w.Sport) == "" {
+			return fmt.Errorf("workout %d: sport required", i+1)
+		}
+		if w.DistanceKm < 0 || w.DurationMin < 0 {
+			return fmt.Errorf("workout %d: distance and duration must not be negative", i+1)
+		}
+	}
+	return nil
+}
+
+// Weeks returns the number of weeks the template spans.
+func (t Template) Weeks() int {
+	n := 0
+	for _, w := range t.Workouts {
+		if w.Week > n {
+			n = w.Week
+		}
+	}
+	return n
+}
+
+// Schedule anchors the template so its last week is the Monday–Sunday week
+// containing raceDate, and returns the resulting planned workouts.
+func (t Template) Schedule(raceDate time.Time) []store.PlannedWorkout {
+	race := time.Date(raceDate.Year(), raceDate.Month(), raceDate.Day(), 0, 0, 0, 0, time.UTC)
+	raceMonday := race.AddDate(0, 0, -((int(race.Weekday()) + 6) % 7))
+	weeks := t.Weeks()
+
+	out := make([]store.PlannedWorkout, 0, len(t.Workouts))
+	for _, w := range t.Workouts {
+		day, _ := ParseWeekday(w.Day)
+		monday := raceMonday.AddDate(0, 0, -7*(weeks-w.Week))
+		pw := store.PlannedWorkout{
+			PlannedDate: monday.AddDate(0, 0, (int(day)+6)%7),
+			Sport:       strings.TrimSpace(w.Sport),
+			Title:       strings.TrimSpace(w.Title),
+			Notes:       strings.TrimSpace(w.Notes),
+		}
+		if w.DistanceKm > 0 {
+			pw.DistanceM = sql.NullInt64{Int64: int64(math.Round(w.DistanceKm * 1000)), Valid: true}
+		}
+		if w.DurationMin > 0 {
+			pw.DurationS = sql.NullInt64{Int64: int64(w.DurationMin * 60), Valid: true}
+		}
+		out = append(out, pw)
+	}
+	return out
+}
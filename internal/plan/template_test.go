@@ -0,0 +1,119 @@
+package plan
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTemplateSchedule(t *testing.T) {
+	tmpl := Template{Name: "test", Workouts: []TemplateWorkout{
+		{Week: 1, Day: "mon", Sport: "running"},
+		{Week: 2, Day: "wed", Sport: "running"},
+		{Week: 3, Day: "sun", Sport: "running", Title: "Race"},
+	}}
+	loc := berlin(t)
+	tests := []struct {
+		name string
+		race time.Time
+		want []time.Time // of the workouts, in template order
+	}{
+		{
+			name: "race on a Sunday",
+			race: days(t, "2024-03-17")[0],
+			want: days(t, "2024-02-26", "2024-03-06", "2024-03-17"),
+		},
+		{
+			name: "race mid-week keeps the Monday to Sunday week",
+			race: days(t, "2024-03-14")[0],
+			want: days(t, "2024-02-26", "2024-03-06", "2024-03-17"),
+		},
+		{
+			name: "race on a Monday",
+			race: days(t, "2024-03-18")[0],
+			want: days(t, "2024-03-04", "2024-03-13", "2024-03-24"),
+		},
+		{
+			name: "across a month end in a leap year",
+			race: days(t, "2024-03-03")[0],
+			want: days(t, "2024-02-12", "2024-02-21", "2024-03-03"),
+		},
+		{
+			name: "across the year end",
+			race: days(t, "2026-01-04")[0],
+			want: days(t, "2025-12-15", "2025-12-24", "2026-01-04"),
+		},
+		{
+			// 00:30 CET on Sunday is still Saturday in UTC; the local date counts
+			name: "end of summer time",
+			race: time.Date(2025, 11, 2, 0, 30, 0, 0, loc),
+			want: days(t, "2025-10-13", "2025-10-22", "2025-11-02"),
+		},
+		{
+			// 00:30 CEST on Monday is still Sunday in UTC
+			name: "start of summer time",
+			race: time.Date(2025, 3, 31, 0, 30, 0, 0, loc),
+			want: days(t, "2025-03-17", "2025-03-26", "2025-04-06"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tmpl.Schedule(tt.race)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d workouts, want %d", len(got), len(tt.want))
+			}
+			for i, pw := range got {
+				if !pw.PlannedDate.Equal(tt.want[i]) || pw.PlannedDate.Location() != time.UTC {
+					t.Errorf("workout %d on %v, want %v", i, pw.PlannedDate, tt.want[i].Format(time.DateOnly))
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateScheduleFields(t *testing.T) {
+	tmpl := Template{Workouts: []TemplateWorkout{
+		{Week: 1, Day: "tue", Sport: " running ", Title: " Intervals ", DistanceKm: 8.25, DurationMin: 45, Notes: "6x800m"},
+		{Week: 1, Day: "thu", Sport: "cycling"},
+	}}
+	got := tmpl.Schedule(days(t, "2024-03-07")[0])
+	pw := got[0]
+	if pw.Sport != "running" || pw.Title != "Intervals" || pw.Notes != "6x800m" {
+		t.Errorf("workout %+v", pw)
+	}
+	if !pw.DistanceM.Valid || pw.DistanceM.Int64 != 8250 || !pw.DurationS.Valid || pw.DurationS.Int64 != 2700 {
+		t.Errorf("distance %v, duration %v", pw.DistanceM, pw.DurationS)
+	}
+	if got[1].DistanceM.Valid || got[1].DurationS.Valid {
+		t.Errorf("zero distance and duration should be unset: %+v", got[1])
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	csv := "week,day,sport,title,distance_km,duration_min,notes\n1,tue,running,Easy,5,30,\n2, sun ,running,Race,10,,\n"
+	tmpl, err := ParseTemplate("plan.csv", []byte(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.Weeks() != 2 || len(tmpl.Workouts) != 2 || tmpl.Workouts[1].Day != "sun" || tmpl.Workouts[0].DurationMin != 30 {
+		t.Fatalf("template %+v", tmpl)
+	}
+	js := `{"name": "n", "workouts": [{"week": 1, "day": "tue", "sport": "running"}]}`
+	if tmpl, err = ParseTemplate("upload", []byte(js)); err != nil || tmpl.Name != "n" {
+		t.Fatalf("sniffed json: %+v, %v", tmpl, err)
+	}
+
+	for name, data := range map[string]string{
+		"bad.json":    `{"workouts": [{"week": 1, "day": "tue", "sport": "running", "pace": 5}]}`,
+		"week0.json":  `{"workouts": [{"week": 0, "day": "tue", "sport": "running"}]}`,
+		"day.csv":     "week,day,sport\n1,funday,running\n",
+		"sport.csv":   "week,day\n1,tue\n",
+		"empty.csv":   "week,day,sport\n",
+		"plan.txt":    "week,day,sport\n1,tue,running\n",
+		"neg.csv":     "week,day,sport,distance_km\n1,tue,running,-3\n",
+		"weekstr.csv": "week,day,sport\none,tue,running\n",
+	} {
+		if _, err := ParseTemplate(name, []byte(data)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
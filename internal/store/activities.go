@@ -0,0 +1,157 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const activityColumns = `id, COALESCE(user_id,0), COALESCE(fit_uid,''), start_time_utc, COALESCE(sport,''), COALESCE(sub_sport,''),
+	COALESCE(duration_s,0), COALESCE(distance_m,0), COALESCE(avg_hr,0), COALESCE(max_hr,0),
+	COALESCE(avg_speed_mps,0), COALESCE(calories,0), COALESCE(ascent_m,0), COALESCE(descent_m,0),
+	COALESCE(device_vendor,''), COALESCE(device_model,''), raw_path, aerobic_te, anaerobic_te,
+	elapsed_s, moving_s`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanActivity(row rowScanner) (Activity, error) {
+	var a Activity
+	var start string
+	err := row.Scan(&a.ID, &a.UserID, &a.FitUID, &start, &a.Sport, &a.SubSport, &a.DurationS, &a.DistanceM,
+		&a.AvgHR, &a.MaxHR, &a.AvgSpeedMPS, &a.Calories, &a.AscentM, &a.DescentM,
+		&a.DeviceVendor, &a.DeviceModel, &a.RawPath, &a.AerobicTE, &a.AnaerobicTE,
+		&a.ElapsedS, &a.MovingS)
+	if err != nil {
+		return Activity{}, err
+	}
+	a.StartTimeUTC, _ = ParseStoredTime(start)
+	return a, nil
+}
+
+// ParseStoredTime parses start_time_utc values, which are written by the
+// sqlite driver in time.Time.String() form.
+func ParseStoredTime(ts string) (time.Time, error) {
+	layouts := []string{
+		"2006-01-02 15:04:05.999999999 -0700 MST",
+		time.RFC3339Nano,
+		"2006-01-02 15:04:05",
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, ts); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse time %q", ts)
+}
+
+// ListActivities returns one page of the user's activities (newest first)
+// and the total number matching the optional sport filter.
+func (db *DB) ListActivities(userID int64, sport string, limit, offset int) ([]Activity, int, error) {
+	where := ` WHERE user_id = ?`
+	args := []any{userID}
+	if sport != "" {
+		where += ` AND sport = ?`
+		args = append(args, sport)
+	}
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM activities`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := db.Query(`SELECT `+activityColumns+` FROM activities`+where+` ORDER BY start_time_utc DESC LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var res []Activity
+	for rows.Next() {
+		a, err := scanActivity(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		res = append(res, a)
+	}
+	return res, total, rows.Err()
+}
+
+// GetActivity loads one of the user's activities; other users' activities
+// are reported as sql.ErrNoRows.
+func (db *DB) GetActivity(userID, id int64) (*Activity, error) {
+	a, err := scanActivity(db.QueryRow(`SELECT `+activityColumns+` FROM activities WHERE id=? AND user_id=?`, id, userID))
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ListRecords returns a page of an activity's records ordered by time
+// offset, together with the total record count. Callers check ownership
+// with GetActivity first.
+func (db *DB) ListRecords(activityID int64, limit, offset int) ([]Record, int, error) {
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM records WHERE activity_id=?`, activityID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := db.Query(`
+		SELECT t_offset_s, lat_deg, lon_deg, elev_m, hr, cad, temp_c, power_w, speed_mps,
+		       distance_m, cad_fraction, vert_osc_mm, gct_ms, gct_balance, stride_m, vert_ratio, resp_rate, power_balance
+		FROM records WHERE activity_id=?
+		ORDER BY t_offset_s LIMIT ? OFFSET ?`, activityID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var res []Record
+	for rows.Next() {
+		var r Record
+		if err := rows.Scan(&r.TOffsetS, &r.Lat, &r.Lon, &r.ElevM, &r.HR, &r.Cad, &r.TempC, &r.PowerW, &r.SpeedMPS,
+			&r.DistanceM, &r.CadFraction, &r.VertOscMM, &r.GCTMS, &r.GCTBalance, &r.StrideM, &r.VertRatio, &r.RespRate, &r.PowerBalance); err != nil {
+			return nil, 0, err
+		}
+		res = append(res, r)
+	}
+	return res, total, rows.Err()
+}
+
+func (db *DB) ListLaps(activityID int64) ([]Lap, error) {
+	rows, err := db.Query(`
+		SELECT COALESCE(lap_index,0), COALESCE(start_offset_s,0), COALESCE(duration_s,0), COALESCE(distance_m,0),
+		       COALESCE(avg_hr,0), COALESCE(max_hr,0), COALESCE(avg_speed_mps,0)
+		FROM laps WHERE activity_id=? ORDER BY lap_index`, activityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Lap
+	for rows.Next() {
+		var l Lap
+		if err := rows.Scan(&l.Index, &l.StartOff, &l.DurS, &l.DistM, &l.AvgHR, &l.MaxHR, &l.AvgSpd); err != nil {
+			return nil, err
+		}
+		res = append(res, l)
+	}
+	return res, rows.Err()
+}
+
+func (db *DB) GetPlannedWorkout(userID, id int64) (*PlannedWorkout, error) {
+	var it PlannedWorkout
+	var dateStr string
+	var title, notes sql.NullString
+	err := db.QueryRow(`
+        SELECT id, planned_date, sport, title, distance_m, duration_s, notes, block_id
+        FROM planned_workouts WHERE id=? AND user_id=?`, id, userID).
+		Scan(&it.ID, &dateStr, &it.Sport, &title, &it.DistanceM, &it.DurationS, &notes, &it.BlockID)
+	if err != nil {
+		return nil, err
+	}
+	it.Title, it.Notes = title.String, notes.String
+	it.PlannedDate, _ = time.Parse("2006-01-02", dateStr)
+	return &it, nil
+}
+
+func (db *DB) DeletePlannedWorkout(userID, id int64) error {
+	res, err := db.Exec(`DELETE FROM planned_workouts WHERE id = ? AND user_id = ?`, id, userID)
+	return affectedOne(res, err)
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+
+	apiTokenPrefix = "garmr_"
+)
+
+type APIToken struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Scope      string
+	CreatedAt  string
+	LastUsedAt sql.NullString
+}
+
+// CreateAPIToken issues a personal API token. Only its hash is stored; the
+// plain token is returned once to the caller.
+func (db *DB) CreateAPIToken(userID int64, name, scope string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("token name required")
+	}
+	if scope != ScopeRead && scope != ScopeWrite {
+		return "", errors.New("invalid token scope")
+	}
+	secret, err := generateSessionID()
+	if err != nil {
+		return "", err
+	}
+	token := apiTokenPrefix + secret
+	_, err = db.Exec(`INSERT INTO api_tokens(user_id, name, token_hash, scope, created_at) VALUES(?,?,?,?,datetime('now'))`,
+		userID, name, hashToken(token), scope)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (db *DB) ListAPITokens(userID int64) ([]APIToken, error) {
+	rows, err := db.Query(`SELECT id, user_id, name, scope, created_at, last_used_at FROM api_tokens WHERE user_id=? ORDER BY id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []APIToken
+	for rows.Next() {
+		var t APIToken
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.CreatedAt, &t.LastUsedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
+
+// DeleteAPIToken revokes one of the user's tokens.
+func (db *DB) DeleteAPIToken(userID, id int64) error {
+	res, err := db.Exec(`DELETE FROM api_tokens WHERE id=? AND user_id=?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// LookupAPIToken resolves a bearer token and records its use. Tokens of
+// disabled users don't resolve.
+func (db *DB) LookupAPIToken(token string) (*APIToken, error) {
+	token = strings.TrimSpace(token)
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, sql.ErrNoRows
+	}
+	h := hashToken(token)
+	var t APIToken
+	err := db.QueryRow(`
+        SELECT t.id, t.user_id, t.name, t.scope, t.created_at, t.last_used_at
+        FROM api_tokens t JOIN users u ON u.id = t.user_id
+        WHERE t.token_hash=? AND u.disabled=0`, h).
+		Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.CreatedAt, &t.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = db.Exec(`UPDATE api_tokens SET last_used_at=datetime('now') WHERE id=?`, t.ID)
+	return &t, nil
+}
@@ -18,15 +18,59 @@ type AuthUser struct {
 	PasswordHash string
 	LastLoginAt  sql.NullString
 	Theme        string
+	CreatedAt    string
+	Role         string
+	Disabled     bool
+	TwoFactor    bool // TOTP is set up
 }
 
+const (
+	RoleAdmin   = "admin"   // everything, including user administration
+	RoleAthlete = "athlete" // imports, edits and deletes data
+	RoleViewer  = "viewer"  // read-only
+)
+
+// Roles lists the assignable roles, most privileged first.
+var Roles = []string{RoleAdmin, RoleAthlete, RoleViewer}
+
+var errLastAdmin = errors.New("at least one active admin is required")
+
+func roleRank(role string) int {
+	switch role {
+	case RoleAdmin:
+		return 3
+	case RoleAthlete:
+		return 2
+	case RoleViewer:
+		return 1
+	}
+	return 0
+}
+
+func ValidRole(role string) bool { return roleRank(role) > 0 }
+
+// RoleAtLeast reports whether role grants at least the access of min.
+func RoleAtLeast(role, min string) bool { return roleRank(role) >= roleRank(min) }
+
 type Session struct {
-	ID        string
-	UserID    int64
-	ExpiresAt time.Time
+	ID         string
+	UserID     int64
+	ExpiresAt  time.Time
+	CreatedAt  string
+	LastSeenAt string
+	UserAgent  string
+	IP         string // address the session signed in from
 }
 
-const sessionTTL = 30 * 24 * time.Hour
+// Handle identifies the session on the sessions page without exposing
+// its ID, which is the cookie value.
+func (s Session) Handle() string { return hashToken(s.ID)[:16] }
+
+const (
+	sessionTTL = 30 * 24 * time.Hour
+	// pendingTTL is how long a sign-in may wait for its second factor.
+	pendingTTL = 10 * time.Minute
+)
 
 func (db *DB) HasUsers() (bool, error) {
 	var count int
@@ -36,7 +80,17 @@ func (db *DB) HasUsers() (bool, error) {
 	return count > 0, nil
 }
 
-func (db *DB) CreateUser(username, password string) (int64, error) {
+func (db *DB) CreateUser(username, password, role string) (int64, error) {
+	var id int64
+	err := db.WithTx(func(tx *sql.Tx) error {
+		var err error
+		id, err = insertUser(tx, username, password, role)
+		return err
+	})
+	return id, err
+}
+
+func insertUser(tx *sql.Tx, username, password, role string) (int64, error) {
 	username = strings.TrimSpace(username)
 	if username == "" {
 		return 0, errors.New("username required")
@@ -44,37 +98,168 @@ func (db *DB) CreateUser(username, password string) (int64, error) {
 	if len(password) < 8 {
 		return 0, errors.New("password must be at least 8 characters")
 	}
+	if !ValidRole(role) {
+		return 0, fmt.Errorf("invalid role %q", role)
+	}
+	var taken int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM users WHERE username=?`, username).Scan(&taken); err != nil {
+		return 0, err
+	}
+	if taken > 0 {
+		return 0, fmt.Errorf("username %q is already taken", username)
+	}
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return 0, err
 	}
-	res, err := db.Exec(`INSERT INTO users(username,password_hash,theme,created_at,updated_at) VALUES(?,?,?,datetime('now'),datetime('now'))`,
-		username, string(hash), "system")
+	res, err := tx.Exec(`INSERT INTO users(username,password_hash,theme,role,created_at,updated_at) VALUES(?,?,?,?,datetime('now'),datetime('now'))`,
+		username, string(hash), "system", role)
 	if err != nil {
 		return 0, err
 	}
-	id, _ := res.LastInsertId()
-	return id, nil
+	return res.LastInsertId()
 }
 
-func (db *DB) GetUserByUsername(username string) (*AuthUser, error) {
+const userColumns = `id, username, password_hash, last_login_at, theme, created_at, role, disabled, totp_secret IS NOT NULL`
+
+func scanUser(row rowScanner) (*AuthUser, error) {
 	var u AuthUser
-	err := db.QueryRow(`SELECT id, username, password_hash, last_login_at, theme FROM users WHERE username=?`, username).
-		Scan(&u.ID, &u.Username, &u.PasswordHash, &u.LastLoginAt, &u.Theme)
-	if err != nil {
+	var disabled, twoFactor int
+	if err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.LastLoginAt, &u.Theme, &u.CreatedAt, &u.Role, &disabled, &twoFactor); err != nil {
 		return nil, err
 	}
+	u.Disabled, u.TwoFactor = disabled != 0, twoFactor != 0
 	return &u, nil
 }
 
+func (db *DB) GetUserByUsername(username string) (*AuthUser, error) {
+	return scanUser(db.QueryRow(`SELECT `+userColumns+` FROM users WHERE username=?`, username))
+}
+
 func (db *DB) GetUserByID(id int64) (*AuthUser, error) {
-	var u AuthUser
-	err := db.QueryRow(`SELECT id, username, password_hash, last_login_at, theme FROM users WHERE id=?`, id).
-		Scan(&u.ID, &u.Username, &u.PasswordHash, &u.LastLoginAt, &u.Theme)
+	return scanUser(db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id=?`, id))
+}
+
+func (db *DB) ListUsers() ([]AuthUser, error) {
+	rows, err := db.Query(`SELECT ` + userColumns + ` FROM users ORDER BY id`)
 	if err != nil {
 		return nil, err
 	}
-	return &u, nil
+	defer rows.Close()
+	var res []AuthUser
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *u)
+	}
+	return res, rows.Err()
+}
+
+// keepAnAdmin fails if taking id out of the active admins would leave none.
+func keepAnAdmin(tx *sql.Tx, id int64) error {
+	var others int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM users WHERE role=? AND disabled=0 AND id<>?`, RoleAdmin, id).Scan(&others)
+	if err != nil {
+		return err
+	}
+	if others == 0 {
+		return errLastAdmin
+	}
+	return nil
+}
+
+// SetUserRole changes a user's role. The last active admin cannot be demoted.
+func (db *DB) SetUserRole(id int64, role string) error {
+	if !ValidRole(role) {
+		return fmt.Errorf("invalid role %q", role)
+	}
+	return db.WithTx(func(tx *sql.Tx) error {
+		if role != RoleAdmin {
+			if err := keepAnAdmin(tx, id); err != nil {
+				return err
+			}
+		}
+		res, err := tx.Exec(`UPDATE users SET role=?, updated_at=datetime('now') WHERE id=?`, role, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+// SetUserDisabled blocks or unblocks sign-in. Disabling also ends the
+// user's sessions; their API tokens and feed stop working while disabled.
+func (db *DB) SetUserDisabled(id int64, disabled bool) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		v := 0
+		if disabled {
+			if err := keepAnAdmin(tx, id); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id=?`, id); err != nil {
+				return err
+			}
+			v = 1
+		}
+		res, err := tx.Exec(`UPDATE users SET disabled=?, updated_at=datetime('now') WHERE id=?`, v, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+// DeleteUser removes a user with their sessions, tokens, sharing grants and
+// training plan. The last active admin and users who still own activities
+// cannot be deleted; disable those instead.
+func (db *DB) DeleteUser(id int64) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		if err := keepAnAdmin(tx, id); err != nil {
+			return err
+		}
+		var owned int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM activities WHERE user_id=?`, id).Scan(&owned); err != nil {
+			return err
+		}
+		if owned > 0 {
+			return fmt.Errorf("user still owns %d activities; disable the account instead", owned)
+		}
+		for _, q := range []string{
+			`DELETE FROM sessions WHERE user_id=?`,
+			`DELETE FROM api_tokens WHERE user_id=?`,
+			`DELETE FROM calendar_feeds WHERE user_id=?`,
+			`DELETE FROM sharing_grants WHERE owner_id=?1 OR grantee_id=?1`,
+			`DELETE FROM planned_workouts WHERE user_id=?`,
+			`DELETE FROM plan_blocks WHERE user_id=?`,
+			`DELETE FROM privacy_zones WHERE user_id=?`,
+			`DELETE FROM recovery_codes WHERE user_id=?`,
+			`DELETE FROM user_identities WHERE user_id=?`,
+			`DELETE FROM devices WHERE user_id=?`,
+			`DELETE FROM wellness_days WHERE user_id=?`,
+			`DELETE FROM wellness_files WHERE user_id=?`,
+			`DELETE FROM weights WHERE user_id=?`,
+		} {
+			if _, err := tx.Exec(q, id); err != nil {
+				return err
+			}
+		}
+		res, err := tx.Exec(`DELETE FROM users WHERE id=?`, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
 }
 
 func (db *DB) UpdatePassword(userID int64, newPassword string) error {
@@ -107,16 +292,21 @@ func (db *DB) EnsureInitialUser(username, password string) error {
 	if err != nil {
 		return err
 	}
-	if hasUsers {
-		return nil
+	if !hasUsers {
+		username = strings.TrimSpace(username)
+		password = strings.TrimSpace(password)
+		if username == "" || password == "" {
+			return fmt.Errorf("no users exist; set auth_user/auth_pass in config to bootstrap an account")
+		}
+		if _, err := db.CreateUser(username, password, RoleAdmin); err != nil {
+			return err
+		}
 	}
-	username = strings.TrimSpace(username)
-	password = strings.TrimSpace(password)
-	if username == "" || password == "" {
-		return fmt.Errorf("no users exist; set auth_user/auth_pass in config to bootstrap an account")
+	id, err := db.PrimaryUserID()
+	if err != nil {
+		return err
 	}
-	_, err = db.CreateUser(username, password)
-	return err
+	return db.claimUnownedData(id)
 }
 
 func (db *DB) UpdateTheme(userID int64, theme string) error {
@@ -137,14 +327,30 @@ func generateSessionID() (string, error) {
 	return hex.EncodeToString(buf), nil
 }
 
-func (db *DB) CreateSession(userID int64) (string, error) {
+// CreateSession starts a session for userID, remembering the browser and
+// address it signed in from.
+func (db *DB) CreateSession(userID int64, userAgent, ip string) (string, error) {
+	return db.insertSession(userID, userAgent, ip, sessionTTL, false)
+}
+
+// CreatePendingSession records a sign-in whose password was right but that
+// still has to pass the second factor. GetSession doesn't accept it.
+func (db *DB) CreatePendingSession(userID int64, userAgent, ip string) (string, error) {
+	return db.insertSession(userID, userAgent, ip, pendingTTL, true)
+}
+
+func (db *DB) insertSession(userID int64, userAgent, ip string, ttl time.Duration, pending bool) (string, error) {
 	sessionID, err := generateSessionID()
 	if err != nil {
 		return "", err
 	}
-	expiresAt := time.Now().UTC().Add(sessionTTL)
-	_, err = db.Exec(`INSERT INTO sessions(id,user_id,expires_at,created_at,last_seen_at) VALUES(?,?,?,datetime('now'),datetime('now'))`,
-		sessionID, userID, expiresAt.Format(time.RFC3339))
+	if len(userAgent) > 256 {
+		userAgent = userAgent[:256]
+	}
+	expiresAt := time.Now().UTC().Add(ttl)
+	_, err = db.Exec(`INSERT INTO sessions(id,user_id,expires_at,created_at,last_seen_at,user_agent,ip,mfa_pending)
+        VALUES(?,?,?,datetime('now'),datetime('now'),?,?,?)`,
+		sessionID, userID, expiresAt.Format(time.RFC3339), userAgent, ip, boolInt(pending))
 	if err != nil {
 		return "", err
 	}
@@ -152,10 +358,20 @@ func (db *DB) CreateSession(userID int64) (string, error) {
 }
 
 func (db *DB) GetSession(id string) (*Session, error) {
+	return db.getSession(id, false)
+}
+
+// GetPendingSession returns a sign-in waiting for its second factor.
+func (db *DB) GetPendingSession(id string) (*Session, error) {
+	return db.getSession(id, true)
+}
+
+func (db *DB) getSession(id string, pending bool) (*Session, error) {
 	var s Session
 	var expires string
-	err := db.QueryRow(`SELECT id, user_id, expires_at FROM sessions WHERE id=?`, id).
-		Scan(&s.ID, &s.UserID, &expires)
+	err := db.QueryRow(`SELECT id, user_id, expires_at, created_at, last_seen_at, user_agent, ip
+        FROM sessions WHERE id=? AND mfa_pending=?`, id, boolInt(pending)).
+		Scan(&s.ID, &s.UserID, &expires, &s.CreatedAt, &s.LastSeenAt, &s.UserAgent, &s.IP)
 	if err != nil {
 		return nil, err
 	}
@@ -169,10 +385,53 @@ func (db *DB) GetSession(id string) (*Session, error) {
 		return nil, sql.ErrNoRows
 	}
 	s.ExpiresAt = exp
-	_, _ = db.Exec(`UPDATE sessions SET last_seen_at=datetime('now') WHERE id=?`, id)
+	if !pending {
+		_, _ = db.Exec(`UPDATE sessions SET last_seen_at=datetime('now') WHERE id=?`, id)
+	}
 	return &s, nil
 }
 
+// ListSessions returns the user's signed-in sessions, most recently used
+// first.
+func (db *DB) ListSessions(userID int64) ([]Session, error) {
+	rows, err := db.Query(`SELECT id, user_id, expires_at, created_at, last_seen_at, user_agent, ip
+        FROM sessions WHERE user_id=? AND mfa_pending=0 ORDER BY last_seen_at DESC, created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	now := time.Now().UTC()
+	var res []Session
+	for rows.Next() {
+		var s Session
+		var expires string
+		if err := rows.Scan(&s.ID, &s.UserID, &expires, &s.CreatedAt, &s.LastSeenAt, &s.UserAgent, &s.IP); err != nil {
+			return nil, err
+		}
+		exp, err := time.Parse(time.RFC3339, expires)
+		if err != nil || now.After(exp) {
+			continue
+		}
+		s.ExpiresAt = exp
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
+
+// DeleteSessionByHandle signs out one of the user's sessions.
+func (db *DB) DeleteSessionByHandle(userID int64, handle string) error {
+	sessions, err := db.ListSessions(userID)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if s.Handle() == handle {
+			return db.DeleteSession(s.ID)
+		}
+	}
+	return sql.ErrNoRows
+}
+
 func (db *DB) DeleteSession(id string) error {
 	_, err := db.Exec(`DELETE FROM sessions WHERE id=?`, id)
 	return err
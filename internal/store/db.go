@@ -4,8 +4,11 @@ import (
 	"database/sql"
 	"embed"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"garmr/internal/fitx"
@@ -20,6 +23,7 @@ type DB struct{ *sql.DB }
 
 type Activity struct {
 	ID           int64
+	UserID       int64
 	FitUID       string
 	StartTimeUTC time.Time
 	Sport        string
@@ -38,6 +42,9 @@ type Activity struct {
 	// Training effects (Garmin specific)
 	AerobicTE   sql.NullFloat64 // Aerobic Training Effect (0.0-5.0)
 	AnaerobicTE sql.NullFloat64 // Anaerobic Training Effect (0.0-5.0)
+	// DurationS is the timer time; NULL until read from the FIT file
+	ElapsedS sql.NullInt64
+	MovingS  sql.NullInt64
 }
 
 type Record struct {
@@ -47,6 +54,15 @@ type Record struct {
 	TempC           sql.NullFloat64
 	PowerW          sql.NullInt64
 	SpeedMPS        sql.NullFloat64
+	DistanceM       sql.NullFloat64
+	CadFraction     sql.NullFloat64
+	VertOscMM       sql.NullFloat64
+	GCTMS           sql.NullFloat64
+	GCTBalance      sql.NullFloat64 // % left
+	StrideM         sql.NullFloat64
+	VertRatio       sql.NullFloat64
+	RespRate        sql.NullFloat64
+	PowerBalance    sql.NullFloat64 // % left
 }
 
 type Lap struct {
@@ -67,6 +83,7 @@ type PlannedWorkout struct {
 	DistanceM   sql.NullInt64
 	DurationS   sql.NullInt64
 	Notes       string
+	BlockID     sql.NullInt64
 }
 
 func Open(path string) (*DB, error) {
@@ -101,31 +118,94 @@ func Migrate(db *DB) error {
 	return goose.Up(db.DB, "migrations")
 }
 
-func (db *DB) LookupActivityByUID(tx *sql.Tx, uid string) (int64, error) {
+// MigrateDown rolls back the most recent migration.
+func MigrateDown(db *DB) error {
+	goose.SetBaseFS(embedMigrations)
+	goose.SetDialect("sqlite3")
+	return goose.Down(db.DB, "migrations")
+}
+
+// MigrationStatus logs the applied state of every migration.
+func MigrationStatus(db *DB) error {
+	goose.SetBaseFS(embedMigrations)
+	goose.SetDialect("sqlite3")
+	return goose.Status(db.DB, "migrations")
+}
+
+// Vacuum rebuilds the database file, reclaiming space from deleted rows.
+func (db *DB) Vacuum() error {
+	_, err := db.Exec(`VACUUM`)
+	return err
+}
+
+// MigrationVersion reports the applied schema version and the newest
+// version embedded in the binary. It reads goose's version table itself
+// rather than going through goose, whose settings are package-wide, so
+// health probes can call it concurrently.
+func MigrationVersion(db *DB) (current, latest int64, err error) {
+	// a version counts as applied if its latest row says so
+	err = db.QueryRow(`
+		SELECT COALESCE(MAX(version_id), 0)
+		FROM goose_db_version g
+		WHERE is_applied AND id = (SELECT MAX(id) FROM goose_db_version WHERE version_id = g.version_id)`).Scan(&current)
+	if err != nil {
+		return 0, 0, err
+	}
+	files, err := fs.ReadDir(embedMigrations, "migrations")
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, f := range files {
+		num, _, _ := strings.Cut(f.Name(), "_")
+		if v, err := strconv.ParseInt(num, 10, 64); err == nil && v > latest {
+			latest = v
+		}
+	}
+	return current, latest, nil
+}
+
+// SizeBytes returns the size of the SQLite database file.
+func (db *DB) SizeBytes() (int64, error) {
+	var pages, pageSize int64
+	if err := db.QueryRow(`PRAGMA page_count`).Scan(&pages); err != nil {
+		return 0, err
+	}
+	if err := db.QueryRow(`PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pages * pageSize, nil
+}
+
+// LookupActivityByUID finds userID's activity with a FIT file ID. Other
+// users may have imported the same file.
+func (db *DB) LookupActivityByUID(tx *sql.Tx, userID int64, uid string) (int64, error) {
 	var id int64
-	err := tx.QueryRow("SELECT id FROM activities WHERE fit_uid=?", uid).Scan(&id)
+	err := tx.QueryRow("SELECT id FROM activities WHERE user_id=? AND fit_uid=?", userID, uid).Scan(&id)
 	return id, err
 }
-func (db *DB) LookupActivityByHash(tx *sql.Tx, h string) (int64, error) {
+
+// LookupActivityByHash finds userID's activity imported from a file with
+// hash h.
+func (db *DB) LookupActivityByHash(tx *sql.Tx, userID int64, h string) (int64, error) {
 	var id int64
-	err := tx.QueryRow("SELECT id FROM activities WHERE file_hash=?", h).Scan(&id)
+	err := tx.QueryRow("SELECT id FROM activities WHERE user_id=? AND file_hash=?", userID, h).Scan(&id)
 	return id, err
 }
 
-func (db *DB) ActivityRawPath(id int64) (string, error) {
+func (db *DB) ActivityRawPath(userID, id int64) (string, error) {
 	var path string
-	err := db.QueryRow(`SELECT raw_path FROM activities WHERE id = ?`, id).Scan(&path)
+	err := db.QueryRow(`SELECT raw_path FROM activities WHERE id = ? AND user_id = ?`, id, userID).Scan(&path)
 	if err != nil {
 		return "", err
 	}
 	return path, nil
 }
 
-func (db *DB) InsertActivity(tx *sql.Tx, a fitx.Activity, rawPath, hash string) (int64, error) {
+func (db *DB) InsertActivity(tx *sql.Tx, userID int64, a fitx.Activity, rawPath, hash string) (int64, error) {
 	res, err := tx.Exec(`INSERT INTO activities(
-		fit_uid,start_time_utc,sport,sub_sport,duration_s,distance_m,avg_hr,max_hr,avg_speed_mps,calories,ascent_m,descent_m,device_vendor,device_model,raw_path,file_hash,aerobic_te,anaerobic_te,created_at
-	) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,datetime('now'))`,
-		a.FitUID, a.StartTimeUTC, a.Sport, a.SubSport, a.DurationS, a.DistanceM, a.AvgHR, a.MaxHR, a.AvgSpeedMPS, a.Calories, a.AscentM, a.DescentM, a.DeviceVendor, a.DeviceModel, rawPath, hash, a.AerobicTE, a.AnaerobicTE)
+		user_id,fit_uid,start_time_utc,sport,sub_sport,duration_s,distance_m,avg_hr,max_hr,avg_speed_mps,calories,ascent_m,descent_m,device_vendor,device_model,raw_path,file_hash,aerobic_te,anaerobic_te,created_at
+	) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,datetime('now'))`,
+		userID, a.FitUID, a.StartTimeUTC, a.Sport, a.SubSport, a.DurationS, a.DistanceM, a.AvgHR, a.MaxHR, a.AvgSpeedMPS, a.Calories, a.AscentM, a.DescentM, a.DeviceVendor, a.DeviceModel, rawPath, hash, a.AerobicTE, a.AnaerobicTE)
 	if err != nil {
 		return 0, err
 	}
@@ -133,7 +213,8 @@ func (db *DB) InsertActivity(tx *sql.Tx, a fitx.Activity, rawPath, hash string)
 }
 
 func (db *DB) InsertRecords(tx *sql.Tx, id int64, recs []fitx.Record) error {
-	stmt, err := tx.Prepare(`INSERT INTO records(activity_id,t_offset_s,lat_deg,lon_deg,elev_m,hr,cad,temp_c,power_w,speed_mps) VALUES(?,?,?,?,?,?,?,?,?,?)`)
+	stmt, err := tx.Prepare(`INSERT INTO records(activity_id,t_offset_s,lat_deg,lon_deg,elev_m,hr,cad,temp_c,power_w,speed_mps,
+		distance_m,cad_fraction,vert_osc_mm,gct_ms,gct_balance,stride_m,vert_ratio,resp_rate,power_balance) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`)
 	if err != nil {
 		return err
 	}
@@ -165,7 +246,9 @@ func (db *DB) InsertRecords(tx *sql.Tx, id int64, recs []fitx.Record) error {
 		if r.PowerW != nil {
 			pwr = *r.PowerW
 		}
-		if _, err := stmt.Exec(id, r.TOffsetS, lat, lon, elev, hr, cad, temp, pwr, spd); err != nil {
+		if _, err := stmt.Exec(id, r.TOffsetS, lat, lon, elev, hr, cad, temp, pwr, spd,
+			nullable(r.DistanceM), nullable(r.CadFraction), nullable(r.VertOscMM), nullable(r.GCTMS), nullable(r.GCTBalance),
+			nullable(r.StrideM), nullable(r.VertRatio), nullable(r.RespRate), nullable(r.PowerBalance)); err != nil {
 			return err
 		}
 	}
@@ -334,47 +417,83 @@ func (db *DB) CalculateHRZonesForActivity(activityID int64, maxHR int) error {
 	})
 }
 
-func (db *DB) DeleteActivity(id int64) error {
-	_, err := db.Exec(`DELETE FROM activities WHERE id = ?`, id)
-	return err
+// DeleteActivity removes one of the user's activities and revokes its share
+// links, since activity ids can be reused. sql.ErrNoRows means it doesn't
+// exist or belongs to someone else.
+func (db *DB) DeleteActivity(userID, id int64) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM activities WHERE id = ? AND user_id = ?`, id, userID)
+		if err := affectedOne(res, err); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM activity_shares WHERE activity_id = ?`, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM swim_lengths WHERE activity_id = ?`, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM dev_values WHERE field_id IN (SELECT id FROM dev_fields WHERE activity_id = ?)`, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM dev_fields WHERE activity_id = ?`, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM timer_events WHERE activity_id = ?`, id); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM activity_devices WHERE activity_id = ?`, id)
+		return err
+	})
 }
 
-func (db *DB) InsertPlannedWorkout(date time.Time, sport, title string, distanceM, durationS sql.NullInt64, notes string) (int64, error) {
+func (db *DB) InsertPlannedWorkout(userID int64, date time.Time, sport, title string, distanceM, durationS sql.NullInt64, notes string) (int64, error) {
 	plannedDate := date.UTC().Format("2006-01-02")
 	res, err := db.Exec(`
-        INSERT INTO planned_workouts(planned_date, sport, title, distance_m, duration_s, notes, created_at, updated_at)
-        VALUES(?,?,?,?,?,?,datetime('now'),datetime('now'))`,
-		plannedDate, sport, title, nullableInt(distanceM), nullableInt(durationS), notes)
+        INSERT INTO planned_workouts(user_id, planned_date, sport, title, distance_m, duration_s, notes, created_at, updated_at)
+        VALUES(?,?,?,?,?,?,?,datetime('now'),datetime('now'))`,
+		userID, plannedDate, sport, title, nullableInt(distanceM), nullableInt(durationS), notes)
 	if err != nil {
 		return 0, err
 	}
 	return res.LastInsertId()
 }
 
-func (db *DB) UpdatePlannedWorkout(id int64, date time.Time, sport, title string, distanceM, durationS sql.NullInt64, notes string) error {
+func (db *DB) UpdatePlannedWorkout(userID, id int64, date time.Time, sport, title string, distanceM, durationS sql.NullInt64, notes string) error {
 	plannedDate := date.UTC().Format("2006-01-02")
-	_, err := db.Exec(`
+	res, err := db.Exec(`
         UPDATE planned_workouts
         SET planned_date=?, sport=?, title=?, distance_m=?, duration_s=?, notes=?, updated_at=datetime('now')
-        WHERE id=?`,
-		plannedDate, sport, title, nullableInt(distanceM), nullableInt(durationS), notes, id)
-	return err
+        WHERE id=? AND user_id=?`,
+		plannedDate, sport, title, nullableInt(distanceM), nullableInt(durationS), notes, id, userID)
+	return affectedOne(res, err)
 }
 
-func (db *DB) UpdatePlannedWorkoutDate(id int64, date time.Time) error {
+func (db *DB) UpdatePlannedWorkoutDate(userID, id int64, date time.Time) error {
 	plannedDate := date.UTC().Format("2006-01-02")
-	_, err := db.Exec(`UPDATE planned_workouts SET planned_date=?, updated_at=datetime('now') WHERE id=?`, plannedDate, id)
-	return err
+	res, err := db.Exec(`UPDATE planned_workouts SET planned_date=?, updated_at=datetime('now') WHERE id=? AND user_id=?`, plannedDate, id, userID)
+	return affectedOne(res, err)
+}
+
+// affectedOne turns "no row matched" into sql.ErrNoRows, so writes to
+// another user's rows fail like missing ones.
+func affectedOne(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-func (db *DB) ListPlannedWorkouts(from, to time.Time) ([]PlannedWorkout, error) {
+func (db *DB) ListPlannedWorkouts(userID int64, from, to time.Time) ([]PlannedWorkout, error) {
 	f := from.UTC().Format("2006-01-02")
 	t := to.UTC().Format("2006-01-02")
 	rows, err := db.Query(`
-        SELECT id, planned_date, sport, title, distance_m, duration_s, notes
+        SELECT id, planned_date, sport, title, distance_m, duration_s, notes, block_id
         FROM planned_workouts
-        WHERE planned_date >= ? AND planned_date < ?
-        ORDER BY planned_date ASC, id ASC`, f, t)
+        WHERE user_id = ? AND planned_date >= ? AND planned_date < ?
+        ORDER BY planned_date ASC, id ASC`, userID, f, t)
 	if err != nil {
 		return nil, err
 	}
@@ -384,7 +503,7 @@ func (db *DB) ListPlannedWorkouts(from, to time.Time) ([]PlannedWorkout, error)
 	for rows.Next() {
 		var it PlannedWorkout
 		var dateStr string
-		if err := rows.Scan(&it.ID, &dateStr, &it.Sport, &it.Title, &it.DistanceM, &it.DurationS, &it.Notes); err != nil {
+		if err := rows.Scan(&it.ID, &dateStr, &it.Sport, &it.Title, &it.DistanceM, &it.DurationS, &it.Notes, &it.BlockID); err != nil {
 			return nil, err
 		}
 		if t, err := time.Parse("2006-01-02", dateStr); err == nil {
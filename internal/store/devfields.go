@@ -0,0 +1,114 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	"garmr/internal/fitx"
+)
+
+// DevField is a developer data field of an activity, e.g. Stryd power or a
+// Connect IQ app's value.
+type DevField struct {
+	ID    int64
+	Index int // developer data index
+	Num   int // field definition number
+	AppID string
+	Name  string
+	Units string
+}
+
+// Label is the field's name, or its numbers if the file didn't name it.
+func (f DevField) Label() string {
+	if f.Name != "" {
+		return f.Name
+	}
+	return fmt.Sprintf("Developer field %d/%d", f.Index, f.Num)
+}
+
+// DevValue is one value of a developer field; Pos is the record's offset in
+// seconds, the lap index, or 0 for the session.
+type DevValue struct {
+	FieldID int64
+	Pos     int
+	Value   float64
+}
+
+// InsertDevFields stores an activity's developer fields and their values,
+// replacing any stored before.
+func (db *DB) InsertDevFields(tx *sql.Tx, id int64, a fitx.Activity) error {
+	if _, err := tx.Exec(`DELETE FROM dev_values WHERE field_id IN (SELECT id FROM dev_fields WHERE activity_id=?)`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM dev_fields WHERE activity_id=?`, id); err != nil {
+		return err
+	}
+	if len(a.DevFields) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(`INSERT INTO dev_values(field_id,msg,pos,value) VALUES(?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, f := range a.DevFields {
+		res, err := tx.Exec(`INSERT INTO dev_fields(activity_id,dev_index,field_num,app_id,name,units) VALUES(?,?,?,?,?,?)`,
+			id, f.Index, f.Num, f.AppID, f.Name, f.Units)
+		if err != nil {
+			return err
+		}
+		fieldID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, v := range f.Values {
+			if _, err := stmt.Exec(fieldID, v.Msg, v.Pos, v.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ListDevFields returns an activity's developer fields in the order the
+// file described them.
+func (db *DB) ListDevFields(activityID int64) ([]DevField, error) {
+	rows, err := db.Query(`SELECT id,dev_index,field_num,app_id,name,units
+        FROM dev_fields WHERE activity_id=? ORDER BY id`, activityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []DevField
+	for rows.Next() {
+		var f DevField
+		if err := rows.Scan(&f.ID, &f.Index, &f.Num, &f.AppID, &f.Name, &f.Units); err != nil {
+			return nil, err
+		}
+		res = append(res, f)
+	}
+	return res, rows.Err()
+}
+
+// ListDevValues returns an activity's developer field values of one message
+// kind ("record", "lap" or "session") with from <= Pos <= to, ordered by
+// position.
+func (db *DB) ListDevValues(activityID int64, msg string, from, to int) ([]DevValue, error) {
+	rows, err := db.Query(`SELECT v.field_id, v.pos, v.value
+        FROM dev_values v JOIN dev_fields f ON f.id = v.field_id
+        WHERE f.activity_id=? AND v.msg=? AND v.pos BETWEEN ? AND ?
+        ORDER BY v.pos, v.field_id`, activityID, msg, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []DevValue
+	for rows.Next() {
+		var v DevValue
+		if err := rows.Scan(&v.FieldID, &v.Pos, &v.Value); err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,286 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"garmr/internal/fitx"
+	"garmr/internal/mount"
+)
+
+// Device is a watch, bike computer or sensor that appeared in a user's
+// activities. Firmware and battery are as of the most recent one.
+type Device struct {
+	ID           int64
+	UserID       int64
+	Key          string
+	Recorder     bool
+	Type         string
+	Source       string
+	Manufacturer string
+	Product      string
+	Serial       int64
+	Firmware     string
+	Battery      string
+	BatteryV     sql.NullFloat64
+	FirstSeenAt  string
+	LastSeenAt   string
+	Activities   int
+
+	// set for watches recognised from their GarminDevice.xml
+	PartNumber    string
+	ConnectedAt   sql.NullString
+	ImportFolders sql.NullString // newline separated; NULL = the default folders
+	ImportRemove  bool
+}
+
+// Pulls reports whether imports from the watch read the folder at path.
+func (d Device) Pulls(path string, byDefault bool) bool {
+	if !d.ImportFolders.Valid {
+		return byDefault
+	}
+	for _, f := range strings.Split(d.ImportFolders.String, "\n") {
+		if f == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Name is what the device is shown as: its make and model, else its
+// sensor type.
+func (d Device) Name() string {
+	name := strings.TrimSpace(d.Manufacturer + " " + d.Product)
+	if name == "" {
+		name = TypeLabel(d.Type)
+	}
+	if name == "" {
+		name = "Unknown device"
+	}
+	return name
+}
+
+// TypeLabel turns a device type like "bike_power" into "Bike power".
+func TypeLabel(t string) string {
+	if t == "" {
+		return ""
+	}
+	t = strings.ReplaceAll(t, "_", " ")
+	return strings.ToUpper(t[:1]) + t[1:]
+}
+
+// DeviceReading is a device's state in one activity.
+type DeviceReading struct {
+	ActivityID int64
+	Start      time.Time
+	Sport      string
+	Firmware   string
+	Battery    string
+	BatteryV   sql.NullFloat64
+}
+
+const deviceTimeLayout = "2006-01-02 15:04:05"
+
+// InsertActivityDevices records the devices of a newly imported activity,
+// adding devices not seen before. Firmware and battery of a device are
+// only updated from activities newer than the ones already seen.
+func (db *DB) InsertActivityDevices(tx *sql.Tx, userID, activityID int64, start time.Time, devs []fitx.Device) error {
+	seen := start.UTC().Format(deviceTimeLayout)
+	for _, d := range devs {
+		var battV any
+		if d.BatteryV != nil {
+			battV = *d.BatteryV
+		}
+		_, err := tx.Exec(`INSERT INTO devices(user_id,device_key,recorder,device_type,source,manufacturer,product,serial,
+                firmware,battery,battery_v,first_seen_at,last_seen_at)
+            VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?)
+            ON CONFLICT(user_id,device_key) DO UPDATE SET
+                first_seen_at = MIN(first_seen_at, excluded.first_seen_at),
+                recorder = CASE WHEN excluded.last_seen_at >= last_seen_at THEN excluded.recorder ELSE recorder END,
+                device_type = CASE WHEN excluded.device_type <> '' THEN excluded.device_type ELSE device_type END,
+                source = CASE WHEN excluded.source <> '' THEN excluded.source ELSE source END,
+                manufacturer = CASE WHEN excluded.manufacturer <> '' THEN excluded.manufacturer ELSE manufacturer END,
+                product = CASE WHEN excluded.product <> '' THEN excluded.product ELSE product END,
+                firmware = CASE WHEN excluded.last_seen_at >= last_seen_at AND excluded.firmware <> '' THEN excluded.firmware ELSE firmware END,
+                battery = CASE WHEN excluded.last_seen_at >= last_seen_at THEN excluded.battery ELSE battery END,
+                battery_v = CASE WHEN excluded.last_seen_at >= last_seen_at THEN excluded.battery_v ELSE battery_v END,
+                last_seen_at = MAX(last_seen_at, excluded.last_seen_at)`,
+			userID, d.Key, boolInt(d.Creator()), d.Type, d.Source, d.Manufacturer, d.Product, int64(d.Serial),
+			d.Firmware, d.Battery, battV, seen, seen)
+		if err != nil {
+			return fmt.Errorf("upsert device %s: %w", d.Key, err)
+		}
+		var deviceID int64
+		if err := tx.QueryRow(`SELECT id FROM devices WHERE user_id=? AND device_key=?`, userID, d.Key).Scan(&deviceID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO activity_devices(activity_id,device_id,device_index,firmware,battery,battery_v)
+            VALUES(?,?,?,?,?,?)`, activityID, deviceID, d.Index, d.Firmware, d.Battery, battV); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetActivityDevices fills in the devices of an activity imported before
+// they were parsed, including its device_vendor and device_model.
+func (db *DB) SetActivityDevices(userID, activityID int64, start time.Time, a fitx.Activity) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`UPDATE activities SET device_vendor=?, device_model=? WHERE id=? AND user_id=?`,
+			a.DeviceVendor, a.DeviceModel, activityID, userID); err != nil {
+			return err
+		}
+		return db.InsertActivityDevices(tx, userID, activityID, start, a.Devices)
+	})
+}
+
+// ActivitiesWithoutDevices lists the user's activities that have no
+// devices recorded yet, with their raw file paths.
+func (db *DB) ActivitiesWithoutDevices(userID int64) ([]Activity, error) {
+	rows, err := db.Query(`SELECT `+activityColumns+` FROM activities
+        WHERE user_id=? AND id NOT IN (SELECT activity_id FROM activity_devices)
+        ORDER BY start_time_utc`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Activity
+	for rows.Next() {
+		a, err := scanActivity(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, a)
+	}
+	return res, rows.Err()
+}
+
+const deviceColumns = `d.id, d.user_id, d.device_key, d.recorder, d.device_type, d.source, d.manufacturer, d.product, d.serial,
+    d.firmware, d.battery, d.battery_v, d.first_seen_at, d.last_seen_at,
+    (SELECT COUNT(*) FROM activity_devices ad WHERE ad.device_id = d.id),
+    d.part_number, d.connected_at, d.import_folders, d.import_remove`
+
+func scanDevice(row rowScanner) (Device, error) {
+	var d Device
+	var recorder, remove int
+	err := row.Scan(&d.ID, &d.UserID, &d.Key, &recorder, &d.Type, &d.Source, &d.Manufacturer, &d.Product, &d.Serial,
+		&d.Firmware, &d.Battery, &d.BatteryV, &d.FirstSeenAt, &d.LastSeenAt, &d.Activities,
+		&d.PartNumber, &d.ConnectedAt, &d.ImportFolders, &remove)
+	d.Recorder = recorder != 0
+	d.ImportRemove = remove != 0
+	return d, err
+}
+
+// ListDevices returns the user's devices, recorders first, most recently
+// seen first.
+func (db *DB) ListDevices(userID int64) ([]Device, error) {
+	rows, err := db.Query(`SELECT `+deviceColumns+` FROM devices d WHERE d.user_id=?
+        ORDER BY d.recorder DESC, d.last_seen_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Device
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+func (db *DB) GetDevice(userID, id int64) (*Device, error) {
+	return scanDevicePtr(db.QueryRow(`SELECT `+deviceColumns+` FROM devices d WHERE d.id=? AND d.user_id=?`, id, userID))
+}
+
+func scanDevicePtr(row rowScanner) (*Device, error) {
+	d, err := scanDevice(row)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// DeviceReadings returns the device's firmware and battery per activity,
+// oldest first.
+func (db *DB) DeviceReadings(deviceID int64) ([]DeviceReading, error) {
+	rows, err := db.Query(`SELECT a.id, a.start_time_utc, COALESCE(a.sport,''), ad.firmware, ad.battery, ad.battery_v
+        FROM activity_devices ad JOIN activities a ON a.id = ad.activity_id
+        WHERE ad.device_id=? ORDER BY a.start_time_utc`, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []DeviceReading
+	for rows.Next() {
+		var r DeviceReading
+		var start string
+		if err := rows.Scan(&r.ActivityID, &start, &r.Sport, &r.Firmware, &r.Battery, &r.BatteryV); err != nil {
+			return nil, err
+		}
+		r.Start, _ = ParseStoredTime(start)
+		res = append(res, r)
+	}
+	return res, rows.Err()
+}
+
+// ActivityDevices returns the devices used in an activity, with firmware
+// and battery as they were then.
+func (db *DB) ActivityDevices(activityID int64) ([]Device, error) {
+	rows, err := db.Query(`SELECT d.id, d.user_id, d.device_key, ad.device_index = 0, d.device_type, d.source,
+            d.manufacturer, d.product, d.serial, ad.firmware, ad.battery, ad.battery_v, d.first_seen_at, d.last_seen_at, 0,
+            d.part_number, d.connected_at, d.import_folders, d.import_remove
+        FROM activity_devices ad JOIN devices d ON d.id = ad.device_id
+        WHERE ad.activity_id=? ORDER BY ad.device_index`, activityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Device
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+// RegisterWatch records a watch found on a mounted volume as a device of
+// the user, keyed like the recorder of its FIT files, and returns it with
+// its import settings. Its firmware is current, so it wins over older
+// activities.
+func (db *DB) RegisterWatch(userID int64, w mount.Watch) (*Device, error) {
+	now := time.Now().UTC().Format(deviceTimeLayout)
+	key := fmt.Sprintf("serial:%d", w.UnitID)
+	if w.UnitID == 0 {
+		key = "model:garmin:" + strings.ToLower(w.Model) + ":"
+	}
+	_, err := db.Exec(`INSERT INTO devices(user_id,device_key,recorder,source,manufacturer,product,serial,firmware,
+            part_number,connected_at,first_seen_at,last_seen_at)
+        VALUES(?,?,1,'local','Garmin',?,?,?,?,?,?,?)
+        ON CONFLICT(user_id,device_key) DO UPDATE SET
+            recorder = 1,
+            product = excluded.product,
+            firmware = CASE WHEN excluded.firmware <> '' THEN excluded.firmware ELSE firmware END,
+            part_number = excluded.part_number,
+            connected_at = excluded.connected_at,
+            last_seen_at = MAX(last_seen_at, excluded.last_seen_at)`,
+		userID, key, w.Model, int64(w.UnitID), w.Software, w.PartNumber, now, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("register %s: %w", w.Name(), err)
+	}
+	return scanDevicePtr(db.QueryRow(`SELECT `+deviceColumns+` FROM devices d WHERE d.user_id=? AND d.device_key=?`, userID, key))
+}
+
+// SetDeviceImport saves which folders of a watch are imported and whether
+// imported files are removed from it.
+func (db *DB) SetDeviceImport(userID, id int64, folders []string, remove bool) error {
+	return affectedOne(db.Exec(`UPDATE devices SET import_folders=?, import_remove=? WHERE id=? AND user_id=?`,
+		strings.Join(folders, "\n"), boolInt(remove), id, userID))
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// hashToken returns the hex SHA-256 of a bearer-style secret. Only hashes
+// are persisted so a leaked database doesn't expose usable tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateCalendarFeedToken issues a new iCalendar feed token for the user,
+// replacing any previous one. The plain token is only returned here.
+func (db *DB) CreateCalendarFeedToken(userID int64) (string, error) {
+	token, err := generateSessionID()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.Exec(`
+        INSERT INTO calendar_feeds(user_id, token_hash, created_at) VALUES(?,?,datetime('now'))
+        ON CONFLICT(user_id) DO UPDATE SET token_hash=excluded.token_hash, created_at=excluded.created_at, last_used_at=NULL`,
+		userID, hashToken(token))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (db *DB) DeleteCalendarFeedToken(userID int64) error {
+	_, err := db.Exec(`DELETE FROM calendar_feeds WHERE user_id=?`, userID)
+	return err
+}
+
+// CalendarFeedCreatedAt reports when the user's feed token was issued;
+// ok is false when the user has no feed.
+func (db *DB) CalendarFeedCreatedAt(userID int64) (createdAt string, ok bool, err error) {
+	err = db.QueryRow(`SELECT created_at FROM calendar_feeds WHERE user_id=?`, userID).Scan(&createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return createdAt, true, nil
+}
+
+// UserIDForCalendarFeedToken resolves a feed token to its owner.
+func (db *DB) UserIDForCalendarFeedToken(token string) (int64, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return 0, sql.ErrNoRows
+	}
+	var userID int64
+	h := hashToken(token)
+	if err := db.QueryRow(`
+        SELECT f.user_id FROM calendar_feeds f JOIN users u ON u.id = f.user_id
+        WHERE f.token_hash=? AND u.disabled=0`, h).Scan(&userID); err != nil {
+		return 0, err
+	}
+	_, _ = db.Exec(`UPDATE calendar_feeds SET last_used_at=datetime('now') WHERE token_hash=?`, h)
+	return userID, nil
+}
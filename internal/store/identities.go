@@ -0,0 +1,78 @@
+package store
+
+import "database/sql"
+
+// UserForIdentity returns the user linked to an OpenID Connect account and
+// notes that it was used. It fails with ErrNoRows if none is linked.
+func (db *DB) UserForIdentity(issuer, subject string) (*AuthUser, error) {
+	var userID int64
+	err := db.QueryRow(`SELECT user_id FROM user_identities WHERE issuer=? AND subject=?`, issuer, subject).Scan(&userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`UPDATE user_identities SET last_used_at=datetime('now') WHERE issuer=? AND subject=?`, issuer, subject); err != nil {
+		return nil, err
+	}
+	return db.GetUserByID(userID)
+}
+
+// LinkIdentity links an OpenID Connect account to userID, replacing an
+// earlier link of the same account.
+func (db *DB) LinkIdentity(userID int64, issuer, subject string) error {
+	_, err := db.Exec(`INSERT INTO user_identities(issuer,subject,user_id,last_used_at) VALUES(?,?,?,datetime('now'))
+        ON CONFLICT(issuer,subject) DO UPDATE SET user_id=excluded.user_id, last_used_at=excluded.last_used_at`,
+		issuer, subject, userID)
+	return err
+}
+
+// Identity is an OpenID Connect account linked to a user.
+type Identity struct {
+	Issuer, Subject string
+	CreatedAt       string
+	LastUsedAt      string // empty if never used to sign in
+}
+
+// ListIdentities returns the OpenID Connect accounts linked to userID.
+func (db *DB) ListIdentities(userID int64) ([]Identity, error) {
+	rows, err := db.Query(`SELECT issuer, subject, created_at, COALESCE(last_used_at,'')
+        FROM user_identities WHERE user_id=? ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Identity
+	for rows.Next() {
+		var i Identity
+		if err := rows.Scan(&i.Issuer, &i.Subject, &i.CreatedAt, &i.LastUsedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, i)
+	}
+	return res, rows.Err()
+}
+
+// UnlinkIdentity removes one of userID's linked accounts; sql.ErrNoRows
+// means it isn't linked to them.
+func (db *DB) UnlinkIdentity(userID int64, issuer, subject string) error {
+	res, err := db.Exec(`DELETE FROM user_identities WHERE user_id=? AND issuer=? AND subject=?`, userID, issuer, subject)
+	return affectedOne(res, err)
+}
+
+// CreateSSOUser provisions a user that signs in through single sign-on. It
+// gets a random password nobody knows; an admin can reset it if the account
+// should also sign in locally.
+func (db *DB) CreateSSOUser(username, role string) (*AuthUser, error) {
+	password, err := generateSessionID()
+	if err != nil {
+		return nil, err
+	}
+	var id int64
+	err = db.WithTx(func(tx *sql.Tx) error {
+		id, err = insertUser(tx, username, password, role)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return db.GetUserByID(id)
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const inviteTTL = 7 * 24 * time.Hour
+
+type Invite struct {
+	ID        int64
+	Role      string
+	CreatedBy string // username, empty if that user is gone
+	CreatedAt string
+	ExpiresAt string
+}
+
+// CreateInvite issues a single-use sign-up token for the given role. Only
+// its hash is stored; the plain token is returned once to the caller.
+func (db *DB) CreateInvite(createdBy int64, role string) (string, error) {
+	if !ValidRole(role) {
+		return "", fmt.Errorf("invalid role %q", role)
+	}
+	token, err := generateSessionID()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.Exec(`INSERT INTO user_invites(token_hash, role, created_by, created_at, expires_at) VALUES(?,?,?,datetime('now'),?)`,
+		hashToken(token), role, createdBy, time.Now().UTC().Add(inviteTTL).Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ListOpenInvites returns unused invites that have not expired yet.
+func (db *DB) ListOpenInvites() ([]Invite, error) {
+	rows, err := db.Query(`
+        SELECT i.id, i.role, COALESCE(u.username,''), i.created_at, i.expires_at
+        FROM user_invites i LEFT JOIN users u ON u.id = i.created_by
+        WHERE i.used_at IS NULL AND i.expires_at > datetime('now')
+        ORDER BY i.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Invite
+	for rows.Next() {
+		var inv Invite
+		if err := rows.Scan(&inv.ID, &inv.Role, &inv.CreatedBy, &inv.CreatedAt, &inv.ExpiresAt); err != nil {
+			return nil, err
+		}
+		res = append(res, inv)
+	}
+	return res, rows.Err()
+}
+
+func (db *DB) DeleteInvite(id int64) error {
+	_, err := db.Exec(`DELETE FROM user_invites WHERE id=?`, id)
+	return err
+}
+
+// InviteRole returns the role an open invite grants, or sql.ErrNoRows if
+// the token is unknown, used or expired.
+func (db *DB) InviteRole(token string) (string, error) {
+	var role string
+	err := db.QueryRow(`SELECT role FROM user_invites WHERE token_hash=? AND used_at IS NULL AND expires_at > datetime('now')`,
+		hashToken(token)).Scan(&role)
+	return role, err
+}
+
+// AcceptInvite creates the account for an open invite and marks it used.
+func (db *DB) AcceptInvite(token, username, password string) (int64, error) {
+	var userID int64
+	err := db.WithTx(func(tx *sql.Tx) error {
+		var id int64
+		var role string
+		err := tx.QueryRow(`SELECT id, role FROM user_invites WHERE token_hash=? AND used_at IS NULL AND expires_at > datetime('now')`,
+			hashToken(token)).Scan(&id, &role)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("this invite is invalid, used or expired")
+		}
+		if err != nil {
+			return err
+		}
+		if userID, err = insertUser(tx, username, password, role); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE user_invites SET used_at=datetime('now'), used_by=? WHERE id=?`, userID, id)
+		return err
+	})
+	return userID, err
+}
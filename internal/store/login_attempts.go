@@ -0,0 +1,68 @@
+package store
+
+import "time"
+
+// Outcomes of a sign-in attempt.
+const (
+	LoginOK     = "ok"
+	LoginFailed = "failed"
+	LoginLocked = "locked" // refused without checking the password
+)
+
+// keepLoginAttempts is how long the sign-in audit log is kept.
+const keepLoginAttempts = 90 * 24 * time.Hour
+
+type LoginAttempt struct {
+	ID        int64
+	CreatedAt string
+	Username  string
+	IP        string
+	Outcome   string
+}
+
+// RecordLoginAttempt adds a sign-in attempt to the audit log and drops
+// entries older than 90 days.
+func (db *DB) RecordLoginAttempt(username, ip, outcome string) error {
+	if _, err := db.Exec(`INSERT INTO login_attempts(created_at, username, ip, outcome) VALUES(datetime('now'),?,?,?)`,
+		username, ip, outcome); err != nil {
+		return err
+	}
+	_, err := db.Exec(`DELETE FROM login_attempts WHERE created_at < ?`, time.Now().UTC().Add(-keepLoginAttempts).Format("2006-01-02 15:04:05"))
+	return err
+}
+
+// LoginFailures counts the failed sign-ins since since, for username (only
+// those after its last successful sign-in) and from ip.
+func (db *DB) LoginFailures(username, ip string, since time.Time) (byUser, byIP int, err error) {
+	ts := since.UTC().Format("2006-01-02 15:04:05")
+	err = db.QueryRow(`
+        SELECT COUNT(*) FROM login_attempts
+        WHERE username=?1 AND outcome='failed' AND created_at >= ?2
+          AND id > COALESCE((SELECT MAX(id) FROM login_attempts WHERE username=?1 AND outcome='ok'), 0)`,
+		username, ts).Scan(&byUser)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = db.QueryRow(`SELECT COUNT(*) FROM login_attempts WHERE ip=? AND outcome='failed' AND created_at >= ?`,
+		ip, ts).Scan(&byIP)
+	return byUser, byIP, err
+}
+
+// ListFailedLogins returns the latest failed and refused sign-ins, newest first.
+func (db *DB) ListFailedLogins(limit int) ([]LoginAttempt, error) {
+	rows, err := db.Query(`SELECT id, created_at, username, ip, outcome FROM login_attempts
+        WHERE outcome != 'ok' ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []LoginAttempt
+	for rows.Next() {
+		var a LoginAttempt
+		if err := rows.Scan(&a.ID, &a.CreatedAt, &a.Username, &a.IP, &a.Outcome); err != nil {
+			return nil, err
+		}
+		res = append(res, a)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS plan_blocks (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL,
+  source TEXT NOT NULL DEFAULT 'recurrence', -- recurrence | template
+  anchor_date TEXT,                          -- race date for templates (YYYY-MM-DD)
+  created_at DATETIME DEFAULT (datetime('now'))
+);
+ALTER TABLE planned_workouts ADD COLUMN block_id INTEGER REFERENCES plan_blocks(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS planned_workouts_block_idx ON planned_workouts(block_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS planned_workouts_block_idx;
+ALTER TABLE planned_workouts DROP COLUMN block_id;
+DROP TABLE IF EXISTS plan_blocks;
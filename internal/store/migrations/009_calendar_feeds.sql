@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+  user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  token_hash TEXT NOT NULL UNIQUE, -- sha256 hex of the feed token
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  last_used_at TEXT
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS calendar_feeds;
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'athlete'; -- admin | athlete | viewer
+ALTER TABLE users ADD COLUMN disabled INTEGER NOT NULL DEFAULT 0;
+-- accounts created before roles existed had full access
+UPDATE users SET role = 'admin';
+
+CREATE TABLE IF NOT EXISTS user_invites (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  token_hash TEXT NOT NULL UNIQUE, -- sha256 hex of the invite token
+  role TEXT NOT NULL,
+  created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  expires_at TEXT NOT NULL,
+  used_at TEXT,
+  used_by INTEGER REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS user_invites;
+ALTER TABLE users DROP COLUMN disabled;
+ALTER TABLE users DROP COLUMN role;
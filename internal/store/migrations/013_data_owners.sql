@@ -0,0 +1,41 @@
+-- +goose Up
+-- Activities and plans belong to one user. Existing rows go to the first
+-- admin; rows left NULL (no users yet) are claimed by the bootstrap account.
+ALTER TABLE activities ADD COLUMN user_id INTEGER REFERENCES users(id);
+ALTER TABLE planned_workouts ADD COLUMN user_id INTEGER REFERENCES users(id);
+ALTER TABLE plan_blocks ADD COLUMN user_id INTEGER REFERENCES users(id);
+UPDATE activities SET user_id = (SELECT MIN(id) FROM users WHERE role = 'admin');
+UPDATE planned_workouts SET user_id = (SELECT MIN(id) FROM users WHERE role = 'admin');
+UPDATE plan_blocks SET user_id = (SELECT MIN(id) FROM users WHERE role = 'admin');
+CREATE INDEX IF NOT EXISTS idx_activities_user_start ON activities(user_id, start_time_utc);
+CREATE INDEX IF NOT EXISTS planned_workouts_user_date_idx ON planned_workouts(user_id, planned_date);
+-- Duplicate activities are detected per user, so two users can import the
+-- same file (a coach importing for an athlete, a shared watch).
+DROP INDEX IF EXISTS uidx_activities_fituid;
+DROP INDEX IF EXISTS uidx_activities_filehash;
+CREATE UNIQUE INDEX IF NOT EXISTS uidx_activities_user_fituid ON activities(user_id, fit_uid);
+CREATE UNIQUE INDEX IF NOT EXISTS uidx_activities_user_filehash ON activities(user_id, file_hash);
+
+CREATE TABLE IF NOT EXISTS sharing_grants (
+  owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,   -- whose data
+  grantee_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- who may see it
+  view_activities INTEGER NOT NULL DEFAULT 0,
+  view_stats INTEGER NOT NULL DEFAULT 0,
+  edit_plans INTEGER NOT NULL DEFAULT 0,
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  PRIMARY KEY (owner_id, grantee_id)
+);
+CREATE INDEX IF NOT EXISTS idx_sharing_grants_grantee ON sharing_grants(grantee_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS sharing_grants;
+DROP INDEX IF EXISTS uidx_activities_user_filehash;
+DROP INDEX IF EXISTS uidx_activities_user_fituid;
+-- users may share files by now, so the old indexes can't be unique again
+CREATE INDEX IF NOT EXISTS uidx_activities_fituid ON activities(fit_uid);
+CREATE INDEX IF NOT EXISTS uidx_activities_filehash ON activities(file_hash);
+DROP INDEX IF EXISTS planned_workouts_user_date_idx;
+DROP INDEX IF EXISTS idx_activities_user_start;
+ALTER TABLE plan_blocks DROP COLUMN user_id;
+ALTER TABLE planned_workouts DROP COLUMN user_id;
+ALTER TABLE activities DROP COLUMN user_id;
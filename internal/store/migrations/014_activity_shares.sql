@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS activity_shares (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  activity_id INTEGER NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+  token_hash TEXT NOT NULL UNIQUE, -- sha256 hex of the link token
+  privacy INTEGER NOT NULL DEFAULT 1, -- hide the start and end of the track
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  expires_at TEXT, -- NULL = never
+  views INTEGER NOT NULL DEFAULT 0,
+  last_viewed_at TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_activity_shares_activity ON activity_shares(activity_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS activity_shares;
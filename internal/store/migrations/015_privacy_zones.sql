@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS privacy_zones (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL DEFAULT '',
+  lat_deg REAL NOT NULL,
+  lon_deg REAL NOT NULL,
+  radius_m INTEGER NOT NULL,
+  created_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+CREATE INDEX IF NOT EXISTS idx_privacy_zones_user ON privacy_zones(user_id);
+
+-- metres cut from the start and end of shared and exported tracks
+ALTER TABLE users ADD COLUMN privacy_trim_m INTEGER NOT NULL DEFAULT 500;
+-- also hide privacy zones on the in-app map
+ALTER TABLE users ADD COLUMN privacy_own_map INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_privacy_zones_user;
+DROP TABLE IF EXISTS privacy_zones;
+ALTER TABLE users DROP COLUMN privacy_own_map;
+ALTER TABLE users DROP COLUMN privacy_trim_m;
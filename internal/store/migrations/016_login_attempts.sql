@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS login_attempts (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  username TEXT NOT NULL,
+  ip TEXT NOT NULL,
+  outcome TEXT NOT NULL -- ok | failed | locked
+);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_username ON login_attempts(username, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip, created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_login_attempts_ip;
+DROP INDEX IF EXISTS idx_login_attempts_username;
+DROP TABLE IF EXISTS login_attempts;
@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+-- password checked, second factor still missing; not a usable session
+ALTER TABLE sessions ADD COLUMN mfa_pending INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE users ADD COLUMN totp_secret TEXT; -- NULL = two-factor off
+ALTER TABLE users ADD COLUMN totp_pending TEXT; -- secret being set up, not confirmed yet
+ALTER TABLE users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0; -- last accepted code, against replay
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash TEXT NOT NULL, -- sha256 hex of the normalised code
+  used_at TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_recovery_codes_user;
+DROP TABLE IF EXISTS recovery_codes;
+ALTER TABLE users DROP COLUMN totp_last_step;
+ALTER TABLE users DROP COLUMN totp_pending;
+ALTER TABLE users DROP COLUMN totp_secret;
+ALTER TABLE sessions DROP COLUMN mfa_pending;
+ALTER TABLE sessions DROP COLUMN ip;
+ALTER TABLE sessions DROP COLUMN user_agent;
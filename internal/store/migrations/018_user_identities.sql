@@ -0,0 +1,15 @@
+-- +goose Up
+-- Single sign-on accounts (OpenID Connect issuer + subject) linked to users.
+CREATE TABLE IF NOT EXISTS user_identities (
+  issuer TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  last_used_at TEXT,
+  PRIMARY KEY (issuer, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_user_identities_user;
+DROP TABLE IF EXISTS user_identities;
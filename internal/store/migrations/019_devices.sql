@@ -0,0 +1,36 @@
+-- +goose Up
+-- Recording devices and paired sensors seen in a user's activities.
+CREATE TABLE IF NOT EXISTS devices (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  device_key TEXT NOT NULL, -- serial:N, ant:TYPE:NUMBER or model:...
+  recorder INTEGER NOT NULL DEFAULT 0, -- made the files, rather than a sensor
+  device_type TEXT NOT NULL DEFAULT '', -- ANT+ profile, e.g. heart_rate
+  source TEXT NOT NULL DEFAULT '',
+  manufacturer TEXT NOT NULL DEFAULT '',
+  product TEXT NOT NULL DEFAULT '',
+  serial INTEGER NOT NULL DEFAULT 0,
+  -- as of the most recent activity
+  firmware TEXT NOT NULL DEFAULT '',
+  battery TEXT NOT NULL DEFAULT '',
+  battery_v REAL,
+  first_seen_at TEXT NOT NULL,
+  last_seen_at TEXT NOT NULL,
+  UNIQUE(user_id, device_key)
+);
+
+CREATE TABLE IF NOT EXISTS activity_devices (
+  activity_id INTEGER NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+  device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  device_index INTEGER NOT NULL,
+  firmware TEXT NOT NULL DEFAULT '',
+  battery TEXT NOT NULL DEFAULT '',
+  battery_v REAL,
+  PRIMARY KEY (activity_id, device_id)
+);
+CREATE INDEX IF NOT EXISTS idx_activity_devices_device ON activity_devices(device_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_activity_devices_device;
+DROP TABLE IF EXISTS activity_devices;
+DROP TABLE IF EXISTS devices;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Watches recognised from their GarminDevice.xml and how to import from them.
+ALTER TABLE devices ADD COLUMN part_number TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN connected_at TEXT; -- last time it was mounted
+ALTER TABLE devices ADD COLUMN import_folders TEXT; -- newline separated; NULL = the activity folders
+ALTER TABLE devices ADD COLUMN import_remove INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE devices DROP COLUMN import_remove;
+ALTER TABLE devices DROP COLUMN import_folders;
+ALTER TABLE devices DROP COLUMN connected_at;
+ALTER TABLE devices DROP COLUMN part_number;
@@ -0,0 +1,45 @@
+-- +goose Up
+-- Daily wellness data from the watch's monitoring, sleep, HRV status and
+-- metrics files. Columns are NULL when no file said anything about them.
+CREATE TABLE IF NOT EXISTS wellness_days (
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  day TEXT NOT NULL, -- local date, YYYY-MM-DD
+  steps INTEGER,
+  distance_m REAL,
+  moderate_min INTEGER,
+  vigorous_min INTEGER,
+  resting_hr INTEGER,
+  min_hr INTEGER,
+  max_hr INTEGER,
+  stress_avg REAL,
+  stress_max INTEGER,
+  stress_samples INTEGER NOT NULL DEFAULT 0,
+  sleep_start TEXT, -- the night that ended on day, UTC
+  sleep_end TEXT,
+  sleep_deep_s INTEGER,
+  sleep_light_s INTEGER,
+  sleep_rem_s INTEGER,
+  sleep_awake_s INTEGER,
+  sleep_score INTEGER,
+  hrv_last_night REAL, -- ms
+  hrv_weekly REAL,
+  hrv_status TEXT NOT NULL DEFAULT '',
+  vo2max REAL,
+  vo2max_cycling REAL,
+  PRIMARY KEY (user_id, day)
+);
+
+-- Imported wellness files, so the same file isn't counted twice.
+CREATE TABLE IF NOT EXISTS wellness_files (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  file_type INTEGER NOT NULL,
+  raw_path TEXT NOT NULL,
+  file_hash TEXT NOT NULL,
+  imported_at TEXT NOT NULL DEFAULT (datetime('now')),
+  UNIQUE(user_id, file_hash)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS wellness_files;
+DROP TABLE IF EXISTS wellness_days;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- Weight and body composition, entered by hand, imported from CSV or from
+-- scale FIT files.
+CREATE TABLE IF NOT EXISTS weights (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  measured_at TEXT NOT NULL, -- UTC, RFC 3339
+  weight_kg REAL NOT NULL,
+  fat_pct REAL,
+  water_pct REAL,
+  muscle_kg REAL,
+  bone_kg REAL,
+  bmi REAL,
+  source TEXT NOT NULL DEFAULT 'manual', -- manual, csv, fit
+  UNIQUE(user_id, measured_at)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS weights;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- Pool swims: the pool length and each length swum. pool_length_m is NULL
+-- until the activity's FIT file was read for lengths, and 0 if it isn't a
+-- pool swim.
+ALTER TABLE activities ADD COLUMN pool_length_m REAL;
+
+CREATE TABLE IF NOT EXISTS swim_lengths (
+  activity_id INTEGER NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+  length_index INTEGER NOT NULL,
+  start_offset_s REAL NOT NULL,
+  duration_s REAL NOT NULL,
+  strokes INTEGER NOT NULL DEFAULT 0,
+  stroke TEXT NOT NULL DEFAULT '',
+  active INTEGER NOT NULL DEFAULT 1, -- 0 for rests
+  PRIMARY KEY (activity_id, length_index)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS swim_lengths;
+ALTER TABLE activities DROP COLUMN pool_length_m;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Optional record fields: distance, running dynamics, respiration and
+-- power balance. NULL when the device didn't record them.
+ALTER TABLE records ADD COLUMN distance_m REAL;
+ALTER TABLE records ADD COLUMN cad_fraction REAL;
+ALTER TABLE records ADD COLUMN vert_osc_mm REAL;
+ALTER TABLE records ADD COLUMN gct_ms REAL;
+ALTER TABLE records ADD COLUMN gct_balance REAL; -- % left
+ALTER TABLE records ADD COLUMN stride_m REAL;
+ALTER TABLE records ADD COLUMN vert_ratio REAL;
+ALTER TABLE records ADD COLUMN resp_rate REAL;
+ALTER TABLE records ADD COLUMN power_balance REAL; -- % left
+
+-- +goose Down
+ALTER TABLE records DROP COLUMN power_balance;
+ALTER TABLE records DROP COLUMN resp_rate;
+ALTER TABLE records DROP COLUMN vert_ratio;
+ALTER TABLE records DROP COLUMN stride_m;
+ALTER TABLE records DROP COLUMN gct_balance;
+ALTER TABLE records DROP COLUMN gct_ms;
+ALTER TABLE records DROP COLUMN vert_osc_mm;
+ALTER TABLE records DROP COLUMN cad_fraction;
+ALTER TABLE records DROP COLUMN distance_m;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- Developer data fields (Connect IQ apps, Stryd) as described in each FIT
+-- file, and their values per record, lap and session.
+CREATE TABLE IF NOT EXISTS dev_fields (
+  id INTEGER PRIMARY KEY,
+  activity_id INTEGER NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+  dev_index INTEGER NOT NULL,
+  field_num INTEGER NOT NULL,
+  app_id TEXT NOT NULL DEFAULT '',
+  name TEXT NOT NULL DEFAULT '',
+  units TEXT NOT NULL DEFAULT '',
+  UNIQUE (activity_id, dev_index, field_num)
+);
+
+CREATE TABLE IF NOT EXISTS dev_values (
+  field_id INTEGER NOT NULL REFERENCES dev_fields(id) ON DELETE CASCADE,
+  msg TEXT NOT NULL, -- record, lap or session
+  pos INTEGER NOT NULL, -- record: t_offset_s; lap: lap_index; session: 0
+  value REAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_dev_values_field ON dev_values(field_id, msg, pos);
+
+-- +goose Down
+DROP TABLE IF EXISTS dev_values;
+DROP TABLE IF EXISTS dev_fields;
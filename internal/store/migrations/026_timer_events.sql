@@ -0,0 +1,18 @@
+-- +goose Up
+-- Elapsed and moving time next to duration_s (the timer time), and the
+-- timer's start and stop events. elapsed_s is NULL until the activity's
+-- FIT file was read for them.
+ALTER TABLE activities ADD COLUMN elapsed_s INTEGER;
+ALTER TABLE activities ADD COLUMN moving_s INTEGER;
+
+CREATE TABLE IF NOT EXISTS timer_events (
+  activity_id INTEGER NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+  t_offset_s INTEGER NOT NULL,
+  start INTEGER NOT NULL -- 1 start, 0 stop
+);
+CREATE INDEX IF NOT EXISTS idx_timer_events_activity ON timer_events(activity_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS timer_events;
+ALTER TABLE activities DROP COLUMN moving_s;
+ALTER TABLE activities DROP COLUMN elapsed_s;
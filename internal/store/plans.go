@@ -0,0 +1,133 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PlanBlock groups planned workouts created together, either from a
+// recurrence rule or from an imported multi-week template.
+type PlanBlock struct {
+	ID         int64
+	Name       string
+	Source     string
+	AnchorDate sql.NullString
+	Count      int
+	FirstDate  string
+	LastDate   string
+}
+
+// CreatePlanBlock stores a block and all of its workouts in one transaction.
+func (db *DB) CreatePlanBlock(userID int64, name, source string, anchor *time.Time, workouts []PlannedWorkout) (int64, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, errors.New("plan name required")
+	}
+	if len(workouts) == 0 {
+		return 0, errors.New("plan has no workouts")
+	}
+	var anchorVal interface{}
+	if anchor != nil {
+		anchorVal = anchor.UTC().Format("2006-01-02")
+	}
+
+	var blockID int64
+	err := db.WithTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`INSERT INTO plan_blocks(user_id, name, source, anchor_date, created_at) VALUES(?,?,?,?,datetime('now'))`,
+			userID, name, source, anchorVal)
+		if err != nil {
+			return err
+		}
+		if blockID, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		stmt, err := tx.Prepare(`
+            INSERT INTO planned_workouts(user_id, planned_date, sport, title, distance_m, duration_s, notes, block_id, created_at, updated_at)
+            VALUES(?,?,?,?,?,?,?,?,datetime('now'),datetime('now'))`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, w := range workouts {
+			if _, err := stmt.Exec(userID, w.PlannedDate.UTC().Format("2006-01-02"), w.Sport, w.Title,
+				nullableInt(w.DistanceM), nullableInt(w.DurationS), w.Notes, blockID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return blockID, err
+}
+
+func (db *DB) ListPlanBlocks(userID int64) ([]PlanBlock, error) {
+	rows, err := db.Query(`
+        SELECT b.id, b.name, b.source, b.anchor_date,
+               COUNT(w.id), COALESCE(MIN(w.planned_date), ''), COALESCE(MAX(w.planned_date), '')
+        FROM plan_blocks b
+        LEFT JOIN planned_workouts w ON w.block_id = b.id
+        WHERE b.user_id = ?
+        GROUP BY b.id
+        ORDER BY MIN(w.planned_date) DESC, b.id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []PlanBlock
+	for rows.Next() {
+		var b PlanBlock
+		if err := rows.Scan(&b.ID, &b.Name, &b.Source, &b.AnchorDate, &b.Count, &b.FirstDate, &b.LastDate); err != nil {
+			return nil, err
+		}
+		res = append(res, b)
+	}
+	return res, rows.Err()
+}
+
+// ShiftPlanBlock moves every workout in one of the user's blocks by the
+// given number of days.
+func (db *DB) ShiftPlanBlock(userID, id int64, days int) error {
+	if days == 0 {
+		return nil
+	}
+	modifier := fmt.Sprintf("%+d days", days)
+	return db.WithTx(func(tx *sql.Tx) error {
+		if err := ownsPlanBlock(tx, userID, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE planned_workouts SET planned_date=date(planned_date, ?), updated_at=datetime('now') WHERE block_id=?`, modifier, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`UPDATE plan_blocks SET anchor_date=date(anchor_date, ?) WHERE id=? AND anchor_date IS NOT NULL`, modifier, id)
+		return err
+	})
+}
+
+// DeletePlanBlock removes a block together with its workouts. Workouts are
+// deleted explicitly since SQLite foreign keys may not be enforced.
+func (db *DB) DeletePlanBlock(userID, id int64) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		if err := ownsPlanBlock(tx, userID, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM planned_workouts WHERE block_id=?`, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM plan_blocks WHERE id=?`, id)
+		return err
+	})
+}
+
+func ownsPlanBlock(tx *sql.Tx, userID, id int64) error {
+	var n int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM plan_blocks WHERE id=? AND user_id=?`, id, userID).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
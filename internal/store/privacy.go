@@ -0,0 +1,86 @@
+package store
+
+import (
+	"errors"
+	"strings"
+)
+
+// Limits for privacy zone radii and the start/end trim, in metres.
+const (
+	MinPrivacyRadiusM = 50
+	MaxPrivacyRadiusM = 5000
+	MaxPrivacyTrimM   = 5000
+)
+
+// PrivacyZone is a circle in which a user's tracks are hidden from others.
+type PrivacyZone struct {
+	ID        int64
+	UserID    int64
+	Name      string
+	Lat       float64
+	Lon       float64
+	RadiusM   int
+	CreatedAt string
+}
+
+// PrivacySettings says how a user's tracks are cut before they are shown
+// to others. The raw records are never changed.
+type PrivacySettings struct {
+	TrimM  int  // metres hidden at the start and end of a track
+	OwnMap bool // apply zones and trim to the owner's in-app map as well
+}
+
+func (db *DB) ListPrivacyZones(userID int64) ([]PrivacyZone, error) {
+	rows, err := db.Query(`SELECT id, user_id, name, lat_deg, lon_deg, radius_m, created_at
+        FROM privacy_zones WHERE user_id=? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []PrivacyZone
+	for rows.Next() {
+		var z PrivacyZone
+		if err := rows.Scan(&z.ID, &z.UserID, &z.Name, &z.Lat, &z.Lon, &z.RadiusM, &z.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, z)
+	}
+	return res, rows.Err()
+}
+
+func (db *DB) AddPrivacyZone(z PrivacyZone) (int64, error) {
+	z.Name = strings.TrimSpace(z.Name)
+	if z.Lat < -90 || z.Lat > 90 || z.Lon < -180 || z.Lon > 180 || (z.Lat == 0 && z.Lon == 0) {
+		return 0, errors.New("invalid zone center")
+	}
+	if z.RadiusM < MinPrivacyRadiusM || z.RadiusM > MaxPrivacyRadiusM {
+		return 0, errors.New("zone radius must be between 50 and 5000 m")
+	}
+	res, err := db.Exec(`INSERT INTO privacy_zones(user_id, name, lat_deg, lon_deg, radius_m, created_at)
+        VALUES(?,?,?,?,?,datetime('now'))`, z.UserID, z.Name, z.Lat, z.Lon, z.RadiusM)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (db *DB) DeletePrivacyZone(userID, id int64) error {
+	res, err := db.Exec(`DELETE FROM privacy_zones WHERE id=? AND user_id=?`, id, userID)
+	return affectedOne(res, err)
+}
+
+func (db *DB) GetPrivacySettings(userID int64) (PrivacySettings, error) {
+	var ps PrivacySettings
+	var own int
+	err := db.QueryRow(`SELECT privacy_trim_m, privacy_own_map FROM users WHERE id=?`, userID).Scan(&ps.TrimM, &own)
+	ps.OwnMap = own != 0
+	return ps, err
+}
+
+func (db *DB) SetPrivacySettings(userID int64, ps PrivacySettings) error {
+	if ps.TrimM < 0 || ps.TrimM > MaxPrivacyTrimM {
+		return errors.New("trim must be between 0 and 5000 m")
+	}
+	res, err := db.Exec(`UPDATE users SET privacy_trim_m=?, privacy_own_map=? WHERE id=?`, ps.TrimM, boolInt(ps.OwnMap), userID)
+	return affectedOne(res, err)
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// ActivityShare is a public, read-only link to one activity.
+type ActivityShare struct {
+	ID           int64
+	ActivityID   int64
+	OwnerID      int64
+	Privacy      bool // apply the owner's privacy zones and trim
+	CreatedAt    string
+	ExpiresAt    sql.NullString
+	Views        int
+	LastViewedAt sql.NullString
+}
+
+const shareColumns = `s.id, s.activity_id, COALESCE(a.user_id,0), s.privacy, s.created_at, s.expires_at, s.views, s.last_viewed_at`
+
+func scanShare(row rowScanner) (ActivityShare, error) {
+	var sh ActivityShare
+	var privacy int
+	err := row.Scan(&sh.ID, &sh.ActivityID, &sh.OwnerID, &privacy, &sh.CreatedAt, &sh.ExpiresAt, &sh.Views, &sh.LastViewedAt)
+	sh.Privacy = privacy != 0
+	return sh, err
+}
+
+// CreateActivityShare issues a share link token for an activity; ttl 0
+// means the link never expires. Only the token's hash is stored.
+func (db *DB) CreateActivityShare(activityID int64, ttl time.Duration, privacy bool) (string, error) {
+	token, err := generateSessionID()
+	if err != nil {
+		return "", err
+	}
+	var expires any
+	if ttl > 0 {
+		expires = time.Now().UTC().Add(ttl).Format("2006-01-02 15:04:05")
+	}
+	_, err = db.Exec(`INSERT INTO activity_shares(activity_id, token_hash, privacy, created_at, expires_at) VALUES(?,?,?,datetime('now'),?)`,
+		activityID, hashToken(token), boolInt(privacy), expires)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (db *DB) ListActivityShares(activityID int64) ([]ActivityShare, error) {
+	rows, err := db.Query(`SELECT `+shareColumns+` FROM activity_shares s JOIN activities a ON a.id = s.activity_id
+        WHERE s.activity_id=? ORDER BY s.id DESC`, activityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []ActivityShare
+	for rows.Next() {
+		sh, err := scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, sh)
+	}
+	return res, rows.Err()
+}
+
+// DeleteActivityShare revokes one link of an activity.
+func (db *DB) DeleteActivityShare(activityID, id int64) error {
+	res, err := db.Exec(`DELETE FROM activity_shares WHERE id=? AND activity_id=?`, id, activityID)
+	return affectedOne(res, err)
+}
+
+// LookupActivityShare resolves a link token. Expired links and links of
+// disabled owners don't resolve.
+func (db *DB) LookupActivityShare(token string) (*ActivityShare, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, sql.ErrNoRows
+	}
+	sh, err := scanShare(db.QueryRow(`SELECT `+shareColumns+`
+        FROM activity_shares s
+        JOIN activities a ON a.id = s.activity_id
+        JOIN users u ON u.id = a.user_id
+        WHERE s.token_hash=? AND u.disabled=0
+          AND (s.expires_at IS NULL OR s.expires_at > datetime('now'))`, hashToken(token)))
+	if err != nil {
+		return nil, err
+	}
+	return &sh, nil
+}
+
+// RecordShareView counts a page view of a share link.
+func (db *DB) RecordShareView(id int64) {
+	_, _ = db.Exec(`UPDATE activity_shares SET views=views+1, last_viewed_at=datetime('now') WHERE id=?`, id)
+}
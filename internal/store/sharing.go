@@ -0,0 +1,129 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Grant lets Grantee look at (and, with EditPlans, change the plan of)
+// Owner's data. Users always have full access to their own data.
+type Grant struct {
+	OwnerID        int64
+	OwnerName      string
+	GranteeID      int64
+	GranteeName    string
+	ViewActivities bool
+	ViewStats      bool
+	EditPlans      bool
+	CreatedAt      string
+}
+
+// Any reports whether the grant allows anything at all.
+func (g Grant) Any() bool { return g.ViewActivities || g.ViewStats || g.EditPlans }
+
+const grantColumns = `g.owner_id, o.username, g.grantee_id, u.username,
+	g.view_activities, g.view_stats, g.edit_plans, g.created_at`
+
+const grantFrom = ` FROM sharing_grants g
+	JOIN users o ON o.id = g.owner_id
+	JOIN users u ON u.id = g.grantee_id`
+
+func scanGrant(row rowScanner) (Grant, error) {
+	var g Grant
+	var va, vs, ep int
+	err := row.Scan(&g.OwnerID, &g.OwnerName, &g.GranteeID, &g.GranteeName, &va, &vs, &ep, &g.CreatedAt)
+	g.ViewActivities, g.ViewStats, g.EditPlans = va != 0, vs != 0, ep != 0
+	return g, err
+}
+
+// SetGrant creates or replaces what ownerID shares with granteeID. A grant
+// without any permission is removed.
+func (db *DB) SetGrant(g Grant) error {
+	if g.OwnerID == g.GranteeID {
+		return errors.New("you always have access to your own data")
+	}
+	if !g.Any() {
+		return db.DeleteGrant(g.OwnerID, g.GranteeID)
+	}
+	_, err := db.Exec(`
+        INSERT INTO sharing_grants(owner_id, grantee_id, view_activities, view_stats, edit_plans, created_at)
+        VALUES(?,?,?,?,?,datetime('now'))
+        ON CONFLICT(owner_id, grantee_id) DO UPDATE SET
+          view_activities=excluded.view_activities, view_stats=excluded.view_stats, edit_plans=excluded.edit_plans`,
+		g.OwnerID, g.GranteeID, boolInt(g.ViewActivities), boolInt(g.ViewStats), boolInt(g.EditPlans))
+	return err
+}
+
+func (db *DB) DeleteGrant(ownerID, granteeID int64) error {
+	_, err := db.Exec(`DELETE FROM sharing_grants WHERE owner_id=? AND grantee_id=?`, ownerID, granteeID)
+	return err
+}
+
+// GetGrant returns what ownerID shares with granteeID. Grants from disabled
+// owners still resolve; grants to disabled users never get used since they
+// can't sign in.
+func (db *DB) GetGrant(ownerID, granteeID int64) (*Grant, error) {
+	g, err := scanGrant(db.QueryRow(`SELECT `+grantColumns+grantFrom+` WHERE g.owner_id=? AND g.grantee_id=?`, ownerID, granteeID))
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// GrantsByOwner lists who the user shares data with.
+func (db *DB) GrantsByOwner(ownerID int64) ([]Grant, error) {
+	return db.listGrants(`SELECT `+grantColumns+grantFrom+` WHERE g.owner_id=? ORDER BY u.username`, ownerID)
+}
+
+// GrantsForGrantee lists whose data the user can see.
+func (db *DB) GrantsForGrantee(granteeID int64) ([]Grant, error) {
+	return db.listGrants(`SELECT `+grantColumns+grantFrom+` WHERE g.grantee_id=? ORDER BY o.username`, granteeID)
+}
+
+func (db *DB) listGrants(q string, id int64) ([]Grant, error) {
+	rows, err := db.Query(q, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Grant
+	for rows.Next() {
+		g, err := scanGrant(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, g)
+	}
+	return res, rows.Err()
+}
+
+// PrimaryUserID returns the oldest active admin. Imports without a signed-in
+// user (USB polling) are owned by this account.
+func (db *DB) PrimaryUserID() (int64, error) {
+	var id int64
+	err := db.QueryRow(`SELECT id FROM users WHERE role=? AND disabled=0 ORDER BY id LIMIT 1`, RoleAdmin).Scan(&id)
+	return id, err
+}
+
+// claimUnownedData gives rows that predate data ownership to userID.
+func (db *DB) claimUnownedData(userID int64) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		for _, q := range []string{
+			`UPDATE activities SET user_id=? WHERE user_id IS NULL`,
+			`UPDATE planned_workouts SET user_id=? WHERE user_id IS NULL`,
+			`UPDATE plan_blocks SET user_id=? WHERE user_id IS NULL`,
+		} {
+			if _, err := tx.Exec(q, userID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
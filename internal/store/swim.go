@@ -0,0 +1,78 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+
+	"garmr/internal/fitx"
+)
+
+// SwimLength is one length of a pool swim.
+type SwimLength struct {
+	Index    int
+	StartOff float64
+	DurS     float64
+	Strokes  int
+	Stroke   string
+	Active   bool
+}
+
+// SWOLF is the length's time in whole seconds plus its strokes.
+func (l SwimLength) SWOLF() int {
+	return int(l.DurS+0.5) + l.Strokes
+}
+
+// IsSwim reports whether sport is swimming, as stored from the FIT file.
+func IsSwim(sport string) bool {
+	return strings.EqualFold(sport, "swimming")
+}
+
+// InsertSwim stores the pool length and lengths of an activity, replacing
+// any stored before. A pool length of 0 marks the activity as read and not
+// a pool swim.
+func (db *DB) InsertSwim(tx *sql.Tx, id int64, a fitx.Activity) error {
+	if _, err := tx.Exec(`UPDATE activities SET pool_length_m=? WHERE id=?`, a.PoolLengthM, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM swim_lengths WHERE activity_id=?`, id); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO swim_lengths(activity_id,length_index,start_offset_s,duration_s,strokes,stroke,active) VALUES(?,?,?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, l := range a.Lengths {
+		if _, err := stmt.Exec(id, l.Index, l.StartOff, l.DurS, l.Strokes, l.Stroke, boolInt(l.Active)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SwimPoolLength returns the activity's pool length; it is NULL until the
+// FIT file was read for lengths.
+func (db *DB) SwimPoolLength(id int64) (sql.NullFloat64, error) {
+	var pool sql.NullFloat64
+	err := db.QueryRow(`SELECT pool_length_m FROM activities WHERE id=?`, id).Scan(&pool)
+	return pool, err
+}
+
+// ListSwimLengths returns an activity's lengths in order.
+func (db *DB) ListSwimLengths(activityID int64) ([]SwimLength, error) {
+	rows, err := db.Query(`SELECT length_index,start_offset_s,duration_s,strokes,stroke,active
+        FROM swim_lengths WHERE activity_id=? ORDER BY length_index`, activityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []SwimLength
+	for rows.Next() {
+		var l SwimLength
+		if err := rows.Scan(&l.Index, &l.StartOff, &l.DurS, &l.Strokes, &l.Stroke, &l.Active); err != nil {
+			return nil, err
+		}
+		res = append(res, l)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"database/sql"
+
+	"garmr/internal/fitx"
+)
+
+// InsertTimer stores an activity's elapsed and moving time and its timer
+// events, replacing any stored before.
+func (db *DB) InsertTimer(tx *sql.Tx, id int64, a fitx.Activity) error {
+	if _, err := tx.Exec(`UPDATE activities SET elapsed_s=?, moving_s=? WHERE id=?`, a.ElapsedS, a.MovingS, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM timer_events WHERE activity_id=?`, id); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO timer_events(activity_id,t_offset_s,start) VALUES(?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range a.Timer {
+		if _, err := stmt.Exec(id, e.TOffsetS, boolInt(e.Start)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListTimerEvents returns an activity's timer events in the order they
+// happened.
+func (db *DB) ListTimerEvents(activityID int64) ([]fitx.TimerEvent, error) {
+	rows, err := db.Query(`SELECT t_offset_s, start FROM timer_events WHERE activity_id=? ORDER BY rowid`, activityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []fitx.TimerEvent
+	for rows.Next() {
+		var e fitx.TimerEvent
+		if err := rows.Scan(&e.TOffsetS, &e.Start); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
+
+// ActivityPauses returns the stretches an activity's timer was stopped.
+func (db *DB) ActivityPauses(activityID int64) ([]fitx.Pause, error) {
+	events, err := db.ListTimerEvents(activityID)
+	if err != nil {
+		return nil, err
+	}
+	return fitx.Pauses(events), nil
+}
+
+// ActivityFile is an activity's ID, owner and stored FIT file.
+type ActivityFile struct {
+	ID, UserID int64
+	RawPath    string
+}
+
+// ActivitiesWithoutTimer returns the activities imported before elapsed and
+// moving time were stored, of userID or, if it is 0, of all users.
+func (db *DB) ActivitiesWithoutTimer(userID int64) ([]ActivityFile, error) {
+	rows, err := db.Query(`SELECT id, user_id, raw_path FROM activities
+		WHERE elapsed_s IS NULL AND (?=0 OR user_id=?) ORDER BY id`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []ActivityFile
+	for rows.Next() {
+		var f ActivityFile
+		if err := rows.Scan(&f.ID, &f.UserID, &f.RawPath); err != nil {
+			return nil, err
+		}
+		res = append(res, f)
+	}
+	return res, rows.Err()
+}
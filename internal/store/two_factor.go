@@ -0,0 +1,108 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+)
+
+// recoveryCodeCount is how many single-use recovery codes a user gets.
+const recoveryCodeCount = 10
+
+// SetPendingTOTP stores a secret the user is setting up; it only takes
+// effect once EnableTOTP confirms it. An empty secret cancels the setup.
+func (db *DB) SetPendingTOTP(userID int64, secret string) error {
+	var pending any
+	if secret != "" {
+		pending = secret
+	}
+	res, err := db.Exec(`UPDATE users SET totp_pending=? WHERE id=?`, pending, userID)
+	return affectedOne(res, err)
+}
+
+// PendingTOTP returns the secret being set up, or "" if there is none.
+func (db *DB) PendingTOTP(userID int64) (string, error) {
+	var secret sql.NullString
+	err := db.QueryRow(`SELECT totp_pending FROM users WHERE id=?`, userID).Scan(&secret)
+	return secret.String, err
+}
+
+// EnableTOTP makes the pending secret active. step is the step of the code
+// that confirmed it, which can't be used again.
+func (db *DB) EnableTOTP(userID int64, step int64) error {
+	res, err := db.Exec(`UPDATE users SET totp_secret=totp_pending, totp_pending=NULL, totp_last_step=?
+        WHERE id=? AND totp_pending IS NOT NULL`, step, userID)
+	return affectedOne(res, err)
+}
+
+// DisableTOTP turns two-factor sign-in off and drops the recovery codes.
+func (db *DB) DisableTOTP(userID int64) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`UPDATE users SET totp_secret=NULL, totp_pending=NULL, totp_last_step=0 WHERE id=?`, userID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id=?`, userID)
+		return err
+	})
+}
+
+// TOTPSecret returns the active secret ("" when two-factor is off).
+func (db *DB) TOTPSecret(userID int64) (string, error) {
+	var secret sql.NullString
+	err := db.QueryRow(`SELECT totp_secret FROM users WHERE id=?`, userID).Scan(&secret)
+	return secret.String, err
+}
+
+// UseTOTPStep marks the code of step as used. It fails with ErrNoRows if
+// that step or a later one was used already, so a code works only once.
+func (db *DB) UseTOTPStep(userID int64, step int64) error {
+	res, err := db.Exec(`UPDATE users SET totp_last_step=? WHERE id=? AND totp_last_step < ?`, step, userID, step)
+	return affectedOne(res, err)
+}
+
+// ReplaceRecoveryCodes issues a new set of recovery codes, invalidating
+// the old ones. Only hashes are stored; the codes are returned once.
+func (db *DB) ReplaceRecoveryCodes(userID int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		h := hex.EncodeToString(buf)
+		codes[i] = h[:5] + "-" + h[5:]
+	}
+	err := db.WithTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id=?`, userID); err != nil {
+			return err
+		}
+		for _, c := range codes {
+			if _, err := tx.Exec(`INSERT INTO recovery_codes(user_id, code_hash) VALUES(?,?)`, userID, hashToken(normalizeRecoveryCode(c))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode spends one unused recovery code; ErrNoRows if there is none.
+func (db *DB) UseRecoveryCode(userID int64, code string) error {
+	res, err := db.Exec(`UPDATE recovery_codes SET used_at=datetime('now')
+        WHERE user_id=? AND code_hash=? AND used_at IS NULL`, userID, hashToken(normalizeRecoveryCode(code)))
+	return affectedOne(res, err)
+}
+
+func (db *DB) RecoveryCodesLeft(userID int64) (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM recovery_codes WHERE user_id=? AND used_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
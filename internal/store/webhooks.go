@@ -0,0 +1,234 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type Webhook struct {
+	ID        int64
+	URL       string
+	Secret    string
+	Events    []string
+	Enabled   bool
+	CreatedAt string
+}
+
+// Subscribed reports whether the hook wants the given event.
+func (h Webhook) Subscribed(event string) bool {
+	for _, e := range h.Events {
+		if e == "*" || e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDelivery struct {
+	ID            int64
+	WebhookID     int64
+	URL           string
+	Secret        string
+	Event         string
+	Payload       string
+	Status        string
+	Attempts      int
+	NextAttemptAt string
+	ResponseCode  sql.NullInt64
+	LastError     string
+	CreatedAt     string
+	UpdatedAt     string
+}
+
+// CreateWebhook registers an endpoint with a freshly generated signing secret.
+func (db *DB) CreateWebhook(rawURL string, events []string) (int64, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return 0, errors.New("webhook URL must be an absolute http(s) URL")
+	}
+	if len(events) == 0 {
+		return 0, errors.New("select at least one event")
+	}
+	secret, err := generateSessionID()
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.Exec(`INSERT INTO webhooks(url, secret, events, enabled, created_at) VALUES(?,?,?,1,datetime('now'))`,
+		u.String(), secret, strings.Join(events, ","))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func scanWebhook(row rowScanner) (Webhook, error) {
+	var h Webhook
+	var events string
+	var enabled int
+	if err := row.Scan(&h.ID, &h.URL, &h.Secret, &events, &enabled, &h.CreatedAt); err != nil {
+		return Webhook{}, err
+	}
+	h.Events = strings.Split(events, ",")
+	h.Enabled = enabled != 0
+	return h, nil
+}
+
+func (db *DB) ListWebhooks() ([]Webhook, error) {
+	rows, err := db.Query(`SELECT id, url, secret, events, enabled, created_at FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Webhook
+	for rows.Next() {
+		h, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, h)
+	}
+	return res, rows.Err()
+}
+
+func (db *DB) GetWebhook(id int64) (*Webhook, error) {
+	h, err := scanWebhook(db.QueryRow(`SELECT id, url, secret, events, enabled, created_at FROM webhooks WHERE id=?`, id))
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func (db *DB) SetWebhookEnabled(id int64, enabled bool) error {
+	v := 0
+	if enabled {
+		v = 1
+	}
+	_, err := db.Exec(`UPDATE webhooks SET enabled=? WHERE id=?`, v, id)
+	return err
+}
+
+// DeleteWebhook removes the hook together with its delivery log.
+func (db *DB) DeleteWebhook(id int64) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id=?`, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM webhooks WHERE id=?`, id)
+		return err
+	})
+}
+
+// EnqueueWebhookDelivery queues a payload for immediate delivery.
+func (db *DB) EnqueueWebhookDelivery(webhookID int64, event, payload string) (int64, error) {
+	res, err := db.Exec(`
+        INSERT INTO webhook_deliveries(webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+        VALUES(?,?,?,?,datetime('now'),datetime('now'),datetime('now'))`,
+		webhookID, event, payload, DeliveryPending)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+const deliveryColumns = `d.id, d.webhook_id, h.url, h.secret, d.event, d.payload, d.status, d.attempts,
+	d.next_attempt_at, d.response_code, COALESCE(d.last_error,''), d.created_at, d.updated_at`
+
+func scanDelivery(row rowScanner) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	err := row.Scan(&d.ID, &d.WebhookID, &d.URL, &d.Secret, &d.Event, &d.Payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.ResponseCode, &d.LastError, &d.CreatedAt, &d.UpdatedAt)
+	return d, err
+}
+
+func (db *DB) GetWebhookDelivery(id int64) (*WebhookDelivery, error) {
+	d, err := scanDelivery(db.QueryRow(`SELECT `+deliveryColumns+`
+        FROM webhook_deliveries d JOIN webhooks h ON h.id = d.webhook_id WHERE d.id=?`, id))
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// DueWebhookDeliveries returns pending deliveries whose next attempt is due.
+func (db *DB) DueWebhookDeliveries(limit int) ([]WebhookDelivery, error) {
+	rows, err := db.Query(`SELECT `+deliveryColumns+`
+        FROM webhook_deliveries d JOIN webhooks h ON h.id = d.webhook_id
+        WHERE d.status = ? AND d.next_attempt_at <= datetime('now')
+        ORDER BY d.next_attempt_at, d.id LIMIT ?`, DeliveryPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+// ListWebhookDeliveries returns the newest deliveries, optionally for one hook.
+func (db *DB) ListWebhookDeliveries(webhookID int64, limit int) ([]WebhookDelivery, error) {
+	q := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries d JOIN webhooks h ON h.id = d.webhook_id`
+	args := []any{}
+	if webhookID > 0 {
+		q += ` WHERE d.webhook_id = ?`
+		args = append(args, webhookID)
+	}
+	q += ` ORDER BY d.id DESC LIMIT ?`
+	rows, err := db.Query(q, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+// RecordWebhookAttempt stores the outcome of one delivery attempt. A zero
+// retryInSec on an undelivered attempt marks the delivery as failed for good.
+func (db *DB) RecordWebhookAttempt(id int64, code int, errMsg string, delivered bool, retryInSec int) error {
+	status := DeliveryPending
+	switch {
+	case delivered:
+		status = DeliveryDelivered
+	case retryInSec <= 0:
+		status = DeliveryFailed
+	}
+	var respCode sql.NullInt64
+	if code > 0 {
+		respCode = sql.NullInt64{Int64: int64(code), Valid: true}
+	}
+	_, err := db.Exec(`
+        UPDATE webhook_deliveries
+        SET attempts = attempts + 1, status = ?, response_code = ?, last_error = ?,
+            next_attempt_at = datetime('now', ?), updated_at = datetime('now')
+        WHERE id = ?`, status, respCode, errMsg, fmt.Sprintf("+%d seconds", retryInSec), id)
+	return err
+}
+
+// PruneWebhookDeliveries keeps the newest keep entries of the delivery log.
+func (db *DB) PruneWebhookDeliveries(keep int) error {
+	_, err := db.Exec(`DELETE FROM webhook_deliveries WHERE status != ? AND id NOT IN (
+        SELECT id FROM webhook_deliveries ORDER BY id DESC LIMIT ?)`, DeliveryPending, keep)
+	return err
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"garmr/internal/fitx"
+)
+
+// Weight is a weight and body composition measurement.
+type Weight struct {
+	ID         int64
+	MeasuredAt time.Time
+	WeightKg   float64
+	FatPct     sql.NullFloat64
+	WaterPct   sql.NullFloat64
+	MuscleKg   sql.NullFloat64
+	BoneKg     sql.NullFloat64
+	BMI        sql.NullFloat64
+	Source     string // "manual", "csv" or "fit"
+}
+
+// A later measurement at the same time replaces the earlier one, so
+// importing the same CSV twice doesn't duplicate anything.
+const weightUpsert = `INSERT INTO weights(user_id,measured_at,weight_kg,fat_pct,water_pct,muscle_kg,bone_kg,bmi,source)
+        VALUES(?,?,?,?,?,?,?,?,?)
+        ON CONFLICT(user_id,measured_at) DO UPDATE SET weight_kg=excluded.weight_kg, fat_pct=excluded.fat_pct,
+            water_pct=excluded.water_pct, muscle_kg=excluded.muscle_kg, bone_kg=excluded.bone_kg, bmi=excluded.bmi,
+            source=excluded.source`
+
+func addWeight(tx *sql.Tx, userID int64, w Weight) error {
+	_, err := tx.Exec(weightUpsert, userID, w.MeasuredAt.UTC().Format(time.RFC3339), w.WeightKg,
+		w.FatPct, w.WaterPct, w.MuscleKg, w.BoneKg, w.BMI, w.Source)
+	return err
+}
+
+// AddWeights stores measurements for the user in one transaction.
+func (db *DB) AddWeights(userID int64, ws []Weight) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		for _, w := range ws {
+			if err := addWeight(tx, userID, w); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// insertFITWeights stores the measurements of a scale FIT file.
+func insertFITWeights(tx *sql.Tx, userID int64, ws []fitx.Weight) error {
+	for _, fw := range ws {
+		w := Weight{MeasuredAt: fw.Time, WeightKg: fw.WeightKg, Source: "fit",
+			FatPct: nullFloat(fw.FatPct), WaterPct: nullFloat(fw.WaterPct), MuscleKg: nullFloat(fw.MuscleKg),
+			BoneKg: nullFloat(fw.BoneKg), BMI: nullFloat(fw.BMI)}
+		if err := addWeight(tx, userID, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func nullFloat(p *float64) sql.NullFloat64 {
+	if p == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *p, Valid: true}
+}
+
+// DeleteWeight removes one of the user's measurements.
+func (db *DB) DeleteWeight(userID, id int64) error {
+	return affectedOne(db.Exec(`DELETE FROM weights WHERE id=? AND user_id=?`, id, userID))
+}
+
+const weightColumns = `id,measured_at,weight_kg,fat_pct,water_pct,muscle_kg,bone_kg,bmi,source`
+
+func scanWeight(row rowScanner) (Weight, error) {
+	var w Weight
+	var at string
+	if err := row.Scan(&w.ID, &at, &w.WeightKg, &w.FatPct, &w.WaterPct, &w.MuscleKg, &w.BoneKg, &w.BMI, &w.Source); err != nil {
+		return w, err
+	}
+	w.MeasuredAt, _ = ParseStoredTime(at)
+	return w, nil
+}
+
+// ListWeights returns the user's measurements in [from, to), oldest first.
+// A zero from or to leaves that end open.
+func (db *DB) ListWeights(userID int64, from, to time.Time) ([]Weight, error) {
+	q := `SELECT ` + weightColumns + ` FROM weights WHERE user_id=?`
+	args := []any{userID}
+	if !from.IsZero() {
+		q += ` AND measured_at >= ?`
+		args = append(args, from.UTC().Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		q += ` AND measured_at < ?`
+		args = append(args, to.UTC().Format(time.RFC3339))
+	}
+	rows, err := db.Query(q+` ORDER BY measured_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Weight
+	for rows.Next() {
+		w, err := scanWeight(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, w)
+	}
+	return res, rows.Err()
+}
+
+// WeightAt returns the user's weight at t: the last measurement before it,
+// or the first one after it if there is none before. It returns
+// sql.ErrNoRows when the user never recorded a weight.
+func (db *DB) WeightAt(userID int64, t time.Time) (Weight, error) {
+	at := t.UTC().Format(time.RFC3339)
+	w, err := scanWeight(db.QueryRow(`SELECT `+weightColumns+` FROM weights
+        WHERE user_id=? AND measured_at <= ? ORDER BY measured_at DESC LIMIT 1`, userID, at))
+	if err == sql.ErrNoRows {
+		w, err = scanWeight(db.QueryRow(`SELECT `+weightColumns+` FROM weights
+            WHERE user_id=? ORDER BY measured_at LIMIT 1`, userID))
+	}
+	return w, err
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"garmr/internal/fitx"
+)
+
+// WellnessDay is a day of all-day data from the watch.
+type WellnessDay struct {
+	Day           string
+	Steps         sql.NullInt64
+	DistanceM     sql.NullFloat64
+	ModerateMin   sql.NullInt64
+	VigorousMin   sql.NullInt64
+	RestingHR     sql.NullInt64
+	MinHR         sql.NullInt64
+	MaxHR         sql.NullInt64
+	StressAvg     sql.NullFloat64
+	StressMax     sql.NullInt64
+	SleepStart    sql.NullString
+	SleepEnd      sql.NullString
+	SleepDeepS    sql.NullInt64
+	SleepLightS   sql.NullInt64
+	SleepRemS     sql.NullInt64
+	SleepAwakeS   sql.NullInt64
+	SleepScore    sql.NullInt64
+	HRVLastNight  sql.NullFloat64
+	HRVWeekly     sql.NullFloat64
+	HRVStatus     string
+	VO2Max        sql.NullFloat64
+	VO2MaxCycling sql.NullFloat64
+}
+
+// SleepS is the time asleep, without time awake in bed.
+func (d WellnessDay) SleepS() int64 {
+	return d.SleepDeepS.Int64 + d.SleepLightS.Int64 + d.SleepRemS.Int64
+}
+
+// IntensityMinutes counts vigorous minutes double, as Garmin does.
+func (d WellnessDay) IntensityMinutes() int64 {
+	return d.ModerateMin.Int64 + 2*d.VigorousMin.Int64
+}
+
+// How a day's values from a new file combine with what is stored:
+// counters that run through the day keep the highest value, minutes from
+// separate files add up, and single readings are replaced.
+var wellnessUpsert = func() string {
+	keepMax := func(c string) string {
+		return fmt.Sprintf("%[1]s = CASE WHEN %[1]s IS NULL OR excluded.%[1]s > %[1]s THEN excluded.%[1]s ELSE %[1]s END", c)
+	}
+	keepMin := func(c string) string {
+		return fmt.Sprintf("%[1]s = CASE WHEN %[1]s IS NULL OR excluded.%[1]s < %[1]s THEN excluded.%[1]s ELSE %[1]s END", c)
+	}
+	add := func(c string) string {
+		return fmt.Sprintf("%[1]s = CASE WHEN excluded.%[1]s IS NULL THEN %[1]s ELSE COALESCE(%[1]s, 0) + excluded.%[1]s END", c)
+	}
+	replace := func(c string) string {
+		return fmt.Sprintf("%[1]s = COALESCE(excluded.%[1]s, %[1]s)", c)
+	}
+	set := []string{
+		keepMax("steps"), keepMax("distance_m"),
+		add("moderate_min"), add("vigorous_min"),
+		replace("resting_hr"), keepMin("min_hr"), keepMax("max_hr"),
+		`stress_avg = CASE WHEN excluded.stress_avg IS NULL THEN stress_avg WHEN stress_avg IS NULL THEN excluded.stress_avg
+            ELSE (stress_avg*stress_samples + excluded.stress_avg*excluded.stress_samples) / (stress_samples + excluded.stress_samples) END`,
+		keepMax("stress_max"), "stress_samples = stress_samples + excluded.stress_samples",
+	}
+	for _, c := range []string{"sleep_start", "sleep_end", "sleep_deep_s", "sleep_light_s", "sleep_rem_s", "sleep_awake_s", "sleep_score"} {
+		// a night comes from one file; a later file replaces all of it
+		set = append(set, fmt.Sprintf("%[1]s = CASE WHEN excluded.sleep_end IS NOT NULL THEN excluded.%[1]s ELSE %[1]s END", c))
+	}
+	set = append(set, replace("hrv_last_night"), replace("hrv_weekly"),
+		"hrv_status = CASE WHEN excluded.hrv_status <> '' THEN excluded.hrv_status ELSE hrv_status END",
+		replace("vo2max"), replace("vo2max_cycling"))
+	return `INSERT INTO wellness_days(user_id,day,steps,distance_m,moderate_min,vigorous_min,resting_hr,min_hr,max_hr,
+            stress_avg,stress_max,stress_samples,sleep_start,sleep_end,sleep_deep_s,sleep_light_s,sleep_rem_s,sleep_awake_s,
+            sleep_score,hrv_last_night,hrv_weekly,hrv_status,vo2max,vo2max_cycling)
+        VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+        ON CONFLICT(user_id,day) DO UPDATE SET ` + strings.Join(set, ",\n            ")
+}()
+
+// HasWellnessFile reports whether the user already imported the file with
+// this hash.
+func (db *DB) HasWellnessFile(tx *sql.Tx, userID int64, hash string) (bool, error) {
+	var n int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM wellness_files WHERE user_id=? AND file_hash=?`, userID, hash).Scan(&n)
+	return n > 0, err
+}
+
+// InsertWellness records an imported wellness file and merges its days into
+// the user's wellness data; a weight file's measurements go to weights.
+func (db *DB) InsertWellness(tx *sql.Tx, userID int64, w fitx.Wellness, rawPath, hash string) error {
+	if _, err := tx.Exec(`INSERT INTO wellness_files(user_id,file_type,raw_path,file_hash) VALUES(?,?,?,?)`,
+		userID, w.FileType, rawPath, hash); err != nil {
+		return err
+	}
+	for _, d := range w.Days {
+		var start, end, deep, light, rem, awake, score any
+		if s := d.Sleep; s != nil {
+			start, end = s.Start.UTC().Format(time.RFC3339), s.End.UTC().Format(time.RFC3339)
+			deep, light, rem, awake = s.DeepS, s.LightS, s.RemS, s.AwakeS
+			score = nullable(s.Score)
+		}
+		_, err := tx.Exec(wellnessUpsert, userID, d.Day, nullable(d.Steps), nullable(d.DistanceM),
+			nullable(d.ModerateMin), nullable(d.VigorousMin), nullable(d.RestingHR), nullable(d.MinHR), nullable(d.MaxHR),
+			nullable(d.StressAvg), nullable(d.StressMax), d.StressSamples,
+			start, end, deep, light, rem, awake, score,
+			nullable(d.HRVLastNight), nullable(d.HRVWeekly), d.HRVStatus, nullable(d.VO2Max), nullable(d.VO2MaxCycling))
+		if err != nil {
+			return fmt.Errorf("wellness day %s: %w", d.Day, err)
+		}
+	}
+	return insertFITWeights(tx, userID, w.Weights)
+}
+
+// nullable turns a nil pointer into SQL NULL.
+func nullable[T any](p *T) any {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+// ListWellness returns the user's wellness days from from to to (inclusive,
+// YYYY-MM-DD), oldest first.
+func (db *DB) ListWellness(userID int64, from, to string) ([]WellnessDay, error) {
+	rows, err := db.Query(`SELECT day,steps,distance_m,moderate_min,vigorous_min,resting_hr,min_hr,max_hr,stress_avg,stress_max,
+            sleep_start,sleep_end,sleep_deep_s,sleep_light_s,sleep_rem_s,sleep_awake_s,sleep_score,
+            hrv_last_night,hrv_weekly,hrv_status,vo2max,vo2max_cycling
+        FROM wellness_days WHERE user_id=? AND day BETWEEN ? AND ? ORDER BY day`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []WellnessDay
+	for rows.Next() {
+		var d WellnessDay
+		if err := rows.Scan(&d.Day, &d.Steps, &d.DistanceM, &d.ModerateMin, &d.VigorousMin, &d.RestingHR, &d.MinHR, &d.MaxHR,
+			&d.StressAvg, &d.StressMax, &d.SleepStart, &d.SleepEnd, &d.SleepDeepS, &d.SleepLightS, &d.SleepRemS,
+			&d.SleepAwakeS, &d.SleepScore, &d.HRVLastNight, &d.HRVWeekly, &d.HRVStatus, &d.VO2Max, &d.VO2MaxCycling); err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+// LatestVO2Max returns the most recent running and cycling VO2max estimates
+// up to day.
+func (db *DB) LatestVO2Max(userID int64, day string) (run, bike sql.NullFloat64, err error) {
+	err = db.QueryRow(`SELECT
+            (SELECT vo2max FROM wellness_days WHERE user_id=?1 AND day<=?2 AND vo2max IS NOT NULL ORDER BY day DESC LIMIT 1),
+            (SELECT vo2max_cycling FROM wellness_days WHERE user_id=?1 AND day<=?2 AND vo2max_cycling IS NOT NULL ORDER BY day DESC LIMIT 1)`,
+		userID, day).Scan(&run, &bike)
+	return run, bike, err
+}
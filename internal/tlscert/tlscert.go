@@ -0,0 +1,220 @@
+// Package tlscert provides the server certificate: loaded from files and
+// reloaded when they change, or generated self-signed for use on a LAN.
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// checkEvery limits how often the files are stat'ed for changes.
+const checkEvery = 10 * time.Second
+
+// Reloader serves a certificate from files, picking up renewed files (for
+// example from certbot) without a restart.
+type Reloader struct {
+	certFile, keyFile string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+	checkedAt time.Time
+}
+
+// NewReloader loads the certificate and key, failing if they can't be used.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) load() error {
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	r.cert, r.certMod, r.keyMod = &cert, certMod, keyMod
+	return nil
+}
+
+func (r *Reloader) modTimes() (cert, key time.Time, err error) {
+	ci, err := os.Stat(r.certFile)
+	if err != nil {
+		return cert, key, fmt.Errorf("tls: %w", err)
+	}
+	ki, err := os.Stat(r.keyFile)
+	if err != nil {
+		return cert, key, fmt.Errorf("tls: %w", err)
+	}
+	return ci.ModTime(), ki.ModTime(), nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate. When the files
+// changed it reloads them; if that fails it keeps serving the old pair.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checkedAt) < checkEvery {
+		return r.cert, nil
+	}
+	r.checkedAt = time.Now()
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		log.Printf("%v (keeping current certificate)", err)
+		return r.cert, nil
+	}
+	if certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod) {
+		return r.cert, nil
+	}
+	if err := r.load(); err != nil {
+		// a renewal may have written only one of the files so far
+		log.Printf("%v (keeping current certificate)", err)
+		return r.cert, nil
+	}
+	log.Printf("tls: reloaded %s", r.certFile)
+	return r.cert, nil
+}
+
+// selfSignedValidity is how long a generated certificate is valid; it is
+// replaced once less than selfSignedRenew is left.
+const (
+	selfSignedValidity = 365 * 24 * time.Hour
+	selfSignedRenew    = 30 * 24 * time.Hour
+)
+
+// SelfSigned returns the paths of a self-signed certificate and key in dir,
+// generating them if they don't exist, are about to expire or don't cover
+// hosts. The certificate always covers localhost, the machine's host name
+// and its interface addresses.
+func SelfSigned(dir string, hosts []string) (certFile, keyFile string, err error) {
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	names, ips := selfSignedNames(hosts)
+	if existing, err := readCert(certFile); err == nil && time.Until(existing.NotAfter) > selfSignedRenew &&
+		covers(existing, names, ips) {
+		if _, err := os.Stat(keyFile); err == nil {
+			return certFile, keyFile, nil
+		}
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", "", fmt.Errorf("tls: %w", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: names[0], Organization: []string{"garmr self-signed"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              names,
+		IPAddresses:           ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	if err := writePEM(keyFile, "PRIVATE KEY", keyDER, 0o600); err != nil {
+		return "", "", err
+	}
+	if err := writePEM(certFile, "CERTIFICATE", der, 0o644); err != nil {
+		return "", "", err
+	}
+	log.Printf("tls: generated self-signed certificate %s for %v %v", certFile, names, ips)
+	return certFile, keyFile, nil
+}
+
+func selfSignedNames(hosts []string) ([]string, []net.IP) {
+	names := []string{"localhost"}
+	if h, err := os.Hostname(); err == nil && h != "" && h != "localhost" {
+		names = append(names, h)
+	}
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && !n.IP.IsLoopback() && !n.IP.IsLinkLocalUnicast() {
+				ips = append(ips, n.IP)
+			}
+		}
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			ips = append(ips, ip)
+		} else if h != "" && !slices.Contains(names, h) {
+			names = append(names, h)
+		}
+	}
+	return names, ips
+}
+
+func covers(cert *x509.Certificate, names []string, ips []net.IP) bool {
+	for _, n := range names {
+		if !slices.Contains(cert.DNSNames, n) {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+			return false
+		}
+	}
+	return true
+}
+
+func readCert(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no certificate in " + path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func writePEM(path, typ string, der []byte, mode os.FileMode) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of RFC 6238 appendix B, "12345678901234567890".
+var rfcSecret = b32.EncodeToString([]byte("12345678901234567890"))
+
+// The RFC's vectors are 8 digits; authenticator apps show the last 6.
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},          // 94287082
+		{1111111109, "081804"},  // 07081804
+		{1111111111, "050471"},  // 14050471
+		{1234567890, "005924"},  // 89005924
+		{2000000000, "279037"},  // 69279037
+		{20000000000, "353130"}, // 65353130
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("T=%d: code %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	step := Step(at)
+	code := func(s int64) string {
+		c, err := Code(rfcSecret, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		ok       bool
+	}{
+		{"current step", rfcSecret, code(step), step, true},
+		{"previous step", rfcSecret, code(step - 1), step - 1, true},
+		{"next step", rfcSecret, code(step + 1), step + 1, true},
+		{"two steps behind", rfcSecret, code(step - 2), 0, false},
+		{"two steps ahead", rfcSecret, code(step + 2), 0, false},
+		{"spaces and lower case secret", strings.ToLower(rfcSecret), " 050 471 ", step, true},
+		{"too short", rfcSecret, "05047", 0, false},
+		{"wrong code", rfcSecret, "123456", 0, false},
+		{"invalid secret", "not base32!", "050471", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Validate(tt.secret, tt.code, at)
+			if ok != tt.ok || got != tt.wantStep {
+				t.Fatalf("Validate = %d %v, want %d %v", got, ok, tt.wantStep, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,730 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"garmr/internal/store"
+	"garmr/internal/webhook"
+)
+
+// Versioned JSON API. The endpoint reference lives in the README.
+//
+// Every response is JSON. Collections are wrapped as
+// {"data": [...], "pagination": {...}}, single resources as {"data": {...}},
+// and failures as {"error": {"code": "...", "message": "..."}}.
+
+const (
+	apiDefaultPerPage    = 25
+	apiMaxPerPage        = 100
+	apiRecordsPerPage    = 1000
+	apiMaxRecordsPerPage = 5000
+)
+
+type apiErrorBody struct {
+	Error apiError `json:"error"`
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type apiPagination struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+type apiList struct {
+	Data       any           `json:"data"`
+	Pagination apiPagination `json:"pagination"`
+}
+
+type apiItem struct {
+	Data any `json:"data"`
+}
+
+type apiActivity struct {
+	ID           int64    `json:"id"`
+	StartTime    string   `json:"start_time"`
+	Sport        string   `json:"sport"`
+	SubSport     string   `json:"sub_sport"`
+	DurationS    int      `json:"duration_s"`
+	DistanceM    int      `json:"distance_m"`
+	AvgHR        int      `json:"avg_hr"`
+	MaxHR        int      `json:"max_hr"`
+	AvgSpeedMPS  float64  `json:"avg_speed_mps"`
+	Calories     int      `json:"calories"`
+	AscentM      float64  `json:"ascent_m"`
+	DescentM     float64  `json:"descent_m"`
+	DeviceVendor string   `json:"device_vendor"`
+	DeviceModel  string   `json:"device_model"`
+	AerobicTE    *float64 `json:"aerobic_te"`
+	AnaerobicTE  *float64 `json:"anaerobic_te"`
+	ElapsedS     *int64   `json:"elapsed_s"` // null until `garmrd activity backfill` for old imports
+	MovingS      *int64   `json:"moving_s"`
+}
+
+type apiRecord struct {
+	TOffsetS int      `json:"t_offset_s"`
+	Lat      *float64 `json:"lat"`
+	Lon      *float64 `json:"lon"`
+	ElevM    *float64 `json:"elev_m"`
+	HR       *int64   `json:"hr"`
+	Cad      *int64   `json:"cad"`
+	TempC    *float64 `json:"temp_c"`
+	PowerW   *int64   `json:"power_w"`
+	SpeedMPS *float64 `json:"speed_mps"`
+
+	DistanceM    *float64 `json:"distance_m,omitempty"`
+	CadFraction  *float64 `json:"cad_fraction,omitempty"`
+	VertOscMM    *float64 `json:"vertical_oscillation_mm,omitempty"`
+	GCTMS        *float64 `json:"ground_contact_ms,omitempty"`
+	GCTBalance   *float64 `json:"ground_contact_balance_left,omitempty"`
+	StrideM      *float64 `json:"stride_length_m,omitempty"`
+	VertRatio    *float64 `json:"vertical_ratio,omitempty"`
+	RespRate     *float64 `json:"respiration_rate,omitempty"`
+	PowerBalance *float64 `json:"power_balance_left,omitempty"`
+
+	Developer map[string]float64 `json:"developer,omitempty"` // by field name
+}
+
+type apiLap struct {
+	Index       int     `json:"index"`
+	StartOffS   int     `json:"start_offset_s"`
+	DurationS   int     `json:"duration_s"`
+	DistanceM   int     `json:"distance_m"`
+	AvgHR       int     `json:"avg_hr"`
+	MaxHR       int     `json:"max_hr"`
+	AvgSpeedMPS float64 `json:"avg_speed_mps"`
+
+	Developer map[string]float64 `json:"developer,omitempty"` // by field name
+}
+
+type apiSplit struct {
+	Index      int     `json:"index"`
+	DistanceM  float64 `json:"distance_m"`
+	DurationS  float64 `json:"duration_s"` // timer time
+	PaceSPerKm float64 `json:"pace_s_per_km"`
+	GAPSPerKm  float64 `json:"gap_s_per_km"` // grade-adjusted pace
+	Grade      float64 `json:"grade"`
+	AvgHR      float64 `json:"avg_hr,omitempty"`
+	AvgCadence float64 `json:"avg_cadence,omitempty"` // as recorded, per foot for runs
+	ElevGainM  float64 `json:"elev_gain_m"`
+	ElevLossM  float64 `json:"elev_loss_m"`
+	Best       bool    `json:"best,omitempty"`
+	Worst      bool    `json:"worst,omitempty"`
+}
+
+type apiStats struct {
+	From        string  `json:"from"`
+	To          string  `json:"to"`
+	Sport       string  `json:"sport,omitempty"`
+	Count       int     `json:"count"`
+	DistanceM   float64 `json:"distance_m"`
+	DurationS   int     `json:"duration_s"`
+	AscentM     float64 `json:"ascent_m"`
+	AvgSpeedMPS float64 `json:"avg_speed_mps"`
+}
+
+type apiPlanned struct {
+	ID        int64  `json:"id"`
+	Date      string `json:"date"`
+	Sport     string `json:"sport"`
+	Title     string `json:"title"`
+	DistanceM *int64 `json:"distance_m"`
+	DurationS *int64 `json:"duration_s"`
+	Notes     string `json:"notes"`
+	BlockID   *int64 `json:"block_id"`
+}
+
+// apiPlannedInput is the body accepted by POST and PUT on planned workouts.
+type apiPlannedInput struct {
+	Date      string `json:"date"`
+	Sport     string `json:"sport"`
+	Title     string `json:"title"`
+	DistanceM *int64 `json:"distance_m"`
+	DurationS *int64 `json:"duration_s"`
+	Notes     string `json:"notes"`
+}
+
+func (s *Server) apiV1() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("/api/v1/activities", s.apiActivities)
+	api.HandleFunc("/api/v1/activities/{id}", s.apiActivity)
+	api.HandleFunc("/api/v1/activities/{id}/records", s.apiActivityRecords)
+	api.HandleFunc("/api/v1/activities/{id}/laps", s.apiActivityLaps)
+	api.HandleFunc("/api/v1/activities/{id}/zones", s.apiActivityZones)
+	api.HandleFunc("/api/v1/activities/{id}/splits", s.apiActivitySplits)
+	api.HandleFunc("/api/v1/stats", s.apiStats)
+	api.HandleFunc("/api/v1/planned", s.apiPlannedCollection)
+	api.HandleFunc("/api/v1/planned/{id}", s.apiPlannedItem)
+	api.HandleFunc("/api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "unknown endpoint")
+	})
+	return api
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeAPIJSON(w, status, apiErrorBody{Error: apiError{Code: code, Message: message}})
+}
+
+func apiMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "use "+strings.Join(allowed, " or "))
+}
+
+func apiInternalError(w http.ResponseWriter, what string, err error) {
+	log.Printf("api: %s: %v", what, err)
+	writeAPIError(w, http.StatusInternalServerError, "internal", "failed to "+what)
+}
+
+func apiPathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "invalid id")
+		return 0, false
+	}
+	return id, true
+}
+
+// apiPage reads page/per_page query parameters with the given defaults.
+func apiPage(r *http.Request, def, max int) (page, perPage int) {
+	page, perPage = 1, def
+	if v, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && v > 0 {
+		page = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("per_page")); err == nil && v > 0 {
+		perPage = v
+	}
+	if perPage > max {
+		perPage = max
+	}
+	return page, perPage
+}
+
+func newPagination(page, perPage, total int) apiPagination {
+	return apiPagination{
+		Page:       page,
+		PerPage:    perPage,
+		Total:      total,
+		TotalPages: (total + perPage - 1) / perPage,
+	}
+}
+
+func toAPIActivity(a store.Activity) apiActivity {
+	out := apiActivity{
+		ID:           a.ID,
+		StartTime:    a.StartTimeUTC.Format(time.RFC3339),
+		Sport:        a.Sport,
+		SubSport:     a.SubSport,
+		DurationS:    a.DurationS,
+		DistanceM:    a.DistanceM,
+		AvgHR:        a.AvgHR,
+		MaxHR:        a.MaxHR,
+		AvgSpeedMPS:  a.AvgSpeedMPS,
+		Calories:     a.Calories,
+		AscentM:      a.AscentM,
+		DescentM:     a.DescentM,
+		DeviceVendor: a.DeviceVendor,
+		DeviceModel:  a.DeviceModel,
+	}
+	if a.AerobicTE.Valid {
+		out.AerobicTE = &a.AerobicTE.Float64
+	}
+	if a.AnaerobicTE.Valid {
+		out.AnaerobicTE = &a.AnaerobicTE.Float64
+	}
+	if a.ElapsedS.Valid {
+		out.ElapsedS, out.MovingS = &a.ElapsedS.Int64, &a.MovingS.Int64
+	}
+	return out
+}
+
+func toAPIPlanned(p store.PlannedWorkout) apiPlanned {
+	out := apiPlanned{
+		ID:    p.ID,
+		Date:  p.PlannedDate.Format("2006-01-02"),
+		Sport: p.Sport,
+		Title: p.Title,
+		Notes: p.Notes,
+	}
+	if p.DistanceM.Valid {
+		out.DistanceM = &p.DistanceM.Int64
+	}
+	if p.DurationS.Valid {
+		out.DurationS = &p.DurationS.Int64
+	}
+	if p.BlockID.Valid {
+		out.BlockID = &p.BlockID.Int64
+	}
+	return out
+}
+
+func nullFloatPtr(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
+
+func nullIntPtr(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Int64
+}
+
+// GET /api/v1/activities?page=&per_page=&sport=
+func (s *Server) apiActivities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	page, perPage := apiPage(r, apiDefaultPerPage, apiMaxPerPage)
+	sport := strings.TrimSpace(r.URL.Query().Get("sport"))
+	acts, total, err := s.store.ListActivities(s.currentUser(r).ID, sport, perPage, (page-1)*perPage)
+	if err != nil {
+		apiInternalError(w, "list activities", err)
+		return
+	}
+	data := make([]apiActivity, 0, len(acts))
+	for _, a := range acts {
+		data = append(data, toAPIActivity(a))
+	}
+	writeAPIJSON(w, http.StatusOK, apiList{Data: data, Pagination: newPagination(page, perPage, total)})
+}
+
+// GET, DELETE /api/v1/activities/{id}
+func (s *Server) apiActivity(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiPathID(w, r)
+	if !ok {
+		return
+	}
+	uid := s.currentUser(r).ID
+	switch r.Method {
+	case http.MethodGet:
+		a, err := s.store.GetActivity(uid, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeAPIError(w, http.StatusNotFound, "not_found", "activity not found")
+			return
+		}
+		if err != nil {
+			apiInternalError(w, "load activity", err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, apiItem{Data: toAPIActivity(*a)})
+	case http.MethodDelete:
+		a, err := s.store.GetActivity(uid, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeAPIError(w, http.StatusNotFound, "not_found", "activity not found")
+			return
+		}
+		if err != nil {
+			apiInternalError(w, "load activity", err)
+			return
+		}
+		if err := s.store.DeleteActivity(uid, id); err != nil {
+			apiInternalError(w, "delete activity", err)
+			return
+		}
+		s.hooks.Emit(webhook.EventActivityDeleted, webhook.NewActivityData(a, "api", ""))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		apiMethodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	}
+}
+
+// apiRequireActivity writes a 404 and returns false when the activity is
+// missing or belongs to someone else.
+func (s *Server) apiRequireActivity(w http.ResponseWriter, r *http.Request, id int64) bool {
+	if _, err := s.store.GetActivity(s.currentUser(r).ID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeAPIError(w, http.StatusNotFound, "not_found", "activity not found")
+		} else {
+			apiInternalError(w, "load activity", err)
+		}
+		return false
+	}
+	return true
+}
+
+// GET /api/v1/activities/{id}/records?page=&per_page=
+func (s *Server) apiActivityRecords(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	id, ok := apiPathID(w, r)
+	if !ok || !s.apiRequireActivity(w, r, id) {
+		return
+	}
+	page, perPage := apiPage(r, apiRecordsPerPage, apiMaxRecordsPerPage)
+	recs, total, err := s.store.ListRecords(id, perPage, (page-1)*perPage)
+	if err != nil {
+		apiInternalError(w, "list records", err)
+		return
+	}
+	var dev map[int]map[string]float64
+	if len(recs) > 0 {
+		dev, err = s.apiDevValues(id, "record", recs[0].TOffsetS, recs[len(recs)-1].TOffsetS)
+		if err != nil {
+			apiInternalError(w, "list developer fields", err)
+			return
+		}
+	}
+	data := make([]apiRecord, 0, len(recs))
+	for _, rec := range recs {
+		data = append(data, apiRecord{
+			TOffsetS: rec.TOffsetS,
+			Lat:      nullFloatPtr(rec.Lat),
+			Lon:      nullFloatPtr(rec.Lon),
+			ElevM:    nullFloatPtr(rec.ElevM),
+			HR:       nullIntPtr(rec.HR),
+			Cad:      nullIntPtr(rec.Cad),
+			TempC:    nullFloatPtr(rec.TempC),
+			PowerW:   nullIntPtr(rec.PowerW),
+			SpeedMPS: nullFloatPtr(rec.SpeedMPS),
+
+			DistanceM:    nullFloatPtr(rec.DistanceM),
+			CadFraction:  nullFloatPtr(rec.CadFraction),
+			VertOscMM:    nullFloatPtr(rec.VertOscMM),
+			GCTMS:        nullFloatPtr(rec.GCTMS),
+			GCTBalance:   nullFloatPtr(rec.GCTBalance),
+			StrideM:      nullFloatPtr(rec.StrideM),
+			VertRatio:    nullFloatPtr(rec.VertRatio),
+			RespRate:     nullFloatPtr(rec.RespRate),
+			PowerBalance: nullFloatPtr(rec.PowerBalance),
+
+			Developer: dev[rec.TOffsetS],
+		})
+	}
+	writeAPIJSON(w, http.StatusOK, apiList{Data: data, Pagination: newPagination(page, perPage, total)})
+}
+
+// GET /api/v1/activities/{id}/laps
+func (s *Server) apiActivityLaps(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	id, ok := apiPathID(w, r)
+	if !ok || !s.apiRequireActivity(w, r, id) {
+		return
+	}
+	laps, err := s.store.ListLaps(id)
+	if err != nil {
+		apiInternalError(w, "list laps", err)
+		return
+	}
+	dev, err := s.apiDevValues(id, "lap", 0, math.MaxInt32)
+	if err != nil {
+		apiInternalError(w, "list developer fields", err)
+		return
+	}
+	data := make([]apiLap, 0, len(laps))
+	for _, l := range laps {
+		data = append(data, apiLap{
+			Index: l.Index, StartOffS: l.StartOff, DurationS: l.DurS, DistanceM: l.DistM,
+			AvgHR: l.AvgHR, MaxHR: l.MaxHR, AvgSpeedMPS: l.AvgSpd,
+			Developer: dev[l.Index],
+		})
+	}
+	writeAPIJSON(w, http.StatusOK, apiItem{Data: data})
+}
+
+// apiDevValues returns an activity's developer field values of one message
+// kind by position and field name. Names used by more than one field get
+// the field's numbers appended.
+func (s *Server) apiDevValues(id int64, msg string, from, to int) (map[int]map[string]float64, error) {
+	fields, err := s.store.ListDevFields(id)
+	if err != nil || len(fields) == 0 {
+		return nil, err
+	}
+	seen := map[string]int{}
+	for _, f := range fields {
+		seen[f.Label()]++
+	}
+	names := map[int64]string{}
+	for _, f := range fields {
+		names[f.ID] = f.Label()
+		if seen[f.Label()] > 1 {
+			names[f.ID] = fmt.Sprintf("%s (%d/%d)", f.Label(), f.Index, f.Num)
+		}
+	}
+	values, err := s.store.ListDevValues(id, msg, from, to)
+	if err != nil {
+		return nil, err
+	}
+	res := map[int]map[string]float64{}
+	for _, v := range values {
+		if res[v.Pos] == nil {
+			res[v.Pos] = map[string]float64{}
+		}
+		res[v.Pos][names[v.FieldID]] = v.Value
+	}
+	return res, nil
+}
+
+// GET /api/v1/activities/{id}/zones
+func (s *Server) apiActivityZones(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	id, ok := apiPathID(w, r)
+	if !ok || !s.apiRequireActivity(w, r, id) {
+		return
+	}
+	zones, err := s.store.GetHRZones(id)
+	if err != nil {
+		apiInternalError(w, "list zones", err)
+		return
+	}
+	if zones == nil {
+		zones = []store.HRZone{}
+	}
+	writeAPIJSON(w, http.StatusOK, apiItem{Data: zones})
+}
+
+// GET /api/v1/activities/{id}/splits?length_m=1000 (or unit=km|mi)
+func (s *Server) apiActivitySplits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	id, ok := apiPathID(w, r)
+	if !ok || !s.apiRequireActivity(w, r, id) {
+		return
+	}
+	lengthM, _ := splitLength(r.URL.Query().Get("unit"))
+	if v := r.URL.Query().Get("length_m"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 100 || f > 100000 {
+			writeAPIError(w, http.StatusBadRequest, "bad_request", "length_m must be between 100 and 100000")
+			return
+		}
+		lengthM = f
+	}
+	splits, err := s.activitySplits(id, lengthM)
+	if err != nil {
+		apiInternalError(w, "list splits", err)
+		return
+	}
+	round := func(v float64) float64 { return math.Round(v*10) / 10 }
+	perKm := func(mps float64) float64 {
+		if mps <= 0 {
+			return 0
+		}
+		return round(1000 / mps)
+	}
+	data := make([]apiSplit, 0, len(splits))
+	for _, sp := range splits {
+		data = append(data, apiSplit{
+			Index: sp.Index, DistanceM: round(sp.DistM), DurationS: round(sp.TimeS),
+			PaceSPerKm: perKm(sp.SpeedMPS()), GAPSPerKm: perKm(sp.GAPSpeedMPS()),
+			Grade: math.Round(sp.Grade*1000) / 1000, AvgHR: round(sp.AvgHR), AvgCadence: round(sp.AvgCad),
+			ElevGainM: round(sp.GainM), ElevLossM: round(sp.LossM), Best: sp.Best, Worst: sp.Worst,
+		})
+	}
+	writeAPIJSON(w, http.StatusOK, apiItem{Data: data})
+}
+
+// GET /api/v1/stats?from=YYYY-MM-DD&to=YYYY-MM-DD&sport=
+// "to" is exclusive; the default range is the current calendar month.
+func (s *Server) apiStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	q := r.URL.Query()
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "bad_request", "from must be YYYY-MM-DD")
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "bad_request", "to must be YYYY-MM-DD")
+			return
+		}
+		to = t
+	}
+	if !to.After(from) {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "to must be after from")
+		return
+	}
+	sport := strings.TrimSpace(q.Get("sport"))
+	ps, err := s.periodStatsFiltered(s.currentUser(r).ID, from, to, sport)
+	if err != nil {
+		apiInternalError(w, "compute stats", err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, apiItem{Data: apiStats{
+		From:        from.Format("2006-01-02"),
+		To:          to.Format("2006-01-02"),
+		Sport:       sport,
+		Count:       ps.Count,
+		DistanceM:   ps.DistM,
+		DurationS:   ps.DurS,
+		AscentM:     ps.ElevM,
+		AvgSpeedMPS: ps.AvgSpd,
+	}})
+}
+
+// GET /api/v1/planned?from=&to=   POST /api/v1/planned
+func (s *Server) apiPlannedCollection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		now := time.Now().UTC()
+		from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		to := from.AddDate(0, 0, 28)
+		if v := r.URL.Query().Get("from"); v != "" {
+			t, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, "bad_request", "from must be YYYY-MM-DD")
+				return
+			}
+			from = t
+		}
+		if v := r.URL.Query().Get("to"); v != "" {
+			t, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, "bad_request", "to must be YYYY-MM-DD")
+				return
+			}
+			to = t
+		}
+		items, err := s.store.ListPlannedWorkouts(s.currentUser(r).ID, from, to)
+		if err != nil {
+			apiInternalError(w, "list planned workouts", err)
+			return
+		}
+		data := make([]apiPlanned, 0, len(items))
+		for _, it := range items {
+			data = append(data, toAPIPlanned(it))
+		}
+		writeAPIJSON(w, http.StatusOK, apiItem{Data: data})
+	case http.MethodPost:
+		in, date, ok := decodePlannedInput(w, r)
+		if !ok {
+			return
+		}
+		id, err := s.store.InsertPlannedWorkout(s.currentUser(r).ID, date, in.Sport, in.Title, int64PtrToNull(in.DistanceM), int64PtrToNull(in.DurationS), in.Notes)
+		if err != nil {
+			apiInternalError(w, "save planned workout", err)
+			return
+		}
+		s.planUpdated(s.currentUser(r).ID, "created", id, 0, date.Format("2006-01-02"))
+		s.apiWritePlanned(w, r, http.StatusCreated, id)
+	default:
+		apiMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// GET, PUT, DELETE /api/v1/planned/{id}
+func (s *Server) apiPlannedItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiPathID(w, r)
+	if !ok {
+		return
+	}
+	uid := s.currentUser(r).ID
+	if _, err := s.store.GetPlannedWorkout(uid, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeAPIError(w, http.StatusNotFound, "not_found", "planned workout not found")
+		} else {
+			apiInternalError(w, "load planned workout", err)
+		}
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.apiWritePlanned(w, r, http.StatusOK, id)
+	case http.MethodPut:
+		in, date, ok := decodePlannedInput(w, r)
+		if !ok {
+			return
+		}
+		if err := s.store.UpdatePlannedWorkout(uid, id, date, in.Sport, in.Title, int64PtrToNull(in.DistanceM), int64PtrToNull(in.DurationS), in.Notes); err != nil {
+			apiInternalError(w, "update planned workout", err)
+			return
+		}
+		s.planUpdated(uid, "updated", id, 0, date.Format("2006-01-02"))
+		s.apiWritePlanned(w, r, http.StatusOK, id)
+	case http.MethodDelete:
+		if err := s.store.DeletePlannedWorkout(uid, id); err != nil {
+			apiInternalError(w, "delete planned workout", err)
+			return
+		}
+		s.planUpdated(uid, "deleted", id, 0, "")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		apiMethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (s *Server) apiWritePlanned(w http.ResponseWriter, r *http.Request, status int, id int64) {
+	p, err := s.store.GetPlannedWorkout(s.currentUser(r).ID, id)
+	if err != nil {
+		apiInternalError(w, "load planned workout", err)
+		return
+	}
+	writeAPIJSON(w, status, apiItem{Data: toAPIPlanned(*p)})
+}
+
+func decodePlannedInput(w http.ResponseWriter, r *http.Request) (apiPlannedInput, time.Time, bool) {
+	var in apiPlannedInput
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "invalid JSON body: "+err.Error())
+		return in, time.Time{}, false
+	}
+	date, err := time.Parse("2006-01-02", strings.TrimSpace(in.Date))
+	if err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, "invalid", "date must be YYYY-MM-DD")
+		return in, time.Time{}, false
+	}
+	in.Sport = strings.TrimSpace(in.Sport)
+	if in.Sport == "" {
+		writeAPIError(w, http.StatusUnprocessableEntity, "invalid", "sport required")
+		return in, time.Time{}, false
+	}
+	if (in.DistanceM != nil && *in.DistanceM < 0) || (in.DurationS != nil && *in.DurationS < 0) {
+		writeAPIError(w, http.StatusUnprocessableEntity, "invalid", "distance_m and duration_s must not be negative")
+		return in, time.Time{}, false
+	}
+	in.Title = strings.TrimSpace(in.Title)
+	in.Notes = strings.TrimSpace(in.Notes)
+	return in, date, true
+}
+
+func int64PtrToNull(v *int64) sql.NullInt64 {
+	if v == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *v, Valid: true}
+}
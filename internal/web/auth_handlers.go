@@ -3,22 +3,53 @@ package web
 import (
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"golang.org/x/crypto/bcrypt"
+
+	"garmr/internal/store"
 )
 
 type loginView struct {
 	CurrentUser *userView
 	Error       string
 	Next        string
+	CSRFToken   string
+	TwoFactor   bool   // asking for the second factor
+	SSOButton   string // label of the OIDC sign-in button, "" when off
 }
 
 type accountDetailsView struct {
+	CurrentUser   *userView
+	Theme         string
+	Error         string
+	Success       string
+	HasFeed       bool
+	FeedCreatedAt string
+	FeedURL       string // only set right after (re)generating the token
+	SSO           bool   // OpenID Connect is configured
+	Identities    []store.Identity
+}
+
+// ssoLinkResults are the messages for /account/details?sso=, where linking
+// single sign-on comes back to.
+var ssoLinkResults = map[string]struct {
+	msg string
+	ok  bool
+}{
+	"linked": {"Single sign-on account linked", true},
+	"taken":  {"That single sign-on account is already linked to another user", false},
+	"failed": {"Linking single sign-on failed. Check server logs.", false},
+}
+
+type accountTokensView struct {
 	CurrentUser *userView
-	Theme       string
 	Error       string
 	Success     string
+	NewToken    string // only set right after creation
+	Tokens      []store.APIToken
 }
 
 type accountPasswordView struct {
@@ -51,34 +82,63 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 			s.renderLogin(w, r, next, "Username and password are required")
 			return
 		}
+		ip := s.clientIP(r)
+		if s.loginLocked(username, ip) {
+			s.recordLogin(username, ip, store.LoginLocked)
+			s.renderLogin(w, r, next, "Too many failed sign-ins. Try again in a few minutes.")
+			return
+		}
 		user, err := s.store.GetUserByUsername(username)
-		if err != nil {
+		if err != nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+			s.recordLogin(username, ip, store.LoginFailed)
 			s.renderLogin(w, r, next, "Invalid username or password")
 			return
 		}
-		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
-			s.renderLogin(w, r, next, "Invalid username or password")
+		if user.Disabled {
+			s.recordLogin(username, ip, store.LoginFailed)
+			s.renderLogin(w, r, next, "This account is disabled. Ask an admin to enable it.")
 			return
 		}
-		sessionID, err := s.store.CreateSession(user.ID)
-		if err != nil {
-			log.Printf("login: create session: %v", err)
-			s.renderLogin(w, r, next, "Unable to create session. Check server logs.")
+		if user.TwoFactor {
+			pendingID, err := s.store.CreatePendingSession(user.ID, r.UserAgent(), ip)
+			if err != nil {
+				log.Printf("login: create pending session: %v", err)
+				s.renderLogin(w, r, next, "Unable to create session. Check server logs.")
+				return
+			}
+			s.setMFACookie(w, r, pendingID)
+			http.Redirect(w, r, "/login/2fa?next="+url.QueryEscape(next), http.StatusSeeOther)
 			return
 		}
-		s.store.UpdateLastLogin(user.ID)
-		s.setSessionCookie(w, r, sessionID)
-		http.Redirect(w, r, nextTarget(next), http.StatusSeeOther)
+		s.signIn(w, r, user, next)
 	default:
 		s.renderLogin(w, r, next, "")
 	}
 }
 
+// signIn starts a session for user after all checks passed and sends the
+// browser on to next.
+func (s *Server) signIn(w http.ResponseWriter, r *http.Request, user *store.AuthUser, next string) {
+	ip := s.clientIP(r)
+	sessionID, err := s.store.CreateSession(user.ID, r.UserAgent(), ip)
+	if err != nil {
+		log.Printf("login: create session: %v", err)
+		s.renderLogin(w, r, next, "Unable to create session. Check server logs.")
+		return
+	}
+	s.recordLogin(user.Username, ip, store.LoginOK)
+	s.store.UpdateLastLogin(user.ID)
+	s.setSessionCookie(w, r, sessionID)
+	http.Redirect(w, r, nextTarget(next), http.StatusSeeOther)
+}
+
 func (s *Server) renderLogin(w http.ResponseWriter, r *http.Request, next, message string) {
 	data := loginView{
 		CurrentUser: s.currentUser(r),
 		Error:       message,
 		Next:        next,
+		CSRFToken:   s.anonCSRF(w, r),
+		SSOButton:   s.ssoButton(),
 	}
 	if err := s.tplLogin.ExecuteTemplate(w, "layout", data); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -108,7 +168,14 @@ func (s *Server) handleAccountDetails(w http.ResponseWriter, r *http.Request) {
 	if theme == "" {
 		theme = "system"
 	}
-	data := accountDetailsView{CurrentUser: user, Theme: theme}
+	data := accountDetailsView{CurrentUser: user, Theme: theme, SSO: s.oidc != nil}
+	if res, ok := ssoLinkResults[r.URL.Query().Get("sso")]; ok && r.Method == http.MethodGet {
+		if res.ok {
+			data.Success = res.msg
+		} else {
+			data.Error = res.msg
+		}
+	}
 	if r.Method == http.MethodPost {
 		if err := r.ParseForm(); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
@@ -128,6 +195,46 @@ func (s *Server) handleAccountDetails(w http.ResponseWriter, r *http.Request) {
 				data.Theme = theme
 				data.Success = "Theme preference saved"
 			}
+		case "calendar_feed":
+			token, err := s.store.CreateCalendarFeedToken(user.ID)
+			if err != nil {
+				data.Error = err.Error()
+			} else {
+				data.FeedURL = s.feedURL(r, token)
+				data.Success = "Calendar feed URL created. Copy it now, it won't be shown again."
+			}
+		case "calendar_feed_revoke":
+			if err := s.store.DeleteCalendarFeedToken(user.ID); err != nil {
+				data.Error = err.Error()
+			} else {
+				data.Success = "Calendar feed revoked"
+			}
+		case "sso_link":
+			if s.oidc == nil {
+				data.Error = "Single sign-on is not configured"
+				break
+			}
+			stored, err := s.store.GetUserByID(user.ID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if bcrypt.CompareHashAndPassword([]byte(stored.PasswordHash), []byte(r.FormValue("current_password"))) != nil {
+				data.Error = "Current password is incorrect"
+				break
+			}
+			if err := s.startOIDC(w, r, "/account/details", user.ID); err != nil {
+				log.Printf("oidc: start linking: %v", err)
+				data.Error = "Single sign-on is unavailable right now. Check server logs."
+				break
+			}
+			return
+		case "sso_unlink":
+			if err := s.store.UnlinkIdentity(user.ID, r.FormValue("issuer"), r.FormValue("subject")); err != nil {
+				data.Error = "Single sign-on account not found"
+			} else {
+				data.Success = "Single sign-on account unlinked"
+			}
 		default:
 			newUsername := strings.TrimSpace(r.FormValue("new_username"))
 			current := r.FormValue("current_password")
@@ -154,6 +261,12 @@ func (s *Server) handleAccountDetails(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
+	if created, ok, err := s.store.CalendarFeedCreatedAt(user.ID); err == nil {
+		data.HasFeed, data.FeedCreatedAt = ok, created
+	}
+	if ids, err := s.store.ListIdentities(user.ID); err == nil {
+		data.Identities = ids
+	}
 	if err := s.tplAccountDetails.ExecuteTemplate(w, "layout", data); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
@@ -191,7 +304,7 @@ func (s *Server) handleAccountPassword(w http.ResponseWriter, r *http.Request) {
 			} else if err := s.store.UpdatePassword(user.ID, newPass); err != nil {
 				data.Error = err.Error()
 			} else {
-				newSession, err := s.store.CreateSession(user.ID)
+				newSession, err := s.store.CreateSession(user.ID, r.UserAgent(), s.clientIP(r))
 				if err == nil {
 					_ = s.store.DeleteSessionsForUserExcept(user.ID, newSession)
 					s.setSessionCookie(w, r, newSession)
@@ -220,3 +333,51 @@ func nextTarget(next string) string {
 	}
 	return next
 }
+
+func (s *Server) handleAccountTokens(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	data := accountTokensView{CurrentUser: user}
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch r.FormValue("intent") {
+		case "create":
+			if r.FormValue("scope") == store.ScopeWrite && !user.CanEdit() {
+				data.Error = "Viewers can only create read-only tokens"
+				break
+			}
+			token, err := s.store.CreateAPIToken(user.ID, r.FormValue("name"), r.FormValue("scope"))
+			if err != nil {
+				data.Error = err.Error()
+			} else {
+				data.NewToken = token
+				data.Success = "Token created. Copy it now, it won't be shown again."
+			}
+		case "revoke":
+			id, _ := strconv.ParseInt(r.FormValue("id"), 10, 64)
+			if err := s.store.DeleteAPIToken(user.ID, id); err != nil {
+				data.Error = "Token not found"
+			} else {
+				data.Success = "Token revoked"
+			}
+		default:
+			data.Error = "Unknown action"
+		}
+	}
+	tokens, err := s.store.ListAPITokens(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Tokens = tokens
+	if err := s.tplAccountTokens.ExecuteTemplate(w, "layout", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -3,6 +3,7 @@ package web
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -15,7 +16,10 @@ import (
 	"strings"
 	"time"
 
+	"garmr/internal/fitx"
+	"garmr/internal/plan"
 	"garmr/internal/store"
+	"garmr/internal/webhook"
 )
 
 // If listItem already exists elsewhere, remove this.
@@ -60,18 +64,20 @@ type dashVM struct {
 }
 
 type activitiesVM struct {
-	Items        []listItem
-	Sports       []string
-	CurrentSport string
-	CurrentUser  *userView
-	Page         int
-	TotalPages   int
-	PageNumbers  []int
-	HasPrev      bool
-	HasNext      bool
-	PrevPage     int
-	NextPage     int
-	PaginationQS string
+	Items         []listItem
+	Sports        []string
+	CurrentSport  string
+	Devices       []store.Device
+	CurrentDevice int64
+	CurrentUser   *userView
+	Page          int
+	TotalPages    int
+	PageNumbers   []int
+	HasPrev       bool
+	HasNext       bool
+	PrevPage      int
+	NextPage      int
+	PaginationQS  string
 }
 
 type activityDetailVM struct {
@@ -81,8 +87,25 @@ type activityDetailVM struct {
 	DurS, DistM, AvgHR, MaxHR, Cals int
 	AvgSpd, Asc, Dsc                float64
 	AerobicTE, AnaerobicTE          sql.NullFloat64
+	AvgPowerW                       sql.NullFloat64
+	WeightKg                        sql.NullFloat64 // the athlete's weight at the time
+	CalsEstimated                   bool            // the FIT file had no calories
+	Swim                            *swimVM         // pool swims only
+	Dev                             *devVM          // lap and session developer fields, if any
+	ElapsedS, MovingS               int             // DurS is the timer time
+	Pauses                          int             // times the timer was stopped
+	Splits                          *splitsVM       // km or mile splits, nil without distance
+	Climbs                          []climbRow
 	CurrentUser                     *userView
 	HasHRData                       bool
+	Laps                            []store.Lap
+	Devices                         []store.Device // as they were in this activity
+
+	ShareToken string // set when rendered through a public share link
+	Shares     []store.ActivityShare
+	ShareURL   string // only set right after creating a link
+	Error      string
+	Success    string
 }
 
 type calendarEntry struct {
@@ -95,12 +118,14 @@ type calendarEntry struct {
 }
 
 type plannedEntry struct {
-	ID     int64
-	Sport  string
-	Title  string
-	DistKm float64
-	DurS   int
-	Notes  string
+	ID        int64
+	Sport     string
+	Title     string
+	DistKm    float64
+	DurS      int
+	Notes     string
+	BlockID   int64
+	BlockName string
 }
 
 type calendarDay struct {
@@ -121,14 +146,18 @@ type calendarVM struct {
 	WeekDays      []calendarDay
 	WeekTotals    weekTotals
 	WeekRowTotals []weekTotals
-	PrevURL       string
-	NextURL       string
-	TodayURL      string
-	MonthLink     string
-	WeekLink      string
-	View          string
-	Sports        []string
-	CurrentUser   *userView
+	// planned volume, per week (week view) or per grid row (month view)
+	WeekPlanned    weekTotals
+	WeekRowPlanned []weekTotals
+	Blocks         []store.PlanBlock
+	PrevURL        string
+	NextURL        string
+	TodayURL       string
+	MonthLink      string
+	WeekLink       string
+	View           string
+	Sports         []string
+	CurrentUser    *userView
 }
 
 type weekTotals struct {
@@ -169,13 +198,15 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	sport := strings.TrimSpace(r.URL.Query().Get("sport")) // "" => All
 	now := time.Now()
 	loc := now.Location()
+	uid := s.athlete(r).ID
 
 	// ----- recent activities (unfiltered; change if you want it filtered too) -----
 	rows, err := s.db.Query(`
         SELECT id, start_time_utc, sport, distance_m, duration_s
         FROM activities
+        WHERE user_id = ?
         ORDER BY start_time_utc DESC
-        LIMIT 5`)
+        LIMIT 5`, uid)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
@@ -204,8 +235,9 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	err = s.db.QueryRow(`
         SELECT id, start_time_utc, sport, distance_m, duration_s, avg_speed_mps
         FROM activities
+        WHERE user_id = ?
         ORDER BY start_time_utc DESC
-        LIMIT 1`).Scan(&latestID, &startStr, &sportName, &distM, &durS, &avgSpd)
+        LIMIT 1`, uid).Scan(&latestID, &startStr, &sportName, &distM, &durS, &avgSpd)
 	switch err {
 	case nil:
 		startTime, _ := parseActivityTime(startStr)
@@ -238,7 +270,7 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	rowsSports, err := s.db.Query(`
         SELECT DISTINCT TRIM(sport)
         FROM activities
-        WHERE sport IS NOT NULL AND TRIM(sport) <> ''`)
+        WHERE user_id = ? AND sport IS NOT NULL AND TRIM(sport) <> ''`, uid)
 	if err == nil {
 		defer rowsSports.Close()
 		seen := map[string]struct{}{}
@@ -273,17 +305,17 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	yearEnd := time.Date(now.Year()+1, 1, 1, 0, 0, 0, 0, loc)
 
 	// ----- aggregated stats (filtered by sport if provided) -----
-	weekStats, err := s.periodStatsFiltered(weekStart, weekEnd, sport)
+	weekStats, err := s.periodStatsFiltered(uid, weekStart, weekEnd, sport)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
-	monthStats, err := s.periodStatsFiltered(monthStart, monthEnd, sport)
+	monthStats, err := s.periodStatsFiltered(uid, monthStart, monthEnd, sport)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
-	yearStats, err := s.periodStatsFiltered(yearStart, yearEnd, sport)
+	yearStats, err := s.periodStatsFiltered(uid, yearStart, yearEnd, sport)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
@@ -351,12 +383,15 @@ func buildPageNumbers(current, total int) []int {
 	return pages
 }
 
-func buildActivitiesRedirect(sport, page string) string {
+func buildActivitiesRedirect(sport, device, page string) string {
 	params := url.Values{}
 	sport = strings.TrimSpace(sport)
 	if sport != "" {
 		params.Set("sport", sport)
 	}
+	if id, err := strconv.ParseInt(strings.TrimSpace(device), 10, 64); err == nil && id > 0 {
+		params.Set("device", strconv.FormatInt(id, 10))
+	}
 	page = strings.TrimSpace(page)
 	if page != "" && page != "1" {
 		if _, err := strconv.Atoi(page); err == nil {
@@ -382,7 +417,7 @@ func iterRows(rows *sql.Rows) <-chan *sql.Rows {
 	return ch
 }
 
-func (s *Server) periodStatsFiltered(from, to time.Time, sport string) (periodStats, error) {
+func (s *Server) periodStatsFiltered(userID int64, from, to time.Time, sport string) (periodStats, error) {
 	f := from.UTC().Format(time.RFC3339)
 	t := to.UTC().Format(time.RFC3339)
 
@@ -394,9 +429,9 @@ func (s *Server) periodStatsFiltered(from, to time.Time, sport string) (periodSt
           COALESCE(SUM(ascent_m), 0),
           COUNT(*)
         FROM activities
-        WHERE start_time_utc >= ? AND start_time_utc < ?
+        WHERE user_id = ? AND start_time_utc >= ? AND start_time_utc < ?
     `
-	args := []any{f, t}
+	args := []any{userID, f, t}
 	if sport != "" {
 		q += ` AND sport = ?`
 		args = append(args, sport)
@@ -492,19 +527,21 @@ func timeAgo(t time.Time, now time.Time) string {
 
 func (s *Server) handleActivities(w http.ResponseWriter, r *http.Request) {
 	sport := strings.TrimSpace(r.URL.Query().Get("sport")) // "" => All
+	device, _ := strconv.ParseInt(r.URL.Query().Get("device"), 10, 64)
 	pageStr := strings.TrimSpace(r.URL.Query().Get("page"))
 	page := 1
 	if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
 		page = p
 	}
+	uid := s.athlete(r).ID
 
 	// Build sports list from ALL activities (stable dropdown)
 	sports := make([]string, 0, 8)
 	rowsSports, err := s.db.Query(`
         SELECT DISTINCT TRIM(sport)
         FROM activities
-        WHERE sport IS NOT NULL AND TRIM(sport) <> ''
-    `)
+        WHERE user_id = ? AND sport IS NOT NULL AND TRIM(sport) <> ''
+    `, uid)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
@@ -529,14 +566,26 @@ func (s *Server) handleActivities(w http.ResponseWriter, r *http.Request) {
 	}
 	sort.Strings(sports)
 
+	devices, err := s.store.ListDevices(uid)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	where := ` WHERE user_id = ?`
+	args := []any{uid}
+	if sport != "" {
+		where += ` AND sport = ?`
+		args = append(args, sport)
+	}
+	if device > 0 {
+		where += ` AND id IN (SELECT activity_id FROM activity_devices WHERE device_id = ?)`
+		args = append(args, device)
+	}
+
 	// Count total items for pagination
 	var total int
-	if sport == "" {
-		err = s.db.QueryRow(`SELECT COUNT(*) FROM activities`).Scan(&total)
-	} else {
-		err = s.db.QueryRow(`SELECT COUNT(*) FROM activities WHERE sport = ?`, sport).Scan(&total)
-	}
-	if err != nil {
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM activities`+where, args...).Scan(&total); err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
@@ -552,22 +601,12 @@ func (s *Server) handleActivities(w http.ResponseWriter, r *http.Request) {
 	}
 	offset := (page - 1) * activitiesPageSize
 
-	// Query items (optionally filtered by sport)
-	var rows *sql.Rows
-	if sport == "" {
-		rows, err = s.db.Query(`
-            SELECT id, start_time_utc, sport, distance_m, duration_s
-            FROM activities
-            ORDER BY start_time_utc DESC
-            LIMIT ? OFFSET ?`, activitiesPageSize, offset)
-	} else {
-		rows, err = s.db.Query(`
+	// Query items (optionally filtered by sport and device)
+	rows, err := s.db.Query(`
             SELECT id, start_time_utc, sport, distance_m, duration_s
-            FROM activities
-            WHERE sport = ?
+            FROM activities`+where+`
             ORDER BY start_time_utc DESC
-            LIMIT ? OFFSET ?`, sport, activitiesPageSize, offset)
-	}
+            LIMIT ? OFFSET ?`, append(args, activitiesPageSize, offset)...)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
@@ -591,6 +630,9 @@ func (s *Server) handleActivities(w http.ResponseWriter, r *http.Request) {
 	if sport != "" {
 		params.Set("sport", sport)
 	}
+	if device > 0 {
+		params.Set("device", strconv.FormatInt(device, 10))
+	}
 	qs := params.Encode()
 	if qs != "" {
 		qs += "&"
@@ -603,18 +645,20 @@ func (s *Server) handleActivities(w http.ResponseWriter, r *http.Request) {
 	nextPage := page + 1
 
 	vm := activitiesVM{
-		Items:        items,
-		Sports:       sports, // full unfiltered list
-		CurrentSport: sport,  // selected value
-		CurrentUser:  s.currentUser(r),
-		Page:         page,
-		TotalPages:   totalPages,
-		PageNumbers:  pageNumbers,
-		HasPrev:      page > 1,
-		HasNext:      totalPages > 0 && page < totalPages,
-		PrevPage:     prevPage,
-		NextPage:     nextPage,
-		PaginationQS: qs,
+		Items:         items,
+		Sports:        sports, // full unfiltered list
+		CurrentSport:  sport,  // selected value
+		Devices:       devices,
+		CurrentDevice: device,
+		CurrentUser:   s.currentUser(r),
+		Page:          page,
+		TotalPages:    totalPages,
+		PageNumbers:   pageNumbers,
+		HasPrev:       page > 1,
+		HasNext:       totalPages > 0 && page < totalPages,
+		PrevPage:      prevPage,
+		NextPage:      nextPage,
+		PaginationQS:  qs,
 	}
 	if err := s.tplList.ExecuteTemplate(w, "layout", vm); err != nil {
 		http.Error(w, err.Error(), 500)
@@ -626,22 +670,50 @@ func (s *Server) handleActivityDetail(w http.ResponseWriter, r *http.Request) {
 	idStr := strings.TrimPrefix(r.URL.Path, "/activity/")
 	id, _ := strconv.ParseInt(idStr, 10, 64)
 
+	user := s.currentUser(r)
+	vm := activityDetailVM{CurrentUser: user}
+	if err := s.loadActivityDetail(&vm, s.athlete(r).ID, id); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.loadSplits(&vm, r.URL.Query().Get("splits"))
+	s.loadClimbs(&vm)
+	if user.CanEditActivities() {
+		if r.Method == http.MethodPost {
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, "invalid form", http.StatusBadRequest)
+				return
+			}
+			vm.Error, vm.Success = s.activityShareAction(r, &vm)
+		}
+		shares, err := s.store.ListActivityShares(id)
+		if err != nil {
+			log.Printf("list share links for activity %d: %v", id, err)
+		}
+		vm.Shares = shares
+	} else if r.Method == http.MethodPost {
+		forbidden(w, r)
+		return
+	}
+	_ = s.tplDetail.ExecuteTemplate(w, "layout", vm)
+}
+
+// loadActivityDetail fills vm with the activity and its laps; it returns
+// sql.ErrNoRows unless userID owns the activity.
+func (s *Server) loadActivityDetail(vm *activityDetailVM, userID, id int64) error {
 	row := s.db.QueryRow(`
         SELECT id, start_time_utc, sport, sub_sport, duration_s, distance_m,
                avg_hr, max_hr, avg_speed_mps, calories, ascent_m, descent_m,
                aerobic_te, anaerobic_te
-        FROM activities WHERE id=?`, id)
-
-	var vm activityDetailVM
+        FROM activities WHERE id=? AND user_id=?`, id, userID)
 	if err := row.Scan(&vm.ID, &vm.Start, &vm.Sport, &vm.Sub, &vm.DurS, &vm.DistM,
 		&vm.AvgHR, &vm.MaxHR, &vm.AvgSpd, &vm.Cals, &vm.Asc, &vm.Dsc,
 		&vm.AerobicTE, &vm.AnaerobicTE); err != nil {
-		if err == sql.ErrNoRows {
-			http.NotFound(w, r)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return err
 	}
 
 	var hrCount int
@@ -650,9 +722,35 @@ func (s *Server) handleActivityDetail(w http.ResponseWriter, r *http.Request) {
 	} else {
 		vm.HasHRData = hrCount > 0
 	}
+	laps, err := s.store.ListLaps(id)
+	if err != nil {
+		log.Printf("list laps for activity %d: %v", id, err)
+	}
+	vm.Laps = laps
+	devices, err := s.store.ActivityDevices(id)
+	if err != nil {
+		log.Printf("list devices for activity %d: %v", id, err)
+	}
+	vm.Devices = devices
 
-	vm.CurrentUser = s.currentUser(r)
-	_ = s.tplDetail.ExecuteTemplate(w, "layout", vm)
+	if err := s.db.QueryRow(`SELECT AVG(power_w) FROM records WHERE activity_id=? AND power_w IS NOT NULL AND power_w != 65535`, id).Scan(&vm.AvgPowerW); err != nil {
+		log.Printf("query avg power for activity %d: %v", id, err)
+	}
+	if start, err := parseActivityTime(vm.Start); err == nil {
+		if wt, err := s.store.WeightAt(userID, start); err == nil {
+			vm.WeightKg = sql.NullFloat64{Float64: wt.WeightKg, Valid: true}
+		} else if err != sql.ErrNoRows {
+			log.Printf("weight for activity %d: %v", id, err)
+		}
+	}
+	s.loadSwim(vm, userID)
+	s.loadDevFields(vm)
+	s.loadTimer(vm)
+	if vm.Cals == 0 {
+		vm.Cals = estimateCalories(vm.Sport, float64(vm.DistM), vm.DurS, vm.AvgPowerW.Float64, vm.WeightKg.Float64)
+		vm.CalsEstimated = vm.Cals > 0
+	}
+	return nil
 }
 
 func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
@@ -691,9 +789,10 @@ func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	// If no explicit anchor in week view and the current week has no data, align to the latest activity
-	if view == "week" && !anchorFromQuery {
+	athlete := s.athlete(r)
+	if view == "week" && !anchorFromQuery && athlete.CanViewActivities() {
 		var latestStart string
-		if err := s.db.QueryRow(`SELECT start_time_utc FROM activities ORDER BY start_time_utc DESC LIMIT 1`).Scan(&latestStart); err == nil {
+		if err := s.db.QueryRow(`SELECT start_time_utc FROM activities WHERE user_id = ? ORDER BY start_time_utc DESC LIMIT 1`, athlete.ID).Scan(&latestStart); err == nil {
 			if t, err := parseActivityTime(latestStart); err == nil && !t.IsZero() {
 				weekAnchor = dayStart(t.In(loc))
 			}
@@ -722,11 +821,16 @@ func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
 	}
 	rangeStartUTC := toDBTime(rangeStart)
 	rangeEndUTC := toDBTime(rangeEnd)
+	// a coach who may only edit plans sees the calendar without activities
+	actOwner := athlete.ID
+	if !athlete.CanViewActivities() {
+		actOwner = 0
+	}
 	rows, err := s.db.Query(`
         SELECT id, start_time_utc, sport, distance_m, duration_s, calories
         FROM activities
-        WHERE start_time_utc >= ? AND start_time_utc < ?
-        ORDER BY start_time_utc ASC`, rangeStartUTC, rangeEndUTC)
+        WHERE user_id = ? AND start_time_utc >= ? AND start_time_utc < ?
+        ORDER BY start_time_utc ASC`, actOwner, rangeStartUTC, rangeEndUTC)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -761,18 +865,20 @@ func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
 	}
 	// Planned workouts
 	pRows, err := s.db.Query(`
-        SELECT id, planned_date, sport, title, distance_m, duration_s, notes
-        FROM planned_workouts
-        WHERE planned_date >= ? AND planned_date < ?
-        ORDER BY planned_date ASC`, rangeStart.Format("2006-01-02"), rangeEnd.Format("2006-01-02"))
+        SELECT w.id, w.planned_date, w.sport, w.title, w.distance_m, w.duration_s, w.notes,
+               COALESCE(w.block_id, 0), COALESCE(b.name, '')
+        FROM planned_workouts w
+        LEFT JOIN plan_blocks b ON b.id = w.block_id
+        WHERE w.user_id = ? AND w.planned_date >= ? AND w.planned_date < ?
+        ORDER BY w.planned_date ASC`, athlete.ID, rangeStart.Format("2006-01-02"), rangeEnd.Format("2006-01-02"))
 	if err == nil {
 		defer pRows.Close()
 		for pRows.Next() {
-			var id int64
+			var id, blockID int64
 			var dateStr, sport string
 			var distM, durS sql.NullInt64
-			var title, notes string
-			if err := pRows.Scan(&id, &dateStr, &sport, &title, &distM, &durS, &notes); err != nil {
+			var title, notes, blockName string
+			if err := pRows.Scan(&id, &dateStr, &sport, &title, &distM, &durS, &notes, &blockID, &blockName); err != nil {
 				continue
 			}
 			dt, err := time.Parse("2006-01-02", dateStr)
@@ -781,12 +887,14 @@ func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
 			}
 			key := dayKey(dt.Format("2006-01-02"))
 			plannedBuckets[key] = append(plannedBuckets[key], plannedEntry{
-				ID:     id,
-				Sport:  sport,
-				Title:  title,
-				DistKm: nullableToKm(distM),
-				DurS:   int(nullableToInt(durS)),
-				Notes:  notes,
+				ID:        id,
+				Sport:     sport,
+				Title:     title,
+				DistKm:    nullableToKm(distM),
+				DurS:      int(nullableToInt(durS)),
+				Notes:     notes,
+				BlockID:   blockID,
+				BlockName: blockName,
 			})
 		}
 	}
@@ -801,8 +909,8 @@ func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
 	rowsSports, err := s.db.Query(`
         SELECT DISTINCT TRIM(sport)
         FROM activities
-        WHERE sport IS NOT NULL AND TRIM(sport) <> ''
-    `)
+        WHERE user_id = ? AND sport IS NOT NULL AND TRIM(sport) <> ''
+    `, athlete.ID)
 	if err == nil {
 		defer rowsSports.Close()
 		seen := map[string]struct{}{}
@@ -833,13 +941,26 @@ func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
 		CurrentUser: s.currentUser(r),
 		Sports:      sports,
 	}
+	if blocks, err := s.store.ListPlanBlocks(athlete.ID); err == nil {
+		vm.Blocks = blocks
+	} else {
+		log.Printf("calendar: list plan blocks: %v", err)
+	}
+	addPlanned := func(t *weekTotals, items []plannedEntry) {
+		for _, p := range items {
+			t.DistM += p.DistKm * 1000
+			t.DurS += p.DurS
+			t.Count++
+		}
+	}
 
 	if view == "month" {
 		grid := make([][]calendarDay, 0, 6)
 		weekRowTotals := make([]weekTotals, 0, 6)
+		weekRowPlanned := make([]weekTotals, 0, 6)
 		for week := 0; week < 6; week++ {
 			row := make([]calendarDay, 0, 7)
-			var rowTotals weekTotals
+			var rowTotals, rowPlanned weekTotals
 			for dow := 0; dow < 7; dow++ {
 				dt := gridStart.AddDate(0, 0, week*7+dow)
 				k := dayKey(dt.In(loc).Format("2006-01-02"))
@@ -855,6 +976,7 @@ func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
 					rowTotals.Calories += it.Calories
 					rowTotals.Count++
 				}
+				addPlanned(&rowPlanned, plannedBuckets[k])
 				row = append(row, calendarDay{
 					Date:    dt,
 					InMonth: dt.Month() == firstOfMonth.Month(),
@@ -866,11 +988,13 @@ func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
 			}
 			grid = append(grid, row)
 			weekRowTotals = append(weekRowTotals, rowTotals)
+			weekRowPlanned = append(weekRowPlanned, rowPlanned)
 		}
 		prev := firstOfMonth.AddDate(0, -1, 0)
 		next := firstOfMonth.AddDate(0, 1, 0)
 		vm.Grid = grid
 		vm.WeekRowTotals = weekRowTotals
+		vm.WeekRowPlanned = weekRowPlanned
 		vm.PrevURL = fmt.Sprintf("/calendar?view=month&year=%d&month=%d", prev.Year(), int(prev.Month()))
 		vm.NextURL = fmt.Sprintf("/calendar?view=month&year=%d&month=%d", next.Year(), int(next.Month()))
 		vm.TodayURL = fmt.Sprintf("/calendar?view=month&year=%d&month=%d", nowDay.Year(), int(nowDay.Month()))
@@ -878,7 +1002,7 @@ func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
 		vm.WeekLink = fmt.Sprintf("/calendar?view=week&date=%s", weekStart.Format("2006-01-02"))
 	} else {
 		weekDays := make([]calendarDay, 0, 7)
-		var totals weekTotals
+		var totals, planned weekTotals
 		for i := 0; i < 7; i++ {
 			dt := weekStart.AddDate(0, 0, i)
 			k := dayKey(dt.In(loc).Format("2006-01-02"))
@@ -895,6 +1019,7 @@ func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
 				totals.Calories += it.Calories
 				totals.Count++
 			}
+			addPlanned(&planned, plannedItems)
 			weekDays = append(weekDays, calendarDay{
 				Date:    dt,
 				InMonth: true,
@@ -908,6 +1033,7 @@ func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
 		next := weekStart.AddDate(0, 0, 7)
 		vm.WeekDays = weekDays
 		vm.WeekTotals = totals
+		vm.WeekPlanned = planned
 		vm.WeekLabel = fmt.Sprintf("%s – %s", weekStart.Format("Jan 2"), weekEnd.AddDate(0, 0, -1).Format("Jan 2"))
 		vm.PrevURL = fmt.Sprintf("/calendar?view=week&date=%s", prev.Format("2006-01-02"))
 		vm.NextURL = fmt.Sprintf("/calendar?view=week&date=%s", next.Format("2006-01-02"))
@@ -960,9 +1086,45 @@ func (s *Server) handleCalendarPlan(w http.ResponseWriter, r *http.Request) {
 			dur.Int64 = int64(v * 60)
 		}
 	}
-	if _, err := s.store.InsertPlannedWorkout(date, sport, title, dist, dur, notes); err != nil {
-		http.Error(w, "failed to save workout", http.StatusInternalServerError)
-		return
+
+	// Optional recurrence: repeat_days=tue&repeat_days=thu&repeat_weeks=8
+	if days := r.Form["repeat_days"]; len(days) > 0 {
+		weekdays, err := plan.ParseWeekdays(days)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		weeks, _ := strconv.Atoi(strings.TrimSpace(r.FormValue("repeat_weeks")))
+		rec := plan.Recurrence{Weekdays: weekdays, Start: date, Weeks: weeks}
+		dates, err := rec.Dates()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		workouts := make([]store.PlannedWorkout, 0, len(dates))
+		for _, d := range dates {
+			workouts = append(workouts, store.PlannedWorkout{
+				PlannedDate: d, Sport: sport, Title: title, DistanceM: dist, DurationS: dur, Notes: notes,
+			})
+		}
+		name := title
+		if name == "" {
+			name = fmt.Sprintf("%s every %s", sport, rec.Label())
+		}
+		blockID, err := s.store.CreatePlanBlock(s.athlete(r).ID, name, "recurrence", nil, workouts)
+		if err != nil {
+			log.Printf("calendar: create recurring plan: %v", err)
+			http.Error(w, "failed to save workouts", http.StatusInternalServerError)
+			return
+		}
+		s.planUpdated(s.athlete(r).ID, "created", 0, blockID, dateStr)
+	} else {
+		id, err := s.store.InsertPlannedWorkout(s.athlete(r).ID, date, sport, title, dist, dur, notes)
+		if err != nil {
+			http.Error(w, "failed to save workout", http.StatusInternalServerError)
+			return
+		}
+		s.planUpdated(s.athlete(r).ID, "created", id, 0, dateStr)
 	}
 
 	redirect := "/calendar?view=week&date=" + url.QueryEscape(dateStr)
@@ -1015,10 +1177,15 @@ func (s *Server) handleCalendarPlanUpdate(w http.ResponseWriter, r *http.Request
 		}
 	}
 
-	if err := s.store.UpdatePlannedWorkout(id, date, sport, "", dist, dur, notes); err != nil {
+	if err := s.store.UpdatePlannedWorkout(s.athlete(r).ID, id, date, sport, "", dist, dur, notes); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
 		http.Error(w, "failed to update workout", http.StatusInternalServerError)
 		return
 	}
+	s.planUpdated(s.athlete(r).ID, "updated", id, 0, dateStr)
 
 	redirect := "/calendar?view=week&date=" + url.QueryEscape(dateStr)
 	http.Redirect(w, r, redirect, http.StatusSeeOther)
@@ -1060,10 +1227,15 @@ func (s *Server) handleCalendarPlanMove(w http.ResponseWriter, r *http.Request)
 		}
 	}
 	newDate := date.AddDate(0, 0, delta)
-	if err := s.store.UpdatePlannedWorkoutDate(id, newDate); err != nil {
+	if err := s.store.UpdatePlannedWorkoutDate(s.athlete(r).ID, id, newDate); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
 		http.Error(w, "failed to move workout", http.StatusInternalServerError)
 		return
 	}
+	s.planUpdated(s.athlete(r).ID, "moved", id, 0, newDate.Format("2006-01-02"))
 
 	// redirect back to calendar week of new date
 	redirect := "/calendar?view=week&date=" + url.QueryEscape(newDate.Format("2006-01-02"))
@@ -1086,10 +1258,15 @@ func (s *Server) handleCalendarPlanDelete(w http.ResponseWriter, r *http.Request
 		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
-	if _, err := s.db.Exec(`DELETE FROM planned_workouts WHERE id = ?`, id); err != nil {
+	if err := s.store.DeletePlannedWorkout(s.athlete(r).ID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
 		http.Error(w, "failed to delete", http.StatusInternalServerError)
 		return
 	}
+	s.planUpdated(s.athlete(r).ID, "deleted", id, 0, dateStr)
 	redirect := "/calendar"
 	if dateStr != "" {
 		redirect = "/calendar?view=week&date=" + url.QueryEscape(dateStr)
@@ -1102,6 +1279,11 @@ func (s *Server) handleActivityDownload(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	// the FIT file has the whole track, privacy zones included
+	if !s.athlete(r).Self {
+		http.Error(w, "forbidden: only the owner can download the FIT file, use Export GPX", http.StatusForbidden)
+		return
+	}
 
 	idStr := strings.TrimSpace(r.URL.Query().Get("id"))
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -1110,7 +1292,7 @@ func (s *Server) handleActivityDownload(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	rawPath, err := s.store.ActivityRawPath(id)
+	rawPath, err := s.store.ActivityRawPath(s.athlete(r).ID, id)
 	switch err {
 	case nil:
 	case sql.ErrNoRows:
@@ -1205,58 +1387,104 @@ func (s *Server) handleActivityDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.store.DeleteActivity(id); err != nil {
+	// only owners delete, whoever they happen to be viewing
+	uid := s.currentUser(r).ID
+	a, _ := s.store.GetActivity(uid, id)
+	if err := s.store.DeleteActivity(uid, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
 		log.Printf("delete activity %d: %v", id, err)
 		http.Error(w, "failed to delete activity", http.StatusInternalServerError)
 		return
 	}
+	if a != nil {
+		s.hooks.Emit(webhook.EventActivityDeleted, webhook.NewActivityData(a, "web", ""))
+	}
 
-	redirect := buildActivitiesRedirect(r.FormValue("sport"), r.FormValue("page"))
+	redirect := buildActivitiesRedirect(r.FormValue("sport"), r.FormValue("device"), r.FormValue("page"))
 	if ret := strings.TrimSpace(r.FormValue("return_to")); ret != "" && strings.HasPrefix(ret, "/") {
 		redirect = ret
 	}
 	http.Redirect(w, r, redirect, http.StatusSeeOther)
 }
 
+// requireActivity writes a 404 and returns false unless the activity belongs
+// to the athlete being viewed.
+func (s *Server) requireActivity(w http.ResponseWriter, r *http.Request, id int64) bool {
+	if _, err := s.store.GetActivity(s.athlete(r).ID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return false
+	}
+	return true
+}
+
 func (s *Server) handleActivityGeoJSON(w http.ResponseWriter, r *http.Request) {
 	idStr := strings.TrimPrefix(r.URL.Path, "/api/activity/")
 	id, _ := strconv.ParseInt(idStr, 10, 64)
+	if !s.requireActivity(w, r, id) {
+		return
+	}
+	// people the athlete shares with always get the privacy zones applied
+	a := s.athlete(r)
+	pol, err := s.privacyPolicy(a.ID, !a.Self)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeTrack(w, id, pol)
+}
 
+type lonLat [2]float64
+
+func haversineM(lat1, lon1, lat2, lon2 float64) float64 {
+	const R = 6371000.0
+	toRad := func(d float64) float64 { return d * math.Pi / 180 }
+	dlat := toRad(lat2 - lat1)
+	dlon := toRad(lon2 - lon1)
+	a := math.Sin(dlat/2)*math.Sin(dlat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dlon/2)*math.Sin(dlon/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return R * c
+}
+
+// trackPt is one point of a cleaned GPS track.
+type trackPt struct {
+	Lon  float64  `json:"lon"`
+	Lat  float64  `json:"lat"`
+	T    int      `json:"t"`
+	HR   *int     `json:"hr,omitempty"`
+	Spd  *float64 `json:"spd,omitempty"`
+	Elev *float64 `json:"-"`
+	Gap  bool     `json:"gap,omitempty"` // first point after a hidden stretch
+}
+
+// loadTrack reads the GPS track of an activity, dropping invalid fixes,
+// duplicates and implausible jumps. The first point after a pause is
+// marked as a gap.
+func (s *Server) loadTrack(id int64) ([]trackPt, error) {
+	pauses, err := s.store.ActivityPauses(id)
+	if err != nil {
+		return nil, err
+	}
 	rows, err := s.db.Query(`
-        SELECT t_offset_s, lat_deg, lon_deg, hr, speed_mps
+        SELECT t_offset_s, lat_deg, lon_deg, hr, speed_mps, elev_m
         FROM records
         WHERE activity_id = ?
           AND lat_deg IS NOT NULL
           AND lon_deg IS NOT NULL
         ORDER BY t_offset_s ASC`, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
-	type pt [2]float64 // [lon, lat]
-	type richPt struct {
-		Lon float64  `json:"lon"`
-		Lat float64  `json:"lat"`
-		T   int      `json:"t"`
-		HR  *int     `json:"hr,omitempty"`
-		Spd *float64 `json:"spd,omitempty"`
-	}
-	var coords []pt
-	var points []richPt
-
-	haversineM := func(lat1, lon1, lat2, lon2 float64) float64 {
-		const R = 6371000.0
-		toRad := func(d float64) float64 { return d * math.Pi / 180 }
-		dlat := toRad(lat2 - lat1)
-		dlon := toRad(lon2 - lon1)
-		a := math.Sin(dlat/2)*math.Sin(dlat/2) +
-			math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dlon/2)*math.Sin(dlon/2)
-		c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-		return R * c
-	}
-
+	var points []trackPt
 	var lastLat, lastLon float64
 	var lastT int
 	const (
@@ -1265,15 +1493,13 @@ func (s *Server) handleActivityGeoJSON(w http.ResponseWriter, r *http.Request) {
 		maxJumpM   = 5000.0
 	)
 
-	kept := 0
 	for rows.Next() {
 		var t int
 		var lat, lon sql.NullFloat64
 		var hr sql.NullInt64
-		var spd sql.NullFloat64
-		if err := rows.Scan(&t, &lat, &lon, &hr, &spd); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		var spd, elev sql.NullFloat64
+		if err := rows.Scan(&t, &lat, &lon, &hr, &spd, &elev); err != nil {
+			return nil, err
 		}
 		if !lat.Valid || !lon.Valid {
 			continue
@@ -1286,7 +1512,7 @@ func (s *Server) handleActivityGeoJSON(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		if kept > 0 {
+		if len(points) > 0 {
 			if math.Abs(lastLat-la) < epsDeg && math.Abs(lastLon-lo) < epsDeg {
 				continue
 			}
@@ -1303,36 +1529,61 @@ func (s *Server) handleActivityGeoJSON(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		coords = append(coords, pt{lo, la})
-		var hrPtr *int
+		pt := trackPt{Lon: lo, Lat: la, T: t}
+		pt.Gap = len(points) > 0 && fitx.PausedBetween(pauses, lastT, t)
 		if hr.Valid && hr.Int64 != 255 {
 			val := int(hr.Int64)
-			hrPtr = &val
+			pt.HR = &val
 		}
-		var spdPtr *float64
-		if spd.Valid {
+		if spd.Valid && spd.Float64 > 0 {
 			v := spd.Float64
-			if v > 0 {
-				spdPtr = &v
-			}
+			pt.Spd = &v
 		}
-		points = append(points, richPt{Lon: lo, Lat: la, T: t, HR: hrPtr, Spd: spdPtr})
+		if elev.Valid {
+			v := elev.Float64
+			pt.Elev = &v
+		}
+		points = append(points, pt)
 		lastLat, lastLon, lastT = la, lo, t
-		kept++
 	}
+	return points, rows.Err()
+}
 
-	if kept < 2 {
-		log.Printf("geojson: activity %d -> %d points after filtering (nothing to draw)", id, kept)
+// writeTrack writes the cleaned GPS track of an activity as a GeoJSON
+// feature, with whatever pol hides left out. A track cut in the middle by
+// a privacy zone becomes a MultiLineString.
+func (s *Server) writeTrack(w http.ResponseWriter, id int64, pol privacyPolicy) {
+	points, err := s.loadTrack(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	points = pol.apply(points)
+
+	if len(points) < 2 {
+		log.Printf("geojson: activity %d -> %d points after filtering (nothing to draw)", id, len(points))
 	} else {
-		log.Printf("geojson: activity %d -> %d points", id, kept)
+		log.Printf("geojson: activity %d -> %d points", id, len(points))
+	}
+
+	var lines [][]lonLat
+	for i, p := range points {
+		if i == 0 || p.Gap {
+			lines = append(lines, nil)
+		}
+		lines[len(lines)-1] = append(lines[len(lines)-1], lonLat{p.Lon, p.Lat})
+	}
+	geom := map[string]any{"type": "LineString", "coordinates": []lonLat{}}
+	switch {
+	case len(lines) == 1:
+		geom["coordinates"] = lines[0]
+	case len(lines) > 1:
+		geom = map[string]any{"type": "MultiLineString", "coordinates": lines}
 	}
 
 	feat := map[string]any{
-		"type": "Feature",
-		"geometry": map[string]any{
-			"type":        "LineString",
-			"coordinates": coords,
-		},
+		"type":     "Feature",
+		"geometry": geom,
 		"properties": map[string]any{
 			"points": points,
 		},
@@ -1344,7 +1595,13 @@ func (s *Server) handleActivityGeoJSON(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleActivityZones(w http.ResponseWriter, r *http.Request) {
 	idStr := strings.TrimPrefix(r.URL.Path, "/api/zones/")
 	id, _ := strconv.ParseInt(idStr, 10, 64)
+	if !s.requireActivity(w, r, id) {
+		return
+	}
+	s.writeZones(w, id)
+}
 
+func (s *Server) writeZones(w http.ResponseWriter, id int64) {
 	db := &store.DB{DB: s.db}
 	zones, err := db.GetHRZones(id)
 	if err != nil {
@@ -1355,36 +1612,3 @@ func (s *Server) handleActivityZones(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(zones)
 }
-
-func (s *Server) periodStats(from time.Time, to time.Time) (periodStats, error) {
-	// stored as TEXT; we compare with ISO8601
-	f := from.UTC().Format(time.RFC3339)
-	t := to.UTC().Format(time.RFC3339)
-	row := s.db.QueryRow(`
-        SELECT
-          COALESCE(SUM(distance_m), 0),
-          COALESCE(SUM(duration_s), 0),
-          COALESCE(SUM(ascent_m), 0),
-          COUNT(*)
-        FROM activities
-        WHERE start_time_utc >= ? AND start_time_utc < ?
-    `, f, t)
-
-	var distM float64
-	var durS int
-	var elevM float64
-	var count int
-	if err := row.Scan(&distM, &durS, &elevM, &count); err != nil {
-		return periodStats{}, err
-	}
-	ps := periodStats{
-		DistM: distM,
-		DurS:  durS,
-		ElevM: elevM,
-		Count: count,
-	}
-	if durS > 0 {
-		ps.AvgSpd = distM / float64(durS)
-	}
-	return ps, nil
-}
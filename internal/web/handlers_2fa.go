@@ -0,0 +1,248 @@
+package web
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"garmr/internal/store"
+	"garmr/internal/totp"
+)
+
+// mfaCookieName holds the pending session of a sign-in between the
+// password and the second factor.
+const mfaCookieName = "garmr_mfa"
+
+type twoFactorVM struct {
+	CurrentUser   *userView
+	Error         string
+	Success       string
+	Enabled       bool
+	Secret        string       // only while setting up
+	SetupURL      template.URL // otpauth:// link for Secret
+	RecoveryCodes []string     // only right after generating them
+	CodesLeft     int
+}
+
+func (s *Server) setMFACookie(w http.ResponseWriter, r *http.Request, value string) {
+	c := &http.Cookie{
+		Name:     mfaCookieName,
+		Value:    value,
+		Path:     "/login",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   s.secure(r),
+		MaxAge:   int((10 * time.Minute).Seconds()),
+	}
+	if value == "" {
+		c.MaxAge = -1
+	}
+	http.SetCookie(w, c)
+}
+
+// GET, POST /login/2fa  (code: a TOTP code or a recovery code)
+func (s *Server) handleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	next := sanitizeRedirect(r.FormValue("next"))
+	var pending *store.Session
+	c, err := r.Cookie(mfaCookieName)
+	if err == nil {
+		pending, err = s.store.GetPendingSession(c.Value)
+	}
+	var user *store.AuthUser
+	if err == nil {
+		user, err = s.store.GetUserByID(pending.UserID)
+	}
+	if err != nil || user.Disabled || !user.TwoFactor {
+		s.setMFACookie(w, r, "")
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(next), http.StatusSeeOther)
+		return
+	}
+
+	msg := ""
+	if r.Method == http.MethodPost {
+		ip := s.clientIP(r)
+		switch {
+		case s.loginLocked(user.Username, ip):
+			s.recordLogin(user.Username, ip, store.LoginLocked)
+			msg = "Too many failed sign-ins. Try again in a few minutes."
+		case s.checkSecondFactor(user, r.FormValue("code")):
+			_ = s.store.DeleteSession(pending.ID)
+			s.setMFACookie(w, r, "")
+			s.signIn(w, r, user, next)
+			return
+		default:
+			s.recordLogin(user.Username, ip, store.LoginFailed)
+			msg = "Invalid code"
+		}
+	}
+	data := loginView{Error: msg, Next: next, CSRFToken: s.anonCSRF(w, r), TwoFactor: true}
+	if err := s.tplLogin.ExecuteTemplate(w, "layout", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// checkSecondFactor accepts a current, unused TOTP code or an unused
+// recovery code of user.
+func (s *Server) checkSecondFactor(user *store.AuthUser, code string) bool {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return false
+	}
+	if len(strings.ReplaceAll(code, " ", "")) == totp.Digits {
+		return s.checkTOTP(user, code)
+	}
+	if s.store.UseRecoveryCode(user.ID, code) != nil {
+		return false
+	}
+	left, _ := s.store.RecoveryCodesLeft(user.ID)
+	log.Printf("2fa: %s signed in with a recovery code (%d left)", user.Username, left)
+	return true
+}
+
+// checkTOTP accepts a current TOTP code of user that wasn't used before.
+func (s *Server) checkTOTP(user *store.AuthUser, code string) bool {
+	secret, err := s.store.TOTPSecret(user.ID)
+	if err != nil {
+		log.Printf("2fa: load secret of %s: %v", user.Username, err)
+		return false
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	return ok && s.store.UseTOTPStep(user.ID, step) == nil
+}
+
+// confirmIdentity checks the current password, or a code from the app for
+// accounts from single sign-on that have no password anyone knows. Failures
+// count towards the sign-in lockout, since a code is easier to guess than
+// a password. It returns the error to show, or "".
+func (s *Server) confirmIdentity(r *http.Request, user *store.AuthUser) string {
+	ip := s.clientIP(r)
+	if s.loginLocked(user.Username, ip) {
+		return "Too many failed attempts. Try again in a few minutes."
+	}
+	given := r.FormValue("current_password")
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(given)) == nil {
+		return ""
+	}
+	if len(strings.ReplaceAll(strings.TrimSpace(given), " ", "")) == totp.Digits && s.checkTOTP(user, given) {
+		return ""
+	}
+	s.recordLogin(user.Username, ip, store.LoginFailed)
+	return "Current password or code is incorrect"
+}
+
+// GET, POST /account/2fa  (intent: setup | confirm | cancel | recovery_codes | disable)
+func (s *Server) handleAccountTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
+	data := twoFactorVM{CurrentUser: user}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		data.Error, data.Success = s.twoFactorAction(r, user, &data)
+	}
+
+	stored, err := s.store.GetUserByID(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Enabled = stored.TwoFactor
+	if data.Enabled {
+		if data.CodesLeft, err = s.store.RecoveryCodesLeft(user.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		if data.Secret, err = s.store.PendingTOTP(user.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if data.Secret != "" {
+			data.SetupURL = template.URL(totp.URL("garmr", user.Username, data.Secret))
+		}
+	}
+	if err := s.tplAccount2FA.ExecuteTemplate(w, "layout", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// twoFactorAction performs one form intent and returns the error and
+// success messages to show.
+func (s *Server) twoFactorAction(r *http.Request, user *userView, data *twoFactorVM) (string, string) {
+	stored, err := s.store.GetUserByID(user.ID)
+	if err != nil {
+		return "Failed to load account", ""
+	}
+	intent := r.FormValue("intent")
+	switch intent {
+	case "setup", "confirm", "cancel":
+		if stored.TwoFactor {
+			return "Two-factor sign-in is already on", ""
+		}
+	case "recovery_codes", "disable":
+		if !stored.TwoFactor {
+			return "Two-factor sign-in is off", ""
+		}
+		if msg := s.confirmIdentity(r, stored); msg != "" {
+			return msg, ""
+		}
+	}
+
+	switch intent {
+	case "setup":
+		secret, err := totp.NewSecret()
+		if err != nil {
+			return err.Error(), ""
+		}
+		if err := s.store.SetPendingTOTP(user.ID, secret); err != nil {
+			return err.Error(), ""
+		}
+		return "", ""
+	case "confirm":
+		secret, err := s.store.PendingTOTP(user.ID)
+		if err != nil || secret == "" {
+			return "Start the setup again", ""
+		}
+		step, ok := totp.Validate(secret, r.FormValue("code"), time.Now())
+		if !ok {
+			return "That code doesn't match. Check the time on your phone and try the current code.", ""
+		}
+		if err := s.store.EnableTOTP(user.ID, step); err != nil {
+			return err.Error(), ""
+		}
+		codes, err := s.store.ReplaceRecoveryCodes(user.ID)
+		if err != nil {
+			return err.Error(), ""
+		}
+		data.RecoveryCodes = codes
+		log.Printf("2fa: %s turned on two-factor sign-in", user.Username)
+		return "", "Two-factor sign-in is on. Save these recovery codes now, they won't be shown again."
+	case "cancel":
+		if err := s.store.SetPendingTOTP(user.ID, ""); err != nil {
+			return err.Error(), ""
+		}
+		return "", ""
+	case "recovery_codes":
+		codes, err := s.store.ReplaceRecoveryCodes(user.ID)
+		if err != nil {
+			return err.Error(), ""
+		}
+		data.RecoveryCodes = codes
+		return "", "New recovery codes created; the old ones no longer work. Save these now, they won't be shown again."
+	case "disable":
+		if err := s.store.DisableTOTP(user.ID); err != nil {
+			return err.Error(), ""
+		}
+		log.Printf("2fa: %s turned off two-factor sign-in", user.Username)
+		return "", "Two-factor sign-in is off"
+	default:
+		return "Unknown action", ""
+	}
+}
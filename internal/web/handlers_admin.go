@@ -0,0 +1,206 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"garmr/internal/store"
+)
+
+type adminUsersVM struct {
+	CurrentUser  *userView
+	Error        string
+	Success      string
+	InviteURL    string // only set right after creating an invite
+	Roles        []string
+	Users        []store.AuthUser
+	Invites      []store.Invite
+	FailedLogins []store.LoginAttempt
+}
+
+type inviteVM struct {
+	CurrentUser *userView
+	Error       string
+	CSRFToken   string
+	Token       string
+	Role        string
+	Username    string
+}
+
+// GET, POST /admin/users
+// (intent: create | invite | revoke_invite | role | disable | enable | reset_password | reset_2fa | delete)
+func (s *Server) handleAdminUsers(w http.ResponseWriter, r *http.Request) {
+	me := s.currentUser(r)
+	data := adminUsersVM{CurrentUser: me, Roles: store.Roles}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		id, _ := strconv.ParseInt(strings.TrimSpace(r.FormValue("id")), 10, 64)
+		intent := r.FormValue("intent")
+		if id == me.ID && (intent == "disable" || intent == "delete" || intent == "role") {
+			// an admin locking themselves out is almost always a mistake
+			data.Error = "You can't change your own role or disable or delete your own account"
+		} else {
+			data.Error, data.Success = s.adminUsersAction(r, me, id, intent, &data)
+		}
+	}
+
+	users, err := s.store.ListUsers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	invites, err := s.store.ListOpenInvites()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	failed, err := s.store.ListFailedLogins(20)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Users, data.Invites, data.FailedLogins = users, invites, failed
+	if err := s.tplAdminUsers.ExecuteTemplate(w, "layout", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// adminUsersAction performs one form intent and returns the error and
+// success messages to show.
+func (s *Server) adminUsersAction(r *http.Request, me *userView, id int64, intent string, data *adminUsersVM) (string, string) {
+	var target *store.AuthUser
+	if intent != "create" && intent != "invite" && intent != "revoke_invite" {
+		u, err := s.store.GetUserByID(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "User not found", ""
+		}
+		if err != nil {
+			log.Printf("admin: load user %d: %v", id, err)
+			return "Failed to load user", ""
+		}
+		target = u
+	}
+
+	switch intent {
+	case "create":
+		if r.FormValue("password") != r.FormValue("confirm_password") {
+			return "Passwords do not match", ""
+		}
+		username := strings.TrimSpace(r.FormValue("username"))
+		if _, err := s.store.CreateUser(username, r.FormValue("password"), r.FormValue("role")); err != nil {
+			return err.Error(), ""
+		}
+		log.Printf("admin: %s created user %s (%s)", me.Username, username, r.FormValue("role"))
+		return "", "User " + username + " created"
+	case "invite":
+		token, err := s.store.CreateInvite(me.ID, r.FormValue("role"))
+		if err != nil {
+			return err.Error(), ""
+		}
+		data.InviteURL = s.inviteURL(r, token)
+		return "", "Invite created. Send this link to the new user; it works once and expires in 7 days."
+	case "revoke_invite":
+		if err := s.store.DeleteInvite(id); err != nil {
+			log.Printf("admin: revoke invite %d: %v", id, err)
+			return "Failed to revoke invite", ""
+		}
+		return "", "Invite revoked"
+	case "role":
+		role := r.FormValue("role")
+		if err := s.store.SetUserRole(target.ID, role); err != nil {
+			return err.Error(), ""
+		}
+		log.Printf("admin: %s set role of %s to %s", me.Username, target.Username, role)
+		return "", target.Username + " is now " + role
+	case "disable", "enable":
+		if err := s.store.SetUserDisabled(target.ID, intent == "disable"); err != nil {
+			return err.Error(), ""
+		}
+		log.Printf("admin: %s %sd user %s", me.Username, intent, target.Username)
+		return "", "User " + target.Username + " " + intent + "d"
+	case "reset_password":
+		if r.FormValue("password") != r.FormValue("confirm_password") {
+			return "Passwords do not match", ""
+		}
+		if err := s.store.UpdatePassword(target.ID, r.FormValue("password")); err != nil {
+			return err.Error(), ""
+		}
+		if target.ID != me.ID {
+			_ = s.store.DeleteSessionsForUserExcept(target.ID, "")
+		}
+		log.Printf("admin: %s reset the password of %s", me.Username, target.Username)
+		return "", "Password for " + target.Username + " reset"
+	case "reset_2fa":
+		if err := s.store.DisableTOTP(target.ID); err != nil {
+			return err.Error(), ""
+		}
+		log.Printf("admin: %s turned off two-factor sign-in of %s", me.Username, target.Username)
+		return "", "Two-factor sign-in of " + target.Username + " turned off"
+	case "delete":
+		if err := s.store.DeleteUser(target.ID); err != nil {
+			return err.Error(), ""
+		}
+		log.Printf("admin: %s deleted user %s", me.Username, target.Username)
+		return "", "User " + target.Username + " deleted"
+	default:
+		return "Unknown action", ""
+	}
+}
+
+func (s *Server) inviteURL(r *http.Request, token string) string {
+	return s.baseURL(r) + "/invite?token=" + url.QueryEscape(token)
+}
+
+// GET, POST /invite?token=...  (no login; the token is the credential)
+func (s *Server) handleInvite(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	data := inviteVM{CurrentUser: s.currentUser(r), CSRFToken: s.anonCSRF(w, r), Token: r.FormValue("token")}
+	role, err := s.store.InviteRole(data.Token)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("invite: lookup: %v", err)
+		}
+		http.Error(w, "This invite is invalid, used or expired.", http.StatusNotFound)
+		return
+	}
+	data.Role = role
+
+	if r.Method == http.MethodPost {
+		data.Username = strings.TrimSpace(r.FormValue("username"))
+		if r.FormValue("password") != r.FormValue("confirm_password") {
+			data.Error = "Passwords do not match"
+		} else if id, err := s.store.AcceptInvite(data.Token, data.Username, r.FormValue("password")); err != nil {
+			data.Error = err.Error()
+		} else {
+			log.Printf("invite: %s joined as %s", data.Username, role)
+			if cookie, err := r.Cookie(s.cookie); err == nil && cookie.Value != "" {
+				_ = s.store.DeleteSession(cookie.Value)
+			}
+			sessionID, err := s.store.CreateSession(id, r.UserAgent(), s.clientIP(r))
+			if err != nil {
+				log.Printf("invite: create session: %v", err)
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+			s.store.UpdateLastLogin(id)
+			s.setSessionCookie(w, r, sessionID)
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+	}
+	if err := s.tplInvite.ExecuteTemplate(w, "layout", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
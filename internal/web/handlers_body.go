@@ -0,0 +1,182 @@
+package web
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"garmr/internal/importer"
+	"garmr/internal/store"
+)
+
+type bodyVM struct {
+	CurrentUser *userView
+	Error       string
+	Success     string
+	Weights     []store.Weight // newest first
+	Latest      *store.Weight
+	Change30    sql.NullFloat64 // kg since the measurement closest to 30 days before the latest
+	Chart       weightChart
+	Now         time.Time
+}
+
+// weightChart holds the measurements for Chart.js.
+type weightChart struct {
+	Labels   []string `json:"labels"`
+	WeightKg []any    `json:"weight_kg"`
+	FatPct   []any    `json:"fat_pct"`
+}
+
+func newWeightChart(ws []store.Weight) weightChart {
+	c := weightChart{Labels: []string{}, WeightKg: []any{}, FatPct: []any{}}
+	for _, w := range ws {
+		c.Labels = append(c.Labels, w.MeasuredAt.Local().Format("2006-01-02"))
+		c.WeightKg = append(c.WeightKg, w.WeightKg)
+		c.FatPct = append(c.FatPct, nullFloat(w.FatPct))
+	}
+	return c
+}
+
+// handleBody shows the viewed athlete's weight and body composition and
+// lets owners add measurements by hand or from a CSV file.
+func (s *Server) handleBody(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
+	uid := s.athlete(r).ID
+	vm := bodyVM{CurrentUser: user, Now: time.Now()}
+
+	if r.Method == http.MethodPost {
+		if !user.CanEditActivities() {
+			forbidden(w, r)
+			return
+		}
+		if err := r.ParseMultipartForm(10 << 20); err != nil && err != http.ErrNotMultipart {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		switch r.FormValue("intent") {
+		case "add":
+			m, msg := weightFromForm(r)
+			if msg != "" {
+				vm.Error = msg
+				break
+			}
+			if err := s.store.AddWeights(uid, []store.Weight{m}); err != nil {
+				vm.Error = err.Error()
+				break
+			}
+			vm.Success = fmt.Sprintf("Added %.1f kg on %s.", m.WeightKg, m.MeasuredAt.Format("2006-01-02"))
+		case "csv":
+			f, _, err := r.FormFile("file")
+			if err != nil {
+				vm.Error = "Choose a CSV file to import."
+				break
+			}
+			ws, err := importer.ParseWeightCSV(f, time.Local)
+			f.Close()
+			if err != nil {
+				vm.Error = "Could not read the CSV file: " + err.Error()
+				break
+			}
+			if err := s.store.AddWeights(uid, ws); err != nil {
+				vm.Error = err.Error()
+				break
+			}
+			log.Printf("body: %s imported %d weights from CSV", user.Username, len(ws))
+			vm.Success = fmt.Sprintf("Imported %d measurements.", len(ws))
+		case "delete":
+			id, _ := strconv.ParseInt(r.FormValue("id"), 10, 64)
+			if err := s.store.DeleteWeight(uid, id); err != nil {
+				vm.Error = "Measurement not found."
+				break
+			}
+			vm.Success = "Measurement deleted."
+		default:
+			vm.Error = "Unknown action."
+		}
+	}
+
+	ws, err := s.store.ListWeights(uid, time.Time{}, time.Time{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	vm.Chart = newWeightChart(ws)
+	if n := len(ws); n > 0 {
+		latest := ws[n-1]
+		vm.Latest = &latest
+		month := latest.MeasuredAt.AddDate(0, 0, -30)
+		for i := n - 2; i >= 0; i-- {
+			if !ws[i].MeasuredAt.After(month) {
+				vm.Change30 = sql.NullFloat64{Float64: latest.WeightKg - ws[i].WeightKg, Valid: true}
+				break
+			}
+		}
+	}
+	for i := len(ws) - 1; i >= 0; i-- {
+		vm.Weights = append(vm.Weights, ws[i])
+	}
+	if err := s.tplBody.ExecuteTemplate(w, "layout", vm); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// weightFromForm reads a measurement entered by hand; everything but the
+// weight is optional. A non-empty msg tells the user what to fix.
+func weightFromForm(r *http.Request) (m store.Weight, msg string) {
+	at, err := time.ParseInLocation("2006-01-02 15:04", strings.TrimSpace(r.FormValue("date"))+" "+strings.TrimSpace(r.FormValue("time")), time.Local)
+	if err != nil {
+		return m, "Enter the date and time of the measurement."
+	}
+	m = store.Weight{MeasuredAt: at, Source: "manual"}
+	kg, err := strconv.ParseFloat(strings.TrimSpace(r.FormValue("weight_kg")), 64)
+	if err != nil || kg <= 0 || kg > 500 {
+		return m, "Enter a weight in kg."
+	}
+	m.WeightKg = kg
+	for _, f := range []struct {
+		name, label string
+		dst         *sql.NullFloat64
+	}{
+		{"fat_pct", "Body fat", &m.FatPct}, {"water_pct", "Water", &m.WaterPct},
+		{"muscle_kg", "Muscle", &m.MuscleKg}, {"bone_kg", "Bone", &m.BoneKg},
+	} {
+		v := strings.TrimSpace(r.FormValue(f.name))
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n < 0 {
+			return m, f.label + " must be a number, zero or more."
+		}
+		f.dst.Float64, f.dst.Valid = n, true
+	}
+	return m, ""
+}
+
+// estimateCalories guesses the energy of an activity whose FIT file has
+// none: from the work done when there is power (a kJ of work costs about a
+// kcal at a cyclist's ~24% efficiency), otherwise from the weight, at about
+// 1 kcal/kg/km running, 0.75 walking and 7.5 MET cycling. It returns 0 when
+// it can't tell.
+func estimateCalories(sport string, distM float64, durS int, avgPowerW, weightKg float64) int {
+	if avgPowerW > 0 {
+		return int(math.Round(avgPowerW * float64(durS) / 1000))
+	}
+	if weightKg <= 0 {
+		return 0
+	}
+	switch strings.ToLower(sport) {
+	case "running":
+		return int(math.Round(weightKg * distM / 1000))
+	case "walking", "hiking":
+		return int(math.Round(0.75 * weightKg * distM / 1000))
+	case "cycling":
+		return int(math.Round(7.5 * weightKg * float64(durS) / 3600))
+	}
+	return 0
+}
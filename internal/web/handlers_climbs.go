@@ -0,0 +1,38 @@
+package web
+
+import (
+	"fmt"
+	"log"
+
+	"garmr/internal/analysis"
+)
+
+// climbRow is one climb on an activity's page.
+type climbRow struct {
+	analysis.Climb
+	Category string // "Cat 4" … "HC", "-" if uncategorized
+	VAM      float64
+}
+
+// loadClimbs fills the climbs of the activity view. Pool swims have none.
+func (s *Server) loadClimbs(vm *activityDetailVM) {
+	if vm.Swim != nil || vm.DistM == 0 {
+		return
+	}
+	pts, pauses, err := s.activityPoints(vm.ID)
+	if err != nil {
+		log.Printf("climbs of activity %d: %v", vm.ID, err)
+		return
+	}
+	for _, c := range analysis.Climbs(pts, pauses) {
+		row := climbRow{Climb: c, Category: "-", VAM: c.VAM()}
+		switch c.Category {
+		case "":
+		case "HC":
+			row.Category = "HC"
+		default:
+			row.Category = fmt.Sprintf("Cat %s", c.Category)
+		}
+		vm.Climbs = append(vm.Climbs, row)
+	}
+}
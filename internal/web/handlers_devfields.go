@@ -0,0 +1,93 @@
+package web
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"garmr/internal/store"
+)
+
+// devVM holds the developer fields (Connect IQ apps, Stryd) of an activity
+// that were written per lap or for the whole session; those written per
+// record are charted from the series instead.
+type devVM struct {
+	Session   []devStat
+	LapFields []store.DevField
+	lapValues map[int]map[int64]float64 // lap index → field id → value
+}
+
+type devStat struct {
+	Label string
+	Value string
+}
+
+// LapCells returns a lap's values of LapFields, "-" where it has none.
+func (d *devVM) LapCells(lap int) []string {
+	cells := make([]string, len(d.LapFields))
+	for i, f := range d.LapFields {
+		if v, ok := d.lapValues[lap][f.ID]; ok {
+			cells[i] = fmtDevValue(v, f.Units)
+		} else {
+			cells[i] = "-"
+		}
+	}
+	return cells
+}
+
+// loadDevFields fills vm.Dev if the activity has lap or session values of
+// developer fields.
+func (s *Server) loadDevFields(vm *activityDetailVM) {
+	fields, err := s.store.ListDevFields(vm.ID)
+	if err != nil || len(fields) == 0 {
+		if err != nil {
+			log.Printf("developer fields of activity %d: %v", vm.ID, err)
+		}
+		return
+	}
+	byID := map[int64]store.DevField{}
+	for _, f := range fields {
+		byID[f.ID] = f
+	}
+	d := &devVM{lapValues: map[int]map[int64]float64{}}
+
+	session, err := s.store.ListDevValues(vm.ID, "session", 0, 0)
+	if err != nil {
+		log.Printf("developer fields of activity %d: %v", vm.ID, err)
+		return
+	}
+	for _, v := range session {
+		f := byID[v.FieldID]
+		d.Session = append(d.Session, devStat{Label: f.Label(), Value: fmtDevValue(v.Value, f.Units)})
+	}
+
+	laps, err := s.store.ListDevValues(vm.ID, "lap", 0, math.MaxInt32)
+	if err != nil {
+		log.Printf("developer fields of activity %d: %v", vm.ID, err)
+		return
+	}
+	onLaps := map[int64]bool{}
+	for _, v := range laps {
+		if d.lapValues[v.Pos] == nil {
+			d.lapValues[v.Pos] = map[int64]float64{}
+		}
+		d.lapValues[v.Pos][v.FieldID] = v.Value
+		onLaps[v.FieldID] = true
+	}
+	for _, f := range fields {
+		if onLaps[f.ID] {
+			d.LapFields = append(d.LapFields, f)
+		}
+	}
+
+	if len(d.Session) > 0 || len(d.LapFields) > 0 {
+		vm.Dev = d
+	}
+}
+
+// fmtDevValue formats a developer field value with up to two decimals.
+func fmtDevValue(v float64, units string) string {
+	s := strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+	return strings.TrimSpace(s + " " + units)
+}
@@ -0,0 +1,104 @@
+package web
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"garmr/internal/fitx"
+	"garmr/internal/store"
+)
+
+type devicesVM struct {
+	CurrentUser *userView
+	Error       string
+	Success     string
+	Devices     []store.Device
+	Missing     int // activities without device info, fixable by a scan
+
+	Device   *store.Device // set on a device's own page
+	Readings []store.DeviceReading
+	HasVolts bool
+}
+
+// handleDevices lists the viewed athlete's devices and sensors, or with
+// ?id= one device and its battery history.
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
+	uid := s.athlete(r).ID
+	vm := devicesVM{CurrentUser: user}
+
+	if r.Method == http.MethodPost {
+		if !user.CanEditActivities() {
+			forbidden(w, r)
+			return
+		}
+		if r.FormValue("intent") != "scan" {
+			http.Error(w, "unknown action", http.StatusBadRequest)
+			return
+		}
+		vm.Error, vm.Success = s.scanDevices(uid)
+	}
+
+	if id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64); err == nil && id > 0 {
+		d, err := s.store.GetDevice(uid, id)
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		readings, err := s.store.DeviceReadings(d.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		vm.Device, vm.Readings = d, readings
+		for _, rd := range readings {
+			vm.HasVolts = vm.HasVolts || rd.BatteryV.Valid
+		}
+	} else {
+		devices, err := s.store.ListDevices(uid)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		vm.Devices = devices
+		if missing, err := s.store.ActivitiesWithoutDevices(uid); err == nil {
+			vm.Missing = len(missing)
+		}
+	}
+	if err := s.tplDevices.ExecuteTemplate(w, "layout", vm); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// scanDevices reads the devices of activities imported before devices
+// were recorded from their stored FIT files.
+func (s *Server) scanDevices(userID int64) (errMsg, success string) {
+	acts, err := s.store.ActivitiesWithoutDevices(userID)
+	if err != nil {
+		return err.Error(), ""
+	}
+	var done, failed int
+	for _, a := range acts {
+		parsed, _, _, _, err := fitx.ParseFIT(a.RawPath)
+		if err == nil {
+			err = s.store.SetActivityDevices(userID, a.ID, a.StartTimeUTC, parsed)
+		}
+		if err != nil {
+			log.Printf("devices: scan activity %d (%s): %v", a.ID, a.RawPath, err)
+			failed++
+			continue
+		}
+		done++
+	}
+	if failed > 0 {
+		return fmt.Sprintf("Scanned %d activities; %d could not be read, see the server log.", done, failed), ""
+	}
+	return "", fmt.Sprintf("Scanned %d activities.", done)
+}
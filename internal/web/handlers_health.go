@@ -0,0 +1,138 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"garmr/internal/importlog"
+	"garmr/internal/metrics"
+	"garmr/internal/store"
+)
+
+type readyCheck struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type readyResp struct {
+	Status string                `json:"status"`
+	Checks map[string]readyCheck `json:"checks"`
+}
+
+// GET /healthz  -> process is up
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// GET /readyz  -> DB reachable, schema current, raw_store writable
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	resp := readyResp{Status: "ok", Checks: map[string]readyCheck{}}
+	fail := func(name string, err error) {
+		resp.Status = "fail"
+		resp.Checks[name] = readyCheck{Status: "fail", Detail: err.Error()}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	if err := s.db.PingContext(ctx); err != nil {
+		fail("db", err)
+	} else if _, err := s.db.ExecContext(ctx, `SELECT 1`); err != nil {
+		fail("db", err)
+	} else {
+		resp.Checks["db"] = readyCheck{Status: "ok"}
+	}
+
+	if cur, latest, err := store.MigrationVersion(s.store); err != nil {
+		fail("migrations", err)
+	} else if cur < latest {
+		fail("migrations", fmt.Errorf("schema at version %d, binary expects %d", cur, latest))
+	} else {
+		resp.Checks["migrations"] = readyCheck{Status: "ok", Detail: fmt.Sprintf("version %d", cur)}
+	}
+
+	if err := checkWritable(s.cfg.RawStore); err != nil {
+		fail("raw_store", err)
+	} else {
+		resp.Checks["raw_store"] = readyCheck{Status: "ok"}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if resp.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// checkWritable creates and removes a probe file in dir.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".garmr-ready-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// GET /metrics  -> Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	gauges := []metrics.Gauge{
+		{Name: "garmr_sse_subscribers", Help: "Open import log streams.", Value: float64(importlog.Subscribers())},
+	}
+	if size, err := s.store.SizeBytes(); err == nil {
+		gauges = append(gauges, metrics.Gauge{Name: "garmr_db_size_bytes", Help: "Size of the SQLite database.", Value: float64(size)})
+	}
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM activities`).Scan(&count); err == nil {
+		gauges = append(gauges, metrics.Gauge{Name: "garmr_activities", Help: "Activities stored.", Value: float64(count)})
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = metrics.Write(w, gauges)
+}
+
+// statusRecorder captures the response code for request metrics.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	sr.code = code
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter { return sr.ResponseWriter }
+
+// instrument records request latency labelled by the matched mux pattern.
+// Streaming responses (the SSE log) are left out since their duration is
+// the lifetime of the connection.
+func (s *Server) instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		mux.ServeHTTP(sr, r)
+		if sr.Header().Get("Content-Type") == "text/event-stream" {
+			return
+		}
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.ObserveHTTP(route, r.Method, sr.code, time.Since(start))
+	})
+}
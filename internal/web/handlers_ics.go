@@ -0,0 +1,273 @@
+package web
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"garmr/internal/ics"
+	"garmr/internal/store"
+)
+
+// feedHistory limits how far back the .ics feed reaches.
+const feedHistory = 365 * 24 * time.Hour
+
+var icsDistanceRe = regexp.MustCompile(`(?i)(\d+(?:[.,]\d+)?)\s*km\b`)
+
+// GET /calendar.ics?token=...&activities=1
+// Token-protected (no session cookie) so calendar apps can subscribe.
+func (s *Server) handleCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, err := s.store.UserIDForCalendarFeedToken(r.URL.Query().Get("token"))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("ics: token lookup: %v", err)
+		}
+		http.Error(w, "invalid feed token", http.StatusUnauthorized)
+		return
+	}
+	withActivities := r.URL.Query().Get("activities") == "1"
+
+	since := time.Now().UTC().Add(-feedHistory)
+	var events []ics.Event
+
+	rows, err := s.db.Query(`
+        SELECT id, planned_date, sport, title, distance_m, duration_s, notes
+        FROM planned_workouts
+        WHERE user_id = ? AND planned_date >= ?
+        ORDER BY planned_date ASC, id ASC`, userID, since.Format("2006-01-02"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var dateStr, sport string
+		var title, notes sql.NullString
+		var distM, durS sql.NullInt64
+		if err := rows.Scan(&id, &dateStr, &sport, &title, &distM, &durS, &notes); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		day, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			continue
+		}
+		summary := strings.TrimSpace(title.String)
+		if summary == "" {
+			summary = sport
+		}
+		var parts []string
+		if distM.Valid && distM.Int64 > 0 {
+			parts = append(parts, fmt.Sprintf("%.1f km", float64(distM.Int64)/1000))
+		}
+		if durS.Valid && durS.Int64 > 0 {
+			parts = append(parts, shortDuration(int(durS.Int64)))
+		}
+		if len(parts) > 0 {
+			summary += " · " + strings.Join(parts, " · ")
+		}
+		events = append(events, ics.Event{
+			UID:         fmt.Sprintf("planned-%d@garmr", id),
+			Start:       day,
+			AllDay:      true,
+			Summary:     "Planned: " + summary,
+			Description: strings.TrimSpace(notes.String),
+		})
+	}
+
+	if withActivities {
+		aRows, err := s.db.Query(`
+            SELECT id, start_time_utc, sport, distance_m, duration_s, avg_hr, ascent_m, calories
+            FROM activities
+            WHERE user_id = ? AND start_time_utc >= ?
+            ORDER BY start_time_utc ASC`, userID, since.Format("2006-01-02 15:04:05 -0700 MST"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer aRows.Close()
+		for aRows.Next() {
+			var id int64
+			var startStr, sport string
+			var distM, durS, avgHR, cals sql.NullInt64
+			var asc sql.NullFloat64
+			if err := aRows.Scan(&id, &startStr, &sport, &distM, &durS, &avgHR, &asc, &cals); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			start, err := parseActivityTime(startStr)
+			if err != nil {
+				continue
+			}
+			desc := []string{
+				fmt.Sprintf("Distance: %.2f km", float64(distM.Int64)/1000),
+				"Duration: " + shortDuration(int(durS.Int64)),
+			}
+			if distM.Int64 > 0 && durS.Int64 > 0 {
+				p := float64(durS.Int64) / (float64(distM.Int64) / 1000)
+				desc = append(desc, fmt.Sprintf("Avg pace: %d:%02d /km", int(p)/60, int(p)%60))
+			}
+			if avgHR.Valid && avgHR.Int64 > 0 && avgHR.Int64 != 255 {
+				desc = append(desc, fmt.Sprintf("Avg HR: %d bpm", avgHR.Int64))
+			}
+			if asc.Valid && asc.Float64 > 0 {
+				desc = append(desc, fmt.Sprintf("Ascent: %.0f m", asc.Float64))
+			}
+			if cals.Valid && cals.Int64 > 0 {
+				desc = append(desc, fmt.Sprintf("Calories: %d kcal", cals.Int64))
+			}
+			events = append(events, ics.Event{
+				UID:         fmt.Sprintf("activity-%d@garmr", id),
+				Start:       start,
+				End:         start.Add(time.Duration(durS.Int64) * time.Second),
+				Summary:     fmt.Sprintf("%s %.1f km", sport, float64(distM.Int64)/1000),
+				Description: strings.Join(desc, "\n"),
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ics.Write(&buf, "garmr", events); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="garmr.ics"`)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// POST /calendar/plan/ics  (multipart: ics, name)
+// Imports a coach's calendar export into planned_workouts as one plan block.
+func (s *Server) handleCalendarPlanICS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseMultipartForm(4 << 20); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("ics")
+	if err != nil {
+		http.Error(w, "ics file required", http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, 4<<20))
+	file.Close()
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusBadRequest)
+		return
+	}
+	events, err := ics.Parse(bytes.NewReader(data))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(events) == 0 {
+		http.Error(w, "no events found", http.StatusBadRequest)
+		return
+	}
+
+	workouts := make([]store.PlannedWorkout, 0, len(events))
+	first := events[0].Start
+	for _, ev := range events {
+		pw := plannedFromEvent(ev)
+		if pw.PlannedDate.Before(first) {
+			first = pw.PlannedDate
+		}
+		workouts = append(workouts, pw)
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		name = strings.TrimSuffix(header.Filename, ".ics")
+	}
+	blockID, err := s.store.CreatePlanBlock(s.athlete(r).ID, name, "ics", nil, workouts)
+	if err != nil {
+		log.Printf("calendar: import ics: %v", err)
+		http.Error(w, "failed to save plan", http.StatusInternalServerError)
+		return
+	}
+	s.planUpdated(s.athlete(r).ID, "imported", 0, blockID, first.Format("2006-01-02"))
+	http.Redirect(w, r, "/calendar?view=week&date="+url.QueryEscape(first.Format("2006-01-02")), http.StatusSeeOther)
+}
+
+// plannedFromEvent maps a calendar event onto a planned workout, guessing
+// the sport and distance from the summary.
+func plannedFromEvent(ev ics.Event) store.PlannedWorkout {
+	start := ev.Start
+	if !ev.AllDay {
+		start = start.In(time.Local)
+	}
+	pw := store.PlannedWorkout{
+		PlannedDate: time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC),
+		Sport:       guessSport(ev.Summary + " " + ev.Description),
+		Title:       strings.TrimSpace(ev.Summary),
+		Notes:       strings.TrimSpace(ev.Description),
+	}
+	if m := icsDistanceRe.FindStringSubmatch(ev.Summary); m != nil {
+		if v, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", "."), 64); err == nil && v > 0 {
+			pw.DistanceM = sql.NullInt64{Int64: int64(math.Round(v * 1000)), Valid: true}
+		}
+	}
+	if !ev.AllDay && !ev.End.IsZero() && ev.End.After(ev.Start) {
+		pw.DurationS = sql.NullInt64{Int64: int64(ev.End.Sub(ev.Start).Seconds()), Valid: true}
+	}
+	return pw
+}
+
+func guessSport(text string) string {
+	t := strings.ToLower(text)
+	switch {
+	case strings.Contains(t, "swim"):
+		return "swimming"
+	case strings.Contains(t, "ride"), strings.Contains(t, "bike"), strings.Contains(t, "cycl"):
+		return "cycling"
+	case strings.Contains(t, "hike"), strings.Contains(t, "hiking"):
+		return "hiking"
+	case strings.Contains(t, "walk"):
+		return "walking"
+	case strings.Contains(t, "run"), strings.Contains(t, "jog"), strings.Contains(t, "tempo"), strings.Contains(t, "interval"):
+		return "running"
+	case strings.Contains(t, "strength"), strings.Contains(t, "gym"):
+		return "training"
+	default:
+		return "generic"
+	}
+}
+
+// shortDuration renders seconds as "45 min" or "1h 05min".
+func shortDuration(sec int) string {
+	if sec < 3600 {
+		return fmt.Sprintf("%d min", sec/60)
+	}
+	return fmt.Sprintf("%dh %02dmin", sec/3600, (sec%3600)/60)
+}
+
+// feedURL builds the absolute subscription URL for a feed token.
+func (s *Server) feedURL(r *http.Request, token string) string {
+	return s.baseURL(r) + "/calendar.ics?token=" + url.QueryEscape(token)
+}
+
+// baseURL is the scheme and host the request was made to.
+func (s *Server) baseURL(r *http.Request) string {
+	scheme := "http"
+	if s.secure(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
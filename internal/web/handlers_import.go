@@ -1,21 +1,27 @@
 package web
 
 import (
-	"crypto/sha256"
+	"bytes"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"garmr/internal/fitx"
+	"garmr/internal/importer"
 	"garmr/internal/importlog"
+	"garmr/internal/metrics"
+	"garmr/internal/mount"
 	"garmr/internal/store"
+	"garmr/internal/webhook"
 )
 
 // simple lock so only one manual import runs at a time
@@ -24,6 +30,7 @@ var importBusy = make(chan struct{}, 1)
 type importResp struct {
 	FoundFiles int      `json:"found_files"`
 	Imported   int      `json:"imported"`
+	Wellness   int      `json:"wellness"`
 	Duplicates int      `json:"duplicates"`
 	Errors     []string `json:"errors,omitempty"`
 	Message    string   `json:"message"`
@@ -31,6 +38,15 @@ type importResp struct {
 
 type importPageVM struct {
 	CurrentUser *userView
+	Error       string
+	Success     string
+	Watches     []connectedWatch
+}
+
+// connectedWatch is a watch mounted right now, with its import settings.
+type connectedWatch struct {
+	mount.Watch
+	Device *store.Device
 }
 
 type uploadResponse struct {
@@ -38,6 +54,7 @@ type uploadResponse struct {
 	Message    string `json:"message,omitempty"`
 	Error      string `json:"error,omitempty"`
 	Imported   int    `json:"imported"`
+	Wellness   int    `json:"wellness"`
 	Duplicates int    `json:"duplicates"`
 	Failed     int    `json:"failed"`
 }
@@ -62,15 +79,17 @@ func (s *Server) handleImportNow(w http.ResponseWriter, r *http.Request) {
 	}
 
 	importlog.Printf("import: triggered via web")
-	sum, _ := s.im.ScanOnce()
+	sum, _ := s.im.ScanOnce(s.currentUser(r).ID)
 
 	// Create meaningful message based on results
 	var message string
-	if sum.FoundFiles == 0 {
+	if sum.FoundFiles == 0 && len(sum.Devices) > 0 {
+		message = "No new files in the folders set up for import."
+	} else if sum.FoundFiles == 0 {
 		message = "No devices or activity files found. Check if Garmin device is connected."
-	} else if sum.Imported == 0 && sum.Duplicates > 0 {
+	} else if sum.Imported == 0 && sum.Wellness == 0 && sum.Duplicates > 0 {
 		message = fmt.Sprintf("Found %d files, but all were duplicates (already imported).", sum.FoundFiles)
-	} else if sum.Imported == 0 && len(sum.Errors) > 0 {
+	} else if sum.Imported == 0 && sum.Wellness == 0 && len(sum.Errors) > 0 {
 		message = fmt.Sprintf("Found %d files, but failed to import any. Check logs for details.", sum.FoundFiles)
 	} else if sum.Imported > 0 {
 		if sum.Duplicates > 0 {
@@ -78,14 +97,23 @@ func (s *Server) handleImportNow(w http.ResponseWriter, r *http.Request) {
 		} else {
 			message = fmt.Sprintf("Import completed: %d new activities imported from %d files.", sum.Imported, sum.FoundFiles)
 		}
+	} else if sum.Wellness > 0 {
+		message = fmt.Sprintf("Import completed from %d files.", sum.FoundFiles)
 	} else {
 		message = fmt.Sprintf("Scan completed: found %d files, but no new activities to import.", sum.FoundFiles)
 	}
+	if sum.Wellness > 0 {
+		message += fmt.Sprintf(" %d wellness files (steps, sleep, HRV, ...) imported.", sum.Wellness)
+	}
+	if len(sum.Devices) > 0 {
+		message = strings.Join(sum.Devices, ", ") + " connected. " + message
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(importResp{
 		FoundFiles: sum.FoundFiles,
 		Imported:   sum.Imported,
+		Wellness:   sum.Wellness,
 		Duplicates: sum.Duplicates,
 		Errors:     sum.Errors,
 		Message:    message,
@@ -133,8 +161,39 @@ func (s *Server) handleLogsSSE(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleImportPage(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
 	vm := importPageVM{
-		CurrentUser: s.currentUser(r),
+		CurrentUser: user,
+	}
+	if r.Method == http.MethodPost {
+		if r.FormValue("intent") != "device-import" {
+			http.Error(w, "unknown action", http.StatusBadRequest)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id, _ := strconv.ParseInt(r.PostForm.Get("id"), 10, 64)
+		switch err := s.store.SetDeviceImport(user.ID, id, r.PostForm["folder"], r.FormValue("remove") == "1"); {
+		case err == sql.ErrNoRows:
+			http.NotFound(w, r)
+			return
+		case err != nil:
+			vm.Error = err.Error()
+		default:
+			vm.Success = "Import settings saved."
+		}
+	}
+
+	// imports go to the signed-in user, so connected watches are theirs
+	for _, wt := range mount.FindWatches(s.cfg.SearchRoots) {
+		dev, err := s.store.RegisterWatch(user.ID, wt)
+		if err != nil {
+			log.Printf("import page: %v", err)
+			continue
+		}
+		vm.Watches = append(vm.Watches, connectedWatch{Watch: wt, Device: dev})
 	}
 	if err := s.tplImport.ExecuteTemplate(w, "layout", vm); err != nil {
 		http.Error(w, err.Error(), 500)
@@ -163,11 +222,13 @@ func (s *Server) handleFileUpload(w http.ResponseWriter, r *http.Request) {
 
 	importlog.Printf("upload: processing %d files", len(files))
 
-	var imported, duplicates, failed int
+	var imported, wellness, duplicates, failed int
 
 	for _, fileHeader := range files {
+		started := time.Now()
 		if !strings.HasSuffix(strings.ToLower(fileHeader.Filename), ".fit") {
 			importlog.Printf("upload: skipping non-FIT file: %s", fileHeader.Filename)
+			metrics.ObserveImport("upload", metrics.OutcomeFailed, time.Since(started))
 			failed++
 			continue
 		}
@@ -175,6 +236,7 @@ func (s *Server) handleFileUpload(w http.ResponseWriter, r *http.Request) {
 		file, err := fileHeader.Open()
 		if err != nil {
 			importlog.Printf("upload: failed to open file %s: %v", fileHeader.Filename, err)
+			metrics.ObserveImport("upload", metrics.OutcomeFailed, time.Since(started))
 			failed++
 			continue
 		}
@@ -184,132 +246,98 @@ func (s *Server) handleFileUpload(w http.ResponseWriter, r *http.Request) {
 		file.Close()
 		if err != nil {
 			importlog.Printf("upload: failed to read file %s: %v", fileHeader.Filename, err)
+			metrics.ObserveImport("upload", metrics.OutcomeFailed, time.Since(started))
 			failed++
 			continue
 		}
 
-		// Calculate file hash for duplicate detection
-		hash := fmt.Sprintf("%x", sha256.Sum256(data))
-
-		// Check for duplicate by hash
-		isDuplicate, err := s.isFileHashDuplicate(hash)
-		if err != nil {
-			importlog.Printf("upload: failed to check duplicate for %s: %v", fileHeader.Filename, err)
-			failed++
-			continue
-		}
-
-		if isDuplicate {
-			importlog.Printf("upload: duplicate file detected: %s (hash: %s)", fileHeader.Filename, hash[:12])
-			duplicates++
+		// Monitoring, sleep, HRV and metrics files go to the wellness data
+		if t, err := fitx.FileType(bytes.NewReader(data)); err == nil && fitx.IsWellness(t) {
+			switch err := s.processWellnessFile(s.currentUser(r).ID, data, fileHeader.Filename); {
+			case errors.Is(err, importer.ErrDuplicate):
+				importlog.Printf("upload: duplicate wellness file: %s", fileHeader.Filename)
+				metrics.ObserveImport("upload", metrics.OutcomeDuplicate, time.Since(started))
+				duplicates++
+			case err != nil:
+				importlog.Printf("upload: failed to process wellness file %s: %v", fileHeader.Filename, err)
+				metrics.ObserveImport("upload", metrics.OutcomeFailed, time.Since(started))
+				failed++
+			default:
+				importlog.Printf("upload: imported wellness file: %s", fileHeader.Filename)
+				metrics.ObserveImport("upload", metrics.OutcomeImported, time.Since(started))
+				wellness++
+			}
 			continue
 		}
 
 		// Process FIT file
-		if err := s.processFITFile(data, fileHeader.Filename, hash); err != nil {
-			// Check if it's a duplicate detected during processing
-			if strings.Contains(strings.ToLower(err.Error()), "duplicate") ||
-				strings.Contains(strings.ToLower(err.Error()), "already exists") {
-				importlog.Printf("upload: duplicate detected during processing: %s", fileHeader.Filename)
+		actID, err := s.processFITFile(s.currentUser(r).ID, data, fileHeader.Filename)
+		if err != nil {
+			if errors.Is(err, importer.ErrDuplicate) {
+				importlog.Printf("upload: duplicate file detected: %s", fileHeader.Filename)
+				metrics.ObserveImport("upload", metrics.OutcomeDuplicate, time.Since(started))
 				duplicates++
 				continue
 			}
 			importlog.Printf("upload: failed to process FIT file %s: %v", fileHeader.Filename, err)
+			s.hooks.Emit(webhook.EventImportFailed, webhook.ImportFailedData{File: fileHeader.Filename, Source: "upload", Error: err.Error()})
+			metrics.ObserveImport("upload", metrics.OutcomeFailed, time.Since(started))
 			failed++
 			continue
 		}
 
 		importlog.Printf("upload: successfully imported: %s", fileHeader.Filename)
+		if a, err := s.store.GetActivity(s.currentUser(r).ID, actID); err == nil {
+			s.hooks.Emit(webhook.EventActivityCreated, webhook.NewActivityData(a, "upload", fileHeader.Filename))
+		}
+		metrics.ObserveImport("upload", metrics.OutcomeImported, time.Since(started))
 		imported++
 	}
 
 	response := uploadResponse{
 		Success:    true,
 		Imported:   imported,
+		Wellness:   wellness,
 		Duplicates: duplicates,
 		Failed:     failed,
-		Message:    fmt.Sprintf("Processed %d files: %d imported, %d duplicates, %d failed", len(files), imported, duplicates, failed),
+		Message:    fmt.Sprintf("Processed %d files: %d imported, %d wellness, %d duplicates, %d failed", len(files), imported, wellness, duplicates, failed),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-func (s *Server) isFileHashDuplicate(hash string) (bool, error) {
-	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM activities WHERE file_hash = ?", hash).Scan(&count)
-	return count > 0, err
-}
-
-func (s *Server) processFITFile(data []byte, filename, hash string) error {
-	// Save raw file to storage first
+func (s *Server) processWellnessFile(userID int64, data []byte, filename string) error {
 	rawPath := filepath.Join(s.cfg.RawStore, fmt.Sprintf("upload_%s_%s.fit",
 		time.Now().Format("20060102_150405"), filename))
-
 	if err := os.MkdirAll(filepath.Dir(rawPath), 0755); err != nil {
 		return fmt.Errorf("create raw store dir: %w", err)
 	}
-
 	if err := os.WriteFile(rawPath, data, 0644); err != nil {
 		return fmt.Errorf("save raw file: %w", err)
 	}
+	if err := importer.AddWellness(s.store, rawPath, userID); err != nil {
+		os.Remove(rawPath)
+		return err
+	}
+	return nil
+}
 
-	// Parse FIT file from saved path
-	activity, records, laps, zones, err := fitx.ParseFIT(rawPath)
+func (s *Server) processFITFile(userID int64, data []byte, filename string) (int64, error) {
+	rawPath := filepath.Join(s.cfg.RawStore, fmt.Sprintf("upload_%s_%s.fit",
+		time.Now().Format("20060102_150405"), filename))
+	if err := os.MkdirAll(filepath.Dir(rawPath), 0755); err != nil {
+		return 0, fmt.Errorf("create raw store dir: %w", err)
+	}
+	if err := os.WriteFile(rawPath, data, 0644); err != nil {
+		return 0, fmt.Errorf("save raw file: %w", err)
+	}
+	id, err := importer.AddActivity(s.store, rawPath, userID)
 	if err != nil {
-		// Clean up file if parsing fails
 		os.Remove(rawPath)
-		return fmt.Errorf("parse FIT: %w", err)
+		return 0, err
 	}
-
-	// Database operations with transaction
-	db := &store.DB{DB: s.db}
-	return db.WithTx(func(tx *sql.Tx) error {
-		// Check if activity already exists by FIT UID
-		existingID, err := db.LookupActivityByUID(tx, activity.FitUID)
-		if err == nil && existingID > 0 {
-			// Clean up file if it's a duplicate
-			os.Remove(rawPath)
-			return fmt.Errorf("activity already exists with FIT UID: %s", activity.FitUID)
-		}
-
-		// Insert activity
-		actID, err := db.InsertActivity(tx, activity, rawPath, hash)
-		if err != nil {
-			return fmt.Errorf("insert activity: %w", err)
-		}
-
-		// Insert records
-		if err := db.InsertRecords(tx, actID, records); err != nil {
-			return fmt.Errorf("insert records: %w", err)
-		}
-
-		// Insert laps
-		if err := db.InsertLaps(tx, actID, laps); err != nil {
-			return fmt.Errorf("insert laps: %w", err)
-		}
-
-		// Insert HR zones if available
-		if len(zones) > 0 {
-			var storeZones []store.HRZone
-			for _, z := range zones {
-				storeZones = append(storeZones, store.HRZone{
-					Zone:        z.Zone,
-					TimeSeconds: z.TimeSeconds,
-				})
-			}
-			if err := db.InsertHRZones(tx, actID, storeZones); err != nil {
-				return fmt.Errorf("insert hr zones: %w", err)
-			}
-		}
-
-		// Update daily aggregations
-		if err := db.UpsertDailyAgg(tx, activity.StartTimeUTC, activity); err != nil {
-			return fmt.Errorf("upsert daily agg: %w", err)
-		}
-
-		return nil
-	})
+	return id, nil
 }
 
 func writeUploadError(w http.ResponseWriter, message string) {
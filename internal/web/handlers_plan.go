@@ -0,0 +1,150 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"garmr/internal/plan"
+)
+
+// maxPlanBlockShiftDays bounds how far a whole block can be moved at once.
+const maxPlanBlockShiftDays = 365
+
+// POST /calendar/plan/template  (multipart: template, race_date, name)
+// Imports a multi-week JSON/CSV template anchored to a race date.
+func (s *Server) handleCalendarPlanTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	raceDate, err := time.Parse("2006-01-02", strings.TrimSpace(r.FormValue("race_date")))
+	if err != nil {
+		http.Error(w, "invalid race date", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("template")
+	if err != nil {
+		http.Error(w, "template file required", http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, 1<<20))
+	file.Close()
+	if err != nil {
+		http.Error(w, "failed to read template", http.StatusBadRequest)
+		return
+	}
+
+	tpl, err := plan.ParseTemplate(header.Filename, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		name = strings.TrimSpace(tpl.Name)
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	}
+
+	workouts := tpl.Schedule(raceDate)
+	blockID, err := s.store.CreatePlanBlock(s.athlete(r).ID, name, "template", &raceDate, workouts)
+	if err != nil {
+		log.Printf("calendar: import plan template: %v", err)
+		http.Error(w, "failed to save plan", http.StatusInternalServerError)
+		return
+	}
+	s.planUpdated(s.athlete(r).ID, "imported", 0, blockID, raceDate.Format("2006-01-02"))
+
+	// jump to the first week of the imported plan
+	first := raceDate
+	for _, pw := range workouts {
+		if pw.PlannedDate.Before(first) {
+			first = pw.PlannedDate
+		}
+	}
+	http.Redirect(w, r, "/calendar?view=week&date="+url.QueryEscape(first.Format("2006-01-02")), http.StatusSeeOther)
+}
+
+// POST /calendar/block/shift  (id, days, date)
+func (s *Server) handleCalendarBlockShift(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(r.FormValue("id")), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	days, err := strconv.Atoi(strings.TrimSpace(r.FormValue("days")))
+	if err != nil || days < -maxPlanBlockShiftDays || days > maxPlanBlockShiftDays {
+		http.Error(w, "invalid shift", http.StatusBadRequest)
+		return
+	}
+	if err := s.store.ShiftPlanBlock(s.athlete(r).ID, id, days); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("calendar: shift plan block %d: %v", id, err)
+		http.Error(w, "failed to shift plan", http.StatusInternalServerError)
+		return
+	}
+	s.planUpdated(s.athlete(r).ID, "shifted", 0, id, "")
+	http.Redirect(w, r, calendarRedirect(r.FormValue("date"), days), http.StatusSeeOther)
+}
+
+// POST /calendar/block/delete  (id, date)
+func (s *Server) handleCalendarBlockDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(r.FormValue("id")), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if err := s.store.DeletePlanBlock(s.athlete(r).ID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("calendar: delete plan block %d: %v", id, err)
+		http.Error(w, "failed to delete plan", http.StatusInternalServerError)
+		return
+	}
+	s.planUpdated(s.athlete(r).ID, "deleted", 0, id, "")
+	http.Redirect(w, r, calendarRedirect(r.FormValue("date"), 0), http.StatusSeeOther)
+}
+
+// calendarRedirect returns the week view for dateStr moved by delta days,
+// or the default calendar when dateStr is empty or invalid.
+func calendarRedirect(dateStr string, delta int) string {
+	d, err := time.Parse("2006-01-02", strings.TrimSpace(dateStr))
+	if err != nil {
+		return "/calendar"
+	}
+	return "/calendar?view=week&date=" + url.QueryEscape(d.AddDate(0, 0, delta).Format("2006-01-02"))
+}
@@ -0,0 +1,216 @@
+package web
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"garmr/internal/store"
+)
+
+// privacyPolicy is what is cut from a track before it is shown. The zero
+// value shows everything.
+type privacyPolicy struct {
+	zones []store.PrivacyZone
+	trimM float64
+}
+
+// privacyPolicy loads the privacy settings of userID. For the in-app map
+// (shared false) they only apply if the user turned that on; share links
+// and exports (shared true) always apply them.
+func (s *Server) privacyPolicy(userID int64, shared bool) (privacyPolicy, error) {
+	ps, err := s.store.GetPrivacySettings(userID)
+	if err != nil || (!shared && !ps.OwnMap) {
+		return privacyPolicy{}, err
+	}
+	zones, err := s.store.ListPrivacyZones(userID)
+	if err != nil {
+		return privacyPolicy{}, err
+	}
+	return privacyPolicy{zones: zones, trimM: float64(ps.TrimM)}, nil
+}
+
+// apply drops the points within trimM metres along the track from its
+// start or end and those inside a privacy zone. The first point after a
+// dropped stretch is marked as a gap so the stretch isn't drawn across.
+func (p privacyPolicy) apply(pts []trackPt) []trackPt {
+	if len(p.zones) == 0 && p.trimM <= 0 {
+		return pts
+	}
+	n := len(pts)
+	seg := func(i int) float64 {
+		return haversineM(pts[i].Lat, pts[i].Lon, pts[i+1].Lat, pts[i+1].Lon)
+	}
+	hide := make([]bool, n)
+	if p.trimM > 0 {
+		for i, d := 0, 0.0; i < n && d < p.trimM; i++ {
+			hide[i] = true
+			if i+1 < n {
+				d += seg(i)
+			}
+		}
+		for i, d := n-1, 0.0; i >= 0 && d < p.trimM; i-- {
+			hide[i] = true
+			if i > 0 {
+				d += seg(i - 1)
+			}
+		}
+	}
+	for i, pt := range pts {
+		for _, z := range p.zones {
+			if haversineM(pt.Lat, pt.Lon, z.Lat, z.Lon) <= float64(z.RadiusM) {
+				hide[i] = true
+				break
+			}
+		}
+	}
+
+	out := make([]trackPt, 0, n)
+	gap := false
+	for i, pt := range pts {
+		if hide[i] {
+			gap = len(out) > 0
+			continue
+		}
+		pt.Gap = pt.Gap || gap
+		gap = false
+		out = append(out, pt)
+	}
+	return out
+}
+
+type accountPrivacyVM struct {
+	CurrentUser *userView
+	Error       string
+	Success     string
+	Settings    store.PrivacySettings
+	Zones       []store.PrivacyZone
+	MinRadiusM  int
+	MaxRadiusM  int
+	MaxTrimM    int
+}
+
+// GET, POST /account/privacy  (intent: settings | add_zone | delete_zone)
+func (s *Server) handleAccountPrivacy(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
+	data := accountPrivacyVM{
+		CurrentUser: user,
+		MinRadiusM:  store.MinPrivacyRadiusM,
+		MaxRadiusM:  store.MaxPrivacyRadiusM,
+		MaxTrimM:    store.MaxPrivacyTrimM,
+	}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		switch r.FormValue("intent") {
+		case "settings":
+			trim, err := strconv.Atoi(strings.TrimSpace(r.FormValue("trim_m")))
+			if err != nil {
+				data.Error = "Trim must be a whole number of metres"
+				break
+			}
+			ps := store.PrivacySettings{TrimM: trim, OwnMap: r.FormValue("own_map") != ""}
+			if err := s.store.SetPrivacySettings(user.ID, ps); err != nil {
+				data.Error = err.Error()
+				break
+			}
+			data.Success = "Privacy settings saved"
+		case "add_zone":
+			lat, errLat := strconv.ParseFloat(strings.TrimSpace(r.FormValue("lat")), 64)
+			lon, errLon := strconv.ParseFloat(strings.TrimSpace(r.FormValue("lon")), 64)
+			radius, errRadius := strconv.Atoi(strings.TrimSpace(r.FormValue("radius_m")))
+			if errLat != nil || errLon != nil || errRadius != nil {
+				data.Error = "Enter the zone center as latitude and longitude and a radius in metres"
+				break
+			}
+			z := store.PrivacyZone{UserID: user.ID, Name: r.FormValue("name"), Lat: lat, Lon: lon, RadiusM: radius}
+			if _, err := s.store.AddPrivacyZone(z); err != nil {
+				data.Error = err.Error()
+				break
+			}
+			log.Printf("privacy: %s added a privacy zone", user.Username)
+			data.Success = "Privacy zone added"
+		case "delete_zone":
+			id, _ := strconv.ParseInt(r.FormValue("zone_id"), 10, 64)
+			if err := s.store.DeletePrivacyZone(user.ID, id); err != nil {
+				data.Error = "Privacy zone not found"
+				break
+			}
+			data.Success = "Privacy zone removed"
+		default:
+			data.Error = "Unknown action"
+		}
+	}
+
+	settings, err := s.store.GetPrivacySettings(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	zones, err := s.store.ListPrivacyZones(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Settings, data.Zones = settings, zones
+	if err := s.tplAccountPrivacy.ExecuteTemplate(w, "layout", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// GET /activity/gpx?id=
+// Exports the track as GPX with the owner's privacy zones and trim applied.
+func (s *Server) handleActivityGPX(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(r.URL.Query().Get("id")), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid activity id", http.StatusBadRequest)
+		return
+	}
+	owner := s.athlete(r).ID
+	a, err := s.store.GetActivity(owner, id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	pol, err := s.privacyPolicy(owner, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	points, err := s.loadTrack(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	points = pol.apply(points)
+
+	name := a.Sport + " " + a.StartTimeUTC.Format("2006-01-02")
+	w.Header().Set("Content-Type", "application/gpx+xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="activity-%d.gpx"`, id))
+	fmt.Fprint(w, xml.Header)
+	fmt.Fprint(w, `<gpx version="1.1" creator="garmr" xmlns="http://www.topografix.com/GPX/1/1">`+"\n<trk>\n<name>")
+	_ = xml.EscapeText(w, []byte(name))
+	fmt.Fprint(w, "</name>\n<trkseg>\n")
+	for i, p := range points {
+		if p.Gap && i > 0 {
+			fmt.Fprint(w, "</trkseg>\n<trkseg>\n")
+		}
+		fmt.Fprintf(w, `<trkpt lat="%.7f" lon="%.7f">`, p.Lat, p.Lon)
+		if p.Elev != nil {
+			fmt.Fprintf(w, "<ele>%.1f</ele>", *p.Elev)
+		}
+		fmt.Fprintf(w, "<time>%s</time></trkpt>\n", a.StartTimeUTC.Add(time.Duration(p.T)*time.Second).UTC().Format(time.RFC3339))
+	}
+	fmt.Fprint(w, "</trkseg>\n</trk>\n</gpx>\n")
+}
@@ -0,0 +1,76 @@
+package web
+
+import (
+	"slices"
+	"testing"
+
+	"garmr/internal/store"
+)
+
+func TestPrivacyPolicyApply(t *testing.T) {
+	// 11 points north along the meridian, about 111 m apart
+	track := make([]trackPt, 11)
+	for i := range track {
+		track[i] = trackPt{Lat: float64(i) * 0.001, T: i}
+	}
+	step := haversineM(0, 0, 0.001, 0)
+
+	tests := []struct {
+		name    string
+		pol     privacyPolicy
+		keep    []int // T of the points left
+		gapsAtT []int // T of the points marked as gaps
+	}{
+		{name: "zero policy", keep: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{name: "trim just under one step", pol: privacyPolicy{trimM: step - 0.01}, keep: []int{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{name: "trim just over one step", pol: privacyPolicy{trimM: step + 0.01}, keep: []int{2, 3, 4, 5, 6, 7, 8}},
+		{name: "trim longer than the track", pol: privacyPolicy{trimM: 20 * step}, keep: nil},
+		{
+			name:    "zone in the middle",
+			pol:     privacyPolicy{zones: []store.PrivacyZone{{Lat: 0.005, RadiusM: int(step) + 1}}},
+			keep:    []int{0, 1, 2, 3, 7, 8, 9, 10},
+			gapsAtT: []int{7},
+		},
+		{
+			name:    "zone at the start is not a gap",
+			pol:     privacyPolicy{zones: []store.PrivacyZone{{Lat: 0, RadiusM: int(step) + 1}}},
+			keep:    []int{2, 3, 4, 5, 6, 7, 8, 9, 10},
+			gapsAtT: nil,
+		},
+		{
+			name: "trim and zones together",
+			pol: privacyPolicy{trimM: step + 0.01, zones: []store.PrivacyZone{
+				{Lat: 0.004, RadiusM: 50},
+				{Lat: 0.007, RadiusM: 50},
+			}},
+			keep:    []int{2, 3, 5, 6, 8},
+			gapsAtT: []int{5, 8},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := tt.pol.apply(slices.Clone(track))
+			var keep, gaps []int
+			for _, pt := range out {
+				keep = append(keep, pt.T)
+				if pt.Gap {
+					gaps = append(gaps, pt.T)
+				}
+			}
+			if !slices.Equal(keep, tt.keep) {
+				t.Errorf("kept %v, want %v", keep, tt.keep)
+			}
+			if !slices.Equal(gaps, tt.gapsAtT) {
+				t.Errorf("gaps at %v, want %v", gaps, tt.gapsAtT)
+			}
+		})
+	}
+}
+
+func TestPrivacyPolicyApplyKeepsGaps(t *testing.T) {
+	track := []trackPt{{Lat: 0, T: 0}, {Lat: 0.001, T: 1, Gap: true}, {Lat: 0.002, T: 2}}
+	out := privacyPolicy{zones: []store.PrivacyZone{{Lat: 1, RadiusM: 100}}}.apply(track)
+	if len(out) != 3 || !out[1].Gap || out[2].Gap {
+		t.Fatalf("apply changed an unaffected track: %+v", out)
+	}
+}
@@ -7,8 +7,28 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+
+	"garmr/internal/analysis"
+	"garmr/internal/fitx"
 )
 
+// seriesGapS is how long records may be missing before the series shows a
+// gap even without a timer pause.
+const seriesGapS = 60
+
+// optionalSeries are sent only for activities that recorded them.
+var optionalSeries = []struct{ Key, Expr string }{
+	{"cad", "AVG(CASE WHEN cad != 255 THEN cad + COALESCE(cad_fraction, 0) END)"},
+	{"power", "AVG(CASE WHEN power_w != 65535 THEN power_w END)"},
+	{"vert_osc", "AVG(vert_osc_mm)"},
+	{"gct", "AVG(gct_ms)"},
+	{"gct_balance", "AVG(gct_balance)"},
+	{"stride", "AVG(stride_m)"},
+	{"vert_ratio", "AVG(vert_ratio)"},
+	{"resp", "AVG(resp_rate)"},
+	{"power_balance", "AVG(power_balance)"},
+}
+
 // GET /api/series/{id}?width=900
 // Returns time-bucketed series so the frontend draws fast without libs.
 func (s *Server) handleActivitySeries(w http.ResponseWriter, r *http.Request) {
@@ -18,7 +38,13 @@ func (s *Server) handleActivitySeries(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad id", http.StatusBadRequest)
 		return
 	}
+	if !s.requireActivity(w, r, id) {
+		return
+	}
+	s.writeSeries(w, r, id)
+}
 
+func (s *Server) writeSeries(w http.ResponseWriter, r *http.Request, id int64) {
 	// width → target number of points
 	width := 900
 	if q := r.URL.Query().Get("width"); q != "" {
@@ -29,7 +55,8 @@ func (s *Server) handleActivitySeries(w http.ResponseWriter, r *http.Request) {
 
 	// duration_s from activities (fallback to last record if needed)
 	var durS sql.NullInt64
-	if err := s.db.QueryRow(`SELECT duration_s FROM activities WHERE id=?`, id).Scan(&durS); err != nil {
+	var sport string
+	if err := s.db.QueryRow(`SELECT duration_s, COALESCE(sport, '') FROM activities WHERE id=?`, id).Scan(&durS, &sport); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -47,13 +74,23 @@ func (s *Server) handleActivitySeries(w http.ResponseWriter, r *http.Request) {
 		bucket = b
 	}
 
+	pauses, err := s.store.ActivityPauses(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// Bucketed query (SQLite integer math):
 	// t_bin = floor(t_offset_s / bucket) * bucket
+	var extraCols string
+	for _, o := range optionalSeries {
+		extraCols += ", " + o.Expr
+	}
 	rows, err := s.db.Query(`
 		SELECT (t_offset_s / ?) * ? AS t_bin,
 		       AVG(CASE WHEN hr != 255 THEN hr END) AS hr,
 		       AVG(speed_mps) AS spd,
-		       AVG(elev_m)    AS elev
+		       AVG(elev_m)    AS elev`+extraCols+`
 		FROM records
 		WHERE activity_id=?
 		GROUP BY t_bin
@@ -70,6 +107,12 @@ func (s *Server) handleActivitySeries(w http.ResponseWriter, r *http.Request) {
 		HR   []any      `json:"hr"`   // []int or nulls
 		Spd  []any      `json:"spd"`  // []float or nulls (m/s)
 		Elev []any      `json:"elev"` // []float or nulls (m)
+		// elevation smoothed like for splits and climbs
+		ElevSmooth []any `json:"elev_smooth,omitempty"`
+		// optional series by key, e.g. "cad", "gct"; only those with data
+		Extra map[string][]any `json:"extra,omitempty"`
+		// developer fields among Extra, keyed "dev<id>"
+		Dev []seriesDevField `json:"dev,omitempty"`
 	}
 	out := series{
 		T:    make([]int, 0, width*2),
@@ -78,13 +121,45 @@ func (s *Server) handleActivitySeries(w http.ResponseWriter, r *http.Request) {
 		Elev: make([]any, 0, width*2),
 	}
 
+	extra := make([][]any, len(optionalSeries))
+	extraVals := make([]sql.NullFloat64, len(optionalSeries))
+	present := make([]bool, len(optionalSeries))
+	// appendGap adds a point with every series null, so the charts don't
+	// draw across pauses
+	appendGap := func(t int) {
+		out.T = append(out.T, t)
+		out.HR = append(out.HR, nil)
+		out.Spd = append(out.Spd, nil)
+		out.Elev = append(out.Elev, nil)
+		for i := range extra {
+			extra[i] = append(extra[i], nil)
+		}
+	}
 	for rows.Next() {
 		var tbin int
 		var hr, spd, elev sql.NullFloat64
-		if err := rows.Scan(&tbin, &hr, &spd, &elev); err != nil {
+		dest := []any{&tbin, &hr, &spd, &elev}
+		for i := range extraVals {
+			dest = append(dest, &extraVals[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if n := len(out.T); n > 0 {
+			prev := out.T[n-1]
+			if tbin-prev > bucket && (fitx.PausedBetween(pauses, prev, tbin) || tbin-prev > seriesGapS) {
+				appendGap(prev + bucket)
+			}
+		}
+		for i, v := range extraVals {
+			if v.Valid {
+				present[i] = true
+				extra[i] = append(extra[i], math.Round(v.Float64*100)/100)
+			} else {
+				extra[i] = append(extra[i], nil)
+			}
+		}
 		out.T = append(out.T, tbin)
 		if hr.Valid {
 			out.HR = append(out.HR, int(math.Round(hr.Float64)))
@@ -103,6 +178,153 @@ func (s *Server) handleActivitySeries(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	for i, o := range optionalSeries {
+		if present[i] {
+			if out.Extra == nil {
+				out.Extra = map[string][]any{}
+			}
+			out.Extra[o.Key] = extra[i]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rows.Close()
+
+	devSeries, devFields, err := s.devSeries(id, bucket, out.T)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for k, v := range devSeries {
+		if out.Extra == nil {
+			out.Extra = map[string][]any{}
+		}
+		out.Extra[k] = v
+	}
+	out.Dev = devFields
+
+	elevSmooth, grade, err := s.profileSeries(id, bucket, out.T)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out.ElevSmooth = elevSmooth
+	if grade != nil {
+		if out.Extra == nil {
+			out.Extra = map[string][]any{}
+		}
+		out.Extra["grade"] = grade
+		if footSport(sport) {
+			gap := make([]any, len(grade))
+			for i, g := range grade {
+				if spd, ok := out.Spd[i].(float64); ok && g != nil {
+					gap[i] = math.Round(spd*analysis.FlatFactor(g.(float64)/100)*100) / 100
+				}
+			}
+			out.Extra["gap"] = gap
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(out)
 }
+
+// profileSeries returns the activity's smoothed elevation and its grade in
+// percent, bucketed like the other series and aligned to times. Either is
+// nil when the records don't have what it takes.
+func (s *Server) profileSeries(id int64, bucket int, times []int) (elev, grade []any, err error) {
+	pts, _, err := s.activityPoints(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	prof := analysis.NewProfile(pts)
+	if prof.Elev == nil {
+		return nil, nil, nil
+	}
+	type acc struct{ elev, grade, n float64 }
+	byT := map[int]*acc{}
+	for i, p := range pts {
+		t := p.T / bucket * bucket
+		a := byT[t]
+		if a == nil {
+			a = &acc{}
+			byT[t] = a
+		}
+		a.elev += prof.Elev[i]
+		if prof.Grade != nil {
+			a.grade += prof.Grade[i]
+		}
+		a.n++
+	}
+	elev = make([]any, len(times))
+	if prof.Grade != nil {
+		grade = make([]any, len(times))
+	}
+	for i, t := range times {
+		a, ok := byT[t]
+		if !ok {
+			continue // a gap
+		}
+		elev[i] = math.Round(a.elev/a.n*10) / 10
+		if grade != nil {
+			grade[i] = math.Round(a.grade/a.n*1000) / 10
+		}
+	}
+	return elev, grade, nil
+}
+
+type seriesDevField struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	Units string `json:"units"`
+}
+
+// devSeries returns the activity's developer fields recorded per record,
+// bucketed like the other series and aligned to times, keyed "dev<id>".
+func (s *Server) devSeries(id int64, bucket int, times []int) (map[string][]any, []seriesDevField, error) {
+	fields, err := s.store.ListDevFields(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	series := map[string][]any{}
+	var defs []seriesDevField
+	for _, f := range fields {
+		rows, err := s.db.Query(`
+			SELECT (pos / ?) * ? AS t_bin, AVG(value)
+			FROM dev_values
+			WHERE field_id=? AND msg='record'
+			GROUP BY t_bin`, bucket, bucket, f.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		byT := map[int]float64{}
+		for rows.Next() {
+			var t int
+			var v float64
+			if err := rows.Scan(&t, &v); err != nil {
+				rows.Close()
+				return nil, nil, err
+			}
+			byT[t] = v
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+		if len(byT) == 0 {
+			continue // lap or session values only
+		}
+		vals := make([]any, len(times))
+		for i, t := range times {
+			if v, ok := byT[t]; ok {
+				vals[i] = math.Round(v*100) / 100
+			}
+		}
+		key := "dev" + strconv.FormatInt(f.ID, 10)
+		series[key] = vals
+		defs = append(defs, seriesDevField{Key: key, Label: f.Label(), Units: f.Units})
+	}
+	return series, defs, nil
+}
@@ -0,0 +1,109 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"garmr/internal/store"
+)
+
+type sessionRow struct {
+	store.Session
+	Current bool
+	Browser string
+}
+
+type sessionsVM struct {
+	CurrentUser *userView
+	Error       string
+	Success     string
+	Sessions    []sessionRow
+}
+
+// GET, POST /account/sessions  (intent: revoke | revoke_others)
+func (s *Server) handleAccountSessions(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
+	data := sessionsVM{CurrentUser: user}
+	current := ""
+	if c, err := r.Cookie(s.cookie); err == nil {
+		current = c.Value
+	}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		switch r.FormValue("intent") {
+		case "revoke":
+			if err := s.store.DeleteSessionByHandle(user.ID, r.FormValue("session")); err != nil {
+				data.Error = "Session not found"
+				break
+			}
+			data.Success = "Session signed out"
+		case "revoke_others":
+			if err := s.store.DeleteSessionsForUserExcept(user.ID, current); err != nil {
+				data.Error = err.Error()
+				break
+			}
+			data.Success = "All other sessions signed out"
+		default:
+			data.Error = "Unknown action"
+		}
+	}
+
+	sessions, err := s.store.ListSessions(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if current != "" {
+		// a revoked current session signs the user out
+		found := false
+		for _, se := range sessions {
+			found = found || se.ID == current
+		}
+		if !found {
+			s.clearSessionCookie(w, r)
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+	}
+	for _, se := range sessions {
+		data.Sessions = append(data.Sessions, sessionRow{Session: se, Current: se.ID == current, Browser: describeUserAgent(se.UserAgent)})
+	}
+	if err := s.tplAccountSessions.ExecuteTemplate(w, "layout", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// describeUserAgent turns a User-Agent header into "Browser on OS".
+func describeUserAgent(ua string) string {
+	if ua == "" {
+		return "Unknown"
+	}
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"},
+		{"Safari/", "Safari"}, {"curl/", "curl"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	platform := ""
+	for _, o := range []struct{ token, name string }{
+		{"Android", "Android"}, {"iPhone", "iOS"}, {"iPad", "iPadOS"}, {"Windows", "Windows"},
+		{"Mac OS X", "macOS"}, {"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			platform = o.name
+			break
+		}
+	}
+	if platform == "" {
+		return browser
+	}
+	return browser + " on " + platform
+}
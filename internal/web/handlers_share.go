@@ -0,0 +1,100 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shareTTLs are the expiry choices offered for new share links, in days.
+var shareTTLs = map[string]time.Duration{
+	"":   0,
+	"1":  24 * time.Hour,
+	"7":  7 * 24 * time.Hour,
+	"30": 30 * 24 * time.Hour,
+}
+
+// activityShareAction performs one share form intent (share | revoke_share)
+// on the activity in vm and returns the error and success messages to show.
+func (s *Server) activityShareAction(r *http.Request, vm *activityDetailVM) (string, string) {
+	switch r.FormValue("intent") {
+	case "share":
+		ttl, ok := shareTTLs[r.FormValue("expires")]
+		if !ok {
+			return "Invalid expiry", ""
+		}
+		token, err := s.store.CreateActivityShare(vm.ID, ttl, r.FormValue("privacy") != "")
+		if err != nil {
+			log.Printf("share: create link for activity %d: %v", vm.ID, err)
+			return "Failed to create share link", ""
+		}
+		vm.ShareURL = s.shareURL(r, token)
+		return "", "Share link created. Copy it now, it won't be shown again."
+	case "revoke_share":
+		id, _ := strconv.ParseInt(r.FormValue("share_id"), 10, 64)
+		if err := s.store.DeleteActivityShare(vm.ID, id); err != nil {
+			return "Share link not found", ""
+		}
+		return "", "Share link revoked"
+	default:
+		return "Unknown action", ""
+	}
+}
+
+func (s *Server) shareURL(r *http.Request, token string) string {
+	return s.baseURL(r) + "/s/" + url.PathEscape(token)
+}
+
+// GET /s/{token}, /s/{token}/activity, /s/{token}/series, /s/{token}/zones
+// Public read-only view of one activity; the token is the credential.
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, part, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/s/"), "/")
+	sh, err := s.store.LookupActivityShare(token)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("share: lookup: %v", err)
+		}
+		http.Error(w, "This link is invalid, revoked or expired.", http.StatusNotFound)
+		return
+	}
+	// keep the token out of tile requests and search engines
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex")
+
+	switch part {
+	case "":
+		vm := activityDetailVM{CurrentUser: s.currentUser(r), ShareToken: token}
+		if err := s.loadActivityDetail(&vm, sh.OwnerID, sh.ActivityID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.loadSplits(&vm, r.URL.Query().Get("splits"))
+		s.loadClimbs(&vm)
+		s.store.RecordShareView(sh.ID)
+		_ = s.tplDetail.ExecuteTemplate(w, "layout", vm)
+	case "activity":
+		var pol privacyPolicy
+		if sh.Privacy {
+			if pol, err = s.privacyPolicy(sh.OwnerID, true); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		s.writeTrack(w, sh.ActivityID, pol)
+	case "series":
+		s.writeSeries(w, r, sh.ActivityID)
+	case "zones":
+		s.writeZones(w, sh.ActivityID)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,184 @@
+package web
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"garmr/internal/store"
+)
+
+const athleteCookieName = "garmr_athlete"
+
+// athleteView is the athlete whose data a request reads: the signed-in user
+// or an owner who granted them access.
+type athleteView struct {
+	ID       int64
+	Username string
+	Self     bool
+	Grant    store.Grant // zero when Self
+}
+
+func (a *athleteView) CanViewActivities() bool { return a.Self || a.Grant.ViewActivities }
+func (a *athleteView) CanViewStats() bool      { return a.Self || a.Grant.ViewStats }
+
+// CanViewPlans: any grant shows the calendar, so a coach who may only
+// edit plans still sees what they are editing.
+func (a *athleteView) CanViewPlans() bool { return a.Self || a.Grant.Any() }
+
+type sharingVM struct {
+	CurrentUser *userView
+	Error       string
+	Success     string
+	Shared      []store.Grant // what the user shares with others
+	SharedWith  []store.Grant // who shares with the user
+}
+
+// withAthlete fills in the athletes uv can switch to and picks the one named
+// by the athlete cookie, falling back to uv's own data.
+func (s *Server) withAthlete(r *http.Request, uv *userView) *userView {
+	grants, err := s.store.GrantsForGrantee(uv.ID)
+	if err != nil {
+		log.Printf("sharing: load grants for %s: %v", uv.Username, err)
+		return uv
+	}
+	uv.Athletes = grants
+	c, err := r.Cookie(athleteCookieName)
+	if err != nil {
+		return uv
+	}
+	id, _ := strconv.ParseInt(c.Value, 10, 64)
+	for _, g := range grants {
+		if g.OwnerID == id {
+			uv.Viewing = &athleteView{ID: g.OwnerID, Username: g.OwnerName, Grant: g}
+			break
+		}
+	}
+	return uv
+}
+
+// athlete returns the athlete the request acts on. Token requests always
+// act on the token owner.
+func (s *Server) athlete(r *http.Request) *athleteView {
+	if u := s.currentUser(r); u != nil && u.Viewing != nil {
+		return u.Viewing
+	}
+	return &athleteView{}
+}
+
+// requireShared is requireAuth plus a check that the viewed athlete shares
+// what the page shows.
+func (s *Server) requireShared(allowed func(*athleteView) bool, next http.Handler) http.Handler {
+	return s.requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a := s.athlete(r); !allowed(a) {
+			http.Error(w, "forbidden: "+a.Username+" hasn't shared this with you", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// requirePlanEditor guards plan changes: athletes and admins on their own
+// plan or on a plan shared with edit rights.
+func (s *Server) requirePlanEditor(next http.Handler) http.Handler {
+	return s.requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.currentUser(r).CanEditPlans() {
+			forbidden(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// POST /athlete  (athlete_id; 0 or empty switches back to your own data)
+func (s *Server) handleSwitchAthlete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := s.currentUser(r)
+	id, _ := strconv.ParseInt(r.FormValue("athlete_id"), 10, 64)
+	view := &athleteView{ID: user.ID, Username: user.Username, Self: true}
+	for _, g := range user.Athletes {
+		if g.OwnerID == id {
+			view = &athleteView{ID: g.OwnerID, Username: g.OwnerName, Grant: g}
+		}
+	}
+	c := &http.Cookie{Name: athleteCookieName, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode, Secure: s.secure(r)}
+	if view.Self {
+		c.MaxAge = -1
+	} else {
+		c.Value = strconv.FormatInt(view.ID, 10)
+		c.MaxAge = int(sessionDuration.Seconds())
+	}
+	http.SetCookie(w, c)
+
+	target := "/calendar"
+	switch {
+	case view.CanViewActivities():
+		target = "/"
+	case view.CanViewStats():
+		target = "/stats"
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// GET, POST /account/sharing  (intent: share | revoke)
+func (s *Server) handleAccountSharing(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
+	data := sharingVM{CurrentUser: user}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		switch r.FormValue("intent") {
+		case "share":
+			name := strings.TrimSpace(r.FormValue("username"))
+			grantee, err := s.store.GetUserByUsername(name)
+			if err != nil {
+				data.Error = "No user named " + name
+				break
+			}
+			g := store.Grant{
+				OwnerID:        user.ID,
+				GranteeID:      grantee.ID,
+				ViewActivities: r.FormValue("view_activities") != "",
+				ViewStats:      r.FormValue("view_stats") != "",
+				EditPlans:      r.FormValue("edit_plans") != "",
+			}
+			if err := s.store.SetGrant(g); err != nil {
+				data.Error = err.Error()
+				break
+			}
+			log.Printf("sharing: %s updated grant for %s", user.Username, grantee.Username)
+			if g.Any() {
+				data.Success = "Sharing with " + grantee.Username + " updated"
+			} else {
+				data.Success = "Stopped sharing with " + grantee.Username
+			}
+		case "revoke":
+			id, _ := strconv.ParseInt(r.FormValue("grantee_id"), 10, 64)
+			if err := s.store.DeleteGrant(user.ID, id); err != nil {
+				data.Error = err.Error()
+				break
+			}
+			data.Success = "Stopped sharing"
+		default:
+			data.Error = "Unknown action"
+		}
+	}
+
+	shared, err := s.store.GrantsByOwner(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Shared = shared
+	data.SharedWith = user.Athletes
+	if err := s.tplAccountSharing.ExecuteTemplate(w, "layout", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
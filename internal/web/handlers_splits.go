@@ -0,0 +1,153 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"garmr/internal/analysis"
+	"garmr/internal/fitx"
+)
+
+// splitsVM is the splits part of an activity's page.
+type splitsVM struct {
+	Unit    string // "km" or "mi"
+	Foot    bool   // pace and GAP; speed for other sports
+	HasHR   bool
+	HasCad  bool
+	HasElev bool
+	GAP     string // grade-adjusted pace of the whole activity, foot sports only
+	Rows    []splitRow
+}
+
+type splitRow struct {
+	analysis.Split
+	Label string // split number, or the distance of the last, shorter one
+	Pace  string // pace, or speed for other sports
+	GAP   string
+	Cad   float64 // steps per minute for runs
+}
+
+// splitLength returns the split length for a unit, "km" unless it is "mi".
+func splitLength(unit string) (float64, string) {
+	if unit == "mi" {
+		return analysis.Mile, "mi"
+	}
+	return analysis.Kilometre, "km"
+}
+
+// activitySplits computes an activity's splits of lengthM metres from its
+// records.
+func (s *Server) activitySplits(id int64, lengthM float64) ([]analysis.Split, error) {
+	pts, pauses, err := s.activityPoints(id)
+	if err != nil {
+		return nil, err
+	}
+	return analysis.Splits(pts, pauses, lengthM), nil
+}
+
+// activityPoints loads an activity's records and pauses for the analysis.
+func (s *Server) activityPoints(id int64) ([]analysis.Point, []fitx.Pause, error) {
+	recs, _, err := s.store.ListRecords(id, -1, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	pauses, err := s.store.ActivityPauses(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	pts := make([]analysis.Point, len(recs))
+	for i, r := range recs {
+		p := analysis.Point{T: r.TOffsetS}
+		if r.DistanceM.Valid {
+			p.DistM = &r.DistanceM.Float64
+		}
+		if r.Lat.Valid && r.Lon.Valid {
+			p.Lat, p.Lon = &r.Lat.Float64, &r.Lon.Float64
+		}
+		if r.ElevM.Valid {
+			p.ElevM = &r.ElevM.Float64
+		}
+		if r.HR.Valid && r.HR.Int64 != 255 {
+			hr := float64(r.HR.Int64)
+			p.HR = &hr
+		}
+		if r.Cad.Valid && r.Cad.Int64 != 255 {
+			cad := float64(r.Cad.Int64) + r.CadFraction.Float64
+			p.Cad = &cad
+		}
+		pts[i] = p
+	}
+	return pts, pauses, nil
+}
+
+// loadSplits fills the splits of the activity view in unit ("km" or "mi").
+// Pool swims have lengths instead.
+func (s *Server) loadSplits(vm *activityDetailVM, unit string) {
+	if vm.Swim != nil || vm.DistM == 0 {
+		return
+	}
+	lengthM, unit := splitLength(unit)
+	splits, err := s.activitySplits(vm.ID, lengthM)
+	if err != nil {
+		log.Printf("splits of activity %d: %v", vm.ID, err)
+		return
+	}
+	if len(splits) == 0 {
+		return
+	}
+	run := strings.Contains(strings.ToLower(vm.Sport), "run")
+	sv := &splitsVM{Unit: unit, Foot: footSport(vm.Sport)}
+	var flatM, timeS float64
+	for _, sp := range splits {
+		flatM += sp.FlatM
+		timeS += sp.TimeS
+		row := splitRow{Split: sp, Label: fmt.Sprint(sp.Index + 1), Cad: sp.AvgCad}
+		if !sp.Full {
+			row.Label = fmt.Sprintf("%.2f", sp.DistM/lengthM)
+		}
+		if run {
+			row.Cad *= 2
+		}
+		if sv.Foot {
+			row.Pace = fmtSplitPace(sp.SpeedMPS(), lengthM, unit)
+			row.GAP = fmtSplitPace(sp.GAPSpeedMPS(), lengthM, unit)
+		} else {
+			row.Pace = fmtSplitSpeed(sp.SpeedMPS(), lengthM, unit)
+		}
+		sv.HasHR = sv.HasHR || sp.AvgHR > 0
+		sv.HasCad = sv.HasCad || sp.AvgCad > 0
+		sv.HasElev = sv.HasElev || sp.GainM > 0 || sp.LossM > 0
+		sv.Rows = append(sv.Rows, row)
+	}
+	if sv.Foot && sv.HasElev && timeS > 0 {
+		sv.GAP = fmtSplitPace(flatM/timeS, lengthM, unit)
+	}
+	vm.Splits = sv
+}
+
+// footSport reports whether a sport is on foot, where pace and
+// grade-adjusted pace make sense.
+func footSport(sport string) bool {
+	sport = strings.ToLower(sport)
+	return strings.Contains(sport, "run") || strings.Contains(sport, "walk") || strings.Contains(sport, "hik")
+}
+
+// fmtSplitPace formats a speed as time per unit, e.g. "5:12 /km".
+func fmtSplitPace(mps, unitM float64, unit string) string {
+	if mps <= 0 {
+		return "-"
+	}
+	sec := int(math.Round(unitM / mps))
+	return fmt.Sprintf("%d:%02d /%s", sec/60, sec%60, unit)
+}
+
+// fmtSplitSpeed formats a speed per hour, e.g. "28.4 km/h" or "17.6 mph".
+func fmtSplitSpeed(mps, unitM float64, unit string) string {
+	v := mps * 3600 / unitM
+	if unit == "mi" {
+		return fmt.Sprintf("%.1f mph", v)
+	}
+	return fmt.Sprintf("%.1f km/h", v)
+}
@@ -0,0 +1,283 @@
+package web
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"garmr/internal/oidc"
+	"garmr/internal/store"
+)
+
+// oidcCookieName carries state, nonce, PKCE verifier, the next page and,
+// when a signed-in user links an account, their id between /login/oidc and
+// the provider's redirect back.
+const oidcCookieName = "garmr_oidc"
+
+// errSSOUsernameTaken is returned for a first sign-in whose username claim
+// names an existing user. That user has to link the account themselves.
+var errSSOUsernameTaken = errors.New("username claim names an existing user")
+
+// trustedProxy reports whether the request came straight from one of the
+// configured trusted_proxies.
+func (s *Server) trustedProxy(r *http.Request) bool {
+	return s.isProxy(remoteAddr(r))
+}
+
+func (s *Server) isProxy(a netip.Addr) bool {
+	if !a.IsValid() {
+		return false
+	}
+	for _, p := range s.proxies {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	a, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return a.Unmap()
+}
+
+// proxyUser signs in the user named by the proxy auth header, if the request
+// came through a trusted proxy that set it.
+func (s *Server) proxyUser(w http.ResponseWriter, r *http.Request) *userView {
+	if s.cfg.ProxyAuthHeader == "" || !s.trustedProxy(r) {
+		return nil
+	}
+	username := strings.TrimSpace(r.Header.Get(s.cfg.ProxyAuthHeader))
+	if username == "" {
+		return nil
+	}
+	user, err := s.ssoUser(username)
+	if err != nil {
+		log.Printf("auth: proxy user %q: %v", username, err)
+		return nil
+	}
+	if user.Disabled {
+		return nil
+	}
+	uv := s.withAthlete(r, newUserView(user))
+	uv.CSRFToken = s.anonCSRF(w, r)
+	return uv
+}
+
+// ssoUser looks up a user signing in through single sign-on, creating it
+// when sso_auto_create is on.
+func (s *Server) ssoUser(username string) (*store.AuthUser, error) {
+	user, err := s.store.GetUserByUsername(username)
+	if !errors.Is(err, sql.ErrNoRows) || !s.cfg.SSOAutoCreate {
+		return user, err
+	}
+	user, err = s.store.CreateSSOUser(username, s.cfg.SSODefaultRole)
+	if err != nil {
+		// another request may have just created it
+		if u, lerr := s.store.GetUserByUsername(username); lerr == nil {
+			return u, nil
+		}
+		return nil, err
+	}
+	log.Printf("auth: created user %q (%s) on first single sign-on", user.Username, user.Role)
+	return user, nil
+}
+
+// oidcRedirectURL is where the provider sends the browser back to.
+func (s *Server) oidcRedirectURL(r *http.Request) string {
+	if s.cfg.OIDCRedirectURL != "" {
+		return s.cfg.OIDCRedirectURL
+	}
+	return s.baseURL(r) + "/login/oidc/callback"
+}
+
+func (s *Server) handleLoginOIDC(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	next := sanitizeRedirect(r.URL.Query().Get("next"))
+	if err := s.startOIDC(w, r, next, 0); err != nil {
+		log.Printf("oidc: start sign-in: %v", err)
+		s.renderLogin(w, r, next, "Single sign-on is unavailable right now. Check server logs.")
+	}
+}
+
+// startOIDC sends the browser to the provider. With a linkUserID the
+// callback links the provider account to that signed-in user instead of
+// signing in.
+func (s *Server) startOIDC(w http.ResponseWriter, r *http.Request, next string, linkUserID int64) error {
+	ar, err := oidc.NewAuthRequest(s.oidcRedirectURL(r))
+	if err != nil {
+		return err
+	}
+	target, err := s.oidc.AuthCodeURL(r.Context(), ar)
+	if err != nil {
+		return err
+	}
+	link := ""
+	if linkUserID > 0 {
+		link = strconv.FormatInt(linkUserID, 10)
+	}
+	value := strings.Join([]string{ar.State, ar.Nonce, ar.Verifier, base64.RawURLEncoding.EncodeToString([]byte(next)), link}, ".")
+	s.setOIDCCookie(w, r, value, int((10 * time.Minute).Seconds()))
+	http.Redirect(w, r, target, http.StatusSeeOther)
+	return nil
+}
+
+func (s *Server) handleLoginOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var ar oidc.AuthRequest
+	next := "/"
+	var linkUserID int64
+	if c, err := r.Cookie(oidcCookieName); err == nil {
+		if parts := strings.Split(c.Value, "."); len(parts) == 5 {
+			ar = oidc.AuthRequest{State: parts[0], Nonce: parts[1], Verifier: parts[2], RedirectURL: s.oidcRedirectURL(r)}
+			if b, err := base64.RawURLEncoding.DecodeString(parts[3]); err == nil {
+				next = sanitizeRedirect(string(b))
+			}
+			linkUserID, _ = strconv.ParseInt(parts[4], 10, 64)
+		}
+	}
+	s.setOIDCCookie(w, r, "", -1)
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		log.Printf("oidc: provider returned %s: %s", e, q.Get("error_description"))
+		s.renderLogin(w, r, next, "Single sign-on was cancelled or refused.")
+		return
+	}
+	if ar.State == "" || subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(ar.State)) != 1 {
+		s.renderLogin(w, r, next, "Single sign-on expired or was started in another browser. Try again.")
+		return
+	}
+	claims, err := s.oidc.Exchange(r.Context(), q.Get("code"), ar)
+	if err != nil {
+		log.Printf("oidc: %v", err)
+		s.renderLogin(w, r, next, "Single sign-on failed. Check server logs.")
+		return
+	}
+	if linkUserID > 0 {
+		s.linkOIDC(w, r, linkUserID, claims)
+		return
+	}
+	user, err := s.oidcUser(claims)
+	switch {
+	case errors.Is(err, errSSOUsernameTaken):
+		log.Printf("oidc: %s/%s: %v", claims.Issuer, claims.Subject, err)
+		s.renderLogin(w, r, next, "A Garmr account with this name already exists. Sign in to it and link single sign-on under Account → Edit details.")
+		return
+	case err != nil:
+		log.Printf("oidc: map %s/%s: %v", claims.Issuer, claims.Subject, err)
+		s.renderLogin(w, r, next, "No Garmr account is linked to this sign-in. Ask an admin to create one, or sign in and link it under Account → Edit details.")
+		return
+	}
+	if user.Disabled {
+		s.recordLogin(user.Username, s.clientIP(r), store.LoginFailed)
+		s.renderLogin(w, r, next, "This account is disabled. Ask an admin to enable it.")
+		return
+	}
+	// the provider is responsible for any second factor
+	s.signIn(w, r, user, next)
+}
+
+// oidcUser finds the user for verified claims: the one linked to the
+// provider account, else a new one named by the username claim when
+// sso_auto_create is on. Existing users are never matched by name, since
+// most providers let people pick their own; they link from their account
+// settings instead.
+func (s *Server) oidcUser(claims *oidc.Claims) (*store.AuthUser, error) {
+	user, err := s.store.UserForIdentity(claims.Issuer, claims.Subject)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return user, err
+	}
+	if !s.cfg.SSOAutoCreate {
+		return nil, errors.New("no linked user")
+	}
+	username := strings.TrimSpace(claims.String(s.cfg.OIDCUsernameClaim))
+	if username == "" {
+		return nil, errors.New("no " + s.cfg.OIDCUsernameClaim + " claim")
+	}
+	switch _, err := s.store.GetUserByUsername(username); {
+	case err == nil:
+		return nil, fmt.Errorf("%w %q", errSSOUsernameTaken, username)
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+	if user, err = s.store.CreateSSOUser(username, s.cfg.SSODefaultRole); err != nil {
+		return nil, err
+	}
+	if err := s.store.LinkIdentity(user.ID, claims.Issuer, claims.Subject); err != nil {
+		return nil, err
+	}
+	log.Printf("oidc: created user %q (%s) for %s/%s", user.Username, user.Role, claims.Issuer, claims.Subject)
+	return user, nil
+}
+
+// linkOIDC links the provider account of claims to the signed-in user who
+// started the flow from their account settings, and sends them back there.
+func (s *Server) linkOIDC(w http.ResponseWriter, r *http.Request, userID int64, claims *oidc.Claims) {
+	user := s.currentUser(r)
+	if user == nil || user.ID != userID {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape("/account/details"), http.StatusSeeOther)
+		return
+	}
+	result := "linked"
+	switch other, err := s.store.UserForIdentity(claims.Issuer, claims.Subject); {
+	case err == nil && other.ID != userID:
+		result = "taken"
+	case err == nil:
+	case !errors.Is(err, sql.ErrNoRows):
+		log.Printf("oidc: link %s/%s: %v", claims.Issuer, claims.Subject, err)
+		result = "failed"
+	default:
+		if err := s.store.LinkIdentity(userID, claims.Issuer, claims.Subject); err != nil {
+			log.Printf("oidc: link %s/%s: %v", claims.Issuer, claims.Subject, err)
+			result = "failed"
+		} else {
+			log.Printf("oidc: linked %s/%s to user %q", claims.Issuer, claims.Subject, user.Username)
+		}
+	}
+	http.Redirect(w, r, "/account/details?sso="+result, http.StatusSeeOther)
+}
+
+func (s *Server) setOIDCCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    value,
+		Path:     "/login/oidc",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   s.secure(r),
+		MaxAge:   maxAge,
+	})
+}
+
+// ssoButton is the label of the single sign-on button on the login page,
+// empty when OIDC is not configured.
+func (s *Server) ssoButton() string {
+	if s.oidc == nil {
+		return ""
+	}
+	return s.cfg.OIDCButton
+}
@@ -2,6 +2,7 @@ package web
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -31,6 +32,7 @@ type statsPageVM struct {
 	MonthLabel   string
 	YearLabel    string
 	CurrentTab   string
+	Wellness     wellnessVM
 }
 
 type MonthItem struct {
@@ -55,14 +57,15 @@ func (s *Server) handleStatsPage(w http.ResponseWriter, r *http.Request) {
 	yearQS := strings.TrimSpace(r.URL.Query().Get("year"))
 	now := time.Now()
 	loc := now.Location()
+	uid := s.athlete(r).ID
 
 	// Build sports list from ALL activities
 	sports := make([]string, 0, 8)
 	rowsSports, err := s.db.Query(`
         SELECT DISTINCT TRIM(sport)
         FROM activities
-        WHERE sport IS NOT NULL AND TRIM(sport) <> ''
-    `)
+        WHERE user_id = ? AND sport IS NOT NULL AND TRIM(sport) <> ''
+    `, uid)
 	if err == nil {
 		defer rowsSports.Close()
 		seen := map[string]struct{}{}
@@ -112,16 +115,25 @@ func (s *Server) handleStatsPage(w http.ResponseWriter, r *http.Request) {
 		CurrentTab:   tab,
 	}
 
-	monthStats, err := s.periodStatsFiltered(monthStart, monthEnd, sport)
+	monthStats, err := s.periodStatsFiltered(uid, monthStart, monthEnd, sport)
 	if err == nil {
 		vm.Month = monthStats
 		vm.MonthLabel = monthStart.Format("Jan 2006")
 	}
-	yearStats, err := s.periodStatsFiltered(yearStart, yearEnd, sport)
+	yearStats, err := s.periodStatsFiltered(uid, yearStart, yearEnd, sport)
 	if err == nil {
 		vm.Year = yearStats
 		vm.YearLabel = yearStart.Format("2006")
 	}
+	wellFrom, wellTo, wellLabel := monthStart, monthEnd, monthStart.Format("Jan 2006")
+	if tab == "year" {
+		wellFrom, wellTo, wellLabel = yearStart, yearEnd, yearStart.Format("2006")
+	}
+	if wv, err := s.loadWellness(uid, wellFrom, wellTo, wellLabel); err == nil {
+		vm.Wellness = wv
+	} else {
+		log.Printf("stats: wellness for user %d: %v", uid, err)
+	}
 	_ = s.tplStats.ExecuteTemplate(w, "layout", vm)
 }
 
@@ -129,6 +141,7 @@ func (s *Server) handleStatsData(w http.ResponseWriter, r *http.Request) {
 	gran := r.URL.Query().Get("gran")
 	year, _ := strconv.Atoi(r.URL.Query().Get("year"))
 	sport := strings.TrimSpace(r.URL.Query().Get("sport"))
+	uid := s.athlete(r).ID
 
 	type out struct {
 		Labels    []string             `json:"labels"`
@@ -149,7 +162,7 @@ func (s *Server) handleStatsData(w http.ResponseWriter, r *http.Request) {
 		yStart := time.Date(year, 1, 1, 0, 0, 0, 0, loc)
 		yEnd := yStart.AddDate(1, 0, 0)
 		resp.Label = yStart.Format("2006")
-		if s, err := s.periodStatsFiltered(yStart, yEnd, sport); err == nil {
+		if s, err := s.periodStatsFiltered(uid, yStart, yEnd, sport); err == nil {
 			resp.Summary = &s
 		}
 
@@ -168,11 +181,11 @@ func (s *Server) handleStatsData(w http.ResponseWriter, r *http.Request) {
                 SELECT strftime('%Y-%m', `+tsPrefix+`) AS ym, sport,
                        COALESCE(SUM(distance_m),0)
                 FROM activities
-                WHERE `+tsPrefix+` >= ? AND `+tsPrefix+` < ?
+                WHERE user_id = ? AND `+tsPrefix+` >= ? AND `+tsPrefix+` < ?
                   AND sport IS NOT NULL AND TRIM(sport) <> ''
                 GROUP BY ym, sport
                 ORDER BY ym, sport
-            `, toSQLite(yStart), toSQLite(yEnd))
+            `, uid, toSQLite(yStart), toSQLite(yEnd))
 			if err != nil {
 				http.Error(w, err.Error(), 500)
 				return
@@ -201,10 +214,10 @@ func (s *Server) handleStatsData(w http.ResponseWriter, r *http.Request) {
                 SELECT strftime('%Y-%m', `+tsPrefix+`) AS ym,
                        COALESCE(SUM(distance_m),0)
                 FROM activities
-                WHERE `+tsPrefix+` >= ? AND `+tsPrefix+` < ? AND sport = ?
+                WHERE user_id = ? AND `+tsPrefix+` >= ? AND `+tsPrefix+` < ? AND sport = ?
                 GROUP BY ym
                 ORDER BY ym
-            `, toSQLite(yStart), toSQLite(yEnd), sport)
+            `, uid, toSQLite(yStart), toSQLite(yEnd), sport)
 			if err != nil {
 				http.Error(w, err.Error(), 500)
 				return
@@ -250,7 +263,7 @@ func (s *Server) handleStatsData(w http.ResponseWriter, r *http.Request) {
 		mStart := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
 		mEnd := mStart.AddDate(0, 1, 0)
 		resp.Label = mStart.Format("Jan 2006")
-		if s, err := s.periodStatsFiltered(mStart, mEnd, sport); err == nil {
+		if s, err := s.periodStatsFiltered(uid, mStart, mEnd, sport); err == nil {
 			resp.Summary = &s
 		}
 
@@ -270,11 +283,11 @@ func (s *Server) handleStatsData(w http.ResponseWriter, r *http.Request) {
                 SELECT date(`+tsPrefix+`) AS d, sport,
                        COALESCE(SUM(distance_m),0)
                 FROM activities
-                WHERE `+tsPrefix+` >= ? AND `+tsPrefix+` < ?
+                WHERE user_id = ? AND `+tsPrefix+` >= ? AND `+tsPrefix+` < ?
                   AND sport IS NOT NULL AND TRIM(sport) <> ''
                 GROUP BY d, sport
                 ORDER BY d, sport
-            `, toSQLite(mStart), toSQLite(mEnd))
+            `, uid, toSQLite(mStart), toSQLite(mEnd))
 			if err != nil {
 				http.Error(w, err.Error(), 500)
 				return
@@ -304,10 +317,10 @@ func (s *Server) handleStatsData(w http.ResponseWriter, r *http.Request) {
                 SELECT date(`+tsPrefix+`) AS d,
                        COALESCE(SUM(distance_m),0)
                 FROM activities
-                WHERE `+tsPrefix+` >= ? AND `+tsPrefix+` < ? AND sport = ?
+                WHERE user_id = ? AND `+tsPrefix+` >= ? AND `+tsPrefix+` < ? AND sport = ?
                 GROUP BY d
                 ORDER BY d
-            `, toSQLite(mStart), toSQLite(mEnd), sport)
+            `, uid, toSQLite(mStart), toSQLite(mEnd), sport)
 			if err != nil {
 				http.Error(w, err.Error(), 500)
 				return
@@ -335,10 +348,12 @@ func (s *Server) handleStatsData(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleStatsPeriods(w http.ResponseWriter, r *http.Request) {
+	uid := s.athlete(r).ID
 	yrows, err := s.db.Query(`
-        SELECT DISTINCT strftime('%Y', ` + tsPrefix + `) AS y
+        SELECT DISTINCT strftime('%Y', `+tsPrefix+`) AS y
         FROM activities
-        ORDER BY y DESC`)
+        WHERE user_id = ?
+        ORDER BY y DESC`, uid)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
@@ -359,9 +374,10 @@ func (s *Server) handleStatsPeriods(w http.ResponseWriter, r *http.Request) {
 	}
 
 	mrows, err := s.db.Query(`
-        SELECT DISTINCT strftime('%Y-%m', ` + tsPrefix + `) AS ym
+        SELECT DISTINCT strftime('%Y-%m', `+tsPrefix+`) AS ym
         FROM activities
-        ORDER BY ym DESC`)
+        WHERE user_id = ?
+        ORDER BY ym DESC`, uid)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
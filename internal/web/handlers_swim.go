@@ -0,0 +1,164 @@
+package web
+
+import (
+	"database/sql"
+	"log"
+	"sort"
+
+	"garmr/internal/fitx"
+	"garmr/internal/store"
+)
+
+// swimRestGapS is how long a pause between two active lengths has to be to
+// count as a rest, for watches that don't record idle lengths.
+const swimRestGapS = 10
+
+// swimVM is the pool swim part of an activity's page.
+type swimVM struct {
+	PoolLengthM   float64
+	ActiveLengths int
+	DistM         float64
+	SwimS         float64 // time swimming, without rests
+	RestS         float64
+	Pace100S      float64 // s per 100 m while swimming
+	AvgSWOLF      float64
+	AvgStrokes    float64 // per length
+	Strokes       []strokeShare
+	Intervals     []swimInterval
+	Lengths       []store.SwimLength
+}
+
+type strokeShare struct {
+	Stroke  string
+	Lengths int
+	Pct     float64
+}
+
+// swimInterval is a run of lengths without a rest, and the rest after it.
+type swimInterval struct {
+	Index    int
+	Lengths  int
+	DistM    float64
+	DurS     float64
+	Pace100S float64
+	SWOLF    float64 // average per length
+	Strokes  int
+	Stroke   string // the one stroke swum, or "mixed"
+	RestS    float64
+}
+
+// loadSwim fills the pool swim view, reading the lengths from the FIT file
+// for swims imported before lengths were stored.
+func (s *Server) loadSwim(vm *activityDetailVM, userID int64) {
+	if !store.IsSwim(vm.Sport) {
+		return
+	}
+	pool, err := s.store.SwimPoolLength(vm.ID)
+	if err != nil {
+		log.Printf("swim: pool length of activity %d: %v", vm.ID, err)
+		return
+	}
+	if !pool.Valid {
+		pool, err = s.backfillSwim(userID, vm.ID)
+		if err != nil {
+			log.Printf("swim: read lengths of activity %d: %v", vm.ID, err)
+			return
+		}
+	}
+	if pool.Float64 <= 0 {
+		return // open water
+	}
+	lengths, err := s.store.ListSwimLengths(vm.ID)
+	if err != nil {
+		log.Printf("swim: lengths of activity %d: %v", vm.ID, err)
+		return
+	}
+	vm.Swim = newSwimVM(pool.Float64, lengths)
+	if vm.Swim.ActiveLengths > 0 {
+		vm.DistM = int(vm.Swim.DistM + 0.5)
+	}
+}
+
+func (s *Server) backfillSwim(userID, id int64) (sql.NullFloat64, error) {
+	path, err := s.store.ActivityRawPath(userID, id)
+	if err != nil {
+		return sql.NullFloat64{}, err
+	}
+	act, _, _, _, err := fitx.ParseFIT(path)
+	if err != nil {
+		return sql.NullFloat64{}, err
+	}
+	if err := s.store.WithTx(func(tx *sql.Tx) error {
+		return s.store.InsertSwim(tx, id, act)
+	}); err != nil {
+		return sql.NullFloat64{}, err
+	}
+	return sql.NullFloat64{Float64: act.PoolLengthM, Valid: true}, nil
+}
+
+func newSwimVM(pool float64, lengths []store.SwimLength) *swimVM {
+	vm := &swimVM{PoolLengthM: pool, Lengths: lengths}
+	var swolf, strokes int
+	byStroke := map[string]int{}
+	var cur *swimInterval
+	var lastEnd float64
+	closeInterval := func() {
+		if cur == nil {
+			return
+		}
+		cur.SWOLF /= float64(cur.Lengths)
+		if cur.DistM > 0 {
+			cur.Pace100S = cur.DurS / cur.DistM * 100
+		}
+		vm.Intervals = append(vm.Intervals, *cur)
+		cur = nil
+	}
+	for _, l := range lengths {
+		if !l.Active {
+			closeInterval()
+			continue
+		}
+		if cur != nil && l.StartOff-lastEnd >= swimRestGapS {
+			closeInterval()
+		}
+		if cur == nil {
+			if n := len(vm.Intervals); n > 0 {
+				vm.Intervals[n-1].RestS = l.StartOff - lastEnd
+				vm.RestS += l.StartOff - lastEnd
+			}
+			cur = &swimInterval{Index: len(vm.Intervals) + 1, Stroke: l.Stroke}
+		}
+		if cur.Stroke != l.Stroke {
+			cur.Stroke = "mixed"
+		}
+		cur.Lengths++
+		cur.DistM += pool
+		cur.DurS += l.DurS
+		cur.SWOLF += float64(l.SWOLF())
+		cur.Strokes += l.Strokes
+		lastEnd = l.StartOff + l.DurS
+
+		vm.ActiveLengths++
+		vm.SwimS += l.DurS
+		swolf += l.SWOLF()
+		strokes += l.Strokes
+		byStroke[l.Stroke]++
+	}
+	closeInterval()
+	if vm.ActiveLengths == 0 {
+		return vm
+	}
+	n := float64(vm.ActiveLengths)
+	vm.DistM = n * pool
+	vm.Pace100S = vm.SwimS / vm.DistM * 100
+	vm.AvgSWOLF = float64(swolf) / n
+	vm.AvgStrokes = float64(strokes) / n
+	for stroke, c := range byStroke {
+		if stroke == "" {
+			stroke = "unknown"
+		}
+		vm.Strokes = append(vm.Strokes, strokeShare{Stroke: stroke, Lengths: c, Pct: float64(c) / n * 100})
+	}
+	sort.Slice(vm.Strokes, func(i, j int) bool { return vm.Strokes[i].Lengths > vm.Strokes[j].Lengths })
+	return vm
+}
@@ -0,0 +1,24 @@
+package web
+
+import (
+	"database/sql"
+	"log"
+)
+
+// loadTimer fills the elapsed and moving time of the activity view. They
+// stay 0 for activities imported before they were stored, until
+// `garmrd activity backfill` reads them from the FIT files.
+func (s *Server) loadTimer(vm *activityDetailVM) {
+	var elapsed, moving sql.NullInt64
+	if err := s.db.QueryRow(`SELECT elapsed_s, moving_s FROM activities WHERE id=?`, vm.ID).Scan(&elapsed, &moving); err != nil {
+		log.Printf("timer: times of activity %d: %v", vm.ID, err)
+		return
+	}
+	vm.ElapsedS, vm.MovingS = int(elapsed.Int64), int(moving.Int64)
+	pauses, err := s.store.ActivityPauses(vm.ID)
+	if err != nil {
+		log.Printf("timer: pauses of activity %d: %v", vm.ID, err)
+		return
+	}
+	vm.Pauses = len(pauses)
+}
@@ -0,0 +1,97 @@
+package web
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"garmr/internal/store"
+	"garmr/internal/webhook"
+)
+
+// deliveryLogSize is how many recent deliveries the webhooks page shows.
+const deliveryLogSize = 50
+
+type webhooksVM struct {
+	CurrentUser *userView
+	Error       string
+	Success     string
+	Events      []string
+	Hooks       []store.Webhook
+	Deliveries  []store.WebhookDelivery
+	Filter      int64
+}
+
+// GET, POST /webhooks  (intent: create | toggle | delete | test)
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	data := webhooksVM{CurrentUser: s.currentUser(r), Events: webhook.Events}
+	data.Filter, _ = strconv.ParseInt(r.URL.Query().Get("hook"), 10, 64)
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		id, _ := strconv.ParseInt(strings.TrimSpace(r.FormValue("id")), 10, 64)
+		switch r.FormValue("intent") {
+		case "create":
+			var events []string
+			for _, e := range r.Form["events"] {
+				for _, known := range webhook.Events {
+					if e == known {
+						events = append(events, e)
+					}
+				}
+			}
+			if _, err := s.store.CreateWebhook(r.FormValue("url"), events); err != nil {
+				data.Error = err.Error()
+			} else {
+				data.Success = "Webhook added"
+			}
+		case "toggle":
+			if err := s.store.SetWebhookEnabled(id, r.FormValue("enabled") == "1"); err != nil {
+				log.Printf("webhooks: toggle %d: %v", id, err)
+				data.Error = "Failed to update webhook"
+			}
+		case "delete":
+			if err := s.store.DeleteWebhook(id); err != nil {
+				log.Printf("webhooks: delete %d: %v", id, err)
+				data.Error = "Failed to delete webhook"
+			} else {
+				data.Success = "Webhook deleted"
+			}
+		case "test":
+			del, err := s.hooks.Test(id)
+			switch {
+			case err != nil:
+				data.Error = err.Error()
+			case del.Status == store.DeliveryDelivered:
+				data.Success = "Test delivery succeeded (HTTP " + strconv.FormatInt(del.ResponseCode.Int64, 10) + ")"
+			default:
+				data.Error = "Test delivery failed: " + del.LastError
+			}
+		default:
+			data.Error = "Unknown action"
+		}
+	}
+
+	hooks, err := s.store.ListWebhooks()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Hooks = hooks
+	if data.Deliveries, err = s.store.ListWebhookDeliveries(data.Filter, deliveryLogSize); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.tplWebhooks.ExecuteTemplate(w, "layout", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// planUpdated emits a plan.updated webhook event for userID's plan.
+func (s *Server) planUpdated(userID int64, action string, workoutID, blockID int64, date string) {
+	s.hooks.Emit(webhook.EventPlanUpdated, webhook.PlanData{Action: action, UserID: userID, WorkoutID: workoutID, BlockID: blockID, Date: date})
+}
@@ -0,0 +1,168 @@
+package web
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"garmr/internal/store"
+)
+
+// wellnessVM is the wellness section of the statistics page: averages and
+// daily trends of the all-day data for the selected month or year.
+type wellnessVM struct {
+	Label string
+	Days  int // days with any data
+
+	RestingHR  sql.NullFloat64
+	Steps      sql.NullFloat64
+	SleepS     sql.NullFloat64
+	SleepScore sql.NullFloat64
+	HRV        sql.NullFloat64
+	HRVStatus  string // of the last day with one
+	Stress     sql.NullFloat64
+	Intensity  int64 // intensity minutes in the period
+
+	VO2Max        sql.NullFloat64 // latest up to the end of the period
+	VO2MaxCycling sql.NullFloat64
+
+	Chart wellnessChart
+
+	// weight and body composition measured in the period
+	Weights      int
+	WeightKg     sql.NullFloat64 // the last measurement
+	WeightChange sql.NullFloat64 // from the first to the last
+	FatPct       sql.NullFloat64
+	WeightChart  weightChart
+}
+
+// wellnessChart holds one value per day for Chart.js; nil is a gap.
+type wellnessChart struct {
+	Labels    []string `json:"labels"`
+	RestingHR []any    `json:"resting_hr"`
+	Steps     []any    `json:"steps"`
+	DeepH     []any    `json:"deep_h"`
+	LightH    []any    `json:"light_h"`
+	RemH      []any    `json:"rem_h"`
+	HRV       []any    `json:"hrv"`
+	HRVWeekly []any    `json:"hrv_weekly"`
+}
+
+// loadWellness summarises the user's wellness days in [from, to).
+func (s *Server) loadWellness(userID int64, from, to time.Time, label string) (wellnessVM, error) {
+	last := to.AddDate(0, 0, -1).Format("2006-01-02")
+	days, err := s.store.ListWellness(userID, from.Format("2006-01-02"), last)
+	if err != nil {
+		return wellnessVM{}, err
+	}
+	vm := wellnessVM{Label: label, Days: len(days)}
+	vm.VO2Max, vm.VO2MaxCycling, err = s.store.LatestVO2Max(userID, last)
+	if err != nil {
+		return vm, err
+	}
+
+	var rhr, steps, sleep, score, hrv, stress mean
+	byDay := map[string]store.WellnessDay{}
+	for _, d := range days {
+		byDay[d.Day] = d
+		if d.RestingHR.Valid {
+			rhr.add(float64(d.RestingHR.Int64))
+		}
+		if d.Steps.Valid {
+			steps.add(float64(d.Steps.Int64))
+		}
+		if d.SleepEnd.Valid {
+			sleep.add(float64(d.SleepS()))
+		}
+		if d.SleepScore.Valid {
+			score.add(float64(d.SleepScore.Int64))
+		}
+		if d.HRVLastNight.Valid {
+			hrv.add(d.HRVLastNight.Float64)
+		}
+		if d.HRVStatus != "" {
+			vm.HRVStatus = d.HRVStatus
+		}
+		if d.StressAvg.Valid {
+			stress.add(d.StressAvg.Float64)
+		}
+		vm.Intensity += d.IntensityMinutes()
+	}
+	ws, err := s.store.ListWeights(userID, from, to)
+	if err != nil {
+		return vm, err
+	}
+	vm.Weights, vm.WeightChart = len(ws), newWeightChart(ws)
+	if n := len(ws); n > 0 {
+		vm.WeightKg = sql.NullFloat64{Float64: ws[n-1].WeightKg, Valid: true}
+		vm.FatPct = ws[n-1].FatPct
+		if n > 1 {
+			vm.WeightChange = sql.NullFloat64{Float64: ws[n-1].WeightKg - ws[0].WeightKg, Valid: true}
+		}
+	}
+
+	vm.RestingHR, vm.Steps, vm.SleepS = rhr.value(), steps.value(), sleep.value()
+	vm.SleepScore, vm.HRV, vm.Stress = score.value(), hrv.value(), stress.value()
+
+	// every day of the period, so gaps show as gaps
+	now := time.Now()
+	for day := from; day.Before(to) && !day.After(now); day = day.AddDate(0, 0, 1) {
+		k := day.Format("2006-01-02")
+		c := &vm.Chart
+		c.Labels = append(c.Labels, k)
+		d, ok := byDay[k]
+		if !ok {
+			c.RestingHR = append(c.RestingHR, nil)
+			c.Steps = append(c.Steps, nil)
+			c.DeepH = append(c.DeepH, nil)
+			c.LightH = append(c.LightH, nil)
+			c.RemH = append(c.RemH, nil)
+			c.HRV = append(c.HRV, nil)
+			c.HRVWeekly = append(c.HRVWeekly, nil)
+			continue
+		}
+		c.RestingHR = append(c.RestingHR, nullInt(d.RestingHR))
+		c.Steps = append(c.Steps, nullInt(d.Steps))
+		c.DeepH = append(c.DeepH, hours(d.SleepDeepS))
+		c.LightH = append(c.LightH, hours(d.SleepLightS))
+		c.RemH = append(c.RemH, hours(d.SleepRemS))
+		c.HRV = append(c.HRV, nullFloat(d.HRVLastNight))
+		c.HRVWeekly = append(c.HRVWeekly, nullFloat(d.HRVWeekly))
+	}
+	return vm, nil
+}
+
+type mean struct {
+	sum float64
+	n   int
+}
+
+func (m *mean) add(v float64) { m.sum += v; m.n++ }
+
+func (m mean) value() sql.NullFloat64 {
+	if m.n == 0 {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: m.sum / float64(m.n), Valid: true}
+}
+
+func nullInt(v sql.NullInt64) any {
+	if !v.Valid {
+		return nil
+	}
+	return v.Int64
+}
+
+func nullFloat(v sql.NullFloat64) any {
+	if !v.Valid {
+		return nil
+	}
+	return v.Float64
+}
+
+func hours(v sql.NullInt64) any {
+	if !v.Valid {
+		return nil
+	}
+	return math.Round(float64(v.Int64)/3600*100) / 100
+}
@@ -0,0 +1,186 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"garmr/internal/store"
+)
+
+const csrfCookieName = "garmr_csrf"
+
+// Failed sign-ins allowed within loginWindow before further attempts are
+// refused until the oldest failure ages out.
+const (
+	loginWindow        = 15 * time.Minute
+	maxFailuresPerUser = 5
+	maxFailuresPerIP   = 20
+)
+
+// contentSecurityPolicy allows the inline scripts and styles of the
+// templates, the CDN scripts (Leaflet, Chart.js) and OpenStreetMap tiles.
+const contentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' https://unpkg.com https://cdn.jsdelivr.net; " +
+	"style-src 'self' 'unsafe-inline' https://unpkg.com; " +
+	"img-src 'self' data: https://*.tile.openstreetmap.org https://unpkg.com; " +
+	"connect-src 'self'; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", contentSecurityPolicy)
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "same-origin")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfFor derives the CSRF token that goes with a session (or, before
+// sign-in, a garmr_csrf cookie) value.
+func csrfFor(cookieValue string) string {
+	sum := sha256.Sum256([]byte("csrf:" + cookieValue))
+	return hex.EncodeToString(sum[:])
+}
+
+// expectedCSRF is the token a request must carry: bound to the session when
+// signed in, to the garmr_csrf cookie otherwise.
+func (s *Server) expectedCSRF(r *http.Request) string {
+	if u := s.currentUser(r); u != nil {
+		return u.CSRFToken
+	}
+	if c, err := r.Cookie(csrfCookieName); err == nil && c.Value != "" {
+		return csrfFor(c.Value)
+	}
+	return ""
+}
+
+// anonCSRF returns the token for forms shown before sign-in (login,
+// invite), setting the garmr_csrf cookie if the browser has none yet.
+func (s *Server) anonCSRF(w http.ResponseWriter, r *http.Request) string {
+	if token := s.expectedCSRF(r); token != "" {
+		return token
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("csrf: generate cookie: %v", err)
+		return ""
+	}
+	value := hex.EncodeToString(buf)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   s.secure(r),
+	})
+	return csrfFor(value)
+}
+
+// checkCSRF rejects state-changing requests that don't echo the CSRF token
+// in the csrf_token form field or the X-CSRF-Token header. JSON API
+// requests with an API token carry no cookies and are not checked.
+func (s *Server) checkCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if safeMethod(r) || apiToken(r) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		want := s.expectedCSRF(r)
+		got := r.Header.Get("X-CSRF-Token")
+		if got == "" {
+			got = r.PostFormValue("csrf_token")
+		}
+		if want == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			log.Printf("csrf: rejected %s %s from %s", r.Method, r.URL.Path, s.clientIP(r))
+			http.Error(w, "forbidden: missing or invalid CSRF token, reload the page and try again", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// secure reports whether the browser reached garmr over HTTPS: directly, or
+// through a trusted proxy that says so in X-Forwarded-Proto.
+func (s *Server) secure(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	if r.TLS != nil {
+		return true
+	}
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https") && s.trustedProxy(r)
+}
+
+// RedirectToHTTPS answers plain HTTP requests with a redirect to the same
+// URL on the HTTPS listener at httpsAddr.
+func RedirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if port != "" && port != "443" {
+			host += ":" + port
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// clientIP is the address the request came from. Behind trusted proxies it
+// is the rightmost X-Forwarded-For entry that isn't one of them.
+func (s *Server) clientIP(r *http.Request) string {
+	addr := remoteAddr(r)
+	if !s.isProxy(addr) {
+		if addr.IsValid() {
+			return addr.String()
+		}
+		return r.RemoteAddr
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		a, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = a.Unmap()
+		if !s.isProxy(addr) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+// loginLocked reports whether sign-ins for username or from ip are refused
+// because of too many recent failures.
+func (s *Server) loginLocked(username, ip string) bool {
+	byUser, byIP, err := s.store.LoginFailures(username, ip, time.Now().Add(-loginWindow))
+	if err != nil {
+		log.Printf("login: count failures: %v", err)
+		return false
+	}
+	return byUser >= maxFailuresPerUser || byIP >= maxFailuresPerIP
+}
+
+func (s *Server) recordLogin(username, ip, outcome string) {
+	if err := s.store.RecordLoginAttempt(username, ip, outcome); err != nil {
+		log.Printf("login: record attempt: %v", err)
+	}
+	if outcome != store.LoginOK {
+		log.Printf("login: %s sign-in for %q from %s", outcome, username, ip)
+	}
+}
@@ -9,13 +9,16 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"strings"
 	"time"
 
 	"garmr/internal/cfg"
 	"garmr/internal/importer"
+	"garmr/internal/oidc"
 	"garmr/internal/store"
+	"garmr/internal/webhook"
 )
 
 //go:embed views/*.tmpl
@@ -31,10 +34,46 @@ type ctxKey string
 
 var userCtxKey ctxKey = "user"
 
+// scopeCtxKey holds the API token scope when a request authenticated with
+// an Authorization: Bearer token instead of a session cookie.
+var scopeCtxKey ctxKey = "token_scope"
+
 type userView struct {
 	ID       int64
 	Username string
 	Theme    string
+	Role     string
+
+	// CSRFToken must be echoed by state-changing requests; empty for
+	// API token requests, which need none.
+	CSRFToken string
+
+	// Viewing is the athlete whose data the pages show: the user themselves
+	// or someone who shared with them (picked with the athlete switcher).
+	Viewing  *athleteView
+	Athletes []store.Grant // grants the user can switch to
+}
+
+func newUserView(u *store.AuthUser) *userView {
+	uv := &userView{ID: u.ID, Username: u.Username, Theme: u.Theme, Role: u.Role}
+	uv.Viewing = &athleteView{ID: u.ID, Username: u.Username, Self: true}
+	return uv
+}
+
+// CanEdit reports whether the user may import, change or delete data.
+func (u *userView) CanEdit() bool { return u != nil && store.RoleAtLeast(u.Role, store.RoleAthlete) }
+
+func (u *userView) IsAdmin() bool { return u != nil && u.Role == store.RoleAdmin }
+
+// CanEditActivities reports whether the user may delete or import
+// activities for the athlete being viewed; only owners can.
+func (u *userView) CanEditActivities() bool {
+	return u.CanEdit() && u.Viewing != nil && u.Viewing.Self
+}
+
+// CanEditPlans reports whether the user may change the viewed athlete's plan.
+func (u *userView) CanEditPlans() bool {
+	return u.CanEdit() && u.Viewing != nil && (u.Viewing.Self || u.Viewing.Grant.EditPlans)
 }
 
 type Server struct {
@@ -43,21 +82,35 @@ type Server struct {
 	store  *store.DB
 	mux    *http.ServeMux
 	im     *importer.Importer
+	hooks  *webhook.Dispatcher
 	cookie string
 
+	proxies []netip.Prefix // trusted_proxies
+	oidc    *oidc.Client   // nil unless oidc_issuer is set
+
 	// separate template sets (each has layout + that page's content)
-	tplDash           *template.Template
-	tplList           *template.Template
-	tplDetail         *template.Template
-	tplStats          *template.Template
-	tplImport         *template.Template
-	tplLogin          *template.Template
-	tplAccountDetails *template.Template
-	tplAccountPass    *template.Template
-	tplCalendar       *template.Template
+	tplDash            *template.Template
+	tplList            *template.Template
+	tplDetail          *template.Template
+	tplStats           *template.Template
+	tplImport          *template.Template
+	tplLogin           *template.Template
+	tplAccountDetails  *template.Template
+	tplAccountPass     *template.Template
+	tplAccountTokens   *template.Template
+	tplCalendar        *template.Template
+	tplWebhooks        *template.Template
+	tplAdminUsers      *template.Template
+	tplInvite          *template.Template
+	tplAccountSharing  *template.Template
+	tplAccountPrivacy  *template.Template
+	tplAccount2FA      *template.Template
+	tplAccountSessions *template.Template
+	tplDevices         *template.Template
+	tplBody            *template.Template
 }
 
-func New(c cfg.Config, db *store.DB, im *importer.Importer) *http.Server {
+func New(c cfg.Config, db *store.DB, im *importer.Importer, hooks *webhook.Dispatcher) *http.Server {
 	mux := http.NewServeMux()
 	s := &Server{
 		cfg:    c,
@@ -65,8 +118,22 @@ func New(c cfg.Config, db *store.DB, im *importer.Importer) *http.Server {
 		store:  db,
 		mux:    mux,
 		im:     im,
+		hooks:  hooks,
 		cookie: sessionCookieName,
 	}
+	for _, p := range c.TrustedProxies {
+		if prefix, err := cfg.ParseProxy(p); err == nil {
+			s.proxies = append(s.proxies, prefix)
+		}
+	}
+	if c.OIDCIssuer != "" {
+		s.oidc = oidc.New(oidc.Config{
+			Issuer:       c.OIDCIssuer,
+			ClientID:     c.OIDCClientID,
+			ClientSecret: c.OIDCClientSecret,
+			Scopes:       c.OIDCScopes,
+		})
+	}
 
 	// helpers used by templates
 	themeValue := func(u *userView) string {
@@ -106,6 +173,8 @@ func New(c cfg.Config, db *store.DB, im *importer.Importer) *http.Server {
 			return toFloat(a) / bb
 		},
 		"mul": func(a any, b any) float64 { return toFloat(a) * toFloat(b) },
+		"inc": func(i int) int { return i + 1 },
+		"int": func(f float64) int { return int(f + 0.5) },
 
 		// Time formatting (if you ever pass time.Time to tmpl)
 		"fmtTime": func(t time.Time) string { return t.In(loc).Format("2006-01-02 15:04") },
@@ -147,6 +216,14 @@ func New(c cfg.Config, db *store.DB, im *importer.Importer) *http.Server {
 			sec := int(p) % 60
 			return fmt.Sprintf("%d:%02d /km", min, sec)
 		},
+		// swim pace, from seconds per 100 m
+		"fmtPace100": func(secPer100 float64) string {
+			if secPer100 <= 0 {
+				return "-"
+			}
+			s := int(secPer100 + 0.5)
+			return fmt.Sprintf("%d:%02d /100m", s/60, s%60)
+		},
 
 		"sportClass": func(s string) string {
 			ls := strings.ToLower(strings.TrimSpace(s))
@@ -167,6 +244,7 @@ func New(c cfg.Config, db *store.DB, im *importer.Importer) *http.Server {
 		},
 
 		"themeValue": themeValue,
+		"deviceType": store.TypeLabel,
 	}
 
 	// Parse base layout, then clone per page to avoid "content" conflicts
@@ -179,7 +257,17 @@ func New(c cfg.Config, db *store.DB, im *importer.Importer) *http.Server {
 	s.tplLogin = template.Must(template.Must(base.Clone()).ParseFS(tplFS, "views/login.tmpl"))
 	s.tplAccountDetails = template.Must(template.Must(base.Clone()).ParseFS(tplFS, "views/account_details.tmpl"))
 	s.tplAccountPass = template.Must(template.Must(base.Clone()).ParseFS(tplFS, "views/account_password.tmpl"))
+	s.tplAccountTokens = template.Must(template.Must(base.Clone()).ParseFS(tplFS, "views/account_tokens.tmpl"))
 	s.tplCalendar = template.Must(template.Must(base.Clone()).ParseFS(tplFS, "views/calendar.tmpl"))
+	s.tplWebhooks = template.Must(template.Must(base.Clone()).ParseFS(tplFS, "views/webhooks.tmpl"))
+	s.tplAdminUsers = template.Must(template.Must(base.Clone()).ParseFS(tplFS, "views/admin_users.tmpl"))
+	s.tplInvite = template.Must(template.Must(base.Clone()).ParseFS(tplFS, "views/invite.tmpl"))
+	s.tplAccountSharing = template.Must(template.Must(base.Clone()).ParseFS(tplFS, "views/account_sharing.tmpl"))
+	s.tplAccountPrivacy = template.Must(template.Must(base.Clone()).ParseFS(tplFS, "views/account_privacy.tmpl"))
+	s.tplAccount2FA = template.Must(template.Must(base.Clone()).ParseFS(tplFS, "views/account_2fa.tmpl"))
+	s.tplAccountSessions = template.Must(template.Must(base.Clone()).ParseFS(tplFS, "views/account_sessions.tmpl"))
+	s.tplDevices = template.Must(template.Must(base.Clone()).ParseFS(tplFS, "views/devices.tmpl"))
+	s.tplBody = template.Must(template.Must(base.Clone()).ParseFS(tplFS, "views/body.tmpl"))
 
 	// routes
 	mux.Handle("/static/", http.FileServer(http.FS(staticFS)))
@@ -192,48 +280,95 @@ func New(c cfg.Config, db *store.DB, im *importer.Importer) *http.Server {
 		w.Header().Set("Content-Type", "image/svg+xml")
 		_, _ = w.Write(data)
 	})
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/metrics", s.handleMetrics)
 	mux.Handle("/login", http.HandlerFunc(s.handleLogin))
+	mux.Handle("/login/2fa", http.HandlerFunc(s.handleLoginTwoFactor))
+	mux.Handle("/login/oidc", http.HandlerFunc(s.handleLoginOIDC))
+	mux.Handle("/login/oidc/callback", http.HandlerFunc(s.handleLoginOIDCCallback))
 	mux.Handle("/logout", s.requireAuth(http.HandlerFunc(s.handleLogout)))
 	mux.Handle("/account", s.requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/account/details", http.StatusSeeOther)
 	})))
 	mux.Handle("/account/details", s.requireAuth(http.HandlerFunc(s.handleAccountDetails)))
 	mux.Handle("/account/password", s.requireAuth(http.HandlerFunc(s.handleAccountPassword)))
+	mux.Handle("/account/2fa", s.requireAuth(http.HandlerFunc(s.handleAccountTwoFactor)))
+	mux.Handle("/account/sessions", s.requireAuth(http.HandlerFunc(s.handleAccountSessions)))
+	mux.Handle("/account/tokens", s.requireAuth(http.HandlerFunc(s.handleAccountTokens)))
+	mux.Handle("/account/sharing", s.requireAuth(http.HandlerFunc(s.handleAccountSharing)))
+	mux.Handle("/account/privacy", s.requireAuth(http.HandlerFunc(s.handleAccountPrivacy)))
+	mux.Handle("/athlete", s.requireAuth(http.HandlerFunc(s.handleSwitchAthlete))) // POST
+	mux.Handle("/webhooks", s.requireRole(store.RoleAdmin, http.HandlerFunc(s.handleWebhooks)))
+	mux.Handle("/admin/users", s.requireRole(store.RoleAdmin, http.HandlerFunc(s.handleAdminUsers)))
+	mux.Handle("/invite", http.HandlerFunc(s.handleInvite))
+
+	activities := (*athleteView).CanViewActivities
+	stats := (*athleteView).CanViewStats
+	mux.Handle("/", s.requireShared(activities, http.HandlerFunc(s.handleDashboard)))
+	mux.Handle("/activities", s.requireShared(activities, http.HandlerFunc(s.handleActivities)))
+	mux.Handle("/activity/delete", s.requireRole(store.RoleAthlete, http.HandlerFunc(s.handleActivityDelete)))
+	mux.Handle("/activity/download", s.requireShared(activities, http.HandlerFunc(s.handleActivityDownload)))
+	mux.Handle("/activity/gpx", s.requireShared(activities, http.HandlerFunc(s.handleActivityGPX)))
+	mux.Handle("/activity/", s.requireShared(activities, http.HandlerFunc(s.handleActivityDetail)))
+	mux.Handle("/api/activity/", s.requireShared(activities, http.HandlerFunc(s.handleActivityGeoJSON)))
+	mux.Handle("/api/import", s.requireRole(store.RoleAthlete, http.HandlerFunc(s.handleImportNow))) // POST
+	mux.Handle("/api/logs", s.requireRole(store.RoleAthlete, http.HandlerFunc(s.handleLogsSSE)))     // GET (SSE)
+	mux.Handle("/api/series/", s.requireShared(activities, http.HandlerFunc(s.handleActivitySeries)))
+	mux.Handle("/api/zones/", s.requireShared(activities, http.HandlerFunc(s.handleActivityZones)))
+	mux.Handle("/devices", s.requireShared(activities, http.HandlerFunc(s.handleDevices)))
+	mux.Handle("/stats", s.requireShared(stats, http.HandlerFunc(s.handleStatsPage)))
+	mux.Handle("/body", s.requireShared(stats, http.HandlerFunc(s.handleBody)))
+	mux.Handle("/api/stats", s.requireShared(stats, http.HandlerFunc(s.handleStatsData)))
+	mux.Handle("/api/stats/periods", s.requireShared(stats, http.HandlerFunc(s.handleStatsPeriods)))
+	mux.Handle("/calendar", s.requireShared((*athleteView).CanViewPlans, http.HandlerFunc(s.handleCalendar)))
+	mux.Handle("/calendar/plan", s.requirePlanEditor(http.HandlerFunc(s.handleCalendarPlan)))
+	mux.Handle("/calendar/plan/edit", s.requirePlanEditor(http.HandlerFunc(s.handleCalendarPlanUpdate)))
+	mux.Handle("/calendar/plan/delete", s.requirePlanEditor(http.HandlerFunc(s.handleCalendarPlanDelete)))
+	mux.Handle("/calendar/plan/move", s.requirePlanEditor(http.HandlerFunc(s.handleCalendarPlanMove)))
+	mux.Handle("/calendar/plan/template", s.requirePlanEditor(http.HandlerFunc(s.handleCalendarPlanTemplate)))
+	mux.Handle("/calendar/block/shift", s.requirePlanEditor(http.HandlerFunc(s.handleCalendarBlockShift)))
+	mux.Handle("/calendar/block/delete", s.requirePlanEditor(http.HandlerFunc(s.handleCalendarBlockDelete)))
+	mux.Handle("/calendar/plan/ics", s.requirePlanEditor(http.HandlerFunc(s.handleCalendarPlanICS)))
+	mux.Handle("/calendar.ics", http.HandlerFunc(s.handleCalendarFeed)) // token auth
+	mux.Handle("/s/", http.HandlerFunc(s.handleShare))                  // share link token auth
+	mux.Handle("/import", s.requireRole(store.RoleAthlete, http.HandlerFunc(s.handleImportPage)))
+	mux.Handle("/api/upload", s.requireRole(store.RoleAthlete, http.HandlerFunc(s.handleFileUpload))) // POST
+	mux.Handle("/api/v1/", s.requireAuth(s.requireEditorForWrites(s.apiV1())))
 
-	mux.Handle("/", s.requireAuth(http.HandlerFunc(s.handleDashboard)))
-	mux.Handle("/activities", s.requireAuth(http.HandlerFunc(s.handleActivities)))
-	mux.Handle("/activity/delete", s.requireAuth(http.HandlerFunc(s.handleActivityDelete)))
-	mux.Handle("/activity/download", s.requireAuth(http.HandlerFunc(s.handleActivityDownload)))
-	mux.Handle("/activity/", s.requireAuth(http.HandlerFunc(s.handleActivityDetail)))
-	mux.Handle("/api/activity/", s.requireAuth(http.HandlerFunc(s.handleActivityGeoJSON)))
-	mux.Handle("/api/import", s.requireAuth(http.HandlerFunc(s.handleImportNow))) // POST
-	mux.Handle("/api/logs", s.requireAuth(http.HandlerFunc(s.handleLogsSSE)))     // GET (SSE)
-	mux.Handle("/api/series/", s.requireAuth(http.HandlerFunc(s.handleActivitySeries)))
-	mux.Handle("/api/zones/", s.requireAuth(http.HandlerFunc(s.handleActivityZones)))
-	mux.Handle("/stats", s.requireAuth(http.HandlerFunc(s.handleStatsPage)))
-	mux.Handle("/api/stats", s.requireAuth(http.HandlerFunc(s.handleStatsData)))
-	mux.Handle("/api/stats/periods", s.requireAuth(http.HandlerFunc(s.handleStatsPeriods)))
-	mux.Handle("/calendar", s.requireAuth(http.HandlerFunc(s.handleCalendar)))
-	mux.Handle("/calendar/plan", s.requireAuth(http.HandlerFunc(s.handleCalendarPlan)))
-	mux.Handle("/calendar/plan/edit", s.requireAuth(http.HandlerFunc(s.handleCalendarPlanUpdate)))
-	mux.Handle("/calendar/plan/delete", s.requireAuth(http.HandlerFunc(s.handleCalendarPlanDelete)))
-	mux.Handle("/calendar/plan/move", s.requireAuth(http.HandlerFunc(s.handleCalendarPlanMove)))
-	mux.Handle("/import", s.requireAuth(http.HandlerFunc(s.handleImportPage)))
-	mux.Handle("/api/upload", s.requireAuth(http.HandlerFunc(s.handleFileUpload))) // POST
-
-	return &http.Server{Addr: c.HTTPAddr, Handler: s.withSession(mux)}
+	return &http.Server{Addr: c.HTTPAddr, Handler: securityHeaders(s.withSession(s.checkCSRF(s.instrument(mux))))}
 }
 
 func (s *Server) withSession(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
+		if token := apiToken(r); token != "" {
+			// token-authenticated requests never fall back to the cookie
+			if t, err := s.store.LookupAPIToken(token); err == nil {
+				if user, err := s.store.GetUserByID(t.UserID); err == nil && !user.Disabled {
+					ctx = context.WithValue(ctx, userCtxKey, newUserView(user))
+					ctx = context.WithValue(ctx, scopeCtxKey, t.Scope)
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		if uv := s.proxyUser(w, r); uv != nil {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, userCtxKey, uv)))
+			return
+		}
 		cookie, err := r.Cookie(s.cookie)
 		if err == nil && cookie.Value != "" {
 			session, serr := s.store.GetSession(cookie.Value)
 			if serr == nil {
 				user, uerr := s.store.GetUserByID(session.UserID)
+				if uerr == nil && user.Disabled {
+					uerr = errors.New("account disabled")
+				}
 				if uerr == nil {
-					ctx = context.WithValue(ctx, userCtxKey, &userView{ID: user.ID, Username: user.Username, Theme: user.Theme})
+					uv := s.withAthlete(r, newUserView(user))
+					uv.CSRFToken = csrfFor(cookie.Value)
+					ctx = context.WithValue(ctx, userCtxKey, uv)
 				} else {
 					_ = s.store.DeleteSession(cookie.Value)
 					log.Printf("auth: clearing cookie, user lookup failed: %v", uerr)
@@ -252,8 +387,24 @@ func (s *Server) withSession(next http.Handler) http.Handler {
 
 func (s *Server) requireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiToken(r) != "" {
+			if s.currentUser(r) == nil {
+				writeAPIError(w, http.StatusUnauthorized, "unauthorized", "invalid or revoked API token")
+				return
+			}
+			if !tokenAllows(r) {
+				writeAPIError(w, http.StatusForbidden, "forbidden", "token scope does not allow "+r.Method)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
 		user, req := s.ensureUserFromCookie(w, r)
 		if user == nil {
+			if isAPIv1(r) {
+				writeAPIError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+				return
+			}
 			target := r.URL.RequestURI()
 			if target == "" {
 				target = "/"
@@ -265,6 +416,76 @@ func (s *Server) requireAuth(next http.Handler) http.Handler {
 	})
 }
 
+// requireRole is requireAuth plus a minimum role. Viewers and athletes get
+// 403 on endpoints reserved for higher roles.
+func (s *Server) requireRole(role string, next http.Handler) http.Handler {
+	return s.requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := s.currentUser(r); user == nil || !store.RoleAtLeast(user.Role, role) {
+			forbidden(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// requireEditorForWrites lets every signed-in user read but only athletes
+// and admins use the other methods.
+func (s *Server) requireEditorForWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !safeMethod(r) && !s.currentUser(r).CanEdit() {
+			forbidden(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func forbidden(w http.ResponseWriter, r *http.Request) {
+	if isAPIv1(r) {
+		writeAPIError(w, http.StatusForbidden, "forbidden", "your role does not allow this")
+		return
+	}
+	http.Error(w, "forbidden: your role does not allow this", http.StatusForbidden)
+}
+
+// isAPIv1 reports whether the request is for the versioned JSON API.
+func isAPIv1(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/v1/")
+}
+
+// apiToken returns the bearer token of a JSON API request. API tokens
+// don't sign in to the HTML pages, so it is empty for every other path.
+func apiToken(r *http.Request) string {
+	if !isAPIv1(r) {
+		return ""
+	}
+	return bearerToken(r)
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+// tokenAllows reports whether the request's token scope permits its method.
+// Read tokens are limited to safe methods.
+func tokenAllows(r *http.Request) bool {
+	scope, _ := r.Context().Value(scopeCtxKey).(string)
+	return safeMethod(r) || scope == store.ScopeWrite
+}
+
+func safeMethod(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
 func (s *Server) currentUser(r *http.Request) *userView {
 	if val, ok := r.Context().Value(userCtxKey).(*userView); ok {
 		return val
@@ -289,13 +510,17 @@ func (s *Server) ensureUserFromCookie(w http.ResponseWriter, r *http.Request) (*
 		return nil, r
 	}
 	user, err := s.store.GetUserByID(session.UserID)
+	if err == nil && user.Disabled {
+		err = errors.New("account disabled")
+	}
 	if err != nil {
 		_ = s.store.DeleteSession(cookie.Value)
 		log.Printf("auth: user lookup failed for session %s: %v", cookie.Value, err)
 		s.clearSessionCookie(w, r)
 		return nil, r
 	}
-	uv := &userView{ID: user.ID, Username: user.Username, Theme: user.Theme}
+	uv := s.withAthlete(r, newUserView(user))
+	uv.CSRFToken = csrfFor(cookie.Value)
 	ctx := context.WithValue(r.Context(), userCtxKey, uv)
 	return uv, r.WithContext(ctx)
 }
@@ -309,9 +534,7 @@ func (s *Server) setSessionCookie(w http.ResponseWriter, r *http.Request, value
 		MaxAge:   int(sessionDuration.Seconds()),
 		SameSite: http.SameSiteLaxMode,
 	}
-	if r != nil && r.TLS != nil {
-		c.Secure = true
-	}
+	c.Secure = s.secure(r)
 	http.SetCookie(w, c)
 	log.Printf("auth: set cookie for session %s", value)
 }
@@ -325,9 +548,7 @@ func (s *Server) clearSessionCookie(w http.ResponseWriter, r *http.Request) {
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
 	}
-	if r != nil && r.TLS != nil {
-		c.Secure = true
-	}
+	c.Secure = s.secure(r)
 	http.SetCookie(w, c)
 	log.Printf("auth: cleared session cookie")
 }
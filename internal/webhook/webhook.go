@@ -0,0 +1,270 @@
+// Package webhook delivers signed JSON notifications to user-configured
+// endpoints. Deliveries are queued in the database and retried with
+// backoff by Dispatcher.Run, so they survive restarts.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"garmr/internal/metrics"
+	"garmr/internal/store"
+)
+
+const (
+	EventActivityCreated = "activity.created"
+	EventActivityDeleted = "activity.deleted"
+	EventImportFailed    = "import.failed"
+	EventPlanUpdated     = "plan.updated"
+	EventPing            = "ping" // only sent by the test button
+)
+
+// Events lists the events a webhook can subscribe to.
+var Events = []string{EventActivityCreated, EventActivityDeleted, EventImportFailed, EventPlanUpdated}
+
+// backoff is the wait before each retry; a delivery is given up after
+// len(backoff)+1 attempts.
+var backoff = []time.Duration{
+	30 * time.Second,
+	2 * time.Minute,
+	10 * time.Minute,
+	1 * time.Hour,
+	6 * time.Hour,
+}
+
+const (
+	pollInterval = 5 * time.Second
+	keepLog      = 500
+)
+
+type Payload struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+type Dispatcher struct {
+	db     *store.DB
+	client *http.Client
+	wake   chan struct{}
+	mu     sync.Mutex // serialises delivery attempts
+}
+
+func New(db *store.DB) *Dispatcher {
+	return &Dispatcher{
+		db:     db,
+		client: &http.Client{Timeout: 10 * time.Second},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Sign computes the X-Garmr-Signature value for a request body:
+// hex HMAC-SHA256 over "<timestamp>.<body>" keyed with the webhook secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Emit queues event for every enabled webhook subscribed to it. It never
+// blocks on the network and is a no-op on a nil Dispatcher.
+func (d *Dispatcher) Emit(event string, data any) {
+	if d == nil {
+		return
+	}
+	hooks, err := d.db.ListWebhooks()
+	if err != nil {
+		log.Printf("webhook: list hooks: %v", err)
+		return
+	}
+	var body []byte
+	queued := 0
+	for _, h := range hooks {
+		if !h.Enabled || !h.Subscribed(event) {
+			continue
+		}
+		if body == nil {
+			if body, err = json.Marshal(Payload{Event: event, CreatedAt: time.Now().UTC(), Data: data}); err != nil {
+				log.Printf("webhook: encode %s: %v", event, err)
+				return
+			}
+		}
+		if _, err := d.db.EnqueueWebhookDelivery(h.ID, event, string(body)); err != nil {
+			log.Printf("webhook: queue %s for hook %d: %v", event, h.ID, err)
+			continue
+		}
+		queued++
+	}
+	if queued > 0 {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Test sends a ping to one webhook right away and returns the logged
+// delivery. On a nil Dispatcher it returns an error.
+func (d *Dispatcher) Test(hookID int64) (*store.WebhookDelivery, error) {
+	if d == nil {
+		return nil, errors.New("webhooks are not enabled")
+	}
+	h, err := d.db.GetWebhook(hookID)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(Payload{
+		Event:     EventPing,
+		CreatedAt: time.Now().UTC(),
+		Data:      map[string]any{"webhook_id": h.ID, "message": "Test delivery from garmr"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	id, err := d.db.EnqueueWebhookDelivery(h.ID, EventPing, string(body))
+	if err != nil {
+		return nil, err
+	}
+	del, err := d.db.GetWebhookDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	d.attempt(*del)
+	d.mu.Unlock()
+	return d.db.GetWebhookDelivery(id)
+}
+
+// Run delivers queued payloads until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+	d.deliverDue()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-d.wake:
+		}
+		d.deliverDue()
+	}
+}
+
+func (d *Dispatcher) deliverDue() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	due, err := d.db.DueWebhookDeliveries(50)
+	if err != nil {
+		log.Printf("webhook: load due deliveries: %v", err)
+		return
+	}
+	for _, del := range due {
+		d.attempt(del)
+	}
+	if len(due) > 0 {
+		if err := d.db.PruneWebhookDeliveries(keepLog); err != nil {
+			log.Printf("webhook: prune log: %v", err)
+		}
+	}
+}
+
+func (d *Dispatcher) attempt(del store.WebhookDelivery) {
+	code, err := d.post(del)
+	delivered := err == nil
+	metrics.ObserveWebhook(delivered)
+	retry := 0
+	msg := ""
+	if !delivered {
+		msg = err.Error()
+		if del.Event != EventPing && del.Attempts < len(backoff) {
+			retry = int(backoff[del.Attempts].Seconds())
+		}
+		log.Printf("webhook: delivery %d (%s) to %s failed (attempt %d): %v", del.ID, del.Event, del.URL, del.Attempts+1, err)
+	}
+	if err := d.db.RecordWebhookAttempt(del.ID, code, msg, delivered, retry); err != nil {
+		log.Printf("webhook: record attempt %d: %v", del.ID, err)
+	}
+}
+
+func (d *Dispatcher) post(del store.WebhookDelivery) (int, error) {
+	body := []byte(del.Payload)
+	ts := time.Now().Unix()
+	req, err := http.NewRequest(http.MethodPost, del.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "garmr-webhook")
+	req.Header.Set("X-Garmr-Event", del.Event)
+	req.Header.Set("X-Garmr-Delivery", strconv.FormatInt(del.ID, 10))
+	req.Header.Set("X-Garmr-Timestamp", strconv.FormatInt(ts, 10))
+	req.Header.Set("X-Garmr-Signature", Sign(del.Secret, ts, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// ActivityData is the payload of activity.created and activity.deleted.
+type ActivityData struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Sport     string    `json:"sport,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	DistanceM int       `json:"distance_m,omitempty"`
+	DurationS int       `json:"duration_s,omitempty"`
+	Source    string    `json:"source,omitempty"` // scan, upload, api, web
+	File      string    `json:"file,omitempty"`
+}
+
+func NewActivityData(a *store.Activity, source, file string) ActivityData {
+	return ActivityData{
+		ID:        a.ID,
+		UserID:    a.UserID,
+		Sport:     a.Sport,
+		StartTime: a.StartTimeUTC,
+		DistanceM: a.DistanceM,
+		DurationS: a.DurationS,
+		Source:    source,
+		File:      file,
+	}
+}
+
+// ImportFailedData is the payload of import.failed.
+type ImportFailedData struct {
+	File   string `json:"file"`
+	Source string `json:"source"`
+	Error  string `json:"error"`
+}
+
+// PlanData is the payload of plan.updated. Action is one of created,
+// updated, moved, deleted, imported or shifted; IDs name the affected
+// planned workout or plan block of the user.
+type PlanData struct {
+	Action    string `json:"action"`
+	UserID    int64  `json:"user_id"`
+	WorkoutID int64  `json:"workout_id,omitempty"`
+	BlockID   int64  `json:"block_id,omitempty"`
+	Date      string `json:"date,omitempty"`
+}
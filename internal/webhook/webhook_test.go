@@ -0,0 +1,174 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"garmr/internal/store"
+)
+
+// receiver is a local endpoint that answers with the next of its status
+// codes (the last one repeats) and keeps the requests it got.
+type receiver struct {
+	srv *httptest.Server
+
+	mu     sync.Mutex
+	codes  []int
+	got    []*http.Request
+	bodies [][]byte
+}
+
+func newReceiver(t *testing.T, codes ...int) *receiver {
+	rc := &receiver{codes: codes}
+	rc.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		code := rc.codes[min(len(rc.got), len(rc.codes)-1)]
+		rc.got, rc.bodies = append(rc.got, r), append(rc.bodies, body)
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(rc.srv.Close)
+	return rc
+}
+
+func testDispatcher(t *testing.T) (*Dispatcher, *store.DB) {
+	t.Helper()
+	db, err := store.Open(filepath.Join(t.TempDir(), "garmr.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := store.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return New(db), db
+}
+
+func TestDeliverySigned(t *testing.T) {
+	d, db := testDispatcher(t)
+	rc := newReceiver(t, http.StatusNoContent)
+	hookID, err := db.CreateWebhook(rc.srv.URL, []string{EventActivityCreated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook, err := db.GetWebhook(hookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Emit(EventActivityCreated, ActivityData{ID: 7, UserID: 2, Sport: "running"})
+	d.Emit(EventActivityDeleted, ActivityData{ID: 7}) // not subscribed
+	d.deliverDue()
+
+	if len(rc.got) != 1 {
+		t.Fatalf("got %d requests, want 1", len(rc.got))
+	}
+	r, body := rc.got[0], rc.bodies[0]
+	if got := r.Header.Get("X-Garmr-Event"); got != EventActivityCreated {
+		t.Errorf("X-Garmr-Event = %q", got)
+	}
+	ts, err := strconv.ParseInt(r.Header.Get("X-Garmr-Timestamp"), 10, 64)
+	if err != nil || time.Since(time.Unix(ts, 0)).Abs() > time.Minute {
+		t.Errorf("X-Garmr-Timestamp = %q", r.Header.Get("X-Garmr-Timestamp"))
+	}
+	if got, want := r.Header.Get("X-Garmr-Signature"), Sign(hook.Secret, ts, body); got != want {
+		t.Errorf("X-Garmr-Signature = %q, want %q", got, want)
+	}
+	if Sign("other secret", ts, body) == r.Header.Get("X-Garmr-Signature") {
+		t.Error("signature doesn't depend on the secret")
+	}
+	var p struct {
+		Event string       `json:"event"`
+		Data  ActivityData `json:"data"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil || p.Event != EventActivityCreated || p.Data.ID != 7 || p.Data.UserID != 2 {
+		t.Errorf("payload %s (%v)", body, err)
+	}
+	dels, err := db.ListWebhookDeliveries(hookID, 10)
+	if err != nil || len(dels) != 1 || dels[0].Status != store.DeliveryDelivered {
+		t.Fatalf("deliveries = %+v, %v", dels, err)
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	d, db := testDispatcher(t)
+	rc := newReceiver(t, http.StatusInternalServerError)
+	hookID, err := db.CreateWebhook(rc.srv.URL, Events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Emit(EventImportFailed, ImportFailedData{File: "a.fit", Source: "scan", Error: "bad"})
+
+	for attempt := 0; attempt <= len(backoff); attempt++ {
+		d.deliverDue()
+		dels, err := db.ListWebhookDeliveries(hookID, 10)
+		if err != nil || len(dels) != 1 {
+			t.Fatalf("deliveries = %+v, %v", dels, err)
+		}
+		del := dels[0]
+		if del.Attempts != attempt+1 || !del.ResponseCode.Valid || del.ResponseCode.Int64 != 500 {
+			t.Fatalf("attempt %d: %+v", attempt, del)
+		}
+		if attempt == len(backoff) {
+			if del.Status != store.DeliveryFailed {
+				t.Fatalf("after %d attempts status = %q, want failed", del.Attempts, del.Status)
+			}
+			break
+		}
+		next, err := time.Parse(time.DateTime, del.NextAttemptAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait := time.Until(next); del.Status != store.DeliveryPending || (wait-backoff[attempt]).Abs() > 5*time.Second {
+			t.Fatalf("attempt %d: status %q, next attempt in %v, want %v", attempt, del.Status, wait, backoff[attempt])
+		}
+		// not due yet
+		d.deliverDue()
+		if len(rc.got) != attempt+1 {
+			t.Fatalf("retried before the backoff: %d requests", len(rc.got))
+		}
+		if _, err := db.Exec(`UPDATE webhook_deliveries SET next_attempt_at = datetime('now', '-1 second')`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(rc.got) != len(backoff)+1 {
+		t.Fatalf("got %d requests, want %d", len(rc.got), len(backoff)+1)
+	}
+}
+
+func TestPing(t *testing.T) {
+	d, db := testDispatcher(t)
+	rc := newReceiver(t, http.StatusOK)
+	hookID, err := db.CreateWebhook(rc.srv.URL, []string{EventPlanUpdated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	del, err := d.Test(hookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if del.Status != store.DeliveryDelivered || del.Event != EventPing {
+		t.Fatalf("delivery = %+v", del)
+	}
+	if len(rc.got) != 1 || rc.got[0].Header.Get("X-Garmr-Event") != EventPing {
+		t.Fatalf("got %d requests", len(rc.got))
+	}
+
+	// a failed ping isn't retried
+	rc.codes = []int{http.StatusNotFound}
+	del, err = d.Test(hookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if del.Status != store.DeliveryFailed {
+		t.Fatalf("failed ping status = %q, want failed", del.Status)
+	}
+}